@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"time"
@@ -39,6 +40,13 @@ func main() {
 	fmt.Printf("Build commit: %s\n", buildCommit)
 
 	cfg := config.NewConfig()
+	// Run schema migrations instead of the server if requested.
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		if err := migrate(cfg, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	repo := storage.New(cfg)
 	shortener := service.NewShortenerImpl(repo, cfg)
 	r := router.NewRouter(shortener, cfg)
@@ -48,6 +56,6 @@ func main() {
 		grpcS := grpc.NewGRPCServer(shortener, cfg)
 		go grpcS.Run(context.Background())
 	}
-	go s.WaitForExitingSignal(15*time.Second, repo)
+	go s.WaitForExitingSignal(15*time.Second, shortener, repo)
 	s.Run()
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Mldlr/url-shortener/internal/app/config"
+	"github.com/Mldlr/url-shortener/internal/app/storage"
+)
+
+// migrateUsage describes the migrate subcommand.
+const migrateUsage = "usage: shortener [flags] migrate up|down [steps]|status"
+
+// migrate runs a schema migration command of Postgres storage: up, down [steps] or status.
+func migrate(cfg *config.Config, args []string) error {
+	if cfg.PostgresURL == "" {
+		return errors.New("migrations require postgres storage, set DATABASE_DSN or -d")
+	}
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	repo, err := storage.NewPostgresRepo(cfg.PostgresURL)
+	if err != nil {
+		return fmt.Errorf("error initiating postgres connection : %v", err)
+	}
+	defer repo.Close()
+	m, err := repo.Migrator()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, v := range applied {
+			fmt.Printf("applied %d_%s\n", v.Version, v.Name)
+		}
+		return err
+	case "down":
+		// Roll back the last migration by default.
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				return errors.New(migrateUsage)
+			}
+		}
+		rolledBack, err := m.Down(ctx, steps)
+		for _, v := range rolledBack {
+			fmt.Printf("rolled back %d_%s\n", v.Version, v.Name)
+		}
+		return err
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, v := range statuses {
+			state := "pending"
+			if v.AppliedAt != nil {
+				state = "applied " + v.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", v.Version, v.Name, state)
+		}
+		return nil
+	}
+	return errors.New(migrateUsage)
+}
@@ -0,0 +1,111 @@
+// Package analytics provides recording of short url usage.
+package analytics
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/storage"
+)
+
+// maxBatch is the number of clicks that triggers a write before the flush interval.
+const maxBatch = 200
+
+// Recorder buffers clicks and writes them to repository in batches.
+type Recorder struct {
+	// repo stores recorded clicks.
+	repo storage.Repository
+	// clicks is the buffer of clicks waiting to be written.
+	clicks chan *models.Click
+	// interval is the maximal time a click stays in buffer.
+	interval time.Duration
+	// dropped counts clicks lost due to the full buffer.
+	dropped uint64
+	// quit stops the recorder.
+	quit chan struct{}
+	// done is closed when remaining clicks are written after stop.
+	done chan struct{}
+	// once guards closing of quit.
+	once sync.Once
+}
+
+// NewRecorder creates a Recorder with the given buffer size and flush interval and starts it.
+func NewRecorder(repo storage.Repository, buffer int, interval time.Duration) *Recorder {
+	r := &Recorder{
+		repo:     repo,
+		clicks:   make(chan *models.Click, buffer),
+		interval: interval,
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Record queues a click without blocking, the click is dropped if buffer is full.
+func (r *Recorder) Record(click *models.Click) {
+	select {
+	case r.clicks <- click:
+	default:
+		atomic.AddUint64(&r.dropped, 1)
+	}
+}
+
+// Dropped returns the number of clicks lost due to the full buffer.
+func (r *Recorder) Dropped() uint64 {
+	return atomic.LoadUint64(&r.dropped)
+}
+
+// Close writes buffered clicks and stops the recorder.
+func (r *Recorder) Close() error {
+	r.once.Do(func() {
+		close(r.quit)
+	})
+	<-r.done
+	return nil
+}
+
+// run collects clicks to batches and writes them on interval or when batch is full.
+func (r *Recorder) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	batch := make([]*models.Click, 0, maxBatch)
+	for {
+		select {
+		case c := <-r.clicks:
+			batch = append(batch, c)
+			if len(batch) >= maxBatch {
+				batch = r.flush(batch)
+			}
+		case <-ticker.C:
+			batch = r.flush(batch)
+		case <-r.quit:
+			// Write clicks left in buffer.
+			for {
+				select {
+				case c := <-r.clicks:
+					batch = append(batch, c)
+				default:
+					r.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush writes batch to repository and returns an empty batch.
+func (r *Recorder) flush(batch []*models.Click) []*models.Click {
+	if len(batch) == 0 {
+		return batch
+	}
+	if err := r.repo.AddClicks(context.Background(), batch); err != nil {
+		log.Printf("error writing %v clicks : %v", len(batch), err)
+	}
+	return make([]*models.Click, 0, maxBatch)
+}
@@ -0,0 +1,28 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/storage"
+)
+
+func TestRecorder(t *testing.T) {
+	repo := storage.NewInMemRepo()
+	recorder := NewRecorder(repo, 2, time.Hour)
+	now := time.Date(2023, 1, 1, 10, 30, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		recorder.Record(&models.Click{ShortURL: "1", Time: now})
+	}
+	// Close writes buffered clicks regardless of the flush interval.
+	require.NoError(t, recorder.Close())
+	stats, err := repo.GetClickStats(context.Background(), "1", models.BucketHour)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Total)
+	assert.Equal(t, []models.ClickBucket{{Start: now.Truncate(time.Hour), Count: 2}}, stats.Buckets)
+}
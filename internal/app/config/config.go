@@ -17,6 +17,7 @@ type Config struct {
 	ServerAddress string `envconfig:"SERVER_ADDRESS" default:"localhost:8080" json:"server_address"`
 	BaseURL       string `envconfig:"BASE_URL" default:"http://localhost:8080" json:"base_url"`
 	FileStorage   string `envconfig:"FILE_STORAGE_PATH" default:"" json:"file_storage_path"`
+	BoltStorage   string `envconfig:"BOLT_STORAGE_PATH" default:"" json:"bolt_storage_path"`
 	SecretKey     []byte `envconfig:"URL_SHORTENER_KEY" default:"defaultKeyUrlSHoRtenEr" json:"secret_key"`
 	PostgresURL   string `envconfig:"DATABASE_DSN" default:"" json:"database_dsn"`
 	EnableHTTPS   bool   `envconfig:"ENABLE_HTTPS" default:"false" json:"enable_https"`
@@ -25,6 +26,75 @@ type Config struct {
 	TrustedSubnet string `envconfig:"TRUSTED_SUBNET" default:"" json:"trusted_subnet"`
 	SubnetPrefix  netip.Prefix
 	GRPCAddress   string `envconfig:"GRPC_ADDRESS" default:"" json:"grpc_address"`
+	IDStrategy    string `envconfig:"ID_STRATEGY" default:"hash" json:"id_strategy"`
+	IDLength      int    `envconfig:"ID_LENGTH" default:"8" json:"id_length"`
+	IDSalt        string `envconfig:"ID_SALT" default:"" json:"id_salt"`
+	IDRetries     int    `envconfig:"ID_RETRIES" default:"5" json:"id_retries"`
+	ReapInterval  int    `envconfig:"REAP_INTERVAL" default:"60" json:"reap_interval"`
+	ClickBuffer   int    `envconfig:"CLICK_BUFFER" default:"1024" json:"click_buffer"`
+	ClickFlush    int    `envconfig:"CLICK_FLUSH_INTERVAL" default:"5" json:"click_flush_interval"`
+	// FileSyncInterval is the interval in milliseconds between syncs of the file storage log, 0 syncs every write.
+	FileSyncInterval int `envconfig:"FILE_SYNC_INTERVAL" default:"0" json:"file_sync_interval"`
+	// FileCompactInterval is the interval in minutes between compactions of the file storage log.
+	FileCompactInterval int `envconfig:"FILE_COMPACT_INTERVAL" default:"10" json:"file_compact_interval"`
+	// DeletedRetention is the number of hours deleted urls are kept for restore.
+	DeletedRetention int `envconfig:"DELETED_RETENTION" default:"0" json:"deleted_retention"`
+	// CacheSize is the number of redirects cached in front of the storage, 0 disables caching.
+	CacheSize int `envconfig:"CACHE_SIZE" default:"0" json:"cache_size"`
+	// CacheTTL is the number of seconds a redirect stays cached.
+	CacheTTL int `envconfig:"CACHE_TTL" default:"60" json:"cache_ttl"`
+	// PasswordAttempts is the number of wrong passwords accepted for a protected url per PasswordWindow.
+	PasswordAttempts int `envconfig:"PASSWORD_ATTEMPTS" default:"5" json:"password_attempts"`
+	// PasswordWindow is the number of minutes wrong passwords of a protected url are counted for.
+	PasswordWindow int `envconfig:"PASSWORD_WINDOW" default:"15" json:"password_window"`
+	// GeoHeader is the request header holding the country code matched by redirect rules.
+	GeoHeader string `envconfig:"GEO_HEADER" default:"X-Country" json:"geo_header"`
+	// RedirectCode is the status code of redirects of urls without their own: 301, 302, 307 or 308.
+	RedirectCode int `envconfig:"REDIRECT_CODE" default:"307" json:"redirect_code"`
+	// QRCacheSize is the number of generated QR codes kept in memory.
+	QRCacheSize int `envconfig:"QR_CACHE_SIZE" default:"256" json:"qr_cache_size"`
+	// DisableNormalize stores shortened urls as they were sent instead of their canonical form,
+	// so they keep matching links stored before normalization was added.
+	DisableNormalize bool `envconfig:"DISABLE_NORMALIZE" default:"false" json:"disable_normalize"`
+	// NormalizeSortQuery orders query parameters of shortened urls by name.
+	NormalizeSortQuery bool `envconfig:"NORMALIZE_SORT_QUERY" default:"false" json:"normalize_sort_query"`
+	// StripParams lists query parameters removed from shortened urls, names ending with "*" match by prefix.
+	StripParams []string `envconfig:"STRIP_PARAMS" default:"" json:"strip_params"`
+	// AllowedSchemes lists schemes of urls that can be shortened.
+	AllowedSchemes []string `envconfig:"ALLOWED_SCHEMES" default:"http,https" json:"allowed_schemes"`
+	// BlockPrivate rejects urls pointing to loopback, private and link-local addresses.
+	BlockPrivate bool `envconfig:"BLOCK_PRIVATE" default:"true" json:"block_private"`
+	// BlocklistFile is the path to the file of domains that can't be shortened, one per line.
+	BlocklistFile string `envconfig:"BLOCKLIST_FILE" default:"" json:"blocklist_file"`
+	// BlocklistReload is the interval in seconds between checks of the blocklist file for changes.
+	BlocklistReload int `envconfig:"BLOCKLIST_RELOAD" default:"30" json:"blocklist_reload"`
+	// TrustedProxies lists CIDRs of proxies whose X-Real-IP header is taken as the client ip, by default it is never taken.
+	// They are separate from the trusted subnet, which is allowed to call internal endpoints.
+	TrustedProxies []string `envconfig:"TRUSTED_PROXIES" default:"" json:"trusted_proxies"`
+	// ProxyPrefixes are the parsed TrustedProxies.
+	ProxyPrefixes []netip.Prefix
+	// RateLimitCreate is the number of urls a user or an ip can shorten per minute, 0 disables the limit.
+	RateLimitCreate int `envconfig:"RATE_LIMIT_CREATE" default:"0" json:"rate_limit_create"`
+	// RateLimitRedirect is the number of short urls a user or an ip can follow per minute, 0 disables the limit.
+	RateLimitRedirect int `envconfig:"RATE_LIMIT_REDIRECT" default:"0" json:"rate_limit_redirect"`
+	// RateLimitDelete is the number of delete requests a user or an ip can make per minute, 0 disables the limit.
+	RateLimitDelete int `envconfig:"RATE_LIMIT_DELETE" default:"0" json:"rate_limit_delete"`
+	// RateLimitInternal is the number of internal requests an ip can make per minute, 0 disables the limit.
+	RateLimitInternal int `envconfig:"RATE_LIMIT_INTERNAL" default:"0" json:"rate_limit_internal"`
+	// QuotaDaily is the number of urls a user can create per day unless they have a quota of their own, 0 is unlimited.
+	QuotaDaily int `envconfig:"QUOTA_DAILY" json:"quota_daily"`
+	// QuotaTotal is the number of urls a user can keep unless they have a quota of their own, 0 is unlimited.
+	QuotaTotal int `envconfig:"QUOTA_TOTAL" json:"quota_total"`
+	// WebhookMaxAttempts is the number of attempts to deliver an event to a webhook before giving up.
+	WebhookMaxAttempts int `envconfig:"WEBHOOK_MAX_ATTEMPTS" default:"8" json:"webhook_max_attempts"`
+	// WebhookBackoff is the number of seconds before the first retry of a delivery, doubled for every next one.
+	WebhookBackoff int `envconfig:"WEBHOOK_BACKOFF" default:"10" json:"webhook_backoff"`
+	// WebhookTimeout is the number of seconds a webhook has to respond to a delivery.
+	WebhookTimeout int `envconfig:"WEBHOOK_TIMEOUT" default:"10" json:"webhook_timeout"`
+	// EventQueue is the number of domain events queued for every subscriber of the event bus.
+	EventQueue int `envconfig:"EVENT_QUEUE" default:"1024" json:"event_queue"`
+	// EventPolicy is what publishers do when the queue of a subscriber is full: "drop" the event or "block" until it is taken.
+	EventPolicy string `envconfig:"EVENT_POLICY" default:"drop" json:"event_policy"`
 }
 
 // NewConfig initializes and returns a new Config struct. It reads
@@ -38,6 +108,7 @@ func NewConfig() *Config {
 	flag.StringVar(&c.ServerAddress, "a", c.ServerAddress, "server address")
 	flag.StringVar(&c.BaseURL, "b", c.BaseURL, "base url address")
 	flag.StringVar(&c.FileStorage, "f", c.FileStorage, "storage path")
+	flag.StringVar(&c.BoltStorage, "e", c.BoltStorage, "embedded bolt storage path")
 	flag.StringVar(&c.PostgresURL, "d", c.PostgresURL, "postgres url")
 	flag.BoolVar(&c.EnableHTTPS, "s", c.EnableHTTPS, "enable https")
 	flag.StringVar(&c.CertFile, "l", c.CertFile, "tls cert file path")
@@ -45,6 +116,7 @@ func NewConfig() *Config {
 	flag.StringVar(&configFile, "c", configFile, "path to config file")
 	flag.StringVar(&c.TrustedSubnet, "t", c.TrustedSubnet, "trusted subnet CIDR")
 	flag.StringVar(&c.GRPCAddress, "g", c.GRPCAddress, "grpc listening port")
+	flag.StringVar(&c.IDStrategy, "i", c.IDStrategy, "short id strategy: hash, random or sequence")
 	key := flag.String("k", "", "key")
 	flag.Parse()
 
@@ -70,6 +142,16 @@ func NewConfig() *Config {
 			log.Fatalf("invalid trusted network: %v", err)
 		}
 	}
+	for _, v := range c.TrustedProxies {
+		if v == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			log.Fatalf("invalid trusted proxy network: %v", err)
+		}
+		c.ProxyPrefixes = append(c.ProxyPrefixes, prefix)
+	}
 	if *key != "" {
 		c.SecretKey = []byte(*key)
 	}
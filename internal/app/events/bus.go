@@ -0,0 +1,197 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// Policy decides what Publish does when the queue of a subscriber is full.
+type Policy int
+
+const (
+	// Drop drops the event for the subscriber, so publishers never wait.
+	Drop Policy = iota
+	// Block makes the publisher wait until the subscriber takes the event.
+	Block
+)
+
+// ParsePolicy returns the policy named "drop" or "block".
+func ParsePolicy(name string) (Policy, error) {
+	switch name {
+	case "drop":
+		return Drop, nil
+	case "block":
+		return Block, nil
+	}
+	return Drop, fmt.Errorf("unknown event policy %q", name)
+}
+
+// Handler handles events of a subscriber one at a time, in the order they were published.
+// With the Block policy handlers must not publish, they could wait for their own queue.
+type Handler func(Event)
+
+// Bus delivers published events to subscribers, each of them takes events from its own bounded queue.
+type Bus struct {
+	// queue is the capacity of queues of subscribers.
+	queue int
+	// policy applies to full queues.
+	policy Policy
+	// subs are the current subscribers.
+	subs []*Subscription
+	// closed is set when the bus stops accepting events.
+	closed bool
+	// RWMutex guards subs and closed, publishers hold it for reading.
+	sync.RWMutex
+}
+
+// NewBus creates a Bus with queues of the given capacity and the policy of full queues.
+func NewBus(queue int, policy Policy) *Bus {
+	return &Bus{queue: queue, policy: policy}
+}
+
+// Subscription is a subscriber of a Bus.
+type Subscription struct {
+	// name identifies the subscriber in logs.
+	name string
+	// names are the names of received events, all events if empty.
+	names map[string]bool
+	// handler handles events.
+	handler Handler
+	// events is the queue of the subscriber.
+	events chan Event
+	// dropped counts events lost due to the full queue.
+	dropped uint64
+	// done is closed when the queue is drained after unsubscribing.
+	done chan struct{}
+	// once guards closing of events.
+	once sync.Once
+}
+
+// Subscribe starts a subscriber named name handling events with the given names, all events if none are given.
+func (b *Bus) Subscribe(name string, handler Handler, names ...string) *Subscription {
+	s := &Subscription{
+		name:    name,
+		handler: handler,
+		events:  make(chan Event, b.queue),
+		done:    make(chan struct{}),
+	}
+	if len(names) > 0 {
+		s.names = make(map[string]bool)
+		for _, v := range names {
+			s.names[v] = true
+		}
+	}
+	b.Lock()
+	defer b.Unlock()
+	if b.closed {
+		s.once.Do(func() {
+			close(s.events)
+		})
+		close(s.done)
+		return s
+	}
+	b.subs = append(b.subs, s)
+	go s.run()
+	return s
+}
+
+// Subscribed checks if any subscriber receives events with the given name,
+// so publishers can skip preparing events nobody receives.
+func (b *Bus) Subscribed(name string) bool {
+	b.RLock()
+	defer b.RUnlock()
+	for _, v := range b.subs {
+		if v.receives(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish queues event for every subscriber receiving it, applying the policy to full queues.
+// Events published after Close are dropped.
+func (b *Bus) Publish(event Event) {
+	b.RLock()
+	defer b.RUnlock()
+	if b.closed {
+		return
+	}
+	for _, v := range b.subs {
+		if !v.receives(event.Name()) {
+			continue
+		}
+		if b.policy == Block {
+			v.events <- event
+			continue
+		}
+		select {
+		case v.events <- event:
+		default:
+			atomic.AddUint64(&v.dropped, 1)
+		}
+	}
+}
+
+// Unsubscribe stops delivery of events to s, events already queued are handled before it returns.
+func (b *Bus) Unsubscribe(s *Subscription) {
+	b.Lock()
+	for i, v := range b.subs {
+		if v == s {
+			b.subs = append(b.subs[:i:i], b.subs[i+1:]...)
+			break
+		}
+	}
+	b.Unlock()
+	s.stop()
+}
+
+// Close stops accepting events and waits until subscribers handle the queued ones.
+func (b *Bus) Close() error {
+	b.Lock()
+	b.closed = true
+	subs := b.subs
+	b.subs = nil
+	b.Unlock()
+	for _, v := range subs {
+		v.stop()
+	}
+	return nil
+}
+
+// Dropped returns the number of events lost due to the full queue.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// receives checks if the subscriber receives events with the given name.
+func (s *Subscription) receives(name string) bool {
+	return len(s.names) == 0 || s.names[name]
+}
+
+// stop closes the queue and waits until it is drained.
+func (s *Subscription) stop() {
+	s.once.Do(func() {
+		close(s.events)
+	})
+	<-s.done
+}
+
+// run handles queued events until the queue is closed.
+func (s *Subscription) run() {
+	defer close(s.done)
+	for event := range s.events {
+		s.handle(event)
+	}
+}
+
+// handle handles an event, so a failing subscriber doesn't stop the others.
+func (s *Subscription) handle(event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("event subscriber %s panicked on %s : %v", s.name, event.Name(), r)
+		}
+	}()
+	s.handler(event)
+}
@@ -0,0 +1,102 @@
+package events
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus(10, Drop)
+	var mu sync.Mutex
+	var all, created []string
+	bus.Subscribe("all", func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		all = append(all, e.Name())
+	})
+	bus.Subscribe("created", func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		created = append(created, e.(LinkCreated).URL.ShortURL)
+	}, NameLinkCreated)
+	bus.Subscribe("panics", func(e Event) { panic("failed") })
+	assert.True(t, bus.Subscribed(NameLinkClicked))
+
+	bus.Publish(LinkCreated{URL: &models.URL{ShortURL: "a"}})
+	bus.Publish(LinkClicked{URL: &models.URL{ShortURL: "a"}})
+	bus.Publish(LinkCreated{URL: &models.URL{ShortURL: "b"}})
+	// Close waits until queued events are handled.
+	require.NoError(t, bus.Close())
+	assert.Equal(t, []string{NameLinkCreated, NameLinkClicked, NameLinkCreated}, all)
+	assert.Equal(t, []string{"a", "b"}, created)
+
+	// Events published after close are dropped.
+	bus.Publish(LinkCreated{URL: &models.URL{ShortURL: "c"}})
+	assert.Len(t, all, 3)
+	assert.False(t, bus.Subscribed(NameLinkCreated))
+}
+
+func TestBus_Drop(t *testing.T) {
+	bus := NewBus(1, Drop)
+	release := make(chan struct{})
+	handled := make(chan string, 10)
+	sub := bus.Subscribe("slow", func(e Event) {
+		<-release
+		handled <- e.(LinkCreated).URL.ShortURL
+	})
+	bus.Publish(LinkCreated{URL: &models.URL{ShortURL: "a"}})
+	// The first event is taken by the handler, so the next one fills the queue.
+	require.Eventually(t, func() bool { return len(sub.events) == 0 }, time.Second, time.Millisecond)
+	bus.Publish(LinkCreated{URL: &models.URL{ShortURL: "b"}})
+	bus.Publish(LinkCreated{URL: &models.URL{ShortURL: "c"}})
+	assert.Equal(t, uint64(1), sub.Dropped())
+	close(release)
+	bus.Unsubscribe(sub)
+	close(handled)
+	var got []string
+	for v := range handled {
+		got = append(got, v)
+	}
+	assert.Equal(t, []string{"a", "b"}, got)
+}
+
+func TestBus_Block(t *testing.T) {
+	bus := NewBus(1, Block)
+	release := make(chan struct{})
+	sub := bus.Subscribe("slow", func(e Event) { <-release })
+	bus.Publish(LinkCreated{URL: &models.URL{}})
+	require.Eventually(t, func() bool { return len(sub.events) == 0 }, time.Second, time.Millisecond)
+	bus.Publish(LinkCreated{URL: &models.URL{}})
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(LinkCreated{URL: &models.URL{}})
+		close(published)
+	}()
+	// The publisher waits for room in the full queue.
+	select {
+	case <-published:
+		t.Fatal("publish didn't wait for the full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-published
+	require.NoError(t, bus.Close())
+	assert.Zero(t, sub.Dropped())
+}
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("block")
+	require.NoError(t, err)
+	assert.Equal(t, Block, p)
+	p, err = ParsePolicy("drop")
+	require.NoError(t, err)
+	assert.Equal(t, Drop, p)
+	_, err = ParsePolicy("wait")
+	assert.Error(t, err)
+}
@@ -0,0 +1,76 @@
+// Package events provides the in-process bus of domain events published by the service layer.
+package events
+
+import (
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// Names of events.
+const (
+	NameLinkCreated  = models.EventLinkCreated
+	NameLinkDeleted  = models.EventLinkDeleted
+	NameLinkClicked  = models.EventLinkClicked
+	NameBatchDeleted = "batch.deleted"
+)
+
+// Event is a domain event, subscribers switch on its concrete type.
+type Event interface {
+	// Name returns the name of the event subscribers filter by.
+	Name() string
+}
+
+// LinkCreated is published when a url is shortened, duplicates of stored urls are not published.
+type LinkCreated struct {
+	// URL is the created url.
+	URL *models.URL
+	// Time is the moment of creation.
+	Time time.Time
+}
+
+// Name returns NameLinkCreated.
+func (LinkCreated) Name() string { return NameLinkCreated }
+
+// LinkDeleted is published for every url deleted by a batch delete.
+type LinkDeleted struct {
+	// URL is the deleted url.
+	URL *models.URL
+	// Time is the moment of deletion.
+	Time time.Time
+}
+
+// Name returns NameLinkDeleted.
+func (LinkDeleted) Name() string { return NameLinkDeleted }
+
+// LinkClicked is published when a short url is followed.
+type LinkClicked struct {
+	// URL is the followed url, its LongURL is the target of the visitor.
+	URL *models.URL
+	// Visitor is the visitor following the url, nil if unknown.
+	Visitor *models.Visitor
+	// Time is the moment of the click.
+	Time time.Time
+}
+
+// Name returns NameLinkClicked.
+func (LinkClicked) Name() string { return NameLinkClicked }
+
+// BatchDeleted is published when a batch delete requested by a user completes.
+type BatchDeleted struct {
+	// JobID is the ID of the delete job tracking the batch.
+	JobID string
+	// UserID is the ID of the user who requested the delete.
+	UserID string
+	// IDs are the requested short urls.
+	IDs []string
+	// Deleted is the number of deleted urls.
+	Deleted int
+	// Err is the reason the delete failed, nil if it succeeded.
+	Err error
+	// Time is the moment the delete completed.
+	Time time.Time
+}
+
+// Name returns NameBatchDeleted.
+func (BatchDeleted) Name() string { return NameBatchDeleted }
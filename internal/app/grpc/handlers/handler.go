@@ -3,10 +3,13 @@ package handler
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	pb "github.com/Mldlr/url-shortener/internal/app/grpc/proto"
 	"github.com/Mldlr/url-shortener/internal/app/models"
 	"github.com/Mldlr/url-shortener/internal/app/service"
+	"github.com/Mldlr/url-shortener/internal/app/utils/encoders"
 	"github.com/Mldlr/url-shortener/internal/app/utils/helpers"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -32,11 +35,28 @@ func (h *ShortenerHandler) Shorten(ctx context.Context, in *pb.ShortenURLRequest
 		return nil, status.Error(codes.Internal, "error getting user cookie")
 	}
 	var statusCode codes.Code
-	url, err := h.shortener.Shorten(ctx, &models.URL{LongURL: in.OriginalURL, UserID: userID})
+	url, err := h.shortener.Shorten(ctx, &models.URL{
+		LongURL:      in.OriginalURL,
+		UserID:       userID,
+		Alias:        in.Alias,
+		ExpiresAt:    fromUnix(in.ExpiresAt),
+		ExpireDays:   int(in.ExpireDays),
+		Password:     in.Password,
+		MaxClicks:    int(in.MaxClicks),
+		Variants:     fromPBVariants(in.Variants),
+		Sticky:       in.Sticky,
+		RedirectCode: int(in.RedirectCode),
+	})
 	if err != nil {
 		// If there is an error, and its not a duplicate url
-		if errors.Is(err, models.ErrInvalidURL) {
+		if errors.Is(err, models.ErrInvalidURL) || errors.Is(err, models.ErrInvalidAlias) || errors.Is(err, models.ErrInvalidExpiry) ||
+			errors.Is(err, models.ErrInvalidMaxClicks) || errors.Is(err, models.ErrInvalidVariants) ||
+			errors.Is(err, models.ErrInvalidRedirectCode) || errors.Is(err, models.ErrDestinationBlocked) {
 			return nil, status.Error(codes.InvalidArgument, err.Error())
+		} else if errors.Is(err, models.ErrQuotaExceeded) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		} else if errors.Is(err, models.ErrAliasTaken) || errors.Is(err, models.ErrAliasNotApplied) {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
 		} else if !errors.Is(err, models.ErrDuplicate) {
 			return nil, status.Error(codes.Internal, err.Error())
 		}
@@ -51,18 +71,81 @@ func (h *ShortenerHandler) Shorten(ctx context.Context, in *pb.ShortenURLRequest
 	return &resp, status.Error(statusCode, "")
 }
 
+// fromUnix converts optional unix seconds to time.
+func fromUnix(sec int64) *time.Time {
+	if sec == 0 {
+		return nil
+	}
+	t := time.Unix(sec, 0)
+	return &t
+}
+
+// toUnix converts time to unix seconds, zero time is converted to 0.
+func toUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// fromPBVariants converts variants of a split url from their protobuf messages.
+func fromPBVariants(variants []*pb.Variant) []*models.Variant {
+	if len(variants) == 0 {
+		return nil
+	}
+	res := make([]*models.Variant, len(variants))
+	for i, v := range variants {
+		res[i] = &models.Variant{Target: v.OriginalURL, Weight: int(v.Weight)}
+	}
+	return res
+}
+
 // Expand return original url for short.
 func (h *ShortenerHandler) Expand(ctx context.Context, in *pb.ExpandURLRequest) (*pb.ExpandURLResponse, error) {
+	return h.expand(ctx, in.ShortURL, "", int(in.Variant))
+}
+
+// ExpandWithPassword returns original url for short protected by a password.
+func (h *ShortenerHandler) ExpandWithPassword(ctx context.Context, in *pb.ExpandWithPasswordRequest) (*pb.ExpandURLResponse, error) {
+	return h.expand(ctx, in.ShortURL, in.Password, int(in.Variant))
+}
+
+// expand returns original url for short checking the password if it is protected and records the redirect.
+// The variant assigned to the client before is kept for sticky split urls.
+func (h *ShortenerHandler) expand(ctx context.Context, id string, password string, variant int) (*pb.ExpandURLResponse, error) {
 	var resp pb.ExpandURLResponse
-	url, err := h.shortener.Expand(ctx, in.ShortURL)
+	visitor := &models.Visitor{Header: helpers.MDHeader(ctx), Time: time.Now(), Variant: variant}
+	url, err := h.shortener.ExpandPassword(ctx, id, password, visitor)
 	if err != nil {
-		// If the URL has been deleted, return Gone status.
-		if !errors.Is(err, models.ErrURLDeleted) {
-			return nil, status.Error(codes.NotFound, err.Error())
+		switch {
+		case errors.Is(err, models.ErrURLBlocked):
+			// Clients get the reason of the block instead of the original url.
+			return nil, status.Error(codes.PermissionDenied, fmt.Sprintf("%s: %s", err.Error(), url.BlockReason))
+		case errors.Is(err, models.ErrPasswordRequired), errors.Is(err, models.ErrWrongPassword):
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		case errors.Is(err, models.ErrTooManyAttempts):
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		case errors.Is(err, models.ErrURLDeleted), errors.Is(err, models.ErrURLExpired), errors.Is(err, models.ErrURLExhausted):
+			// If the URL has been deleted, has expired or used all of its clicks, return Gone status.
+			return nil, status.Error(codes.Unavailable, err.Error())
 		}
-		return nil, status.Error(codes.Unavailable, err.Error())
+		return nil, status.Error(codes.NotFound, err.Error())
 	}
+	// Record the redirect.
+	referrer, _ := helpers.CheckMDValue(ctx, "referer")
+	userAgent, _ := helpers.CheckMDValue(ctx, "user-agent")
+	ip, _ := helpers.CheckMDValue(ctx, "X-Real-IP")
+	h.shortener.RecordClick(&models.Click{
+		ShortURL:  id,
+		Time:      time.Now(),
+		Referrer:  referrer,
+		UserAgent: userAgent,
+		IP:        ip,
+		Variant:   visitor.Variant,
+	})
 	resp.OriginalURL = url.LongURL
+	resp.Variant = int32(visitor.Variant)
+	resp.RedirectCode = int32(url.RedirectCode)
 	return &resp, nil
 }
 
@@ -86,8 +169,12 @@ func (h *ShortenerHandler) ShortenBatch(ctx context.Context, in *pb.BatchLinksRe
 	for i, v := range in.BatchLinkRequestItem {
 		// Create a new URL model and add it to the URLs map.
 		urls[i] = &models.URL{
-			LongURL: v.OriginalURL,
-			UserID:  userID,
+			LongURL:      v.OriginalURL,
+			UserID:       userID,
+			ExpiresAt:    fromUnix(v.ExpiresAt),
+			ExpireDays:   int(v.ExpireDays),
+			MaxClicks:    int(v.MaxClicks),
+			RedirectCode: int(v.RedirectCode),
 		}
 	}
 	var statusCode codes.Code
@@ -104,16 +191,84 @@ func (h *ShortenerHandler) ShortenBatch(ctx context.Context, in *pb.BatchLinksRe
 		statusCode = codes.OK
 	}
 	resp := &pb.BatchLinksResponse{BatchLinkResponseItem: make([]*pb.BatchResponseItem, len(in.BatchLinkRequestItem))}
+	var shortened, overQuota int
 	for i, v := range in.BatchLinkRequestItem {
-		// Create response item
-		resp.BatchLinkResponseItem[i] = &pb.BatchResponseItem{
-			CorrelationId: v.CorrelationId,
-			ShortURL:      shortenedURLs[i].ShortURL,
+		// Create response item, with the error instead of the short url if it was not shortened
+		resp.BatchLinkResponseItem[i] = &pb.BatchResponseItem{CorrelationId: v.CorrelationId}
+		if itemErr := shortenedURLs[i].Err; itemErr != nil {
+			resp.BatchLinkResponseItem[i].Error = itemErr.Error()
+			if errors.Is(itemErr, models.ErrQuotaExceeded) {
+				overQuota++
+			}
+			continue
 		}
+		resp.BatchLinkResponseItem[i].ShortURL = shortenedURLs[i].ShortURL
+		shortened++
+	}
+	// If no url was shortened because the quota of the user is used up
+	if shortened == 0 && overQuota > 0 {
+		return resp, status.Error(codes.ResourceExhausted, models.ErrQuotaExceeded.Error())
+	}
+	// If all of the urls or their options are invalid
+	if shortened == 0 && len(resp.BatchLinkResponseItem) > 0 {
+		return resp, status.Error(codes.InvalidArgument, resp.BatchLinkResponseItem[0].Error)
 	}
 	return resp, status.Error(statusCode, "")
 }
 
+// BlockURL blocks or unblocks a url of any user, so it can't be followed.
+func (h *ShortenerHandler) BlockURL(ctx context.Context, in *pb.BlockURLRequest) (*pb.BlockURLResponse, error) {
+	url, err := h.shortener.BlockURL(ctx, in.ShortURL, in.Blocked, in.Reason)
+	if err != nil {
+		if errors.Is(err, models.ErrURLNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.BlockURLResponse{Blocked: url.Blocked, Reason: url.BlockReason}, nil
+}
+
+// UserQuota returns how many urls the user created and how many they can still create.
+func (h *ShortenerHandler) UserQuota(ctx context.Context, in *pb.QuotaRequest) (*pb.QuotaResponse, error) {
+	userID, ok := helpers.CheckMDValue(ctx, "user_id")
+	if !ok {
+		return nil, status.Error(codes.Internal, "error getting user cookie")
+	}
+	usage, err := h.shortener.Quota(ctx, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return toPBQuota(usage), nil
+}
+
+// SetQuota replaces the configured quota of a user with their own.
+func (h *ShortenerHandler) SetQuota(ctx context.Context, in *pb.SetQuotaRequest) (*pb.QuotaResponse, error) {
+	usage, err := h.shortener.SetQuota(ctx, &models.Quota{UserID: in.UserID, Daily: int(in.Daily), Total: int(in.Total)})
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidQuota) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return toPBQuota(usage), nil
+}
+
+// toPBQuota converts usage of a quota to its response.
+func toPBQuota(usage *models.QuotaUsage) *pb.QuotaResponse {
+	counter := func(c models.QuotaCounter) *pb.QuotaCounter {
+		remaining := int32(-1)
+		if c.Remaining != nil {
+			remaining = int32(*c.Remaining)
+		}
+		return &pb.QuotaCounter{Limit: int32(c.Limit), Used: int32(c.Used), Remaining: remaining}
+	}
+	return &pb.QuotaResponse{
+		Daily:    counter(usage.Daily),
+		Total:    counter(usage.Total),
+		ResetsAt: usage.ResetsAt.Unix(),
+	}
+}
+
 // InternalStats returns the amount of registered users and stored urls
 func (h *ShortenerHandler) InternalStats(ctx context.Context, in *pb.StatsRequest) (*pb.StatsResponse, error) {
 	stats, err := h.shortener.Stats(ctx)
@@ -123,36 +278,202 @@ func (h *ShortenerHandler) InternalStats(ctx context.Context, in *pb.StatsReques
 	var resp pb.StatsResponse
 	resp.UrlCount = int32(stats.URLCount)
 	resp.UserCount = int32(stats.UserCount)
+	resp.CacheHits = stats.CacheHits
+	resp.CacheMisses = stats.CacheMisses
 	return &resp, nil
 }
 
-// APIUserExpand retrieves the list of shortened URLs
-// created by a user and returns them as a JSON array.
-func (h *ShortenerHandler) UserExpand(ctx context.Context, in *pb.UserURLRequest) (*pb.UserURLResponse, error) {
+// ExpandUser retrieves a page of shortened URLs created by a user.
+func (h *ShortenerHandler) ExpandUser(ctx context.Context, in *pb.UserURLRequest) (*pb.UserURLResponse, error) {
 	// Get the user ID from the request context.
 	userID, ok := helpers.CheckMDValue(ctx, "user_id")
 	if !ok {
 		return nil, status.Error(codes.Internal, "error getting user cookie")
 	}
+	query := &models.URLQuery{Limit: int(in.Limit), Desc: in.Desc, Search: in.Search}
+	if in.Cursor != "" {
+		cursor, err := encoders.DecodeCursor(in.Cursor)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, models.ErrInvalidQuery.Error())
+		}
+		query.After = cursor
+	}
+	if in.Deleted != pb.UserURLRequest_ALL {
+		deleted := in.Deleted == pb.UserURLRequest_DELETED
+		query.Deleted = &deleted
+	}
 	// Get the list of URLs created by user.
-	urls, err := h.shortener.ExpandUser(ctx, userID)
+	page, err := h.shortener.ExpandUser(ctx, userID, query)
 	if err != nil {
-		if !errors.Is(err, models.ErrNoContent) {
-			return nil, status.Error(codes.Internal, err.Error())
+		switch {
+		case errors.Is(err, models.ErrNoContent):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, models.ErrInvalidQuery):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
 		}
-		return nil, status.Error(codes.NotFound, err.Error())
+		return nil, status.Error(codes.Internal, err.Error())
 	}
-	resp := &pb.UserURLResponse{Urls: make([]*pb.UserLink, len(urls))}
+	resp := &pb.UserURLResponse{Urls: make([]*pb.UserLink, len(page.URLs)), NextCursor: page.NextCursor}
 	// Build the response
-	for i, v := range urls {
+	for i, v := range page.URLs {
 		resp.Urls[i] = &pb.UserLink{
 			ShortURL:    v.ShortURL,
 			OriginalURL: v.LongURL,
+			Deleted:     v.Deleted,
+			CreatedAt:   toUnix(v.CreatedAt),
 		}
 	}
 	return resp, nil
 }
 
+// UpdateURL changes the original URL of a shortened URL created by user.
+func (h *ShortenerHandler) UpdateURL(ctx context.Context, in *pb.UpdateURLRequest) (*pb.UpdateURLResponse, error) {
+	// Get the user ID from the request context.
+	userID, ok := helpers.CheckMDValue(ctx, "user_id")
+	if !ok {
+		return nil, status.Error(codes.Internal, "error getting user cookie")
+	}
+	url, err := h.shortener.UpdateURL(ctx, userID, in.ShortURL, in.OriginalURL)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidURL), errors.Is(err, models.ErrDestinationBlocked):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, models.ErrURLNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, models.ErrNotOwner):
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		case errors.Is(err, models.ErrURLDeleted):
+			return nil, status.Error(codes.Unavailable, err.Error())
+		case errors.Is(err, models.ErrDuplicate):
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.UpdateURLResponse{ShortURL: url.ShortURL, OriginalURL: url.LongURL}, nil
+}
+
+// URLHistory returns previous original URLs of a shortened URL created by user.
+func (h *ShortenerHandler) URLHistory(ctx context.Context, in *pb.URLHistoryRequest) (*pb.URLHistoryResponse, error) {
+	// Get the user ID from the request context.
+	userID, ok := helpers.CheckMDValue(ctx, "user_id")
+	if !ok {
+		return nil, status.Error(codes.Internal, "error getting user cookie")
+	}
+	history, err := h.shortener.URLHistory(ctx, userID, in.ShortURL)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrURLNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, models.ErrNotOwner):
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	resp := &pb.URLHistoryResponse{Versions: make([]*pb.URLVersion, len(history))}
+	for i, v := range history {
+		resp.Versions[i] = &pb.URLVersion{
+			Version:     int32(v.Version),
+			OriginalURL: v.LongURL,
+			ChangedAt:   toUnix(v.ChangedAt),
+		}
+	}
+	return resp, nil
+}
+
+// GetRules returns redirect rules of a shortened URL created by user.
+func (h *ShortenerHandler) GetRules(ctx context.Context, in *pb.GetRulesRequest) (*pb.RulesResponse, error) {
+	// Get the user ID from the request context.
+	userID, ok := helpers.CheckMDValue(ctx, "user_id")
+	if !ok {
+		return nil, status.Error(codes.Internal, "error getting user cookie")
+	}
+	rules, err := h.shortener.Rules(ctx, userID, in.ShortURL)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrURLNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, models.ErrNotOwner):
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.RulesResponse{Rules: toPBRules(rules)}, nil
+}
+
+// QRCode returns a QR code image of a short url.
+func (h *ShortenerHandler) QRCode(ctx context.Context, in *pb.QRCodeRequest) (*pb.QRCodeResponse, error) {
+	code, err := h.shortener.QRCode(ctx, in.ShortURL, models.QROptions{
+		Format: in.Format,
+		Size:   int(in.Size),
+		Level:  in.Ecc,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidQROptions):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, models.ErrURLDeleted), errors.Is(err, models.ErrURLExpired):
+			return nil, status.Error(codes.Unavailable, err.Error())
+		case errors.Is(err, models.ErrURLBlocked):
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		case errors.Is(err, models.ErrRepoError):
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.QRCodeResponse{Image: code.Image, ContentType: code.ContentType}, nil
+}
+
+// SetRules replaces redirect rules of a shortened URL created by user.
+func (h *ShortenerHandler) SetRules(ctx context.Context, in *pb.SetRulesRequest) (*pb.RulesResponse, error) {
+	// Get the user ID from the request context.
+	userID, ok := helpers.CheckMDValue(ctx, "user_id")
+	if !ok {
+		return nil, status.Error(codes.Internal, "error getting user cookie")
+	}
+	rules := make([]*models.RedirectRule, len(in.Rules))
+	for i, v := range in.Rules {
+		rules[i] = &models.RedirectRule{
+			Device:   v.Device,
+			Language: v.Language,
+			Country:  v.Country,
+			From:     v.From,
+			To:       v.To,
+			Target:   v.Target,
+		}
+	}
+	url, err := h.shortener.SetRules(ctx, userID, in.ShortURL, rules)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidRule), errors.Is(err, models.ErrDestinationBlocked):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, models.ErrURLNotFound):
+			return nil, status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, models.ErrNotOwner):
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		case errors.Is(err, models.ErrURLDeleted):
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.RulesResponse{Rules: toPBRules(url.Rules)}, nil
+}
+
+// toPBRules converts redirect rules to their protobuf messages.
+func toPBRules(rules []*models.RedirectRule) []*pb.RedirectRule {
+	res := make([]*pb.RedirectRule, len(rules))
+	for i, v := range rules {
+		res[i] = &pb.RedirectRule{
+			Device:   v.Device,
+			Language: v.Language,
+			Country:  v.Country,
+			From:     v.From,
+			To:       v.To,
+			Target:   v.Target,
+		}
+	}
+	return res
+}
+
 // APIDeleteBatch processes a batch request to delete multiple shortened URLs.
 func (h *ShortenerHandler) DeleteBatch(ctx context.Context, in *pb.DeleteURLRequest) (*pb.DeleteURLResponse, error) {
 	// Get the user ID from the request context.
@@ -163,7 +484,39 @@ func (h *ShortenerHandler) DeleteBatch(ctx context.Context, in *pb.DeleteURLRequ
 	if len(in.Urls) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "empty request")
 	}
-	go h.shortener.DeleteBatch(in.Urls, userID)
-	var resp pb.DeleteURLResponse
-	return &resp, nil
+	job, err := h.shortener.DeleteBatch(ctx, in.Urls, userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.DeleteURLResponse{JobID: job.ID}, nil
+}
+
+// GetJob returns the state of a delete job requested by user.
+func (h *ShortenerHandler) GetJob(ctx context.Context, in *pb.JobRequest) (*pb.JobResponse, error) {
+	userID, ok := helpers.CheckMDValue(ctx, "user_id")
+	if !ok {
+		return nil, status.Error(codes.Internal, "error getting user cookie")
+	}
+	job, err := h.shortener.Job(ctx, userID, in.JobID)
+	if err != nil {
+		if errors.Is(err, models.ErrJobNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	resp := &pb.JobResponse{
+		JobID:     job.ID,
+		Status:    job.Status,
+		Urls:      job.IDs,
+		Deleted:   int32(job.Deleted),
+		Error:     job.Error,
+		CreatedAt: job.CreatedAt.Unix(),
+	}
+	if job.FinishedAt != nil {
+		resp.FinishedAt = job.FinishedAt.Unix()
+	}
+	for _, v := range job.Failures {
+		resp.Failures = append(resp.Failures, &pb.JobFailure{ShortURL: v.ID, Error: v.Error})
+	}
+	return resp, nil
 }
@@ -2,14 +2,17 @@ package handler
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Mldlr/url-shortener/internal/app/config"
 	pb "github.com/Mldlr/url-shortener/internal/app/grpc/proto"
+	"github.com/Mldlr/url-shortener/internal/app/models"
 	"github.com/Mldlr/url-shortener/internal/app/service"
 	"github.com/Mldlr/url-shortener/internal/app/storage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
@@ -30,13 +33,13 @@ func TestShorten(t *testing.T) {
 			name:     "Post correct url",
 			url:      "https://github.com",
 			errCode:  codes.OK,
-			shortURL: "wCg6zOhmhh1",
+			shortURL: "vRveliyDLz8",
 		},
 		{
 			name:     "Post Duplicate url",
 			url:      "https://github.com",
 			errCode:  codes.AlreadyExists,
-			shortURL: "wCg6zOhmhh1",
+			shortURL: "vRveliyDLz8",
 		},
 		{
 			name:     "Post invalid url",
@@ -62,6 +65,65 @@ func TestShorten(t *testing.T) {
 	}
 }
 
+func TestShortenAlias(t *testing.T) {
+	repo := storage.NewMockRepo()
+	cfg := &config.Config{}
+	shortener := service.NewShortenerImpl(repo, cfg)
+	shortenerHandler := NewShortenerHandler(shortener)
+	tests := []struct {
+		name     string
+		url      string
+		alias    string
+		errCode  codes.Code
+		shortURL string
+	}{
+		{
+			name:     "Post url with alias",
+			url:      "https://github.com",
+			alias:    "q3-report",
+			errCode:  codes.OK,
+			shortURL: "q3-report",
+		},
+		{
+			name:     "Post url with taken alias",
+			url:      "https://gitlab.com",
+			alias:    "q3-report",
+			errCode:  codes.AlreadyExists,
+			shortURL: "",
+		},
+		{
+			name:     "Post shortened url with another alias",
+			url:      "https://github.com",
+			alias:    "q4-report",
+			errCode:  codes.AlreadyExists,
+			shortURL: "",
+		},
+		{
+			name:     "Post url with invalid alias",
+			url:      "https://gitlab.com",
+			alias:    "q3/report",
+			errCode:  codes.InvalidArgument,
+			shortURL: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := &pb.ShortenURLRequest{
+				OriginalURL: tt.url,
+				Alias:       tt.alias,
+			}
+			incCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user_id": "1324"}))
+			rsp, err := shortenerHandler.Shorten(incCtx, reg)
+			if tt.shortURL != "" {
+				assert.Equal(t, tt.shortURL, rsp.ShortURL)
+			}
+			if statusErr, ok := status.FromError(err); ok {
+				assert.Equal(t, tt.errCode.String(), statusErr.Code().String())
+			}
+		})
+	}
+}
+
 func TestExpand(t *testing.T) {
 	repo := storage.NewMockRepo()
 	cfg := &config.Config{}
@@ -240,7 +302,7 @@ func TestInternalStats(t *testing.T) {
 	}
 }
 
-func TestUserExpand(t *testing.T) {
+func TestExpandUser(t *testing.T) {
 	repo := storage.NewMockRepo()
 	cfg := &config.Config{}
 	shortener := service.NewShortenerImpl(repo, cfg)
@@ -277,7 +339,7 @@ func TestUserExpand(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			reg := &pb.UserURLRequest{}
 			incCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user_id": tt.userID}))
-			rsp, err := shortenerHandler.UserExpand(incCtx, reg)
+			rsp, err := shortenerHandler.ExpandUser(incCtx, reg)
 			if tt.response != nil {
 				assert.EqualValues(t, tt.response, rsp.Urls)
 			}
@@ -345,3 +407,272 @@ func TestDeleteBatch(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateURL(t *testing.T) {
+	repo := storage.NewMockRepo()
+	cfg := &config.Config{}
+	shortener := service.NewShortenerImpl(repo, cfg)
+	shortenerHandler := NewShortenerHandler(shortener)
+	tests := []struct {
+		name    string
+		userID  string
+		url     string
+		errCode codes.Code
+	}{
+		{
+			name:    "Update by owner",
+			userID:  "KS097f1lS&F",
+			url:     "https://yandex.com/",
+			errCode: codes.OK,
+		},
+		{
+			name:    "Update by another user",
+			userID:  "1324",
+			url:     "https://yandex.kz/",
+			errCode: codes.PermissionDenied,
+		},
+		{
+			name:    "Update to a shortened url",
+			userID:  "KS097f1lS&F",
+			url:     "https://github.com/Mldlr/url-shortener/internal/app/utils/encoders",
+			errCode: codes.AlreadyExists,
+		},
+		{
+			name:    "Update to invalid url",
+			userID:  "KS097f1lS&F",
+			url:     "",
+			errCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := &pb.UpdateURLRequest{ShortURL: "aQqomlSbUsE", OriginalURL: tt.url}
+			incCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user_id": tt.userID}))
+			_, err := shortenerHandler.UpdateURL(incCtx, reg)
+			statusErr, _ := status.FromError(err)
+			assert.Equal(t, tt.errCode.String(), statusErr.Code().String())
+		})
+	}
+	incCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user_id": "KS097f1lS&F"}))
+	rsp, err := shortenerHandler.URLHistory(incCtx, &pb.URLHistoryRequest{ShortURL: "aQqomlSbUsE"})
+	require.NoError(t, err)
+	require.Len(t, rsp.Versions, 1)
+	assert.Equal(t, "https://yandex.ru/", rsp.Versions[0].OriginalURL)
+}
+
+func TestExpandWithPassword(t *testing.T) {
+	repo := storage.NewInMemRepo()
+	cfg := &config.Config{PasswordAttempts: 2, PasswordWindow: 1}
+	shortener := service.NewShortenerImpl(repo, cfg)
+	shortenerHandler := NewShortenerHandler(shortener)
+	incCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user_id": "1324"}))
+	rsp, err := shortenerHandler.Shorten(incCtx, &pb.ShortenURLRequest{OriginalURL: "https://github.com", Password: "secret"})
+	require.NoError(t, err)
+	id := rsp.ShortURL
+	stored, err := repo.Get(context.Background(), id)
+	require.NoError(t, err)
+	assert.Empty(t, stored.Password)
+	assert.NotEmpty(t, stored.PasswordHash)
+
+	tests := []struct {
+		name     string
+		password string
+		errCode  codes.Code
+	}{
+		{name: "Expand without password", errCode: codes.PermissionDenied},
+		{name: "Correct password", password: "secret", errCode: codes.OK},
+		{name: "Wrong password", password: "public", errCode: codes.PermissionDenied},
+		{name: "Wrong password again", password: "public", errCode: codes.PermissionDenied},
+		{name: "Out of attempts", password: "secret", errCode: codes.ResourceExhausted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rsp *pb.ExpandURLResponse
+			var err error
+			if tt.password == "" {
+				rsp, err = shortenerHandler.Expand(context.Background(), &pb.ExpandURLRequest{ShortURL: id})
+			} else {
+				rsp, err = shortenerHandler.ExpandWithPassword(context.Background(), &pb.ExpandWithPasswordRequest{ShortURL: id, Password: tt.password})
+			}
+			assert.Equal(t, tt.errCode, status.Code(err))
+			if tt.errCode == codes.OK {
+				assert.Equal(t, "https://github.com/", rsp.OriginalURL)
+			}
+		})
+	}
+}
+
+func TestRules(t *testing.T) {
+	shortener := service.NewShortenerImpl(storage.NewInMemRepo(), nil)
+	shortenerHandler := NewShortenerHandler(shortener)
+	incCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user_id": "1324"}))
+	rsp, err := shortenerHandler.Shorten(incCtx, &pb.ShortenURLRequest{OriginalURL: "https://github.com"})
+	require.NoError(t, err)
+	id := rsp.ShortURL
+
+	_, err = shortenerHandler.SetRules(incCtx, &pb.SetRulesRequest{ShortURL: id, Rules: []*pb.RedirectRule{{Target: "https://gitlab.com"}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	otherCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user_id": "4321"}))
+	_, err = shortenerHandler.SetRules(otherCtx, &pb.SetRulesRequest{ShortURL: id, Rules: []*pb.RedirectRule{{Country: "DE", Target: "https://gitlab.com"}}})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	rules, err := shortenerHandler.SetRules(incCtx, &pb.SetRulesRequest{ShortURL: id, Rules: []*pb.RedirectRule{{Country: "DE", Target: "https://gitlab.com"}}})
+	require.NoError(t, err)
+	assert.Len(t, rules.Rules, 1)
+	rules, err = shortenerHandler.GetRules(incCtx, &pb.GetRulesRequest{ShortURL: id})
+	require.NoError(t, err)
+	assert.Equal(t, "https://gitlab.com", rules.Rules[0].Target)
+
+	tests := []struct {
+		name    string
+		country string
+		want    string
+	}{
+		{name: "Matching country", country: "de", want: "https://gitlab.com"},
+		{name: "Other country", country: "US", want: "https://github.com/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"x-country": tt.country}))
+			rsp, err := shortenerHandler.Expand(ctx, &pb.ExpandURLRequest{ShortURL: id})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, rsp.OriginalURL)
+		})
+	}
+}
+
+func TestSplitTargets(t *testing.T) {
+	shortener := service.NewShortenerImpl(storage.NewInMemRepo(), nil)
+	shortenerHandler := NewShortenerHandler(shortener)
+	incCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user_id": "1324"}))
+	_, err := shortenerHandler.Shorten(incCtx, &pb.ShortenURLRequest{
+		OriginalURL: "https://github.com",
+		Variants:    []*pb.Variant{{OriginalURL: "https://github.com/a", Weight: 1}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	rsp, err := shortenerHandler.Shorten(incCtx, &pb.ShortenURLRequest{
+		OriginalURL: "https://github.com",
+		Variants:    []*pb.Variant{{OriginalURL: "https://github.com/a", Weight: 1}, {OriginalURL: "https://github.com/b", Weight: 1}},
+		Sticky:      true,
+	})
+	require.NoError(t, err)
+	id := rsp.ShortURL
+
+	first, err := shortenerHandler.Expand(context.Background(), &pb.ExpandURLRequest{ShortURL: id})
+	require.NoError(t, err)
+	require.NotZero(t, first.Variant)
+	// The variant of the first response keeps the client on its target.
+	for i := 0; i < 10; i++ {
+		rsp, err := shortenerHandler.Expand(context.Background(), &pb.ExpandURLRequest{ShortURL: id, Variant: first.Variant})
+		require.NoError(t, err)
+		assert.Equal(t, first.Variant, rsp.Variant)
+		assert.Equal(t, first.OriginalURL, rsp.OriginalURL)
+	}
+}
+
+func TestQRCode(t *testing.T) {
+	shortener := service.NewShortenerImpl(storage.NewInMemRepo(), &config.Config{BaseURL: "http://localhost:8080"})
+	shortenerHandler := NewShortenerHandler(shortener)
+	incCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user_id": "1324"}))
+	rsp, err := shortenerHandler.Shorten(incCtx, &pb.ShortenURLRequest{OriginalURL: "https://github.com"})
+	require.NoError(t, err)
+	id := rsp.ShortURL
+
+	code, err := shortenerHandler.QRCode(context.Background(), &pb.QRCodeRequest{ShortURL: id, Format: "svg", Size: 128, Ecc: "Q"})
+	require.NoError(t, err)
+	assert.Equal(t, "image/svg+xml", code.ContentType)
+	assert.Contains(t, string(code.Image), "<svg")
+
+	_, err = shortenerHandler.QRCode(context.Background(), &pb.QRCodeRequest{ShortURL: id, Size: 1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = shortenerHandler.QRCode(context.Background(), &pb.QRCodeRequest{ShortURL: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestBlockURL(t *testing.T) {
+	shortener := service.NewShortenerImpl(storage.NewInMemRepo(), nil)
+	shortenerHandler := NewShortenerHandler(shortener)
+	incCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user_id": "1324"}))
+	_, err := shortenerHandler.Shorten(incCtx, &pb.ShortenURLRequest{OriginalURL: "http://127.0.0.1/"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	rsp, err := shortenerHandler.Shorten(incCtx, &pb.ShortenURLRequest{OriginalURL: "https://github.com"})
+	require.NoError(t, err)
+	id := rsp.ShortURL
+
+	_, err = shortenerHandler.BlockURL(context.Background(), &pb.BlockURLRequest{ShortURL: "unknown", Blocked: true})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	blocked, err := shortenerHandler.BlockURL(context.Background(), &pb.BlockURLRequest{ShortURL: id, Blocked: true, Reason: "malware"})
+	require.NoError(t, err)
+	assert.True(t, blocked.Blocked)
+	_, err = shortenerHandler.Expand(context.Background(), &pb.ExpandURLRequest{ShortURL: id})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "malware")
+
+	_, err = shortenerHandler.BlockURL(context.Background(), &pb.BlockURLRequest{ShortURL: id})
+	require.NoError(t, err)
+	_, err = shortenerHandler.Expand(context.Background(), &pb.ExpandURLRequest{ShortURL: id})
+	assert.NoError(t, err)
+}
+
+func TestQuota(t *testing.T) {
+	shortener := service.NewShortenerImpl(storage.NewInMemRepo(), &config.Config{BaseURL: "http://localhost:8080", QuotaTotal: 2})
+	shortenerHandler := NewShortenerHandler(shortener)
+	incCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user_id": "1324"}))
+	_, err := shortenerHandler.Shorten(incCtx, &pb.ShortenURLRequest{OriginalURL: "https://github.com"})
+	require.NoError(t, err)
+	rsp, err := shortenerHandler.ShortenBatch(incCtx, &pb.BatchLinksRequest{BatchLinkRequestItem: []*pb.BatchRequstItem{
+		{CorrelationId: "1", OriginalURL: "https://gitlab.com"},
+		{CorrelationId: "2", OriginalURL: "https://bitbucket.org"},
+	}})
+	require.NoError(t, err)
+	assert.NotEmpty(t, rsp.BatchLinkResponseItem[0].ShortURL)
+	assert.Empty(t, rsp.BatchLinkResponseItem[1].ShortURL)
+	assert.Equal(t, models.ErrQuotaExceeded.Error(), rsp.BatchLinkResponseItem[1].Error)
+	_, err = shortenerHandler.Shorten(incCtx, &pb.ShortenURLRequest{OriginalURL: "https://bitbucket.org"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	quota, err := shortenerHandler.UserQuota(incCtx, &pb.QuotaRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), quota.Total.Limit)
+	assert.Equal(t, int32(2), quota.Total.Used)
+	assert.Zero(t, quota.Total.Remaining)
+	assert.Equal(t, int32(-1), quota.Daily.Remaining)
+
+	_, err = shortenerHandler.SetQuota(context.Background(), &pb.SetQuotaRequest{UserID: "1324", Total: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	quota, err = shortenerHandler.SetQuota(context.Background(), &pb.SetQuotaRequest{UserID: "1324", Total: 3})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), quota.Total.Remaining)
+	_, err = shortenerHandler.Shorten(incCtx, &pb.ShortenURLRequest{OriginalURL: "https://bitbucket.org"})
+	assert.NoError(t, err)
+}
+
+func TestGetJob(t *testing.T) {
+	repo := storage.NewInMemRepo()
+	shortener := service.NewShortenerImpl(repo, &config.Config{BaseURL: "http://localhost:8080"})
+	shortenerHandler := NewShortenerHandler(shortener)
+	incCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user_id": "1324"}))
+	rsp, err := shortenerHandler.Shorten(incCtx, &pb.ShortenURLRequest{OriginalURL: "https://github.com"})
+	require.NoError(t, err)
+	id := strings.TrimPrefix(rsp.ShortURL, "http://localhost:8080/")
+	deleted, err := shortenerHandler.DeleteBatch(incCtx, &pb.DeleteURLRequest{Urls: []string{id, "missing"}})
+	require.NoError(t, err)
+	require.NotEmpty(t, deleted.JobID)
+
+	job, err := shortenerHandler.GetJob(incCtx, &pb.JobRequest{JobID: deleted.JobID})
+	require.NoError(t, err)
+	assert.Equal(t, models.JobPending, job.Status)
+	assert.Zero(t, job.FinishedAt)
+	otherCtx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user_id": "4231"}))
+	_, err = shortenerHandler.GetJob(otherCtx, &pb.JobRequest{JobID: deleted.JobID})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// Close waits for the job to finish.
+	require.NoError(t, shortener.Close())
+	job, err = shortenerHandler.GetJob(incCtx, &pb.JobRequest{JobID: deleted.JobID})
+	require.NoError(t, err)
+	assert.Equal(t, models.JobDone, job.Status)
+	assert.Equal(t, int32(1), job.Deleted)
+	require.Len(t, job.Failures, 1)
+	assert.Equal(t, "missing", job.Failures[0].ShortURL)
+	assert.NotZero(t, job.FinishedAt)
+}
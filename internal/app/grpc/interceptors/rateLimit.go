@@ -0,0 +1,51 @@
+package interceptors
+
+import (
+	"context"
+	"net/netip"
+	"strconv"
+
+	"github.com/Mldlr/url-shortener/internal/app/ratelimit"
+	"github.com/Mldlr/url-shortener/internal/app/utils/helpers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// methodClasses maps methods to the route classes limiting them, other methods aren't limited.
+var methodClasses = map[string]string{
+	"/proto.Shortener/Shorten":            ratelimit.ClassCreate,
+	"/proto.Shortener/ShortenBatch":       ratelimit.ClassCreate,
+	"/proto.Shortener/Expand":             ratelimit.ClassRedirect,
+	"/proto.Shortener/ExpandWithPassword": ratelimit.ClassRedirect,
+	"/proto.Shortener/QRCode":             ratelimit.ClassRedirect,
+	"/proto.Shortener/DeleteBatch":        ratelimit.ClassDelete,
+	"/proto.Shortener/InternalStats":      ratelimit.ClassInternal,
+	"/proto.Shortener/BlockURL":           ratelimit.ClassInternal,
+	"/proto.Shortener/SetQuota":           ratelimit.ClassInternal,
+}
+
+// RateLimit is a rate limiting interceptor.
+type RateLimit struct {
+	Limits *ratelimit.Limits
+	// Proxies are the trusted proxies, the X-Real-IP metadata is only taken from them.
+	Proxies []netip.Prefix
+}
+
+// RateLimitInterceptor limits requests by the user ID metadata and the client ip.
+// It has to run after AuthInterceptor, which replaces user IDs without a valid signature.
+// Requests over the limit fail with ResourceExhausted status and the retry-after header.
+func (l *RateLimit) RateLimitInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	class, ok := methodClasses[info.FullMethod]
+	if !ok {
+		return handler(ctx, req)
+	}
+	userID, _ := helpers.CheckMDValue(ctx, "user_id")
+	if ok, wait := l.Limits.Allow(class, userID, helpers.PeerIP(ctx, l.Proxies)); !ok {
+		retryAfter := strconv.Itoa(ratelimit.RetryAfter(wait))
+		_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfter))
+		return nil, status.Error(codes.ResourceExhausted, "too many requests, retry after "+retryAfter+"s")
+	}
+	return handler(ctx, req)
+}
@@ -0,0 +1,49 @@
+package interceptors
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/Mldlr/url-shortener/internal/app/config"
+	"github.com/Mldlr/url-shortener/internal/app/ratelimit"
+)
+
+func TestRateLimit_RateLimitInterceptor(t *testing.T) {
+	interceptor := RateLimit{Limits: ratelimit.New(&config.Config{RateLimitCreate: 2}), Proxies: []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")}}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	// Calls are made through a trusted proxy.
+	proxy := &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 1234}}
+	call := func(method string, userID string, ip string) error {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user_id": userID, "X-Real-IP": ip}))
+		ctx = peer.NewContext(ctx, proxy)
+		_, err := interceptor.RateLimitInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+	assert.NoError(t, call("/proto.Shortener/Shorten", "1", "10.0.0.1"))
+	assert.NoError(t, call("/proto.Shortener/ShortenBatch", "1", "10.0.0.1"))
+	err := call("/proto.Shortener/Shorten", "1", "10.0.0.2")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	err = call("/proto.Shortener/Shorten", "2", "10.0.0.1")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.NoError(t, call("/proto.Shortener/Shorten", "2", "10.0.0.2"))
+	// Methods of other classes aren't limited.
+	assert.NoError(t, call("/proto.Shortener/Expand", "1", "10.0.0.1"))
+	assert.NoError(t, call("/proto.Shortener/Ping", "1", "10.0.0.1"))
+	// X-Real-IP of clients connecting directly is ignored, so they are limited by their own address.
+	proxy = &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 1234}}
+	assert.NoError(t, call("/proto.Shortener/Shorten", "3", "10.0.0.3"))
+	assert.NoError(t, call("/proto.Shortener/Shorten", "4", "10.0.0.4"))
+	err = call("/proto.Shortener/Shorten", "5", "10.0.0.5")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
@@ -11,6 +11,13 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// internalMethods are the methods allowed from the trusted subnet only.
+var internalMethods = map[string]bool{
+	"/proto.Shortener/InternalStats": true,
+	"/proto.Shortener/BlockURL":      true,
+	"/proto.Shortener/SetQuota":      true,
+}
+
 // Trusted is an incterceptor checking if request was made from trusted subnet.
 type Trusted struct {
 	Config *config.Config
@@ -19,21 +26,19 @@ type Trusted struct {
 // TrustInterceptor verifies request if it came from the trusted network
 // if request tries to access internal enpoints
 func (t *Trusted) TrustInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	if info.FullMethod != "/proto.Shortener/InternalStats" {
+	if !internalMethods[info.FullMethod] {
 		return handler(ctx, req)
 	}
 	if t.Config.TrustedSubnet == "" {
 		return nil, status.Error(codes.PermissionDenied, "untrusted user")
 	}
-	usermd, ok := helpers.CheckMDValue(ctx, "X-Real-IP")
-	if ok {
-		netip, err := netip.ParseAddr(usermd)
-		if err != nil {
-			return nil, status.Error(codes.PermissionDenied, err.Error())
-		}
-		if !t.Config.SubnetPrefix.Contains(netip) {
-			return nil, status.Error(codes.PermissionDenied, "untrusted user")
-		}
+	// X-Real-IP is only taken from trusted proxies, otherwise the address of the peer is checked.
+	netip, err := netip.ParseAddr(helpers.PeerIP(ctx, t.Config.ProxyPrefixes))
+	if err != nil {
+		return nil, status.Error(codes.PermissionDenied, "untrusted user")
+	}
+	if !t.Config.SubnetPrefix.Contains(netip.Unmap()) {
+		return nil, status.Error(codes.PermissionDenied, "untrusted user")
 	}
 	return handler(ctx, req)
 }
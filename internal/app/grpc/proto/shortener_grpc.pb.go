@@ -24,11 +24,21 @@ const _ = grpc.SupportPackageIsVersion7
 type ShortenerClient interface {
 	Shorten(ctx context.Context, in *ShortenURLRequest, opts ...grpc.CallOption) (*ShortenURLResponse, error)
 	Expand(ctx context.Context, in *ExpandURLRequest, opts ...grpc.CallOption) (*ExpandURLResponse, error)
+	ExpandWithPassword(ctx context.Context, in *ExpandWithPasswordRequest, opts ...grpc.CallOption) (*ExpandURLResponse, error)
 	ExpandUser(ctx context.Context, in *UserURLRequest, opts ...grpc.CallOption) (*UserURLResponse, error)
 	DeleteBatch(ctx context.Context, in *DeleteURLRequest, opts ...grpc.CallOption) (*DeleteURLResponse, error)
+	GetJob(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*JobResponse, error)
 	ShortenBatch(ctx context.Context, in *BatchLinksRequest, opts ...grpc.CallOption) (*BatchLinksResponse, error)
 	Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error)
 	InternalStats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error)
+	UpdateURL(ctx context.Context, in *UpdateURLRequest, opts ...grpc.CallOption) (*UpdateURLResponse, error)
+	URLHistory(ctx context.Context, in *URLHistoryRequest, opts ...grpc.CallOption) (*URLHistoryResponse, error)
+	GetRules(ctx context.Context, in *GetRulesRequest, opts ...grpc.CallOption) (*RulesResponse, error)
+	SetRules(ctx context.Context, in *SetRulesRequest, opts ...grpc.CallOption) (*RulesResponse, error)
+	QRCode(ctx context.Context, in *QRCodeRequest, opts ...grpc.CallOption) (*QRCodeResponse, error)
+	BlockURL(ctx context.Context, in *BlockURLRequest, opts ...grpc.CallOption) (*BlockURLResponse, error)
+	UserQuota(ctx context.Context, in *QuotaRequest, opts ...grpc.CallOption) (*QuotaResponse, error)
+	SetQuota(ctx context.Context, in *SetQuotaRequest, opts ...grpc.CallOption) (*QuotaResponse, error)
 }
 
 type shortenerClient struct {
@@ -57,6 +67,15 @@ func (c *shortenerClient) Expand(ctx context.Context, in *ExpandURLRequest, opts
 	return out, nil
 }
 
+func (c *shortenerClient) ExpandWithPassword(ctx context.Context, in *ExpandWithPasswordRequest, opts ...grpc.CallOption) (*ExpandURLResponse, error) {
+	out := new(ExpandURLResponse)
+	err := c.cc.Invoke(ctx, "/proto.Shortener/ExpandWithPassword", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *shortenerClient) ExpandUser(ctx context.Context, in *UserURLRequest, opts ...grpc.CallOption) (*UserURLResponse, error) {
 	out := new(UserURLResponse)
 	err := c.cc.Invoke(ctx, "/proto.Shortener/ExpandUser", in, out, opts...)
@@ -75,6 +94,15 @@ func (c *shortenerClient) DeleteBatch(ctx context.Context, in *DeleteURLRequest,
 	return out, nil
 }
 
+func (c *shortenerClient) GetJob(ctx context.Context, in *JobRequest, opts ...grpc.CallOption) (*JobResponse, error) {
+	out := new(JobResponse)
+	err := c.cc.Invoke(ctx, "/proto.Shortener/GetJob", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *shortenerClient) ShortenBatch(ctx context.Context, in *BatchLinksRequest, opts ...grpc.CallOption) (*BatchLinksResponse, error) {
 	out := new(BatchLinksResponse)
 	err := c.cc.Invoke(ctx, "/proto.Shortener/ShortenBatch", in, out, opts...)
@@ -102,17 +130,99 @@ func (c *shortenerClient) InternalStats(ctx context.Context, in *StatsRequest, o
 	return out, nil
 }
 
+func (c *shortenerClient) UpdateURL(ctx context.Context, in *UpdateURLRequest, opts ...grpc.CallOption) (*UpdateURLResponse, error) {
+	out := new(UpdateURLResponse)
+	err := c.cc.Invoke(ctx, "/proto.Shortener/UpdateURL", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) URLHistory(ctx context.Context, in *URLHistoryRequest, opts ...grpc.CallOption) (*URLHistoryResponse, error) {
+	out := new(URLHistoryResponse)
+	err := c.cc.Invoke(ctx, "/proto.Shortener/URLHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetRules(ctx context.Context, in *GetRulesRequest, opts ...grpc.CallOption) (*RulesResponse, error) {
+	out := new(RulesResponse)
+	err := c.cc.Invoke(ctx, "/proto.Shortener/GetRules", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) SetRules(ctx context.Context, in *SetRulesRequest, opts ...grpc.CallOption) (*RulesResponse, error) {
+	out := new(RulesResponse)
+	err := c.cc.Invoke(ctx, "/proto.Shortener/SetRules", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) QRCode(ctx context.Context, in *QRCodeRequest, opts ...grpc.CallOption) (*QRCodeResponse, error) {
+	out := new(QRCodeResponse)
+	err := c.cc.Invoke(ctx, "/proto.Shortener/QRCode", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) BlockURL(ctx context.Context, in *BlockURLRequest, opts ...grpc.CallOption) (*BlockURLResponse, error) {
+	out := new(BlockURLResponse)
+	err := c.cc.Invoke(ctx, "/proto.Shortener/BlockURL", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) UserQuota(ctx context.Context, in *QuotaRequest, opts ...grpc.CallOption) (*QuotaResponse, error) {
+	out := new(QuotaResponse)
+	err := c.cc.Invoke(ctx, "/proto.Shortener/UserQuota", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) SetQuota(ctx context.Context, in *SetQuotaRequest, opts ...grpc.CallOption) (*QuotaResponse, error) {
+	out := new(QuotaResponse)
+	err := c.cc.Invoke(ctx, "/proto.Shortener/SetQuota", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ShortenerServer is the server API for Shortener service.
 // All implementations must embed UnimplementedShortenerServer
 // for forward compatibility
 type ShortenerServer interface {
 	Shorten(context.Context, *ShortenURLRequest) (*ShortenURLResponse, error)
 	Expand(context.Context, *ExpandURLRequest) (*ExpandURLResponse, error)
+	ExpandWithPassword(context.Context, *ExpandWithPasswordRequest) (*ExpandURLResponse, error)
 	ExpandUser(context.Context, *UserURLRequest) (*UserURLResponse, error)
 	DeleteBatch(context.Context, *DeleteURLRequest) (*DeleteURLResponse, error)
+	GetJob(context.Context, *JobRequest) (*JobResponse, error)
 	ShortenBatch(context.Context, *BatchLinksRequest) (*BatchLinksResponse, error)
 	Ping(context.Context, *PingRequest) (*PingResponse, error)
 	InternalStats(context.Context, *StatsRequest) (*StatsResponse, error)
+	UpdateURL(context.Context, *UpdateURLRequest) (*UpdateURLResponse, error)
+	URLHistory(context.Context, *URLHistoryRequest) (*URLHistoryResponse, error)
+	GetRules(context.Context, *GetRulesRequest) (*RulesResponse, error)
+	SetRules(context.Context, *SetRulesRequest) (*RulesResponse, error)
+	QRCode(context.Context, *QRCodeRequest) (*QRCodeResponse, error)
+	BlockURL(context.Context, *BlockURLRequest) (*BlockURLResponse, error)
+	UserQuota(context.Context, *QuotaRequest) (*QuotaResponse, error)
+	SetQuota(context.Context, *SetQuotaRequest) (*QuotaResponse, error)
 	mustEmbedUnimplementedShortenerServer()
 }
 
@@ -126,12 +236,18 @@ func (UnimplementedShortenerServer) Shorten(context.Context, *ShortenURLRequest)
 func (UnimplementedShortenerServer) Expand(context.Context, *ExpandURLRequest) (*ExpandURLResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Expand not implemented")
 }
+func (UnimplementedShortenerServer) ExpandWithPassword(context.Context, *ExpandWithPasswordRequest) (*ExpandURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExpandWithPassword not implemented")
+}
 func (UnimplementedShortenerServer) ExpandUser(context.Context, *UserURLRequest) (*UserURLResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ExpandUser not implemented")
 }
 func (UnimplementedShortenerServer) DeleteBatch(context.Context, *DeleteURLRequest) (*DeleteURLResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteBatch not implemented")
 }
+func (UnimplementedShortenerServer) GetJob(context.Context, *JobRequest) (*JobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJob not implemented")
+}
 func (UnimplementedShortenerServer) ShortenBatch(context.Context, *BatchLinksRequest) (*BatchLinksResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ShortenBatch not implemented")
 }
@@ -141,6 +257,30 @@ func (UnimplementedShortenerServer) Ping(context.Context, *PingRequest) (*PingRe
 func (UnimplementedShortenerServer) InternalStats(context.Context, *StatsRequest) (*StatsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method InternalStats not implemented")
 }
+func (UnimplementedShortenerServer) UpdateURL(context.Context, *UpdateURLRequest) (*UpdateURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateURL not implemented")
+}
+func (UnimplementedShortenerServer) URLHistory(context.Context, *URLHistoryRequest) (*URLHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method URLHistory not implemented")
+}
+func (UnimplementedShortenerServer) GetRules(context.Context, *GetRulesRequest) (*RulesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRules not implemented")
+}
+func (UnimplementedShortenerServer) SetRules(context.Context, *SetRulesRequest) (*RulesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetRules not implemented")
+}
+func (UnimplementedShortenerServer) QRCode(context.Context, *QRCodeRequest) (*QRCodeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QRCode not implemented")
+}
+func (UnimplementedShortenerServer) BlockURL(context.Context, *BlockURLRequest) (*BlockURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BlockURL not implemented")
+}
+func (UnimplementedShortenerServer) UserQuota(context.Context, *QuotaRequest) (*QuotaResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UserQuota not implemented")
+}
+func (UnimplementedShortenerServer) SetQuota(context.Context, *SetQuotaRequest) (*QuotaResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetQuota not implemented")
+}
 func (UnimplementedShortenerServer) mustEmbedUnimplementedShortenerServer() {}
 
 // UnsafeShortenerServer may be embedded to opt out of forward compatibility for this service.
@@ -190,6 +330,24 @@ func _Shortener_Expand_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Shortener_ExpandWithPassword_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExpandWithPasswordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).ExpandWithPassword(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Shortener/ExpandWithPassword",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).ExpandWithPassword(ctx, req.(*ExpandWithPasswordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Shortener_ExpandUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(UserURLRequest)
 	if err := dec(in); err != nil {
@@ -226,6 +384,24 @@ func _Shortener_DeleteBatch_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Shortener_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Shortener/GetJob",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetJob(ctx, req.(*JobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Shortener_ShortenBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(BatchLinksRequest)
 	if err := dec(in); err != nil {
@@ -280,6 +456,150 @@ func _Shortener_InternalStats_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Shortener_UpdateURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).UpdateURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Shortener/UpdateURL",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).UpdateURL(ctx, req.(*UpdateURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_URLHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(URLHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).URLHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Shortener/URLHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).URLHistory(ctx, req.(*URLHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetRules_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRulesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetRules(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Shortener/GetRules",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetRules(ctx, req.(*GetRulesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_SetRules_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRulesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).SetRules(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Shortener/SetRules",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).SetRules(ctx, req.(*SetRulesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_QRCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QRCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).QRCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Shortener/QRCode",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).QRCode(ctx, req.(*QRCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_BlockURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BlockURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).BlockURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Shortener/BlockURL",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).BlockURL(ctx, req.(*BlockURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_UserQuota_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QuotaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).UserQuota(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Shortener/UserQuota",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).UserQuota(ctx, req.(*QuotaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_SetQuota_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetQuotaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).SetQuota(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Shortener/SetQuota",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).SetQuota(ctx, req.(*SetQuotaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Shortener_ServiceDesc is the grpc.ServiceDesc for Shortener service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -295,6 +615,10 @@ var Shortener_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Expand",
 			Handler:    _Shortener_Expand_Handler,
 		},
+		{
+			MethodName: "ExpandWithPassword",
+			Handler:    _Shortener_ExpandWithPassword_Handler,
+		},
 		{
 			MethodName: "ExpandUser",
 			Handler:    _Shortener_ExpandUser_Handler,
@@ -303,6 +627,10 @@ var Shortener_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteBatch",
 			Handler:    _Shortener_DeleteBatch_Handler,
 		},
+		{
+			MethodName: "GetJob",
+			Handler:    _Shortener_GetJob_Handler,
+		},
 		{
 			MethodName: "ShortenBatch",
 			Handler:    _Shortener_ShortenBatch_Handler,
@@ -315,6 +643,38 @@ var Shortener_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "InternalStats",
 			Handler:    _Shortener_InternalStats_Handler,
 		},
+		{
+			MethodName: "UpdateURL",
+			Handler:    _Shortener_UpdateURL_Handler,
+		},
+		{
+			MethodName: "URLHistory",
+			Handler:    _Shortener_URLHistory_Handler,
+		},
+		{
+			MethodName: "GetRules",
+			Handler:    _Shortener_GetRules_Handler,
+		},
+		{
+			MethodName: "SetRules",
+			Handler:    _Shortener_SetRules_Handler,
+		},
+		{
+			MethodName: "QRCode",
+			Handler:    _Shortener_QRCode_Handler,
+		},
+		{
+			MethodName: "BlockURL",
+			Handler:    _Shortener_BlockURL_Handler,
+		},
+		{
+			MethodName: "UserQuota",
+			Handler:    _Shortener_UserQuota_Handler,
+		},
+		{
+			MethodName: "SetQuota",
+			Handler:    _Shortener_SetQuota_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/shortener.proto",
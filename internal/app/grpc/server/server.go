@@ -9,6 +9,7 @@ import (
 	handler "github.com/Mldlr/url-shortener/internal/app/grpc/handlers"
 	"github.com/Mldlr/url-shortener/internal/app/grpc/interceptors"
 	pb "github.com/Mldlr/url-shortener/internal/app/grpc/proto"
+	"github.com/Mldlr/url-shortener/internal/app/ratelimit"
 	"github.com/Mldlr/url-shortener/internal/app/service"
 	"google.golang.org/grpc"
 )
@@ -33,10 +34,12 @@ func (s *GRPCServer) Run(ctx context.Context) {
 	if err != nil {
 		log.Fatal(err)
 	}
-	// auth and trust net interceptors
+	// auth, trust net and rate limit interceptors
 	trustInterceptor := interceptors.Trusted{Config: s.cfg}
 	authInterceptor := interceptors.Auth{Config: s.cfg}
-	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(trustInterceptor.TrustInterceptor, authInterceptor.AuthInterceptor))
+	rateLimitInterceptor := interceptors.RateLimit{Limits: ratelimit.New(s.cfg), Proxies: s.cfg.ProxyPrefixes}
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(trustInterceptor.TrustInterceptor, authInterceptor.AuthInterceptor,
+		rateLimitInterceptor.RateLimitInterceptor))
 	pb.RegisterShortenerServer(srv, s.handler)
 	if err = srv.Serve(listener); err != nil {
 		log.Fatal(err)
@@ -28,6 +28,8 @@ func init() {
 		GRPCAddress:   ":8888",
 		TrustedSubnet: testSubnet,
 		SubnetPrefix:  testPrefix,
+		// Test clients connect from the loopback, so they are trusted proxies.
+		ProxyPrefixes: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")},
 		SecretKey:     []byte("defaultKeyUrlSHoRtenEr"),
 	}
 	shortener := service.NewShortenerImpl(repo, cfg)
@@ -54,6 +56,10 @@ func TestGRPCServer_Stats(t *testing.T) {
 			xRealIP: "11.11.5.6",
 			errCode: codes.PermissionDenied,
 		},
+		{
+			name:    "Without X-Real-IP",
+			errCode: codes.PermissionDenied,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -64,11 +70,12 @@ func TestGRPCServer_Stats(t *testing.T) {
 			ctx := context.Background()
 			request := &pb.StatsRequest{}
 			assert.NoError(t, err)
-			outCtx := metadata.NewOutgoingContext(ctx, metadata.New(map[string]string{"X-Real-IP": tt.xRealIP}))
-			_, err = c.InternalStats(outCtx, request)
-			if statusErr, ok := status.FromError(err); ok {
-				assert.Equal(t, tt.errCode.String(), statusErr.Code().String())
+			outCtx := ctx
+			if tt.xRealIP != "" {
+				outCtx = metadata.NewOutgoingContext(ctx, metadata.New(map[string]string{"X-Real-IP": tt.xRealIP}))
 			}
+			_, err = c.InternalStats(outCtx, request)
+			assert.Equal(t, tt.errCode.String(), status.Code(err).String())
 		})
 	}
 }
@@ -126,3 +133,41 @@ func TestGRPCServer_DeleteURL(t *testing.T) {
 		})
 	}
 }
+
+// TestGRPCServer_SetQuota checks if quotas can be set from the trusted subnet only
+func TestGRPCServer_SetQuota(t *testing.T) {
+	tests := []struct {
+		name    string
+		xRealIP string
+		errCode codes.Code
+	}{
+		{
+			name:    "Trusted",
+			xRealIP: "155.155.5.6",
+			errCode: codes.OK,
+		},
+		{
+			name:    "Untrusted",
+			xRealIP: "11.11.5.6",
+			errCode: codes.PermissionDenied,
+		},
+		{
+			name:    "Without X-Real-IP",
+			errCode: codes.PermissionDenied,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := grpc.Dial(":8888", grpc.WithTransportCredentials(insecure.NewCredentials()))
+			assert.NoError(t, err)
+			defer conn.Close()
+			c := pb.NewShortenerClient(conn)
+			outCtx := context.Background()
+			if tt.xRealIP != "" {
+				outCtx = metadata.NewOutgoingContext(outCtx, metadata.New(map[string]string{"X-Real-IP": tt.xRealIP}))
+			}
+			_, err = c.SetQuota(outCtx, &pb.SetQuotaRequest{UserID: "user1", Daily: 5})
+			assert.Equal(t, tt.errCode.String(), status.Code(err).String())
+		})
+	}
+}
@@ -6,8 +6,30 @@ import "errors"
 var (
 	// ErrURLNotFound - url not registered
 	ErrURLNotFound = errors.New("URL not found")
+	// ErrInvalidID - short id is not stored
+	ErrInvalidID = errors.New("invalid id")
 	// ErrURLDeleted - ulr deleted
 	ErrURLDeleted = errors.New("URL deleted")
+	// ErrURLExpired - url expired
+	ErrURLExpired = errors.New("URL expired")
+	// ErrURLExhausted - all redirects allowed for url were used
+	ErrURLExhausted = errors.New("URL exhausted")
+	// ErrInvalidMaxClicks - redirect limit is negative
+	ErrInvalidMaxClicks = errors.New("invalid max clicks")
+	// ErrInvalidRule - redirect rule has no conditions or malformed ones
+	ErrInvalidRule = errors.New("invalid redirect rule")
+	// ErrInvalidVariants - split targets are malformed or have no weight
+	ErrInvalidVariants = errors.New("invalid variants")
+	// ErrInvalidRedirectCode - status code is not a redirect
+	ErrInvalidRedirectCode = errors.New("invalid redirect code")
+	// ErrURLBlocked - url was blocked by an administrator
+	ErrURLBlocked = errors.New("URL blocked")
+	// ErrDestinationBlocked - original url is not allowed by the destination policy
+	ErrDestinationBlocked = errors.New("destination not allowed")
+	// ErrInvalidQROptions - unknown format, error correction level or size of a QR code
+	ErrInvalidQROptions = errors.New("invalid QR code options")
+	// ErrInvalidExpiry - expiry is in the past or set twice
+	ErrInvalidExpiry = errors.New("invalid expiry")
 	// ErrInvalidURL - invalid url
 	ErrInvalidURL = errors.New("invalid url")
 	// ErrGettingID - repo error
@@ -16,4 +38,36 @@ var (
 	ErrDuplicate = errors.New("url already in db")
 	// ErrNoContent - no registered url for user
 	ErrNoContent = errors.New("no urls for user")
+	// ErrInvalidAlias - custom alias is malformed or reserved
+	ErrInvalidAlias = errors.New("invalid alias")
+	// ErrAliasTaken - custom alias is used by another url
+	ErrAliasTaken = errors.New("alias already taken")
+	// ErrAliasNotApplied - long url is already shortened under another short url, so the alias is not created
+	ErrAliasNotApplied = errors.New("url already shortened, alias not applied")
+	// ErrNotOwner - url was created by another user
+	ErrNotOwner = errors.New("url belongs to another user")
+	// ErrInvalidBucket - unknown time bucket of click stats
+	ErrInvalidBucket = errors.New("invalid bucket")
+	// ErrInvalidQuery - malformed listing parameters
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrPasswordRequired - url is protected by a password
+	ErrPasswordRequired = errors.New("password required")
+	// ErrWrongPassword - password of a protected url doesn't match
+	ErrWrongPassword = errors.New("wrong password")
+	// ErrTooManyAttempts - too many wrong passwords were submitted for a url
+	ErrTooManyAttempts = errors.New("too many attempts")
+	// ErrQuotaExceeded - user created as many urls as their quota allows
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrInvalidQuota - quota limit is negative
+	ErrInvalidQuota = errors.New("invalid quota")
+	// ErrInvalidWebhook - webhook url is malformed or an event type is unknown
+	ErrInvalidWebhook = errors.New("invalid webhook")
+	// ErrWebhookNotFound - webhook is not registered by user
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrJobNotFound - delete job is not requested by user
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobClaimed - delete job is held by another instance
+	ErrJobClaimed = errors.New("job claimed by another instance")
+	// ErrIDCollision - no free short id found for url
+	ErrIDCollision = errors.New("could not generate unique id")
 )
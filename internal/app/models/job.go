@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// States of delete jobs.
+const (
+	JobPending = "pending"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Job represents a batch delete requested by a user and processed in background.
+type Job struct {
+	// ID is the unique ID of the job.
+	ID string `json:"id"`
+	// UserID is the ID of the user who requested the delete.
+	UserID string `json:"user_id"`
+	// Status is pending until the delete is processed, then done, or failed if the storage failed.
+	Status string `json:"status"`
+	// IDs are the short URLs requested to be deleted.
+	IDs []string `json:"ids"`
+	// Deleted is the number of deleted URLs.
+	Deleted int `json:"deleted"`
+	// Failures are the requested URLs that were not deleted with the reasons.
+	Failures []JobFailure `json:"failures,omitempty"`
+	// Error is the reason the job failed.
+	Error string `json:"error,omitempty"`
+	// CreatedAt is the time the job was requested.
+	CreatedAt time.Time `json:"created_at"`
+	// FinishedAt is the time the job was processed, nil while it is pending.
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Owner is the ID of the instance running the job, only it can save the job until another one claims it.
+	Owner string `json:"-"`
+	// LeaseUntil is the time the owner holds the job until, other instances can claim it afterwards.
+	LeaseUntil *time.Time `json:"-"`
+}
+
+// JobFailure represents a URL a job failed to delete.
+type JobFailure struct {
+	// ID is the short URL.
+	ID string `json:"id"`
+	// Error is the reason the URL was not deleted.
+	Error string `json:"error"`
+}
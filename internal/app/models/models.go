@@ -1,6 +1,8 @@
 // Package models provides definitions of objects used in url-shortener
 package models
 
+import "time"
+
 // URL represents a URL object that contains information about a shortened URL.
 type URL struct {
 	// ShortURL is the shortened version of the URL.
@@ -11,6 +13,55 @@ type URL struct {
 	UserID string `json:"user_id"`
 	// Deleted indicates whether the URL has been deleted or not.
 	Deleted bool `json:"deleted"`
+	// DeletedAt is the time the URL was deleted.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Alias is a custom short ID requested by the user instead of a generated one.
+	Alias string `json:"alias,omitempty"`
+	// ExpiresAt is the time after which the URL stops working, nil if it never expires.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// ExpireDays is the requested lifetime of the URL in days, converted to ExpiresAt on creation.
+	ExpireDays int `json:"expire_days,omitempty"`
+	// CreatedAt is the time the URL was shortened.
+	CreatedAt time.Time `json:"created_at"`
+	// Password is the password requested on creation, it is replaced by PasswordHash before the URL is stored.
+	Password string `json:"password,omitempty"`
+	// PasswordHash is the salted hash of the password required to follow the URL, empty if it is not protected.
+	PasswordHash string `json:"password_hash,omitempty"`
+	// MaxClicks is the number of redirects after which the URL stops working, 0 if it is not limited.
+	MaxClicks int `json:"max_clicks,omitempty"`
+	// Clicks is the number of redirects counted against MaxClicks.
+	Clicks int `json:"clicks,omitempty"`
+	// Rules route matching requests to other targets, the first matching rule wins and LongURL is the default target.
+	Rules []*RedirectRule `json:"rules,omitempty"`
+	// Variants split requests matching no rule between weighted targets instead of LongURL.
+	Variants []*Variant `json:"variants,omitempty"`
+	// Sticky keeps a visitor on the variant assigned by the first redirect.
+	Sticky bool `json:"sticky,omitempty"`
+	// RedirectCode is the status code of redirects: 301, 302, 307 or 308, 0 uses the configured one.
+	RedirectCode int `json:"redirect_code,omitempty"`
+	// Blocked indicates that an administrator blocked the URL, so it shows a warning instead of redirecting.
+	Blocked bool `json:"blocked,omitempty"`
+	// BlockReason is the reason shown on the warning page of a blocked URL.
+	BlockReason string `json:"block_reason,omitempty"`
+	// Err is the reason the URL was not shortened in a batch, it is never stored.
+	Err error `json:"-"`
+	// Duplicate indicates that the original URL added in a batch was already stored under ShortURL, it is never stored.
+	Duplicate bool `json:"-"`
+}
+
+// Exhausted checks if all redirects allowed by MaxClicks were used.
+func (u *URL) Exhausted() bool {
+	return u.MaxClicks > 0 && u.Clicks >= u.MaxClicks
+}
+
+// Protected checks if the URL requires a password.
+func (u *URL) Protected() bool {
+	return u.PasswordHash != ""
+}
+
+// Expired checks if the URL has expired at the given time.
+func (u *URL) Expired(now time.Time) bool {
+	return u.ExpiresAt != nil && !u.ExpiresAt.After(now)
 }
 
 // Response represents a shortened URL sent in response to Users' request.
@@ -33,6 +84,8 @@ type DeleteURLItem struct {
 	UserID string `json:"user_id"`
 	// ShortURL is the shortened version of the URL.
 	ShortURL string `json:"short_url"`
+	// Deleted is set by the storage if the URL was deleted by this item, not before it.
+	Deleted bool `json:"-"`
 }
 
 // BatchReqItem represents an item in a batch request for creating shortened URLs.
@@ -41,14 +94,126 @@ type BatchReqItem struct {
 	CorID string `json:"correlation_id"`
 	// OrigURL is the original, long version of the URL.
 	OrigURL string `json:"original_url"`
+	// ExpiresAt is the time after which the URL stops working.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// ExpireDays is the lifetime of the URL in days.
+	ExpireDays int `json:"expire_days,omitempty"`
+	// MaxClicks is the number of redirects after which the URL stops working.
+	MaxClicks int `json:"max_clicks,omitempty"`
+	// RedirectCode is the status code of redirects.
+	RedirectCode int `json:"redirect_code,omitempty"`
 }
 
 // BatchRespItem represents an item in a batch response containing shortened URLs.
 type BatchRespItem struct {
 	// CorID is the correlation ID for the request.
 	CorID string `json:"correlation_id"`
+	// ShortURL is the shortened version of the URL, empty if it was not shortened.
+	ShortURL string `json:"short_url,omitempty"`
+	// Error is the reason the URL was not shortened.
+	Error string `json:"error,omitempty"`
+}
+
+// RestoreResult represents the result of restoring deleted URLs.
+type RestoreResult struct {
+	// Restored is the number of restored URLs.
+	Restored int `json:"restored"`
+}
+
+// URLVersion represents a previous target of a short URL.
+type URLVersion struct {
 	// ShortURL is the shortened version of the URL.
 	ShortURL string `json:"short_url"`
+	// Version is the number of the target, the first target of the URL has version 1.
+	Version int `json:"version"`
+	// LongURL is the previous original URL.
+	LongURL string `json:"url"`
+	// ChangedAt is the time the target was replaced.
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// URLQuery represents parameters of a user URL listing.
+type URLQuery struct {
+	// Limit is the maximal number of URLs to return, 0 means no limit.
+	Limit int
+	// After is the position in the listing after which URLs are returned.
+	After *Cursor
+	// Desc sorts URLs from newest to oldest instead of oldest to newest.
+	Desc bool
+	// Deleted filters URLs by deleted state if set.
+	Deleted *bool
+	// Search filters URLs by case-insensitive substring of the original URL.
+	Search string
+}
+
+// Cursor is the position of a URL in a listing sorted by creation time.
+type Cursor struct {
+	// CreatedAt is the creation time of the URL.
+	CreatedAt time.Time
+	// ShortURL is the shortened version of the URL, it orders URLs created at the same time.
+	ShortURL string
+}
+
+// URLPage represents a page of a user URL listing.
+type URLPage struct {
+	// URLs are the URLs of the page.
+	URLs []*URL
+	// NextCursor is the cursor of the next page, empty on the last page.
+	NextCursor string
+}
+
+// Time buckets of click statistics.
+const (
+	// BucketHour groups clicks by hour.
+	BucketHour = "hour"
+	// BucketDay groups clicks by day.
+	BucketDay = "day"
+)
+
+// Click represents a single redirect of a short URL.
+type Click struct {
+	// ShortURL is the shortened version of the URL.
+	ShortURL string `json:"short_url"`
+	// Time is the moment of the redirect.
+	Time time.Time `json:"time"`
+	// Referrer is the Referer header of the request.
+	Referrer string `json:"referrer,omitempty"`
+	// UserAgent is the User-Agent header of the request.
+	UserAgent string `json:"user_agent,omitempty"`
+	// IP is the client address from the X-Real-IP header.
+	IP string `json:"ip,omitempty"`
+	// Variant is the number of the variant the client was redirected to, 0 if the URL isn't split.
+	Variant int `json:"variant,omitempty"`
+}
+
+// ClickBucket represents the count of clicks in a time bucket.
+type ClickBucket struct {
+	// Start is the beginning of the bucket.
+	Start time.Time `json:"start"`
+	// Count is the number of clicks in the bucket.
+	Count int `json:"count"`
+}
+
+// ClickStats represents redirect statistics of a short URL.
+type ClickStats struct {
+	// ShortURL is the shortened version of the URL.
+	ShortURL string `json:"short_url"`
+	// Total is the number of clicks.
+	Total int `json:"total"`
+	// Buckets are the click counts grouped by time.
+	Buckets []ClickBucket `json:"buckets"`
+	// Variants are the click counts of variants of a split URL.
+	Variants []VariantClicks `json:"variants,omitempty"`
+}
+
+// VariantClicks represents the count of clicks of a variant.
+type VariantClicks struct {
+	// Variant is the number of the variant, starting with 1.
+	Variant int `json:"variant"`
+	// Target is the original URL of the variant.
+	Target string `json:"target"`
+	// Count is the number of clicks redirected to the variant.
+	Count int `json:"count"`
 }
 
 // Stats structure
@@ -57,4 +222,8 @@ type Stats struct {
 	URLCount int `json:"urls"`
 	// Count of registered users
 	UserCount int `json:"users"`
+	// Count of redirects served from cache
+	CacheHits int64 `json:"cache_hits,omitempty"`
+	// Count of redirects read from storage
+	CacheMisses int64 `json:"cache_misses,omitempty"`
 }
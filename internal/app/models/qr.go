@@ -0,0 +1,39 @@
+package models
+
+// Image formats of QR codes.
+const (
+	// QRFormatPNG is a PNG image.
+	QRFormatPNG = "png"
+	// QRFormatSVG is an SVG image.
+	QRFormatSVG = "svg"
+)
+
+// Error correction levels of QR codes, higher levels survive more damage at the cost of denser codes.
+const (
+	// QRLevelLow recovers 7% of the code.
+	QRLevelLow = "L"
+	// QRLevelMedium recovers 15% of the code.
+	QRLevelMedium = "M"
+	// QRLevelQuartile recovers 25% of the code.
+	QRLevelQuartile = "Q"
+	// QRLevelHigh recovers 30% of the code.
+	QRLevelHigh = "H"
+)
+
+// QROptions describes a QR code image of a short URL. Zero values are replaced with defaults.
+type QROptions struct {
+	// Format is the image format: png or svg.
+	Format string
+	// Size is the width and height of the image in pixels.
+	Size int
+	// Level is the error correction level: L, M, Q or H.
+	Level string
+}
+
+// QRCode is a QR code image of a short URL.
+type QRCode struct {
+	// Image is the encoded image.
+	Image []byte
+	// ContentType is the media type of Image.
+	ContentType string
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Quota limits how many URLs a user can create, a zero limit is unlimited.
+type Quota struct {
+	// UserID is the ID of the user the quota belongs to.
+	UserID string `json:"user_id"`
+	// Daily is the number of URLs the user can create per day.
+	Daily int `json:"daily"`
+	// Total is the number of URLs the user can keep.
+	Total int `json:"total"`
+}
+
+// QuotaUsage represents how much of their quota a user has used.
+type QuotaUsage struct {
+	// Daily is the usage of the daily limit.
+	Daily QuotaCounter `json:"daily"`
+	// Total is the usage of the total limit.
+	Total QuotaCounter `json:"total"`
+	// ResetsAt is the time the daily usage is reset.
+	ResetsAt time.Time `json:"resets_at"`
+}
+
+// QuotaCounter represents usage of a single limit.
+type QuotaCounter struct {
+	// Limit is the number of URLs allowed, 0 if it is unlimited.
+	Limit int `json:"limit"`
+	// Used is the number of URLs counted against the limit.
+	Used int `json:"used"`
+	// Remaining is the number of URLs that can still be created, nil if it is unlimited.
+	Remaining *int `json:"remaining"`
+}
+
+// Left returns the number of URLs that can still be created, -1 if it is unlimited.
+func (q *QuotaUsage) Left() int {
+	left := -1
+	for _, c := range []QuotaCounter{q.Daily, q.Total} {
+		if c.Remaining != nil && (left < 0 || *c.Remaining < left) {
+			left = *c.Remaining
+		}
+	}
+	return left
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"net/http"
+	"time"
+)
+
+// Device families matched by redirect rules against the User-Agent header.
+const (
+	// DeviceIOS matches iPhones, iPads and iPods.
+	DeviceIOS = "ios"
+	// DeviceAndroid matches Android devices.
+	DeviceAndroid = "android"
+	// DeviceMobile matches any mobile device.
+	DeviceMobile = "mobile"
+	// DeviceDesktop matches clients that are not mobile devices.
+	DeviceDesktop = "desktop"
+)
+
+// RedirectRule sends requests matching all of its conditions to another target of a URL.
+// Empty conditions match any request.
+type RedirectRule struct {
+	// Device matches the family of the User-Agent: ios, android, mobile or desktop.
+	Device string `json:"device,omitempty"`
+	// Language matches a language accepted by the Accept-Language header, e.g. "en" or "en-US".
+	Language string `json:"language,omitempty"`
+	// Country matches the country code from the geo header, e.g. "US".
+	Country string `json:"country,omitempty"`
+	// From is the UTC time of day in HH:MM format the rule starts to match at.
+	From string `json:"from,omitempty"`
+	// To is the UTC time of day in HH:MM format the rule stops to match at, it can be before From to wrap around midnight.
+	To string `json:"to,omitempty"`
+	// Target is the original URL requests matching the rule are redirected to.
+	Target string `json:"target"`
+}
+
+// Variant is one of the weighted targets a URL splits requests between.
+type Variant struct {
+	// Target is the original URL of the variant.
+	Target string `json:"url"`
+	// Weight is the share of requests redirected to the variant relative to the weights of other variants.
+	Weight int `json:"weight"`
+}
+
+// Visitor represents the request following a short URL, redirect rules are matched against it.
+type Visitor struct {
+	// Header is the header of the request.
+	Header http.Header
+	// Time is the moment of the request.
+	Time time.Time
+	// Variant is the number of the variant the visitor was assigned to before, 0 if none.
+	// Expand replaces it with the variant the visitor is redirected to, 0 if the URL isn't split.
+	Variant int
+}
@@ -0,0 +1,107 @@
+package models
+
+import "time"
+
+// Types of events of links sent to webhooks.
+const (
+	EventLinkCreated = "link.created"
+	EventLinkDeleted = "link.deleted"
+	EventLinkClicked = "link.clicked"
+)
+
+// EventTypes are all types of events sent to webhooks.
+var EventTypes = []string{EventLinkCreated, EventLinkDeleted, EventLinkClicked}
+
+// States of deliveries.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Event represents a change of a link sent to webhooks of its owner.
+type Event struct {
+	// ID is the unique ID of the event.
+	ID string `json:"id"`
+	// Type is the type of the event.
+	Type string `json:"type"`
+	// UserID is the ID of the user who owns the link.
+	UserID string `json:"user_id"`
+	// ShortURL is the short ID of the link.
+	ShortURL string `json:"short_url"`
+	// LongURL is the original URL of the link, or the target of a click.
+	LongURL string `json:"url,omitempty"`
+	// Time is the moment of the event.
+	Time time.Time `json:"time"`
+}
+
+// Webhook represents an endpoint of a user receiving events of their links.
+type Webhook struct {
+	// ID is the unique ID of the webhook.
+	ID string `json:"id"`
+	// UserID is the ID of the user who registered the webhook.
+	UserID string `json:"user_id"`
+	// URL is the endpoint events are posted to.
+	URL string `json:"url"`
+	// Events are the types of events sent to the webhook, all of them if empty.
+	Events []string `json:"events,omitempty"`
+	// Secret is the key of signatures of payloads, it is only shown when the webhook is registered.
+	Secret string `json:"secret,omitempty"`
+	// CreatedAt is the time the webhook was registered.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Subscribed checks if events of the given type are sent to the webhook.
+func (w *Webhook) Subscribed(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, v := range w.Events {
+		if v == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery represents an event waiting in the outbox to be posted to a webhook.
+type Delivery struct {
+	// ID is the unique ID of the delivery, sent with every attempt of it.
+	ID string `json:"id"`
+	// WebhookID is the ID of the receiving webhook.
+	WebhookID string `json:"webhook_id"`
+	// URL is the endpoint of the webhook.
+	URL string `json:"url"`
+	// Secret is the key signing the payload.
+	Secret string `json:"secret"`
+	// Event is the delivered event.
+	Event *Event `json:"event"`
+	// Attempts is the number of failed attempts.
+	Attempts int `json:"attempts"`
+	// NextAttempt is the time of the next attempt.
+	NextAttempt time.Time `json:"next_attempt"`
+	// Status is pending until the event is delivered or all attempts fail.
+	Status string `json:"status"`
+}
+
+// DeliveryAttempt represents an attempt to post an event in the delivery log of a webhook.
+type DeliveryAttempt struct {
+	// DeliveryID is the ID of the attempted delivery.
+	DeliveryID string `json:"delivery_id"`
+	// WebhookID is the ID of the receiving webhook.
+	WebhookID string `json:"webhook_id"`
+	// EventID is the ID of the delivered event.
+	EventID string `json:"event_id"`
+	// EventType is the type of the delivered event.
+	EventType string `json:"event"`
+	// Attempt is the number of the attempt, starting from 1.
+	Attempt int `json:"attempt"`
+	// StatusCode is the response status of the webhook, 0 if there was no response.
+	StatusCode int `json:"status_code,omitempty"`
+	// Error is the reason the attempt failed, empty if it succeeded.
+	Error string `json:"error,omitempty"`
+	// Status is the status of the delivery after the attempt.
+	Status string `json:"status"`
+	// Time is the moment of the attempt.
+	Time time.Time `json:"time"`
+}
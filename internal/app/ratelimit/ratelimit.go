@@ -0,0 +1,166 @@
+// Package ratelimit provides token bucket rate limiting of clients.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/config"
+)
+
+// Classes of routes limited separately.
+const (
+	// ClassCreate limits shortening of urls.
+	ClassCreate = "create"
+	// ClassRedirect limits following of short urls.
+	ClassRedirect = "redirect"
+	// ClassDelete limits deletion of urls.
+	ClassDelete = "delete"
+	// ClassInternal limits internal endpoints.
+	ClassInternal = "internal"
+)
+
+// Limiter limits requests per key with token buckets refilled at a constant rate.
+type Limiter struct {
+	// rate is the number of tokens added per second.
+	rate float64
+	// burst is the capacity of a bucket.
+	burst float64
+	// buckets maps keys to their buckets.
+	buckets map[string]*bucket
+	// pruned is the time full buckets were last removed.
+	pruned time.Time
+	// Mutex synchronizes access to buckets.
+	sync.Mutex
+}
+
+// bucket holds tokens of a key.
+type bucket struct {
+	// tokens is the number of tokens at updated.
+	tokens float64
+	// updated is the time tokens were last counted.
+	updated time.Time
+}
+
+// NewLimiter creates a limiter allowing perMinute requests per minute of every key in bursts of burst requests.
+func NewLimiter(perMinute int, burst int) *Limiter {
+	return &Limiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the bucket of every key at now if all of them have one.
+// Otherwise no tokens are taken and the time until all buckets have a token is returned.
+func (l *Limiter) Allow(now time.Time, keys ...string) (bool, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	l.prune(now)
+	var wait time.Duration
+	buckets := make([]*bucket, len(keys))
+	for i, key := range keys {
+		b, ok := l.buckets[key]
+		if !ok {
+			b = &bucket{tokens: l.burst, updated: now}
+			l.buckets[key] = b
+		}
+		b.refill(now, l.rate, l.burst)
+		if b.tokens < 1 {
+			missing := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+			if missing > wait {
+				wait = missing
+			}
+		}
+		buckets[i] = b
+	}
+	if wait > 0 {
+		return false, wait
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return true, 0
+}
+
+// refill adds tokens earned since the last count up to burst.
+func (b *bucket) refill(now time.Time, rate float64, burst float64) {
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed*rate)
+		b.updated = now
+	}
+}
+
+// prune removes buckets refilled to capacity at most once a minute, they behave like missing ones.
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < time.Minute {
+		return
+	}
+	l.pruned = now
+	for key, b := range l.buckets {
+		b.refill(now, l.rate, l.burst)
+		if b.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Limits holds limiters of route classes.
+type Limits struct {
+	// limiters maps route classes to their limiters, classes without a limiter aren't limited.
+	limiters map[string]*Limiter
+	// now returns current time.
+	now func() time.Time
+}
+
+// New creates limiters of route classes with limits from config, classes with zero limits aren't limited.
+// A minute worth of requests of a class can be made at once.
+func New(cfg *config.Config) *Limits {
+	l := &Limits{limiters: make(map[string]*Limiter), now: time.Now}
+	if cfg == nil {
+		return l
+	}
+	for class, perMinute := range map[string]int{
+		ClassCreate:   cfg.RateLimitCreate,
+		ClassRedirect: cfg.RateLimitRedirect,
+		ClassDelete:   cfg.RateLimitDelete,
+		ClassInternal: cfg.RateLimitInternal,
+	} {
+		if perMinute > 0 {
+			l.limiters[class] = NewLimiter(perMinute, perMinute)
+		}
+	}
+	return l
+}
+
+// Limited checks if requests of the route class are limited.
+func (l *Limits) Limited(class string) bool {
+	return l.limiters[class] != nil
+}
+
+// Allow takes a token of the route class from the buckets of the user and the client ip.
+// If any of them is empty, the time to retry after is returned. Empty keys are skipped.
+func (l *Limits) Allow(class string, userID string, ip string) (bool, time.Duration) {
+	limiter := l.limiters[class]
+	if limiter == nil {
+		return true, 0
+	}
+	keys := make([]string, 0, 2)
+	if userID != "" {
+		keys = append(keys, "user:"+userID)
+	}
+	if ip != "" {
+		keys = append(keys, "ip:"+ip)
+	}
+	return limiter.Allow(l.now(), keys...)
+}
+
+// RetryAfter returns wait in whole seconds for the Retry-After header, at least 1.
+func RetryAfter(wait time.Duration) int {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
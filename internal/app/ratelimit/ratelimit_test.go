@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Mldlr/url-shortener/internal/app/config"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	l := NewLimiter(60, 3)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow(now, "user:1")
+		assert.True(t, ok)
+	}
+	ok, wait := l.Allow(now, "user:1")
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+	// Other keys have their own buckets.
+	ok, _ = l.Allow(now, "user:2")
+	assert.True(t, ok)
+	// A token is added every second.
+	ok, _ = l.Allow(now.Add(500*time.Millisecond), "user:1")
+	assert.False(t, ok)
+	ok, _ = l.Allow(now.Add(time.Second), "user:1")
+	assert.True(t, ok)
+	// Buckets don't grow over burst.
+	later := now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		ok, _ = l.Allow(later, "user:1")
+		assert.True(t, ok)
+	}
+	ok, _ = l.Allow(later, "user:1")
+	assert.False(t, ok)
+}
+
+func TestLimiter_AllowKeys(t *testing.T) {
+	l := NewLimiter(60, 2)
+	now := time.Now()
+	ok, _ := l.Allow(now, "user:1", "ip:1")
+	assert.True(t, ok)
+	ok, _ = l.Allow(now, "user:2", "ip:1")
+	assert.True(t, ok)
+	// The ip is out of tokens, so new users from it are limited too.
+	ok, _ = l.Allow(now, "user:3", "ip:1")
+	assert.False(t, ok)
+	// Tokens aren't taken from any bucket of a denied request.
+	ok, _ = l.Allow(now, "user:3", "ip:2")
+	assert.True(t, ok)
+	ok, _ = l.Allow(now, "user:3", "ip:2")
+	assert.True(t, ok)
+}
+
+func TestLimiter_Prune(t *testing.T) {
+	l := NewLimiter(60, 2)
+	now := time.Now()
+	l.Allow(now, "user:1")
+	l.Allow(now, "user:2")
+	l.Allow(now, "user:2")
+	assert.Len(t, l.buckets, 2)
+	// Refilled buckets are removed.
+	l.Allow(now.Add(2*time.Minute), "user:3")
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestLimits(t *testing.T) {
+	l := New(&config.Config{RateLimitCreate: 1, RateLimitDelete: 2})
+	assert.True(t, l.Limited(ClassCreate))
+	assert.True(t, l.Limited(ClassDelete))
+	assert.False(t, l.Limited(ClassRedirect))
+	assert.False(t, New(nil).Limited(ClassCreate))
+
+	ok, _ := l.Allow(ClassCreate, "1", "10.0.0.1")
+	assert.True(t, ok)
+	ok, wait := l.Allow(ClassCreate, "1", "10.0.0.2")
+	assert.False(t, ok)
+	assert.Equal(t, 60, RetryAfter(wait))
+	// Classes are limited separately.
+	ok, _ = l.Allow(ClassDelete, "1", "10.0.0.1")
+	assert.True(t, ok)
+	ok, _ = l.Allow(ClassRedirect, "1", "10.0.0.1")
+	assert.True(t, ok)
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, 1, RetryAfter(0))
+	assert.Equal(t, 1, RetryAfter(10*time.Millisecond))
+	assert.Equal(t, 2, RetryAfter(1001*time.Millisecond))
+}
@@ -26,7 +26,7 @@ func ExampleShorten() {
 	bodyResult, _ := io.ReadAll(body)
 	fmt.Println(string(bodyResult))
 	// Output:
-	// http://localhost:8080/aAE3t8nGJ9A
+	// http://localhost:8080/IHnJLD18PA8
 }
 
 func ExampleAPIShorten() {
@@ -42,7 +42,7 @@ func ExampleAPIShorten() {
 	bodyResult, _ := io.ReadAll(body)
 	fmt.Println(string(bodyResult))
 	// Output:
-	// {"result":"http://localhost:8080/GaSgGCXYQ18"}
+	// {"result":"http://localhost:8080/IHnJLD18PA8"}
 
 }
 
@@ -118,7 +118,7 @@ func ExampleAPIInternalStats() {
 	shortener := service.NewShortenerImpl(repo, cfg)
 	r := NewRouter(shortener, cfg)
 	request := httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil)
-	request.Header.Set("X-Real-IP", "192.168.1.3")
+	request.RemoteAddr = "192.168.1.3:1234"
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, request)
 	fmt.Println(w.Body)
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/service"
+)
+
+// blockRequest is the body of a request blocking or unblocking a URL.
+type blockRequest struct {
+	// Blocked blocks the URL if true and unblocks it otherwise.
+	Blocked bool `json:"blocked"`
+	// Reason is shown on the warning page of the blocked URL.
+	Reason string `json:"reason"`
+}
+
+// APIBlockURL blocks or unblocks a shortened URL of any user, so it shows a warning page instead of redirecting.
+func APIBlockURL(shortener service.ShortenerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req blockRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "error reading request", http.StatusBadRequest)
+			return
+		}
+		url, err := shortener.BlockURL(r.Context(), chi.URLParam(r, "id"), req.Blocked, req.Reason)
+		if err != nil {
+			if errors.Is(err, models.ErrURLNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err = json.NewEncoder(w).Encode(blockRequest{Blocked: url.Blocked, Reason: url.BlockReason}); err != nil {
+			http.Error(w, "error building the response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
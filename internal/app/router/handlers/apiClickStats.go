@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/service"
+	"github.com/Mldlr/url-shortener/internal/app/utils/helpers"
+)
+
+// APIClickStats returns redirect statistics of a shortened URL created by user,
+// grouped by the time bucket from the query.
+func APIClickStats(shortener service.ShortenerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the request context.
+		userID, found := helpers.GetUserID(r)
+		if !found {
+			http.Error(w, "error getting user cookie", http.StatusInternalServerError)
+			return
+		}
+		// Group clicks by day if no bucket is requested.
+		bucket := r.URL.Query().Get("bucket")
+		if bucket == "" {
+			bucket = models.BucketDay
+		}
+		stats, err := shortener.ClickStats(r.Context(), userID, chi.URLParam(r, "id"), bucket)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrURLNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, models.ErrNotOwner):
+				http.Error(w, err.Error(), http.StatusForbidden)
+			case errors.Is(err, models.ErrInvalidBucket):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(stats); err != nil {
+			http.Error(w, "error building the response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
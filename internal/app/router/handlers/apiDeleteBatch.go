@@ -10,6 +10,12 @@ import (
 	"github.com/Mldlr/url-shortener/internal/app/utils/helpers"
 )
 
+// deleteBatchResponse is the body of the response to a batch delete request.
+type deleteBatchResponse struct {
+	// JobID is the ID of the job deleting the urls.
+	JobID string `json:"job_id"`
+}
+
 // APIDeleteBatch processes a batch request to delete multiple shortened URLs.
 func APIDeleteBatch(shortener service.ShortenerService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -33,9 +39,14 @@ func APIDeleteBatch(shortener service.ShortenerService) http.HandlerFunc {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		shortener.DeleteBatch(urlIDs, userID)
+		job, err := shortener.DeleteBatch(r.Context(), urlIDs, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 		// Return an accepted status to indicate that the request has been
-		// received and is being processed.
-		w.WriteHeader(http.StatusAccepted)
+		// received and is being processed, the job shows its result.
+		w.Header().Set("Location", "/api/user/jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, deleteBatchResponse{JobID: job.ID})
 	}
 }
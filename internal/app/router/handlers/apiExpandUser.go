@@ -4,14 +4,23 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/Mldlr/url-shortener/internal/app/models"
 	"github.com/Mldlr/url-shortener/internal/app/service"
+	"github.com/Mldlr/url-shortener/internal/app/utils/encoders"
 	"github.com/Mldlr/url-shortener/internal/app/utils/helpers"
 )
 
+// maxPageLimit is the maximal number of URLs returned in one page.
+const maxPageLimit = 1000
+
 // APIUserExpand retrieves the list of shortened URLs
 // created by a user and returns them as a JSON array.
+// The list is paginated with limit and cursor query parameters,
+// sorted by order (asc or desc) and filtered by deleted and q (substring of the original URL).
+// The cursor of the next page is returned in the X-Next-Cursor header.
 func APIUserExpand(shortener service.ShortenerService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get the user ID from the request context.
@@ -21,24 +30,35 @@ func APIUserExpand(shortener service.ShortenerService) http.HandlerFunc {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
+		query, err := parseURLQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		// Get the list of URLs created by user.
-		urls, err := shortener.ExpandUser(r.Context(), userID)
+		page, err := shortener.ExpandUser(r.Context(), userID, query)
 		if err != nil {
-			if !errors.Is(err, models.ErrNoContent) {
+			switch {
+			case errors.Is(err, models.ErrNoContent):
+				http.Error(w, err.Error(), http.StatusNoContent)
+			case errors.Is(err, models.ErrInvalidQuery):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			default:
 				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
 			}
-			http.Error(w, err.Error(), http.StatusNoContent)
 			return
 		}
-		URLItems := make([]*models.URLItem, len(urls))
-		for i, v := range urls {
+		URLItems := make([]*models.URLItem, len(page.URLs))
+		for i, v := range page.URLs {
 			// Build the full shortened url from new id and service URL.
 			URLItems[i] = &models.URLItem{
 				ShortURL:    shortener.BuildURL(v.ShortURL),
 				OriginalURL: v.LongURL,
 			}
 		}
+		if page.NextCursor != "" {
+			w.Header().Set("X-Next-Cursor", page.NextCursor)
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		if err := json.NewEncoder(w).Encode(URLItems); err != nil {
@@ -47,3 +67,40 @@ func APIUserExpand(shortener service.ShortenerService) http.HandlerFunc {
 		}
 	}
 }
+
+// parseURLQuery reads listing parameters of user URLs from request query.
+func parseURLQuery(values url.Values) (*models.URLQuery, error) {
+	query := &models.URLQuery{Search: values.Get("q")}
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return nil, models.ErrInvalidQuery
+		}
+		query.Limit = limit
+	}
+	if query.Limit > maxPageLimit {
+		query.Limit = maxPageLimit
+	}
+	if v := values.Get("cursor"); v != "" {
+		cursor, err := encoders.DecodeCursor(v)
+		if err != nil {
+			return nil, models.ErrInvalidQuery
+		}
+		query.After = cursor
+	}
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return nil, models.ErrInvalidQuery
+	}
+	if v := values.Get("deleted"); v != "" {
+		deleted, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, models.ErrInvalidQuery
+		}
+		query.Deleted = &deleted
+	}
+	return query, nil
+}
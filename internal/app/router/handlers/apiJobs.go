@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/service"
+	"github.com/Mldlr/url-shortener/internal/app/utils/helpers"
+)
+
+// APIJob returns the state of a delete job requested by user.
+func APIJob(shortener service.ShortenerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, found := helpers.GetUserID(r)
+		if !found {
+			http.Error(w, "error getting user cookie", http.StatusInternalServerError)
+			return
+		}
+		job, err := shortener.Job(r.Context(), userID, chi.URLParam(r, "id"))
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrJobNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/service"
+	"github.com/Mldlr/url-shortener/internal/app/utils/helpers"
+)
+
+// APIUserQuota returns how many urls the user created and how many they can still create.
+func APIUserQuota(shortener service.ShortenerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, found := helpers.GetUserID(r)
+		if !found {
+			http.Error(w, "error getting user cookie", http.StatusInternalServerError)
+			return
+		}
+		usage, err := shortener.Quota(r.Context(), userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeQuota(w, usage)
+	}
+}
+
+// quotaRequest is the body of a request setting the quota of a user.
+type quotaRequest struct {
+	// Daily is the number of URLs the user can create per day, 0 is unlimited.
+	Daily int `json:"daily"`
+	// Total is the number of URLs the user can keep, 0 is unlimited.
+	Total int `json:"total"`
+}
+
+// APISetQuota replaces the configured quota of a user with their own.
+func APISetQuota(shortener service.ShortenerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req quotaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "error reading request", http.StatusBadRequest)
+			return
+		}
+		quota := &models.Quota{UserID: chi.URLParam(r, "id"), Daily: req.Daily, Total: req.Total}
+		usage, err := shortener.SetQuota(r.Context(), quota)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidQuota) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeQuota(w, usage)
+	}
+}
+
+// writeQuota writes usage of a quota as the response.
+func writeQuota(w http.ResponseWriter, usage *models.QuotaUsage) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(usage); err != nil {
+		http.Error(w, "error building the response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/service"
+	"github.com/Mldlr/url-shortener/internal/app/utils/helpers"
+)
+
+// APIRestoreBatch processes a batch request to restore multiple deleted shortened URLs
+// and returns the number of restored URLs.
+func APIRestoreBatch(shortener service.ShortenerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the request context.
+		userID, found := helpers.GetUserID(r)
+		if !found {
+			http.Error(w, "error getting user cookie", http.StatusInternalServerError)
+			return
+		}
+		// Read the request body
+		body, err := io.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Unmarshal the request body into a slice of URL IDs.
+		var urlIDs []string
+		err = json.Unmarshal(body, &urlIDs)
+		if err != nil || len(urlIDs) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		n, err := shortener.RestoreBatch(r.Context(), urlIDs, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(&models.RestoreResult{Restored: n}); err != nil {
+			http.Error(w, "error building the response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
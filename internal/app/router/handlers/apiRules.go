@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/service"
+	"github.com/Mldlr/url-shortener/internal/app/utils/helpers"
+)
+
+// APIRules returns redirect rules of a shortened URL created by user.
+func APIRules(shortener service.ShortenerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the request context.
+		userID, found := helpers.GetUserID(r)
+		if !found {
+			http.Error(w, "error getting user cookie", http.StatusInternalServerError)
+			return
+		}
+		rules, err := shortener.Rules(r.Context(), userID, chi.URLParam(r, "id"))
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrURLNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, models.ErrNotOwner):
+				http.Error(w, err.Error(), http.StatusForbidden)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		writeRules(w, rules)
+	}
+}
+
+// APISetRules replaces redirect rules of a shortened URL created by user
+// with the JSON list from the request body and returns the stored rules.
+func APISetRules(shortener service.ShortenerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the request context.
+		userID, found := helpers.GetUserID(r)
+		if !found {
+			http.Error(w, "error getting user cookie", http.StatusInternalServerError)
+			return
+		}
+		var rules []*models.RedirectRule
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			http.Error(w, "error reading request", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+		url, err := shortener.SetRules(r.Context(), userID, chi.URLParam(r, "id"), rules)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrInvalidRule), errors.Is(err, models.ErrDestinationBlocked):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, models.ErrURLNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, models.ErrNotOwner):
+				http.Error(w, err.Error(), http.StatusForbidden)
+			case errors.Is(err, models.ErrURLDeleted):
+				http.Error(w, err.Error(), http.StatusGone)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		writeRules(w, url.Rules)
+	}
+}
+
+// writeRules writes redirect rules as a JSON list.
+func writeRules(w http.ResponseWriter, rules []*models.RedirectRule) {
+	if rules == nil {
+		rules = []*models.RedirectRule{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(rules); err != nil {
+		http.Error(w, "error building the response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -33,9 +33,20 @@ func APIShorten(shortener service.ShortenerService) http.HandlerFunc {
 		// Create URL model, and add it to storage.
 		if err != nil {
 			// If there is an error, and its not a duplicate url
-			if errors.Is(err, models.ErrInvalidURL) {
+			if errors.Is(err, models.ErrInvalidURL) || errors.Is(err, models.ErrInvalidAlias) || errors.Is(err, models.ErrInvalidExpiry) ||
+				errors.Is(err, models.ErrInvalidMaxClicks) || errors.Is(err, models.ErrInvalidRule) ||
+				errors.Is(err, models.ErrInvalidVariants) || errors.Is(err, models.ErrInvalidRedirectCode) ||
+				errors.Is(err, models.ErrDestinationBlocked) {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
+			} else if errors.Is(err, models.ErrQuotaExceeded) {
+				// If the user created as many urls as allowed
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+				return
+			} else if errors.Is(err, models.ErrAliasTaken) || errors.Is(err, models.ErrAliasNotApplied) {
+				// If the alias is used by another url or the url is shortened without it
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
 			} else if !errors.Is(err, models.ErrDuplicate) {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
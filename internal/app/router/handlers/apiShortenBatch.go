@@ -32,8 +32,12 @@ func APIShortenBatch(shortener service.ShortenerService) http.HandlerFunc {
 		for i, v := range bodyItems {
 			// Create a new URL model and add it to the URLs map.
 			urls[i] = &models.URL{
-				LongURL: v.OrigURL,
-				UserID:  userID,
+				LongURL:      v.OrigURL,
+				UserID:       userID,
+				ExpiresAt:    v.ExpiresAt,
+				ExpireDays:   v.ExpireDays,
+				MaxClicks:    v.MaxClicks,
+				RedirectCode: v.RedirectCode,
 			}
 		}
 		// Add the URLs to the repository.
@@ -52,12 +56,25 @@ func APIShortenBatch(shortener service.ShortenerService) http.HandlerFunc {
 			statusCode = http.StatusCreated
 		}
 		respItems := make([]models.BatchRespItem, len(bodyItems))
+		var shortened, overQuota int
 		for i, v := range bodyItems {
-			// Create a new response item.
-			respItems[i] = models.BatchRespItem{
-				CorID:    v.CorID,
-				ShortURL: shortener.BuildURL(shortenedURLs[i].ShortURL),
+			// Create a new response item, with the error instead of the short url if it was not shortened.
+			respItems[i] = models.BatchRespItem{CorID: v.CorID}
+			if itemErr := shortenedURLs[i].Err; itemErr != nil {
+				respItems[i].Error = itemErr.Error()
+				if errors.Is(itemErr, models.ErrQuotaExceeded) {
+					overQuota++
+				}
+				continue
 			}
+			respItems[i].ShortURL = shortener.BuildURL(shortenedURLs[i].ShortURL)
+			shortened++
+		}
+		// If no url was shortened because the quota of the user is used up or all of them are invalid.
+		if shortened == 0 && overQuota > 0 {
+			statusCode = http.StatusTooManyRequests
+		} else if shortened == 0 && len(respItems) > 0 {
+			statusCode = http.StatusBadRequest
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(statusCode)
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/service"
+	"github.com/Mldlr/url-shortener/internal/app/utils/helpers"
+)
+
+// APIUpdateURL changes the original URL of a shortened URL created by user
+// and returns the updated URL as JSON.
+func APIUpdateURL(shortener service.ShortenerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the request context.
+		userID, found := helpers.GetUserID(r)
+		if !found {
+			http.Error(w, "error getting user cookie", http.StatusInternalServerError)
+			return
+		}
+		// Decode the request body into a URL struct.
+		var body models.URL
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "error reading request", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+		url, err := shortener.UpdateURL(r.Context(), userID, chi.URLParam(r, "id"), body.LongURL)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrInvalidURL), errors.Is(err, models.ErrDestinationBlocked):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, models.ErrURLNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, models.ErrNotOwner):
+				http.Error(w, err.Error(), http.StatusForbidden)
+			case errors.Is(err, models.ErrURLDeleted):
+				http.Error(w, err.Error(), http.StatusGone)
+			case errors.Is(err, models.ErrDuplicate):
+				// The new target is already shortened by another url.
+				http.Error(w, err.Error(), http.StatusConflict)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		item := &models.URLItem{ShortURL: shortener.BuildURL(url.ShortURL), OriginalURL: url.LongURL}
+		if err := json.NewEncoder(w).Encode(item); err != nil {
+			http.Error(w, "error building the response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// APIURLHistory returns previous original URLs of a shortened URL created by user.
+func APIURLHistory(shortener service.ShortenerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Get the user ID from the request context.
+		userID, found := helpers.GetUserID(r)
+		if !found {
+			http.Error(w, "error getting user cookie", http.StatusInternalServerError)
+			return
+		}
+		history, err := shortener.URLHistory(r.Context(), userID, chi.URLParam(r, "id"))
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrURLNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, models.ErrNotOwner):
+				http.Error(w, err.Error(), http.StatusForbidden)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		if history == nil {
+			history = []*models.URLVersion{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(history); err != nil {
+			http.Error(w, "error building the response", http.StatusInternalServerError)
+			return
+		}
+	}
+}
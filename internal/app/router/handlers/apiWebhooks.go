@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/service"
+	"github.com/Mldlr/url-shortener/internal/app/utils/helpers"
+)
+
+// webhookRequest is the body of a request registering a webhook.
+type webhookRequest struct {
+	// URL is the endpoint events are posted to.
+	URL string `json:"url"`
+	// Events are the types of events sent to the webhook, all of them if empty.
+	Events []string `json:"events"`
+}
+
+// APIAddWebhook registers a webhook of user receiving events of their URLs.
+// The response holds the secret signing payloads, it is not shown again.
+func APIAddWebhook(shortener service.ShortenerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, found := helpers.GetUserID(r)
+		if !found {
+			http.Error(w, "error getting user cookie", http.StatusInternalServerError)
+			return
+		}
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "error reading request", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+		hook, err := shortener.AddWebhook(r.Context(), userID, req.URL, req.Events)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrInvalidWebhook), errors.Is(err, models.ErrDestinationBlocked):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		writeJSON(w, http.StatusCreated, hook)
+	}
+}
+
+// APIWebhooks returns webhooks registered by user.
+func APIWebhooks(shortener service.ShortenerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, found := helpers.GetUserID(r)
+		if !found {
+			http.Error(w, "error getting user cookie", http.StatusInternalServerError)
+			return
+		}
+		hooks, err := shortener.Webhooks(r.Context(), userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if hooks == nil {
+			hooks = []*models.Webhook{}
+		}
+		writeJSON(w, http.StatusOK, hooks)
+	}
+}
+
+// APIDeleteWebhook deletes a webhook registered by user.
+func APIDeleteWebhook(shortener service.ShortenerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, found := helpers.GetUserID(r)
+		if !found {
+			http.Error(w, "error getting user cookie", http.StatusInternalServerError)
+			return
+		}
+		err := shortener.DeleteWebhook(r.Context(), userID, chi.URLParam(r, "id"))
+		if err != nil {
+			if errors.Is(err, models.ErrWebhookNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// APIWebhookDeliveries returns the delivery log of a webhook registered by user.
+func APIWebhookDeliveries(shortener service.ShortenerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, found := helpers.GetUserID(r)
+		if !found {
+			http.Error(w, "error getting user cookie", http.StatusInternalServerError)
+			return
+		}
+		attempts, err := shortener.WebhookDeliveries(r.Context(), userID, chi.URLParam(r, "id"))
+		if err != nil {
+			if errors.Is(err, models.ErrWebhookNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if attempts == nil {
+			attempts = []*models.DeliveryAttempt{}
+		}
+		writeJSON(w, http.StatusOK, attempts)
+	}
+}
+
+// writeJSON writes v as a JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, "error building the response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -3,31 +3,126 @@ package handlers
 import (
 	"errors"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
 
 	"github.com/Mldlr/url-shortener/internal/app/models"
 	"github.com/Mldlr/url-shortener/internal/app/service"
 )
 
 // Expand redirects the client to the original URL associated with the short URL
-// in the request path.
+// in the request path. A password form is served instead for protected URLs,
+// and a preview page for short URLs followed by "+".
 func Expand(shortener service.ShortenerService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get the short URL id from request path.
 		id := strings.Split(r.URL.Path, "/")[1:]
+		// Aliases can't contain "+", so it always requests the preview.
+		if strings.HasSuffix(id[0], "+") {
+			preview(w, r, shortener, strings.TrimSuffix(id[0], "+"))
+			return
+		}
 		// Get the URL from the storage repository.
-		url, err := shortener.Expand(r.Context(), id[0])
+		v := visitor(r)
+		url, err := shortener.Expand(r.Context(), id[0], v)
+		if errors.Is(err, models.ErrURLBlocked) {
+			renderWarning(w, url)
+			return
+		}
+		if errors.Is(err, models.ErrPasswordRequired) {
+			renderPasswordForm(w, id[0], "", http.StatusOK)
+			return
+		}
+		if errors.Is(err, models.ErrURLExhausted) {
+			// The URL is gone as well, but tells the client why.
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		}
 		if err != nil {
-			// If the URL has been deleted, return Gone status.
-			if !errors.Is(err, models.ErrURLDeleted) {
+			// If the URL has been deleted or has expired, return Gone status.
+			if !errors.Is(err, models.ErrURLDeleted) && !errors.Is(err, models.ErrURLExpired) {
 				http.Error(w, err.Error(), http.StatusNotFound)
 				return
 			}
 			w.WriteHeader(http.StatusGone)
 			return
 		}
-		// To redirect the client set the Location header to original URL.
-		w.Header().Set("Location", url.LongURL)
-		w.WriteHeader(http.StatusTemporaryRedirect)
+		redirect(w, r, shortener, id[0], url, v, url.RedirectCode)
+	}
+}
+
+// ExpandPassword checks the password submitted with the form of a protected URL
+// and redirects the client to the original URL if it matches.
+func ExpandPassword(shortener service.ShortenerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		v := visitor(r)
+		url, err := shortener.ExpandPassword(r.Context(), id, r.PostFormValue("password"), v)
+		switch {
+		case errors.Is(err, models.ErrURLBlocked):
+			renderWarning(w, url)
+			return
+		case errors.Is(err, models.ErrPasswordRequired), errors.Is(err, models.ErrWrongPassword):
+			renderPasswordForm(w, id, err.Error(), http.StatusUnauthorized)
+			return
+		case errors.Is(err, models.ErrTooManyAttempts):
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		case errors.Is(err, models.ErrURLDeleted), errors.Is(err, models.ErrURLExpired):
+			w.WriteHeader(http.StatusGone)
+			return
+		case errors.Is(err, models.ErrURLExhausted):
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		// The form was posted, so the client has to follow the redirect with a GET request.
+		redirect(w, r, shortener, id, url, v, http.StatusSeeOther)
+	}
+}
+
+// variantCookie is the cookie keeping a visitor on the variant of a split URL, its path is the short URL.
+const variantCookie = "variant"
+
+// variantCookieAge is the number of seconds a visitor is kept on a variant.
+const variantCookieAge = 30 * 24 * 60 * 60
+
+// visitor describes the request for matching redirect rules, along with the variant assigned to the client before.
+func visitor(r *http.Request) *models.Visitor {
+	v := &models.Visitor{Header: r.Header, Time: time.Now()}
+	if cookie, err := r.Cookie(variantCookie); err == nil {
+		v.Variant, _ = strconv.Atoi(cookie.Value)
+	}
+	return v
+}
+
+// redirect records the redirect of a short URL and redirects the client to the original URL.
+func redirect(w http.ResponseWriter, r *http.Request, shortener service.ShortenerService, id string, url *models.URL, v *models.Visitor, code int) {
+	// Record the redirect.
+	shortener.RecordClick(&models.Click{
+		ShortURL:  id,
+		Time:      time.Now(),
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		IP:        r.Header.Get("X-Real-IP"),
+		Variant:   v.Variant,
+	})
+	// Keep the client on its variant of a sticky split URL.
+	if url.Sticky && v.Variant > 0 {
+		http.SetCookie(w, &http.Cookie{
+			Name:     variantCookie,
+			Value:    strconv.Itoa(v.Variant),
+			Path:     "/" + id,
+			MaxAge:   variantCookieAge,
+			HttpOnly: true,
+		})
 	}
+	// To redirect the client set the Location header to original URL.
+	w.Header().Set("Location", url.LongURL)
+	w.WriteHeader(code)
 }
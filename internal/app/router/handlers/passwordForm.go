@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+)
+
+// passwordForm is the page asking for the password of a protected URL.
+// The form is posted to the absolute unlock path, so it works from the page re-rendered after a wrong password.
+var passwordForm = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Protected link</title>
+</head>
+<body>
+<p>This link is protected by a password.</p>
+{{if .Error}}<p>{{.Error}}</p>
+{{end}}<form method="post" action="/{{.ID}}/unlock">
+<input type="password" name="password" autofocus required>
+<button type="submit">Open</button>
+</form>
+</body>
+</html>
+`))
+
+// renderPasswordForm writes the password form of a protected URL with an optional error.
+func renderPasswordForm(w http.ResponseWriter, id string, formError string, code int) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	err := passwordForm.Execute(w, struct {
+		ID    string
+		Error string
+	}{ID: id, Error: formError})
+	if err != nil {
+		log.Printf("error rendering password form : %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/service"
+)
+
+// previewPage is the page showing where a short URL leads without following it.
+// Only details safe to show to anyone are rendered, the owner of the URL is never shown.
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Link preview</title>
+</head>
+<body>
+{{if .Blocked}}<p>This link has been blocked because it may be harmful.</p>
+{{end}}<p>{{.ShortURL}} leads to</p>
+{{if .Protected}}<p>a destination protected by a password.</p>
+{{else if .Blocked}}<p>{{.Destination}}</p>
+{{else}}<p><a href="{{.Destination}}" rel="nofollow noopener">{{.Destination}}</a></p>
+{{if .Routed}}<p>Some visitors are sent to other destinations depending on their device, language, country or time.</p>
+{{end}}{{end}}<p>Created {{.CreatedAt}}</p>
+{{if .ExpiresAt}}<p>Expires {{.ExpiresAt}}</p>
+{{end}}{{if .Limited}}<p>{{.ClicksLeft}} visits left</p>
+{{end}}</body>
+</html>
+`))
+
+// previewData is the content of the preview page.
+type previewData struct {
+	ShortURL    string
+	Destination string
+	Protected   bool
+	Blocked     bool
+	Routed      bool
+	CreatedAt   string
+	ExpiresAt   string
+	Limited     bool
+	ClicksLeft  int
+}
+
+// preview renders the preview page of the short URL with id instead of redirecting the client.
+func preview(w http.ResponseWriter, r *http.Request, shortener service.ShortenerService, id string) {
+	url, err := shortener.Preview(r.Context(), id)
+	if err != nil {
+		// If the URL has been deleted or has expired, return Gone status.
+		if errors.Is(err, models.ErrURLDeleted) || errors.Is(err, models.ErrURLExpired) {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	data := previewData{
+		ShortURL:    shortener.BuildURL(id),
+		Destination: url.LongURL,
+		Protected:   url.Protected(),
+		Blocked:     url.Blocked,
+		Routed:      len(url.Rules) > 0 || len(url.Variants) > 0,
+		CreatedAt:   url.CreatedAt.UTC().Format(time.RFC1123),
+	}
+	if url.ExpiresAt != nil {
+		data.ExpiresAt = url.ExpiresAt.UTC().Format(time.RFC1123)
+	}
+	if url.MaxClicks > 0 {
+		data.Limited = true
+		data.ClicksLeft = url.MaxClicks - url.Clicks
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err = previewPage.Execute(w, data); err != nil {
+		log.Printf("error rendering preview page : %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/service"
+)
+
+// QRCode returns a QR code image of the short URL in the request path.
+// The format, size and error correction level of the image are read from the query.
+func QRCode(shortener service.ShortenerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		opts := models.QROptions{
+			Format: query.Get("format"),
+			Level:  query.Get("ecc"),
+		}
+		if size := query.Get("size"); size != "" {
+			var err error
+			if opts.Size, err = strconv.Atoi(size); err != nil {
+				http.Error(w, models.ErrInvalidQROptions.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		code, err := shortener.QRCode(r.Context(), chi.URLParam(r, "id"), opts)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrInvalidQROptions):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, models.ErrURLDeleted), errors.Is(err, models.ErrURLExpired):
+				w.WriteHeader(http.StatusGone)
+			case errors.Is(err, models.ErrURLBlocked):
+				http.Error(w, err.Error(), http.StatusForbidden)
+			case errors.Is(err, models.ErrRepoError):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", code.ContentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(code.Image)))
+		w.WriteHeader(http.StatusOK)
+		if _, err = w.Write(code.Image); err != nil {
+			log.Printf("error writing QR code : %v", err)
+		}
+	}
+}
@@ -32,9 +32,13 @@ func Shorten(shortener service.ShortenerService) http.HandlerFunc {
 		// Create URL model, and add it to storage.
 		if err != nil {
 			// If there is an error, and its not a duplicate url
-			if errors.Is(err, models.ErrInvalidURL) {
+			if errors.Is(err, models.ErrInvalidURL) || errors.Is(err, models.ErrDestinationBlocked) {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
+			} else if errors.Is(err, models.ErrQuotaExceeded) {
+				// If the user created as many urls as allowed
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+				return
 			} else if !errors.Is(err, models.ErrDuplicate) {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
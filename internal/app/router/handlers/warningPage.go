@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// warningPage is the page shown instead of redirecting to a URL blocked by an administrator.
+// The destination is shown as text only, so it can't be followed by a click.
+var warningPage = template.Must(template.New("warning").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Blocked link</title>
+</head>
+<body>
+<p>This link has been blocked because it may be harmful.</p>
+{{if .Reason}}<p>Reason: {{.Reason}}</p>
+{{end}}{{if .Destination}}<p>It leads to {{.Destination}}</p>
+{{end}}</body>
+</html>
+`))
+
+// renderWarning writes the warning page of a blocked URL, hiding the destination of a protected one.
+func renderWarning(w http.ResponseWriter, url *models.URL) {
+	destination := url.LongURL
+	if url.Protected() {
+		destination = ""
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusForbidden)
+	err := warningPage.Execute(w, struct {
+		Reason      string
+		Destination string
+	}{Reason: url.BlockReason, Destination: destination})
+	if err != nil {
+		log.Printf("error rendering warning page : %v", err)
+	}
+}
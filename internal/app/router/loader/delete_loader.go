@@ -14,13 +14,18 @@ func NewDeleteLoader(repo storage.Repository) *UserLoader {
 		// Conditions of starting batch delete.
 		MaxBatch: 200,
 		Wait:     5 * time.Second,
-		// Batch delete function that returns the amount of deleted urls.
+		// Batch delete function that returns 1 for each key which deleted its url and 0 for the others.
 		Fetch: func(keys []*models.DeleteURLItem) ([]int, []error) {
-			n, err := repo.DeleteURLs(keys)
-			if err != nil {
-				return []int{n}, []error{err}
+			if _, err := repo.DeleteURLs(keys); err != nil {
+				return nil, []error{err}
 			}
-			return []int{n}, nil
+			deleted := make([]int, len(keys))
+			for i, v := range keys {
+				if v.Deleted {
+					deleted[i] = 1
+				}
+			}
+			return deleted, nil
 		},
 	}
 	return NewUserLoader(deleteLoaderCfg)
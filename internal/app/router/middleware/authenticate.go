@@ -44,7 +44,8 @@ func (a Auth) Authenticate(next http.Handler) http.Handler {
 				Expires: time.Now().Add(time.Hour * 24 * 7),
 				Value:   encoders.HMACString(id, a.Config.SecretKey),
 			}
-			// Sign the user request.
+			// Sign the user request, replacing the cookies sent by the client so handlers only see the new ID.
+			dropCookies(r, "user_id", "signature")
 			r.AddCookie(userID)
 			r.AddCookie(signature)
 			http.SetCookie(w, userID)
@@ -53,3 +54,21 @@ func (a Auth) Authenticate(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// dropCookies removes cookies with the names from the request.
+func dropCookies(r *http.Request, names ...string) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, c := range cookies {
+		keep := true
+		for _, name := range names {
+			if c.Name == name {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			r.AddCookie(c)
+		}
+	}
+}
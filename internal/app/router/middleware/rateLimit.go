@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"github.com/Mldlr/url-shortener/internal/app/ratelimit"
+	"github.com/Mldlr/url-shortener/internal/app/utils/helpers"
+)
+
+// RateLimit is a middleware limiting requests of users and client ips.
+type RateLimit struct {
+	Limits *ratelimit.Limits
+	// Proxies are the trusted proxies, the X-Real-IP header is only taken from them.
+	Proxies []netip.Prefix
+}
+
+// Limit returns a middleware limiting requests of the route class by the user ID cookie and the client ip.
+// It has to run after Authenticate, which replaces user IDs without a valid signature.
+// Requests over the limit get Too Many Requests status with the Retry-After header.
+func (l RateLimit) Limit(class string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !l.Limits.Limited(class) {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := helpers.GetUserID(r)
+			if ok, wait := l.Limits.Allow(class, userID, helpers.ClientIP(r, l.Proxies)); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(ratelimit.RetryAfter(wait)))
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
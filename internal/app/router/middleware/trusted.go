@@ -5,6 +5,7 @@ import (
 	"net/netip"
 
 	"github.com/Mldlr/url-shortener/internal/app/config"
+	"github.com/Mldlr/url-shortener/internal/app/utils/helpers"
 )
 
 // Trusted is a middleware checking if request was made from trusted subnet.
@@ -13,7 +14,8 @@ type Trusted struct {
 }
 
 // TrustedCheck verifies request if it came from the trusted network
-// if request tries to access api/internal/ enpoints
+// if request tries to access api/internal/ enpoints.
+// The address of the connection is checked unless it is a trusted proxy setting X-Real-IP.
 func (t Trusted) TrustCheck(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Check if subnet was provided
@@ -21,15 +23,15 @@ func (t Trusted) TrustCheck(next http.Handler) http.Handler {
 			http.Error(w, "untrusted user", http.StatusForbidden)
 			return
 		}
-		// Get the ip header
-		xRealIP := r.Header.Get("X-Real-IP")
+		// Get the ip of the client, X-Real-IP is only taken from trusted proxies
+		clientIP := helpers.ClientIP(r, t.Config.ProxyPrefixes)
 		// Check if ip is in trusted subnet
-		netip, err := netip.ParseAddr(xRealIP)
+		netip, err := netip.ParseAddr(clientIP)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		if !t.Config.SubnetPrefix.Contains(netip) {
+		if !t.Config.SubnetPrefix.Contains(netip.Unmap()) {
 			http.Error(w, "untrusted user", http.StatusForbidden)
 			return
 		}
@@ -3,6 +3,7 @@ package router
 
 import (
 	"github.com/Mldlr/url-shortener/internal/app/config"
+	"github.com/Mldlr/url-shortener/internal/app/ratelimit"
 	"github.com/Mldlr/url-shortener/internal/app/router/handlers"
 	"github.com/Mldlr/url-shortener/internal/app/router/middleware"
 	"github.com/Mldlr/url-shortener/internal/app/service"
@@ -23,20 +24,39 @@ func NewRouter(shortener service.ShortenerService, c *config.Config) chi.Router
 	r.Use(middleware.Auth{Config: c}.Authenticate)
 	r.Use(chiMiddleware.AllowContentEncoding("gzip"))
 	r.Use(chiMiddleware.Compress(5, "application/json", "text/plain"))
+	// Requests are limited per route class after users are authenticated.
+	limit := middleware.RateLimit{Limits: ratelimit.New(c), Proxies: c.ProxyPrefixes}.Limit
 
 	// Define routes.
 	r.Mount("/debug", chiMiddleware.Profiler())
 	r.Get("/api/user/urls", handlers.APIUserExpand(shortener))
-	r.Post("/api/shorten", handlers.APIShorten(shortener))
-	r.Post("/api/shorten/batch", handlers.APIShortenBatch(shortener))
-	r.Delete("/api/user/urls", handlers.APIDeleteBatch(shortener))
+	r.Get("/api/user/urls/{id}/stats", handlers.APIClickStats(shortener))
+	r.Get("/api/user/urls/{id}/history", handlers.APIURLHistory(shortener))
+	r.Patch("/api/user/urls/{id}", handlers.APIUpdateURL(shortener))
+	r.Get("/api/user/urls/{id}/rules", handlers.APIRules(shortener))
+	r.Put("/api/user/urls/{id}/rules", handlers.APISetRules(shortener))
+	r.Get("/api/user/quota", handlers.APIUserQuota(shortener))
+	r.Get("/api/user/webhooks", handlers.APIWebhooks(shortener))
+	r.Post("/api/user/webhooks", handlers.APIAddWebhook(shortener))
+	r.Delete("/api/user/webhooks/{id}", handlers.APIDeleteWebhook(shortener))
+	r.Get("/api/user/webhooks/{id}/deliveries", handlers.APIWebhookDeliveries(shortener))
+	r.With(limit(ratelimit.ClassCreate)).Post("/api/shorten", handlers.APIShorten(shortener))
+	r.With(limit(ratelimit.ClassCreate)).Post("/api/shorten/batch", handlers.APIShortenBatch(shortener))
+	r.With(limit(ratelimit.ClassDelete)).Delete("/api/user/urls", handlers.APIDeleteBatch(shortener))
+	r.Post("/api/user/urls/restore", handlers.APIRestoreBatch(shortener))
+	r.Get("/api/user/jobs/{id}", handlers.APIJob(shortener))
 	r.Get("/ping", handlers.Ping(shortener))
-	r.Get("/{id}", handlers.Expand(shortener))
-	r.Post("/", handlers.Shorten(shortener))
+	r.With(limit(ratelimit.ClassRedirect)).Get("/{id}", handlers.Expand(shortener))
+	r.With(limit(ratelimit.ClassRedirect)).Post("/{id}/unlock", handlers.ExpandPassword(shortener))
+	r.With(limit(ratelimit.ClassRedirect)).Get("/{id}/qr", handlers.QRCode(shortener))
+	r.With(limit(ratelimit.ClassCreate)).Post("/", handlers.Shorten(shortener))
 	r.Group(func(r chi.Router) {
 		// Define internal route and middleware for it.
+		r.Use(limit(ratelimit.ClassInternal))
 		r.Use(middleware.Trusted{Config: c}.TrustCheck)
 		r.Get("/api/internal/stats", handlers.APIInternalStats(shortener))
+		r.Put("/api/internal/urls/{id}/block", handlers.APIBlockURL(shortener))
+		r.Put("/api/internal/users/{id}/quota", handlers.APISetQuota(shortener))
 	})
 	return r
 }
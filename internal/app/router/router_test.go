@@ -3,17 +3,26 @@ package router
 import (
 	"compress/gzip"
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/netip"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Mldlr/url-shortener/internal/app/config"
+	"github.com/Mldlr/url-shortener/internal/app/events"
+	"github.com/Mldlr/url-shortener/internal/app/models"
 	"github.com/Mldlr/url-shortener/internal/app/service"
 	"github.com/Mldlr/url-shortener/internal/app/storage"
+	"github.com/Mldlr/url-shortener/internal/app/utils/encoders"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -43,6 +52,8 @@ func runRouterTest(t *testing.T, tests []test, db bool) {
 		BaseURL:       "http://localhost:8080",
 		TrustedSubnet: testSubnet,
 		SubnetPrefix:  testPrefix,
+		// Requests of httptest come from 192.0.2.1, so they are made through a trusted proxy.
+		ProxyPrefixes: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
 	}
 	var mockRepo storage.Repository
 	var prefix string
@@ -117,7 +128,7 @@ func TestPostApiCorrect(t *testing.T) {
 			want: want{
 				contentType: "application/json",
 				statusCode:  http.StatusCreated,
-				body:        `{"result":"http://localhost:8080/gjsBFlccqF6"}` + "\n",
+				body:        `{"result":"http://localhost:8080/ub0DmlJ0yi4"}` + "\n",
 				location:    "",
 			},
 		},
@@ -481,7 +492,1434 @@ func TestAPIInternalStats(t *testing.T) {
 				location:    "",
 			},
 		},
+		{
+			name:        "Stats request without X-Real-IP.",
+			compression: "gzip",
+			method:      http.MethodGet,
+			request:     "/api/internal/stats",
+			body:        "",
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  http.StatusForbidden,
+				body:        "untrusted user\n",
+				location:    "",
+			},
+		},
 	}
 	runRouterTest(t, tests, true)
 	runRouterTest(t, tests, false)
 }
+
+func TestApiAlias(t *testing.T) {
+	tests := []test{
+		{
+			name:    "POST api alias",
+			method:  http.MethodPost,
+			request: "/api/shorten",
+			body:    `{"url":"https://github.com/","alias":"q3-report"}`,
+			want: want{
+				contentType: "application/json",
+				statusCode:  http.StatusCreated,
+				body:        `{"result":"http://localhost:8080/q3-report"}` + "\n",
+				location:    "",
+			},
+		},
+		{
+			name:    "GET alias",
+			method:  http.MethodGet,
+			request: "/q3-report",
+			want: want{
+				contentType: "",
+				statusCode:  http.StatusTemporaryRedirect,
+				body:        "",
+				location:    "https://github.com/",
+			},
+		},
+		{
+			name:    "POST api alias taken",
+			method:  http.MethodPost,
+			request: "/api/shorten",
+			body:    `{"url":"https://gitlab.com/","alias":"q3-report"}`,
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  http.StatusConflict,
+				body:        "alias already taken\n",
+				location:    "",
+			},
+		},
+		{
+			name:    "POST api alias of shortened url",
+			method:  http.MethodPost,
+			request: "/api/shorten",
+			body:    `{"url":"https://github.com/","alias":"q4-report"}`,
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  http.StatusConflict,
+				body:        "url already shortened, alias not applied\n",
+				location:    "",
+			},
+		},
+		{
+			name:    "POST api same alias again",
+			method:  http.MethodPost,
+			request: "/api/shorten",
+			body:    `{"url":"https://github.com/","alias":"q3-report"}`,
+			want: want{
+				contentType: "application/json",
+				statusCode:  http.StatusConflict,
+				body:        `{"result":"http://localhost:8080/q3-report"}` + "\n",
+				location:    "",
+			},
+		},
+		{
+			name:    "POST api reserved alias",
+			method:  http.MethodPost,
+			request: "/api/shorten",
+			body:    `{"url":"https://gitlab.com/","alias":"ping"}`,
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  http.StatusBadRequest,
+				body:        "invalid alias\n",
+				location:    "",
+			},
+		},
+	}
+	runRouterTest(t, tests, true)
+	runRouterTest(t, tests, false)
+}
+
+func TestApiExpiry(t *testing.T) {
+	tests := []test{
+		{
+			name:    "POST api with lifetime",
+			method:  http.MethodPost,
+			request: "/api/shorten",
+			body:    `{"url":"https://github.com/","expire_days":7}`,
+			want: want{
+				contentType: "application/json",
+				statusCode:  http.StatusCreated,
+				body:        `{"result":"http://localhost:8080/vRveliyDLz8"}` + "\n",
+				location:    "",
+			},
+		},
+		{
+			name:    "POST api with past expiry",
+			method:  http.MethodPost,
+			request: "/api/shorten",
+			body:    `{"url":"https://gitlab.com/","expires_at":"2020-01-01T00:00:00Z"}`,
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  http.StatusBadRequest,
+				body:        "invalid expiry\n",
+				location:    "",
+			},
+		},
+		{
+			name:    "POST batch with negative lifetime",
+			method:  http.MethodPost,
+			request: "/api/shorten/batch",
+			body:    `[{"correlation_id":"1","original_url":"https://gitlab.com/","expire_days":-1}]`,
+			want: want{
+				contentType: "application/json",
+				statusCode:  http.StatusBadRequest,
+				body:        `[{"correlation_id":"1","error":"invalid expiry"}]` + "\n",
+				location:    "",
+			},
+		},
+	}
+	runRouterTest(t, tests, true)
+	runRouterTest(t, tests, false)
+}
+
+func TestGetExpired(t *testing.T) {
+	cfg := &config.Config{ServerAddress: "localhost:8080", BaseURL: "http://localhost:8080"}
+	repo := storage.NewInMemRepo()
+	expiresAt := time.Now().Add(-time.Minute)
+	_, err := repo.Add(context.Background(), &models.URL{ShortURL: "expired", LongURL: "https://github.com/", ExpiresAt: &expiresAt})
+	require.NoError(t, err)
+	r := NewRouter(service.NewShortenerImpl(repo, cfg), cfg)
+	request := httptest.NewRequest(http.MethodGet, "/expired", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	result := w.Result()
+	defer result.Body.Close()
+	assert.Equal(t, http.StatusGone, result.StatusCode)
+}
+
+func TestAPIClickStats(t *testing.T) {
+	cfg := &config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     []byte("defaultKeyUrlSHoRtenEr"),
+	}
+	repo := storage.NewInMemRepo()
+	shortener := service.NewShortenerImpl(repo, cfg)
+	r := NewRouter(shortener, cfg)
+	owner := "user_id=user1; signature=60e8d0babc58e796ac223a64b5e68b998de7d3b203bc8a859bc0ec15ee66f5f9"
+	stranger := "user_id=user2; signature=bfe70caa6f0a26dbc64e5cd31121cb3d5d13075f60b0663b4328375bc3f47456"
+	serve := func(method, target, cookie string) *http.Response {
+		request := httptest.NewRequest(method, target, strings.NewReader(`{"url":"https://github.com/"}`))
+		request.Header.Set("Cookie", cookie)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w.Result()
+	}
+	result := serve(http.MethodPost, "/api/shorten", owner)
+	require.NoError(t, result.Body.Close())
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+	for i := 0; i < 2; i++ {
+		result = serve(http.MethodGet, "/vRveliyDLz8", stranger)
+		require.NoError(t, result.Body.Close())
+		require.Equal(t, http.StatusTemporaryRedirect, result.StatusCode)
+	}
+	// Write recorded clicks to repository.
+	require.NoError(t, shortener.Close())
+
+	result = serve(http.MethodGet, "/api/user/urls/vRveliyDLz8/stats?bucket=hour", owner)
+	var stats models.ClickStats
+	require.NoError(t, json.NewDecoder(result.Body).Decode(&stats))
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, 2, stats.Total)
+	assert.Len(t, stats.Buckets, 1)
+
+	result = serve(http.MethodGet, "/api/user/urls/vRveliyDLz8/stats", stranger)
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.StatusForbidden, result.StatusCode)
+
+	result = serve(http.MethodGet, "/api/user/urls/vRveliyDLz8/stats?bucket=week", owner)
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, result.StatusCode)
+}
+
+func TestAPIUserURLsPage(t *testing.T) {
+	cfg := &config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     []byte("defaultKeyUrlSHoRtenEr"),
+	}
+	repo := storage.NewInMemRepo()
+	shortener := service.NewShortenerImpl(repo, cfg)
+	r := NewRouter(shortener, cfg)
+	owner := "user_id=user1; signature=60e8d0babc58e796ac223a64b5e68b998de7d3b203bc8a859bc0ec15ee66f5f9"
+	serve := func(method, target, body string) *http.Response {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Cookie", owner)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w.Result()
+	}
+	for _, u := range []string{"https://github.com/", "https://yandex.ru/", "https://gitlab.com/"} {
+		result := serve(http.MethodPost, "/api/shorten", `{"url":"`+u+`"}`)
+		require.NoError(t, result.Body.Close())
+		require.Equal(t, http.StatusCreated, result.StatusCode)
+	}
+	var got []string
+	target := "/api/user/urls?limit=2&order=desc"
+	for target != "" {
+		result := serve(http.MethodGet, target, "")
+		var items []*models.URLItem
+		require.NoError(t, json.NewDecoder(result.Body).Decode(&items))
+		require.NoError(t, result.Body.Close())
+		require.Equal(t, http.StatusOK, result.StatusCode)
+		for _, v := range items {
+			got = append(got, v.OriginalURL)
+		}
+		target = ""
+		if cursor := result.Header.Get("X-Next-Cursor"); cursor != "" {
+			target = "/api/user/urls?limit=2&order=desc&cursor=" + cursor
+		}
+	}
+	assert.Equal(t, []string{"https://gitlab.com/", "https://yandex.ru/", "https://github.com/"}, got)
+
+	result := serve(http.MethodGet, "/api/user/urls?q=YANDEX", "")
+	var items []*models.URLItem
+	require.NoError(t, json.NewDecoder(result.Body).Decode(&items))
+	require.NoError(t, result.Body.Close())
+	require.Len(t, items, 1)
+	assert.Equal(t, "https://yandex.ru/", items[0].OriginalURL)
+
+	result = serve(http.MethodGet, "/api/user/urls?deleted=true", "")
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.StatusNoContent, result.StatusCode)
+
+	result = serve(http.MethodGet, "/api/user/urls?cursor=broken", "")
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, result.StatusCode)
+}
+
+func TestAPIUpdateURL(t *testing.T) {
+	cfg := &config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     []byte("defaultKeyUrlSHoRtenEr"),
+	}
+	repo := storage.NewInMemRepo()
+	shortener := service.NewShortenerImpl(repo, cfg)
+	r := NewRouter(shortener, cfg)
+	owner := "user_id=user1; signature=60e8d0babc58e796ac223a64b5e68b998de7d3b203bc8a859bc0ec15ee66f5f9"
+	stranger := "user_id=user2; signature=bfe70caa6f0a26dbc64e5cd31121cb3d5d13075f60b0663b4328375bc3f47456"
+	serve := func(method, target, cookie, body string) *http.Response {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Cookie", cookie)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w.Result()
+	}
+	result := serve(http.MethodPost, "/api/shorten", owner, `{"url":"https://github.com/"}`)
+	require.NoError(t, result.Body.Close())
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+
+	result = serve(http.MethodPatch, "/api/user/urls/vRveliyDLz8", stranger, `{"url":"https://gitlab.com/"}`)
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.StatusForbidden, result.StatusCode)
+
+	result = serve(http.MethodPatch, "/api/user/urls/unknown", owner, `{"url":"https://gitlab.com/"}`)
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.StatusNotFound, result.StatusCode)
+
+	result = serve(http.MethodPatch, "/api/user/urls/vRveliyDLz8", owner, `{"url":"https://gitlab.com/"}`)
+	var item models.URLItem
+	require.NoError(t, json.NewDecoder(result.Body).Decode(&item))
+	require.NoError(t, result.Body.Close())
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, "https://gitlab.com/", item.OriginalURL)
+
+	result = serve(http.MethodGet, "/vRveliyDLz8", stranger, "")
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, "https://gitlab.com/", result.Header.Get("Location"))
+
+	result = serve(http.MethodGet, "/api/user/urls/vRveliyDLz8/history", owner, "")
+	var history []*models.URLVersion
+	require.NoError(t, json.NewDecoder(result.Body).Decode(&history))
+	require.NoError(t, result.Body.Close())
+	require.Len(t, history, 1)
+	assert.Equal(t, 1, history[0].Version)
+	assert.Equal(t, "https://github.com/", history[0].LongURL)
+}
+
+func TestAPIRestoreBatch(t *testing.T) {
+	cfg := &config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     []byte("defaultKeyUrlSHoRtenEr"),
+	}
+	repo := storage.NewInMemRepo()
+	shortener := service.NewShortenerImpl(repo, cfg)
+	r := NewRouter(shortener, cfg)
+	owner := "user_id=user1; signature=60e8d0babc58e796ac223a64b5e68b998de7d3b203bc8a859bc0ec15ee66f5f9"
+	stranger := "user_id=user2; signature=bfe70caa6f0a26dbc64e5cd31121cb3d5d13075f60b0663b4328375bc3f47456"
+	serve := func(method, target, cookie, body string) *http.Response {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Cookie", cookie)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w.Result()
+	}
+	result := serve(http.MethodPost, "/api/shorten", owner, `{"url":"https://github.com/"}`)
+	require.NoError(t, result.Body.Close())
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+	_, err := repo.DeleteURLs([]*models.DeleteURLItem{{ShortURL: "vRveliyDLz8", UserID: "user1"}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		cookie   string
+		body     string
+		code     int
+		restored int
+	}{
+		{name: "Restore by another user", cookie: stranger, body: `["vRveliyDLz8"]`, code: http.StatusOK, restored: 0},
+		{name: "Restore by owner", cookie: owner, body: `["vRveliyDLz8"]`, code: http.StatusOK, restored: 1},
+		{name: "Restore not deleted", cookie: owner, body: `["vRveliyDLz8"]`, code: http.StatusOK, restored: 0},
+		{name: "Empty request", cookie: owner, body: `[]`, code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := serve(http.MethodPost, "/api/user/urls/restore", tt.cookie, tt.body)
+			defer result.Body.Close()
+			require.Equal(t, tt.code, result.StatusCode)
+			if tt.code != http.StatusOK {
+				return
+			}
+			var res models.RestoreResult
+			require.NoError(t, json.NewDecoder(result.Body).Decode(&res))
+			assert.Equal(t, tt.restored, res.Restored)
+		})
+	}
+	result = serve(http.MethodGet, "/vRveliyDLz8", stranger, "")
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.StatusTemporaryRedirect, result.StatusCode)
+}
+
+func TestPasswordProtected(t *testing.T) {
+	cfg := &config.Config{
+		ServerAddress:    "localhost:8080",
+		BaseURL:          "http://localhost:8080",
+		SecretKey:        []byte("defaultKeyUrlSHoRtenEr"),
+		PasswordAttempts: 2,
+		PasswordWindow:   1,
+	}
+	shortener := service.NewShortenerImpl(storage.NewInMemRepo(), cfg)
+	r := NewRouter(shortener, cfg)
+	serve := func(method, target, contentType, body string) *http.Response {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w.Result()
+	}
+	result := serve(http.MethodPost, "/api/shorten", "application/json", `{"url":"https://github.com/","password":"secret"}`)
+	require.NoError(t, result.Body.Close())
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+
+	// The form is served instead of the redirect.
+	result = serve(http.MethodGet, "/vRveliyDLz8", "", "")
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", result.Header.Get("Content-Type"))
+	assert.Empty(t, result.Header.Get("Location"))
+	assert.Contains(t, string(body), `action="/vRveliyDLz8/unlock"`)
+
+	tests := []struct {
+		name     string
+		password string
+		code     int
+		location string
+	}{
+		{name: "Correct password", password: "secret", code: http.StatusSeeOther, location: "https://github.com/"},
+		{name: "Empty password", password: "", code: http.StatusUnauthorized},
+		{name: "Wrong password", password: "public", code: http.StatusUnauthorized},
+		{name: "Wrong password again", password: "public", code: http.StatusUnauthorized},
+		{name: "Out of attempts", password: "secret", code: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := serve(http.MethodPost, "/vRveliyDLz8/unlock", "application/x-www-form-urlencoded", "password="+tt.password)
+			require.NoError(t, result.Body.Close())
+			assert.Equal(t, tt.code, result.StatusCode)
+			assert.Equal(t, tt.location, result.Header.Get("Location"))
+		})
+	}
+}
+
+func TestPasswordRetry(t *testing.T) {
+	cfg := &config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     []byte("defaultKeyUrlSHoRtenEr"),
+	}
+	shortener := service.NewShortenerImpl(storage.NewInMemRepo(), cfg)
+	r := NewRouter(shortener, cfg)
+	serve := func(method, target, contentType, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w
+	}
+	// action returns the url the form of a page served at target is posted to, resolved like a browser does.
+	action := func(target string, w *httptest.ResponseRecorder) string {
+		m := regexp.MustCompile(`action="([^"]*)"`).FindStringSubmatch(w.Body.String())
+		require.Len(t, m, 2)
+		base, err := url.Parse(target)
+		require.NoError(t, err)
+		ref, err := url.Parse(m[1])
+		require.NoError(t, err)
+		return base.ResolveReference(ref).Path
+	}
+	require.Equal(t, http.StatusCreated, serve(http.MethodPost, "/api/shorten", "application/json", `{"url":"https://github.com/","password":"secret"}`).Code)
+
+	w := serve(http.MethodGet, "/vRveliyDLz8", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	target := action("/vRveliyDLz8", w)
+	assert.Equal(t, "/vRveliyDLz8/unlock", target)
+	w = serve(http.MethodPost, target, "application/x-www-form-urlencoded", "password=public")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	// The page re-rendered after a wrong password posts to the same url.
+	retry := action(target, w)
+	assert.Equal(t, target, retry)
+	w = serve(http.MethodPost, retry, "application/x-www-form-urlencoded", "password=secret")
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "https://github.com/", w.Header().Get("Location"))
+}
+
+func TestMaxClicks(t *testing.T) {
+	cfg := &config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     []byte("defaultKeyUrlSHoRtenEr"),
+	}
+	shortener := service.NewShortenerImpl(storage.NewInMemRepo(), cfg)
+	r := NewRouter(shortener, cfg)
+	serve := func(method, target, body string) *http.Response {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w.Result()
+	}
+	result := serve(http.MethodPost, "/api/shorten", `{"url":"https://github.com/","max_clicks":-1}`)
+	require.NoError(t, result.Body.Close())
+	require.Equal(t, http.StatusBadRequest, result.StatusCode)
+	result = serve(http.MethodPost, "/api/shorten", `{"url":"https://github.com/","max_clicks":2}`)
+	require.NoError(t, result.Body.Close())
+	require.Equal(t, http.StatusCreated, result.StatusCode)
+
+	for i := 0; i < 2; i++ {
+		result = serve(http.MethodGet, "/vRveliyDLz8", "")
+		require.NoError(t, result.Body.Close())
+		assert.Equal(t, http.StatusTemporaryRedirect, result.StatusCode)
+		assert.Equal(t, "https://github.com/", result.Header.Get("Location"))
+	}
+	// An exhausted url is gone, but unlike a deleted one tells why.
+	result = serve(http.MethodGet, "/vRveliyDLz8", "")
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.StatusGone, result.StatusCode)
+	assert.Empty(t, result.Header.Get("Location"))
+	assert.Equal(t, "URL exhausted\n", string(body))
+}
+
+func TestRedirectRules(t *testing.T) {
+	cfg := &config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     []byte("defaultKeyUrlSHoRtenEr"),
+		GeoHeader:     "CF-IPCountry",
+	}
+	shortener := service.NewShortenerImpl(storage.NewInMemRepo(), cfg)
+	r := NewRouter(shortener, cfg)
+	result := httptest.NewRecorder()
+	r.ServeHTTP(result, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"https://example.com/"}`)))
+	require.Equal(t, http.StatusCreated, result.Code)
+	cookies := result.Result().Cookies()
+	require.NoError(t, result.Result().Body.Close())
+	var shortened models.Response
+	require.NoError(t, json.Unmarshal(result.Body.Bytes(), &shortened))
+	id := strings.TrimPrefix(shortened.Result, cfg.BaseURL+"/")
+
+	setRules := func(body string) int {
+		request := httptest.NewRequest(http.MethodPut, "/api/user/urls/"+id+"/rules", strings.NewReader(body))
+		for _, v := range cookies {
+			request.AddCookie(v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusBadRequest, setRules(`[{"device":"tv","target":"https://example.com/tv"}]`))
+	assert.Equal(t, http.StatusBadRequest, setRules(`[{"from":"09:00","target":"https://example.com/day"}]`))
+	require.Equal(t, http.StatusOK, setRules(`[
+		{"device":"ios","target":"https://apps.apple.com/app"},
+		{"device":"android","target":"https://play.google.com/store/apps"},
+		{"language":"de","country":"AT","target":"https://example.com/at"}
+	]`))
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   string
+	}{
+		{
+			name:   "iPhone",
+			header: map[string]string{"User-Agent": "Mozilla/5.0 (iPhone; CPU iPhone OS 16_0 like Mac OS X) Mobile/15E148"},
+			want:   "https://apps.apple.com/app",
+		},
+		{
+			name:   "Android",
+			header: map[string]string{"User-Agent": "Mozilla/5.0 (Linux; Android 13; Pixel 7) Mobile Safari/537.36"},
+			want:   "https://play.google.com/store/apps",
+		},
+		{
+			name:   "German in Austria",
+			header: map[string]string{"Accept-Language": "en;q=0.8, de-AT", "CF-IPCountry": "AT"},
+			want:   "https://example.com/at",
+		},
+		{
+			name:   "German elsewhere",
+			header: map[string]string{"Accept-Language": "de-DE", "CF-IPCountry": "DE"},
+			want:   "https://example.com/",
+		},
+		{
+			name:   "Language not accepted",
+			header: map[string]string{"Accept-Language": "de;q=0", "CF-IPCountry": "AT"},
+			want:   "https://example.com/",
+		},
+		{
+			name: "Desktop",
+			want: "https://example.com/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/"+id, nil)
+			for k, v := range tt.header {
+				request.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+			assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+			assert.Equal(t, tt.want, w.Header().Get("Location"))
+		})
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/api/user/urls/"+id+"/rules", nil)
+	for _, v := range cookies {
+		request.AddCookie(v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	require.Equal(t, http.StatusOK, w.Code)
+	var rules []*models.RedirectRule
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rules))
+	assert.Len(t, rules, 3)
+	assert.Equal(t, http.StatusOK, setRules(`[]`))
+}
+
+func TestSplitTargets(t *testing.T) {
+	cfg := &config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     []byte("defaultKeyUrlSHoRtenEr"),
+	}
+	shortener := service.NewShortenerImpl(storage.NewInMemRepo(), cfg)
+	r := NewRouter(shortener, cfg)
+	owner := "user_id=user1; signature=60e8d0babc58e796ac223a64b5e68b998de7d3b203bc8a859bc0ec15ee66f5f9"
+	serve := func(method, target, cookie, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Cookie", cookie)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w
+	}
+	w := serve(http.MethodPost, "/api/shorten", owner, `{"url":"https://example.com/","variants":[{"url":"https://example.com/a","weight":70}]}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve(http.MethodPost, "/api/shorten", owner,
+		`{"url":"https://example.com/","sticky":true,"variants":[{"url":"https://example.com/a","weight":70},{"url":"https://example.com/b","weight":30}]}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var shortened models.Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &shortened))
+	id := strings.TrimPrefix(shortened.Result, cfg.BaseURL)
+
+	// Visitors without a cookie are split by weight.
+	const redirects = 500
+	targets := make(map[string]int)
+	for i := 0; i < redirects; i++ {
+		w = serve(http.MethodGet, id, "", "")
+		require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		targets[w.Header().Get("Location")]++
+	}
+	assert.Len(t, targets, 2)
+	assert.InDelta(t, 350, targets["https://example.com/a"], 75)
+
+	// A visitor keeps the variant assigned by the first redirect.
+	var variant *http.Cookie
+	for _, v := range w.Result().Cookies() {
+		if v.Name == "variant" {
+			variant = v
+		}
+	}
+	require.NotNil(t, variant)
+	assert.Equal(t, id, variant.Path)
+	location := w.Header().Get("Location")
+	for i := 0; i < 20; i++ {
+		w = serve(http.MethodGet, id, variant.Name+"="+variant.Value, "")
+		require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, location, w.Header().Get("Location"))
+	}
+	// Write recorded clicks to repository.
+	require.NoError(t, shortener.Close())
+
+	w = serve(http.MethodGet, "/api/user/urls"+id+"/stats?bucket=day", owner, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var stats models.ClickStats
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&stats))
+	require.Len(t, stats.Variants, 2)
+	assert.Equal(t, "https://example.com/a", stats.Variants[0].Target)
+	assert.Equal(t, "https://example.com/b", stats.Variants[1].Target)
+	assert.Equal(t, redirects+20, stats.Variants[0].Count+stats.Variants[1].Count)
+}
+
+func TestRedirectCodes(t *testing.T) {
+	cfg := &config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     []byte("defaultKeyUrlSHoRtenEr"),
+		RedirectCode:  http.StatusFound,
+	}
+	shortener := service.NewShortenerImpl(storage.NewInMemRepo(), cfg)
+	r := NewRouter(shortener, cfg)
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+	shorten := func(body string) string {
+		w := serve(http.MethodPost, "/api/shorten", body)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var shortened models.Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &shortened))
+		return strings.TrimPrefix(shortened.Result, cfg.BaseURL)
+	}
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/api/shorten", `{"url":"https://example.com/","redirect_code":303}`).Code)
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{name: "Configured code", body: `{"url":"https://example.com/"}`, code: http.StatusFound},
+		{name: "Moved permanently", body: `{"url":"https://example.com/301","redirect_code":301}`, code: http.StatusMovedPermanently},
+		{name: "Permanent redirect", body: `{"url":"https://example.com/308","redirect_code":308}`, code: http.StatusPermanentRedirect},
+		{name: "Temporary redirect", body: `{"url":"https://example.com/307","redirect_code":307}`, code: http.StatusTemporaryRedirect},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := shorten(tt.body)
+			w := serve(http.MethodGet, id, "")
+			assert.Equal(t, tt.code, w.Code)
+			assert.NotEmpty(t, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestPreview(t *testing.T) {
+	cfg := &config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     []byte("defaultKeyUrlSHoRtenEr"),
+	}
+	repo := storage.NewInMemRepo()
+	shortener := service.NewShortenerImpl(repo, cfg)
+	r := NewRouter(shortener, cfg)
+	owner := "user_id=user1; signature=60e8d0babc58e796ac223a64b5e68b998de7d3b203bc8a859bc0ec15ee66f5f9"
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Cookie", owner)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w
+	}
+	shorten := func(body string) string {
+		w := serve(http.MethodPost, "/api/shorten", body)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var shortened models.Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &shortened))
+		return strings.TrimPrefix(shortened.Result, cfg.BaseURL)
+	}
+	limited := shorten(`{"url":"https://example.com/page?a=1&b=2","max_clicks":1}`)
+	w := serve(http.MethodGet, limited+"+", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Header().Get("Location"))
+	assert.Contains(t, w.Body.String(), `href="https://example.com/page?a=1&amp;b=2"`)
+	assert.Contains(t, w.Body.String(), "1 visits left")
+	assert.NotContains(t, w.Body.String(), "user1")
+	// The preview doesn't use up clicks of the url.
+	assert.Equal(t, http.StatusTemporaryRedirect, serve(http.MethodGet, limited, "").Code)
+
+	protected := shorten(`{"url":"https://example.com/secret","password":"secret"}`)
+	w = serve(http.MethodGet, protected+"+", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "https://example.com/secret")
+
+	_, err := repo.DeleteURLs([]*models.DeleteURLItem{{ShortURL: strings.TrimPrefix(protected, "/"), UserID: "user1"}})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusGone, serve(http.MethodGet, protected+"+", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/unknown+", "").Code)
+}
+
+func TestQRCode(t *testing.T) {
+	cfg := &config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     []byte("defaultKeyUrlSHoRtenEr"),
+	}
+	shortener := service.NewShortenerImpl(storage.NewInMemRepo(), cfg)
+	r := NewRouter(shortener, cfg)
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+	w := serve(http.MethodPost, "/api/shorten", `{"url":"https://example.com/"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var shortened models.Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &shortened))
+	id := strings.TrimPrefix(shortened.Result, cfg.BaseURL)
+
+	tests := []struct {
+		name        string
+		query       string
+		code        int
+		contentType string
+	}{
+		{name: "Default PNG", code: http.StatusOK, contentType: "image/png"},
+		{name: "Sized PNG", query: "?size=512&ecc=H", code: http.StatusOK, contentType: "image/png"},
+		{name: "SVG", query: "?format=svg&ecc=L", code: http.StatusOK, contentType: "image/svg+xml"},
+		{name: "Malformed size", query: "?size=big", code: http.StatusBadRequest},
+		{name: "Size out of range", query: "?size=10000", code: http.StatusBadRequest},
+		{name: "Unknown level", query: "?ecc=Z", code: http.StatusBadRequest},
+		{name: "Unknown format", query: "?format=gif", code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(http.MethodGet, id+"/qr"+tt.query, "")
+			assert.Equal(t, tt.code, w.Code)
+			if tt.contentType != "" {
+				assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+				assert.NotEmpty(t, w.Body.Bytes())
+			}
+		})
+	}
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/unknown/qr", "").Code)
+}
+
+func TestNormalization(t *testing.T) {
+	cfg := &config.Config{
+		ServerAddress:      "localhost:8080",
+		BaseURL:            "http://localhost:8080",
+		SecretKey:          []byte("defaultKeyUrlSHoRtenEr"),
+		NormalizeSortQuery: true,
+		StripParams:        []string{"utm_*"},
+	}
+	shortener := service.NewShortenerImpl(storage.NewInMemRepo(), cfg)
+	r := NewRouter(shortener, cfg)
+	shorten := func(longURL string) (int, string) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"`+longURL+`"}`)))
+		var shortened models.Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &shortened))
+		return w.Code, strings.TrimPrefix(shortened.Result, cfg.BaseURL)
+	}
+	tests := []struct {
+		name     string
+		variants []string
+		target   string
+	}{
+		{
+			name:     "Host and path",
+			variants: []string{"Example.com", "http://example.com/", "HTTP://EXAMPLE.COM:80", "http://example.com/a/.."},
+			target:   "http://example.com/",
+		},
+		{
+			name:     "Query",
+			variants: []string{"https://example.com/p?b=2&a=1", "https://example.com/p?a=1&b=2&utm_source=mail", "https://example.com:443/p?utm_medium=x&b=2&a=1"},
+			target:   "https://example.com/p?a=1&b=2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, id := shorten(tt.variants[0])
+			require.Equal(t, http.StatusCreated, code)
+			for _, v := range tt.variants[1:] {
+				code, duplicate := shorten(v)
+				assert.Equal(t, http.StatusConflict, code, v)
+				assert.Equal(t, id, duplicate, v)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, id, nil))
+			assert.Equal(t, tt.target, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestNormalizationDisabled(t *testing.T) {
+	cfg := &config.Config{
+		ServerAddress:    "localhost:8080",
+		BaseURL:          "http://localhost:8080",
+		SecretKey:        []byte("defaultKeyUrlSHoRtenEr"),
+		DisableNormalize: true,
+	}
+	repo := storage.NewInMemRepo()
+	// A link stored before normalization was added.
+	_, err := repo.Add(context.Background(), &models.URL{ShortURL: "legacy", LongURL: "ya.ru", UserID: "user1"})
+	require.NoError(t, err)
+	shortener := service.NewShortenerImpl(repo, cfg)
+	r := NewRouter(shortener, cfg)
+	shorten := func(longURL string) (int, string) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"`+longURL+`"}`)))
+		var shortened models.Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &shortened))
+		return w.Code, strings.TrimPrefix(shortened.Result, cfg.BaseURL+"/")
+	}
+	// Urls are stored as sent, so they still match the stored link.
+	code, id := shorten("ya.ru")
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, "legacy", id)
+	code, id = shorten("http://ya.ru/")
+	assert.Equal(t, http.StatusCreated, code)
+	assert.NotEqual(t, "legacy", id)
+}
+
+func TestDestinationPolicy(t *testing.T) {
+	blocklist := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(blocklist, []byte("evil.com\n"), 0o600))
+	testPrefix, _ := netip.ParsePrefix("192.168.1.0/24")
+	cfg := &config.Config{
+		ServerAddress:  "localhost:8080",
+		BaseURL:        "http://localhost:8080",
+		SecretKey:      []byte("defaultKeyUrlSHoRtenEr"),
+		TrustedSubnet:  "192.168.1.0/24",
+		SubnetPrefix:   testPrefix,
+		ProxyPrefixes:  []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+		AllowedSchemes: []string{"http", "https"},
+		BlockPrivate:   true,
+		BlocklistFile:  blocklist,
+	}
+	shortener := service.NewShortenerImpl(storage.NewInMemRepo(), cfg)
+	r := NewRouter(shortener, cfg)
+	serve := func(method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		for k, v := range headers {
+			request.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w
+	}
+	rejected := []struct {
+		name    string
+		request string
+		body    string
+	}{
+		{name: "Scheme", request: "/api/shorten", body: `{"url":"ftp://example.com/file"}`},
+		{name: "Loopback", request: "/api/shorten", body: `{"url":"http://127.0.0.1:8080/admin"}`},
+		{name: "Private", request: "/", body: "http://192.168.0.1/"},
+		{name: "Blocked domain", request: "/api/shorten", body: `{"url":"https://login.evil.com/"}`},
+		{name: "Blocked variant", request: "/api/shorten", body: `{"url":"https://example.com/","variants":[{"url":"https://example.com/a","weight":1},{"url":"https://evil.com/","weight":1}]}`},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, tt.request, tt.body, nil).Code)
+		})
+	}
+	// Blocked items of a batch are reported on their own, the others are shortened.
+	w := serve(http.MethodPost, "/api/shorten/batch", `[{"correlation_id":"1","original_url":"https://example.com/batch"},`+
+		`{"correlation_id":"2","original_url":"http://localhost/"},{"correlation_id":"3","original_url":"https://example.com/","max_clicks":-1}]`, nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var items []models.BatchRespItem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &items))
+	require.Len(t, items, 3)
+	assert.NotEmpty(t, items[0].ShortURL)
+	assert.Empty(t, items[1].ShortURL)
+	assert.Contains(t, items[1].Error, models.ErrDestinationBlocked.Error())
+	assert.Equal(t, models.BatchRespItem{CorID: "3", Error: models.ErrInvalidMaxClicks.Error()}, items[2])
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/api/shorten/batch", `[{"correlation_id":"1","original_url":"http://localhost/"}]`, nil).Code)
+
+	w = serve(http.MethodPost, "/api/shorten", `{"url":"https://example.com/"}`, nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var shortened models.Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &shortened))
+	id := strings.TrimPrefix(shortened.Result, cfg.BaseURL)
+
+	trusted := map[string]string{"X-Real-IP": "192.168.1.1"}
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPut, "/api/internal/urls"+id+"/block", `{"blocked":true}`, map[string]string{"X-Real-IP": "10.0.0.1"}).Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPut, "/api/internal/urls"+id+"/block", `{"blocked":true}`, nil).Code)
+	// X-Real-IP of clients connecting directly is ignored.
+	direct := httptest.NewRequest(http.MethodPut, "/api/internal/urls"+id+"/block", strings.NewReader(`{"blocked":true}`))
+	direct.RemoteAddr = "198.51.100.1:1234"
+	direct.Header.Set("X-Real-IP", "192.168.1.1")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, direct)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPut, "/api/internal/urls/unknown/block", `{"blocked":true}`, trusted).Code)
+	w = serve(http.MethodPut, "/api/internal/urls"+id+"/block", `{"blocked":true,"reason":"phishing"}`, trusted)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"blocked":true,"reason":"phishing"}`, w.Body.String())
+
+	w = serve(http.MethodGet, id, "", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Location"))
+	assert.Contains(t, w.Body.String(), "phishing")
+	assert.Contains(t, w.Body.String(), "https://example.com/")
+	assert.NotContains(t, w.Body.String(), "href=")
+	w = serve(http.MethodGet, id+"+", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "blocked")
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, id+"/qr", "", nil).Code)
+
+	w = serve(http.MethodPut, "/api/internal/urls"+id+"/block", `{"blocked":false,"reason":"phishing"}`, trusted)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"blocked":false,"reason":""}`, w.Body.String())
+	assert.Equal(t, http.StatusTemporaryRedirect, serve(http.MethodGet, id, "", nil).Code)
+}
+
+func TestShortenIgnoresState(t *testing.T) {
+	cfg := &config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     []byte("defaultKeyUrlSHoRtenEr"),
+	}
+	r := NewRouter(service.NewShortenerImpl(storage.NewInMemRepo(), cfg), cfg)
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w
+	}
+	// Urls can only be blocked by administrators and deleted by their owners after they are shortened.
+	w := serve(http.MethodPost, "/api/shorten", `{"url":"https://example.com/","blocked":true,"block_reason":"fake warning",`+
+		`"deleted":true,"deleted_at":"2024-01-01T00:00:00Z"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var shortened models.Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &shortened))
+	id := strings.TrimPrefix(shortened.Result, cfg.BaseURL)
+	w = serve(http.MethodGet, id, "")
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "https://example.com/", w.Header().Get("Location"))
+	assert.NotContains(t, serve(http.MethodGet, id+"+", "").Body.String(), "fake warning")
+}
+
+func TestRateLimit(t *testing.T) {
+	cfg := &config.Config{
+		ServerAddress:   "localhost:8080",
+		BaseURL:         "http://localhost:8080",
+		SecretKey:       []byte("defaultKeyUrlSHoRtenEr"),
+		RateLimitCreate: 3,
+		// Requests of httptest come from 192.0.2.1, so they are made through a trusted proxy.
+		TrustedProxies: []string{"192.0.2.0/24"},
+		ProxyPrefixes:  []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+	}
+	shortener := service.NewShortenerImpl(storage.NewInMemRepo(), cfg)
+	r := NewRouter(shortener, cfg)
+	owner := "user_id=user1; signature=60e8d0babc58e796ac223a64b5e68b998de7d3b203bc8a859bc0ec15ee66f5f9"
+	serve := func(method, target, body, cookie, ip string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		if cookie != "" {
+			request.Header.Set("Cookie", cookie)
+		}
+		if ip != "" {
+			request.Header.Set("X-Real-IP", ip)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w
+	}
+	var id string
+	for i := 0; i < 3; i++ {
+		w := serve(http.MethodPost, "/api/shorten", `{"url":"https://example.com/`+strconv.Itoa(i)+`"}`, owner, "")
+		require.Equal(t, http.StatusCreated, w.Code)
+		var shortened models.Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &shortened))
+		id = strings.TrimPrefix(shortened.Result, cfg.BaseURL)
+	}
+	w := serve(http.MethodPost, "/api/shorten/batch", `[{"correlation_id":"1","original_url":"https://example.com/b"}]`, owner, "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "20", w.Header().Get("Retry-After"))
+	// A new user from the same ip is limited by the ip.
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodPost, "/", "https://example.com/c", "", "").Code)
+	// The user is limited from other ips too.
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodPost, "/", "https://example.com/c", owner, "10.0.0.1").Code)
+	assert.Equal(t, http.StatusCreated, serve(http.MethodPost, "/", "https://example.com/c", "", "10.0.0.1").Code)
+	// An unsigned user ID isn't limited as the user.
+	assert.Equal(t, http.StatusCreated, serve(http.MethodPost, "/", "https://example.com/d", "user_id=user1", "10.0.0.3").Code)
+	// X-Real-IP of clients connecting directly is ignored, so they are limited by their own address.
+	direct := func(body string) int {
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		request.RemoteAddr = "198.51.100.1:1234"
+		request.Header.Set("X-Real-IP", "10.0.0.2")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w.Code
+	}
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusCreated, direct("https://example.com/e"+strconv.Itoa(i)))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, direct("https://example.com/f"))
+	assert.Equal(t, http.StatusCreated, serve(http.MethodPost, "/", "https://example.com/f", "", "10.0.0.2").Code)
+	// Other route classes aren't limited.
+	assert.Equal(t, http.StatusTemporaryRedirect, serve(http.MethodGet, id, "", owner, "").Code)
+	// The trusted subnet doesn't make proxies trusted.
+	cfg.TrustedSubnet = "192.0.2.0/24"
+	cfg.SubnetPrefix = netip.MustParsePrefix("192.0.2.0/24")
+	cfg.TrustedProxies, cfg.ProxyPrefixes = nil, nil
+	r = NewRouter(service.NewShortenerImpl(storage.NewInMemRepo(), cfg), cfg)
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusCreated, serve(http.MethodPost, "/", "https://example.com/g"+strconv.Itoa(i), "", "10.0.0.4").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodPost, "/", "https://example.com/h", "", "10.0.0.5").Code)
+}
+
+func TestQuota(t *testing.T) {
+	testPrefix, _ := netip.ParsePrefix("192.168.1.0/24")
+	cfg := &config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     []byte("defaultKeyUrlSHoRtenEr"),
+		TrustedSubnet: "192.168.1.0/24",
+		SubnetPrefix:  testPrefix,
+		ProxyPrefixes: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+		QuotaDaily:    3,
+	}
+	shortener := service.NewShortenerImpl(storage.NewInMemRepo(), cfg)
+	r := NewRouter(shortener, cfg)
+	owner := "user_id=user1; signature=60e8d0babc58e796ac223a64b5e68b998de7d3b203bc8a859bc0ec15ee66f5f9"
+	serve := func(method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		for k, v := range headers {
+			request.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w
+	}
+	user := map[string]string{"Cookie": owner}
+	quota := func() *models.QuotaUsage {
+		w := serve(http.MethodGet, "/api/user/quota", "", user)
+		require.Equal(t, http.StatusOK, w.Code)
+		var usage models.QuotaUsage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &usage))
+		return &usage
+	}
+
+	usage := quota()
+	assert.Equal(t, 3, usage.Daily.Limit)
+	assert.Zero(t, usage.Daily.Used)
+	require.NotNil(t, usage.Daily.Remaining)
+	assert.Equal(t, 3, *usage.Daily.Remaining)
+	assert.Nil(t, usage.Total.Remaining)
+	assert.True(t, usage.ResetsAt.After(time.Now()))
+
+	require.Equal(t, http.StatusCreated, serve(http.MethodPost, "/api/shorten", `{"url":"https://example.com/1"}`, user).Code)
+	// The batch is accepted up to the quota.
+	w := serve(http.MethodPost, "/api/shorten/batch", `[{"correlation_id":"1","original_url":"not a url"},`+
+		`{"correlation_id":"2","original_url":"https://example.com/2"},{"correlation_id":"3","original_url":"https://example.com/3"},`+
+		`{"correlation_id":"4","original_url":"https://example.com/4"},{"correlation_id":"5","original_url":"https://example.com/2"}]`, user)
+	require.Equal(t, http.StatusConflict, w.Code)
+	var items []models.BatchRespItem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &items))
+	require.Len(t, items, 5)
+	assert.Equal(t, models.BatchRespItem{CorID: "1", Error: models.ErrInvalidURL.Error()}, items[0])
+	assert.NotEmpty(t, items[1].ShortURL)
+	assert.NotEmpty(t, items[2].ShortURL)
+	assert.Equal(t, models.BatchRespItem{CorID: "4", Error: models.ErrQuotaExceeded.Error()}, items[3])
+	// Repeating a url of the batch doesn't use the quota.
+	assert.Equal(t, items[1].ShortURL, items[4].ShortURL)
+	stored := items[2].ShortURL
+
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodPost, "/", "https://example.com/5", user).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodPost, "/api/shorten/batch", `[{"correlation_id":"5","original_url":"https://example.com/5"}]`, user).Code)
+	// Stored urls are still answered with the quota used up.
+	w = serve(http.MethodPost, "/", "https://example.com/1", user)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.NotEmpty(t, w.Body.String())
+	w = serve(http.MethodPost, "/api/shorten/batch", `[{"correlation_id":"6","original_url":"https://example.com/3"},`+
+		`{"correlation_id":"7","original_url":"https://example.com/5"}]`, user)
+	require.Equal(t, http.StatusConflict, w.Code)
+	items = nil
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &items))
+	require.Len(t, items, 2)
+	assert.Equal(t, stored, items[0].ShortURL)
+	assert.Equal(t, models.BatchRespItem{CorID: "7", Error: models.ErrQuotaExceeded.Error()}, items[1])
+	usage = quota()
+	assert.Equal(t, 3, usage.Daily.Used)
+	assert.Equal(t, 3, usage.Total.Used)
+	assert.Equal(t, 0, *usage.Daily.Remaining)
+	// Other users have their own quota.
+	assert.Equal(t, http.StatusCreated, serve(http.MethodPost, "/", "https://example.com/5", nil).Code)
+
+	trusted := map[string]string{"X-Real-IP": "192.168.1.1"}
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPut, "/api/internal/users/user1/quota", `{"daily":5}`, map[string]string{"X-Real-IP": "10.0.0.1"}).Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPut, "/api/internal/users/user1/quota", `{"daily":5}`, nil).Code)
+	// X-Real-IP of clients connecting directly is ignored.
+	direct := httptest.NewRequest(http.MethodPut, "/api/internal/users/user1/quota", strings.NewReader(`{"daily":0,"total":0}`))
+	direct.RemoteAddr = "198.51.100.1:1234"
+	direct.Header.Set("X-Real-IP", "192.168.1.1")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, direct)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, "/api/internal/users/user1/quota", `{"daily":-1}`, trusted).Code)
+	w = serve(http.MethodPut, "/api/internal/users/user1/quota", `{"daily":5,"total":4}`, trusted)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &usage))
+	assert.Equal(t, 2, *usage.Daily.Remaining)
+	assert.Equal(t, 1, *usage.Total.Remaining)
+	assert.Equal(t, http.StatusCreated, serve(http.MethodPost, "/", "https://example.com/6", user).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodPost, "/", "https://example.com/7", user).Code)
+}
+
+func TestWebhooks(t *testing.T) {
+	type received struct {
+		event     models.Event
+		signature string
+		timestamp string
+		body      string
+	}
+	events := make(chan received, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var event models.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		events <- received{event: event, signature: r.Header.Get("X-Webhook-Signature"),
+			timestamp: r.Header.Get("X-Webhook-Timestamp"), body: string(body)}
+	}))
+	defer receiver.Close()
+	cfg := &config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     []byte("defaultKeyUrlSHoRtenEr"),
+	}
+	shortener := service.NewShortenerImpl(storage.NewInMemRepo(), cfg)
+	defer shortener.Close()
+	r := NewRouter(shortener, cfg)
+	owner := "user_id=user1; signature=60e8d0babc58e796ac223a64b5e68b998de7d3b203bc8a859bc0ec15ee66f5f9"
+	serve := func(method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		for k, v := range headers {
+			request.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w
+	}
+	user := map[string]string{"Cookie": owner}
+
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/api/user/webhooks", `{"url":"ftp://example.com"}`, user).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/api/user/webhooks", `{"url":"`+receiver.URL+`","events":["link.updated"]}`, user).Code)
+	w := serve(http.MethodPost, "/api/user/webhooks", `{"url":"`+receiver.URL+`"}`, user)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var hook models.Webhook
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &hook))
+	assert.Equal(t, receiver.URL, hook.URL)
+	require.NotEmpty(t, hook.Secret)
+	// The secret is only shown when the webhook is registered.
+	w = serve(http.MethodGet, "/api/user/webhooks", "", user)
+	require.Equal(t, http.StatusOK, w.Code)
+	var hooks []*models.Webhook
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &hooks))
+	require.Len(t, hooks, 1)
+	assert.Equal(t, hook.ID, hooks[0].ID)
+	assert.Empty(t, hooks[0].Secret)
+
+	next := func() received {
+		select {
+		case e := <-events:
+			// Payloads are signed with the secret of the webhook.
+			assert.Equal(t, "sha256="+encoders.HMACString(e.timestamp+"."+e.body, []byte(hook.Secret)), e.signature)
+			return e
+		case <-time.After(10 * time.Second):
+			require.FailNow(t, "event not delivered")
+			return received{}
+		}
+	}
+	w = serve(http.MethodPost, "/api/shorten", `{"url":"https://example.com/hooked"}`, user)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp models.Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	id := strings.TrimPrefix(resp.Result, cfg.BaseURL+"/")
+	e := next()
+	assert.Equal(t, models.EventLinkCreated, e.event.Type)
+	assert.Equal(t, id, e.event.ShortURL)
+	assert.Equal(t, "https://example.com/hooked", e.event.LongURL)
+	// Duplicates are not created again.
+	require.Equal(t, http.StatusConflict, serve(http.MethodPost, "/api/shorten", `{"url":"https://example.com/hooked"}`, user).Code)
+
+	require.Equal(t, http.StatusTemporaryRedirect, serve(http.MethodGet, "/"+id, "", nil).Code)
+	e = next()
+	assert.Equal(t, models.EventLinkClicked, e.event.Type)
+	assert.Equal(t, id, e.event.ShortURL)
+
+	require.Equal(t, http.StatusAccepted, serve(http.MethodDelete, "/api/user/urls", `["`+id+`"]`, user).Code)
+	e = next()
+	assert.Equal(t, models.EventLinkDeleted, e.event.Type)
+	assert.Equal(t, id, e.event.ShortURL)
+
+	// Attempts are logged once the receiver responds.
+	var log []*models.DeliveryAttempt
+	require.Eventually(t, func() bool {
+		w = serve(http.MethodGet, "/api/user/webhooks/"+hook.ID+"/deliveries", "", user)
+		return w.Code == http.StatusOK && json.Unmarshal(w.Body.Bytes(), &log) == nil && len(log) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, models.EventLinkCreated, log[0].EventType)
+	assert.Equal(t, models.DeliveryDelivered, log[0].Status)
+	assert.Equal(t, http.StatusOK, log[0].StatusCode)
+	// Webhooks of other users can't be seen or deleted.
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/api/user/webhooks/"+hook.ID+"/deliveries", "", nil).Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodDelete, "/api/user/webhooks/"+hook.ID, "", nil).Code)
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/api/user/webhooks/"+hook.ID, "", user).Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/api/user/webhooks/"+hook.ID+"/deliveries", "", user).Code)
+	assert.Empty(t, events)
+}
+
+func TestWebhooksFullEventQueue(t *testing.T) {
+	received := make(chan models.Event, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event models.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- event
+	}))
+	defer receiver.Close()
+	cfg := &config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     []byte("defaultKeyUrlSHoRtenEr"),
+		EventQueue:    1,
+		EventPolicy:   "drop",
+	}
+	shortener := service.NewShortenerImpl(storage.NewInMemRepo(), cfg)
+	defer shortener.Close()
+	// A stuck subscriber fills its queue, so the bus drops events published after the first ones.
+	release := make(chan struct{})
+	defer close(release)
+	stuck := shortener.Events().Subscribe("stuck", func(events.Event) { <-release }, events.NameLinkCreated)
+	r := NewRouter(shortener, cfg)
+	owner := "user_id=user1; signature=60e8d0babc58e796ac223a64b5e68b998de7d3b203bc8a859bc0ec15ee66f5f9"
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Cookie", owner)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w
+	}
+	require.Equal(t, http.StatusCreated, serve(http.MethodPost, "/api/user/webhooks", `{"url":"`+receiver.URL+`","events":["link.created"]}`).Code)
+	for i := 0; i < 5; i++ {
+		require.Equal(t, http.StatusCreated, serve(http.MethodPost, "/api/shorten", `{"url":"https://example.com/`+strconv.Itoa(i)+`"}`).Code)
+	}
+	assert.NotZero(t, stuck.Dropped())
+	// Webhooks get every event anyway.
+	for i := 0; i < 5; i++ {
+		select {
+		case e := <-received:
+			assert.Equal(t, models.EventLinkCreated, e.Type)
+		case <-time.After(10 * time.Second):
+			require.FailNow(t, "event not delivered")
+		}
+	}
+}
+
+func TestDeleteJobs(t *testing.T) {
+	cfg := &config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     []byte("defaultKeyUrlSHoRtenEr"),
+	}
+	repo := storage.NewInMemRepo()
+	shortener := service.NewShortenerImpl(repo, cfg)
+	r := NewRouter(shortener, cfg)
+	owner := "user_id=user1; signature=60e8d0babc58e796ac223a64b5e68b998de7d3b203bc8a859bc0ec15ee66f5f9"
+	stranger := "user_id=user2; signature=bfe70caa6f0a26dbc64e5cd31121cb3d5d13075f60b0663b4328375bc3f47456"
+	serve := func(method, target, cookie, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("Cookie", cookie)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w
+	}
+	shorten := func(cookie, url string) string {
+		w := serve(http.MethodPost, "/api/shorten", cookie, `{"url":"`+url+`"}`)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var resp models.Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return strings.TrimPrefix(resp.Result, cfg.BaseURL+"/")
+	}
+	own := shorten(owner, "https://example.com/own")
+	foreign := shorten(stranger, "https://example.com/foreign")
+
+	w := serve(http.MethodDelete, "/api/user/urls", owner, `["`+own+`","`+foreign+`","missing"]`)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var resp struct {
+		JobID string `json:"job_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.NotEmpty(t, resp.JobID)
+	assert.Equal(t, "/api/user/jobs/"+resp.JobID, w.Header().Get("Location"))
+
+	var job models.Job
+	w = serve(http.MethodGet, "/api/user/jobs/"+resp.JobID, owner, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, models.JobPending, job.Status)
+	assert.Equal(t, []string{own, foreign, "missing"}, job.IDs)
+	// Jobs of other users can't be seen.
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/api/user/jobs/"+resp.JobID, stranger, "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/api/user/jobs/unknown", owner, "").Code)
+
+	// Close waits for the job, its result is kept in the repository.
+	require.NoError(t, shortener.Close())
+	shortener = service.NewShortenerImpl(repo, cfg)
+	defer shortener.Close()
+	r = NewRouter(shortener, cfg)
+	w = serve(http.MethodGet, "/api/user/jobs/"+resp.JobID, owner, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	job = models.Job{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, models.JobDone, job.Status)
+	assert.Equal(t, 1, job.Deleted)
+	assert.Equal(t, []models.JobFailure{
+		{ID: foreign, Error: models.ErrNotOwner.Error()},
+		{ID: "missing", Error: models.ErrURLNotFound.Error()},
+	}, job.Failures)
+	require.NotNil(t, job.FinishedAt)
+	assert.Equal(t, http.StatusGone, serve(http.MethodGet, "/"+own, "", "").Code)
+}
+
+func TestDeleteJobsRestart(t *testing.T) {
+	cfg := &config.Config{
+		ServerAddress: "localhost:8080",
+		BaseURL:       "http://localhost:8080",
+		SecretKey:     []byte("defaultKeyUrlSHoRtenEr"),
+	}
+	ctx := context.Background()
+	repo := storage.NewInMemRepo()
+	for _, v := range []string{"left", "shared", "held"} {
+		_, err := repo.Add(ctx, &models.URL{ShortURL: v, LongURL: "https://example.com/" + v, UserID: "user1"})
+		require.NoError(t, err)
+	}
+	// A job left pending by a previous run is resumed on start.
+	require.NoError(t, repo.SaveJob(ctx, &models.Job{ID: "pending", UserID: "user1", Status: models.JobPending,
+		IDs: []string{"left"}, CreatedAt: time.Now()}))
+	// A job held by a running instance is left to it.
+	leaseUntil := time.Now().Add(time.Hour)
+	require.NoError(t, repo.SaveJob(ctx, &models.Job{ID: "held", UserID: "user1", Status: models.JobPending,
+		IDs: []string{"held"}, CreatedAt: time.Now(), Owner: "other", LeaseUntil: &leaseUntil}))
+	shortener := service.NewShortenerImpl(repo, cfg)
+	r := NewRouter(shortener, cfg)
+	owner := "user_id=user1; signature=60e8d0babc58e796ac223a64b5e68b998de7d3b203bc8a859bc0ec15ee66f5f9"
+	// Jobs deleting the same url count it once.
+	jobIDs := make([]string, 2)
+	for i := range jobIDs {
+		request := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(`["shared"]`))
+		request.Header.Set("Cookie", owner)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		require.Equal(t, http.StatusAccepted, w.Code)
+		var resp struct {
+			JobID string `json:"job_id"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		jobIDs[i] = resp.JobID
+	}
+	require.NoError(t, shortener.Close())
+
+	job, err := repo.GetJob(ctx, "pending")
+	require.NoError(t, err)
+	require.NotNil(t, job)
+	assert.Equal(t, models.JobDone, job.Status)
+	assert.Equal(t, 1, job.Deleted)
+	job, err = repo.GetJob(ctx, "held")
+	require.NoError(t, err)
+	require.NotNil(t, job)
+	assert.Equal(t, models.JobPending, job.Status)
+	url, err := repo.Get(ctx, "held")
+	require.NoError(t, err)
+	assert.False(t, url.Deleted)
+	var deleted int
+	for _, v := range jobIDs {
+		job, err = repo.GetJob(ctx, v)
+		require.NoError(t, err)
+		require.NotNil(t, job)
+		assert.Equal(t, models.JobDone, job.Status)
+		deleted += job.Deleted
+	}
+	assert.Equal(t, 1, deleted)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -12,7 +13,6 @@ import (
 	"time"
 
 	"github.com/Mldlr/url-shortener/internal/app/config"
-	"github.com/Mldlr/url-shortener/internal/app/storage"
 	"github.com/Mldlr/url-shortener/internal/app/tls"
 	"github.com/go-chi/chi/v5"
 )
@@ -68,8 +68,9 @@ func (s *Server) Run() {
 	log.Println("shutdown finished")
 }
 
-// WaitForExitingSignal waits for a signal to exit the server and shutdowns it
-func (s *Server) WaitForExitingSignal(timeout time.Duration, r storage.Repository) {
+// WaitForExitingSignal waits for a signal to exit the server and shutdowns it,
+// closing the given resources in order
+func (s *Server) WaitForExitingSignal(timeout time.Duration, closers ...io.Closer) {
 	var waiter = make(chan os.Signal, 1)
 	signal.Notify(waiter, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 
@@ -78,8 +79,10 @@ func (s *Server) WaitForExitingSignal(timeout time.Duration, r storage.Repositor
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	if err := r.Close(); err != nil {
-		log.Printf("failed to close repo: %v", err)
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			log.Printf("failed to close %T: %v", c, err)
+		}
 	}
 
 	err := s.srv.Shutdown(ctx)
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// attemptLimiter limits wrong passwords submitted for protected urls.
+// Wrong passwords of a url are counted in fixed windows starting with the first one.
+type attemptLimiter struct {
+	// max is the number of wrong passwords accepted per window.
+	max int
+	// window is the duration wrong passwords are counted for.
+	window time.Duration
+	// failures maps short urls to their windows of wrong passwords.
+	failures map[string]*attemptWindow
+	// Mutex synchronizes access to failures.
+	sync.Mutex
+}
+
+// attemptWindow counts wrong passwords of a url.
+type attemptWindow struct {
+	// start is the time of the first wrong password.
+	start time.Time
+	// count is the number of wrong passwords since start.
+	count int
+}
+
+// newAttemptLimiter creates a limiter accepting max wrong passwords per window.
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		max:      max,
+		window:   window,
+		failures: make(map[string]*attemptWindow),
+	}
+}
+
+// Blocked checks if the url has run out of attempts at now.
+func (l *attemptLimiter) Blocked(id string, now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+	w := l.current(id, now)
+	return w != nil && w.count >= l.max
+}
+
+// Fail records a wrong password of the url at now.
+func (l *attemptLimiter) Fail(id string, now time.Time) {
+	l.Lock()
+	defer l.Unlock()
+	w := l.current(id, now)
+	if w == nil {
+		w = &attemptWindow{start: now}
+		l.failures[id] = w
+	}
+	w.count++
+}
+
+// current returns the window of the url active at now, dropping an ended one.
+func (l *attemptLimiter) current(id string, now time.Time) *attemptWindow {
+	w, ok := l.failures[id]
+	if !ok {
+		return nil
+	}
+	if now.Sub(w.start) >= l.window {
+		delete(l.failures, id)
+		return nil
+	}
+	return w
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"log"
+
+	"github.com/Mldlr/url-shortener/internal/app/config"
+	"github.com/Mldlr/url-shortener/internal/app/events"
+)
+
+// Defaults of the event bus when config is not provided.
+const (
+	defaultEventQueue  = 1024
+	defaultEventPolicy = events.Drop
+)
+
+// newEventBus creates the bus of domain events from config.
+func newEventBus(cfg *config.Config) *events.Bus {
+	queue, policy := defaultEventQueue, defaultEventPolicy
+	if cfg != nil && cfg.EventQueue > 0 {
+		queue = cfg.EventQueue
+	}
+	if cfg != nil && cfg.EventPolicy != "" {
+		p, err := events.ParsePolicy(cfg.EventPolicy)
+		if err != nil {
+			log.Printf("%v, dropping events of full queues", err)
+		} else {
+			policy = p
+		}
+	}
+	return events.NewBus(queue, policy)
+}
+
+// Events returns the bus the service publishes domain events to, so other components can subscribe to them.
+func (s *ShortenerImpl) Events() *events.Bus {
+	return s.events
+}
+
+// logDeletes logs results of batch deletes.
+func logDeletes(event events.Event) {
+	e, ok := event.(events.BatchDeleted)
+	if !ok {
+		return
+	}
+	if e.Err != nil {
+		log.Printf("error deleting urls of %s in job %s : %v", e.UserID, e.JobID, e.Err)
+	}
+	log.Printf("deleted %v urls in job %s", e.Deleted, e.JobID)
+}
+
+// publishLink adds an event of a link to the webhook outbox before publishing it to the bus.
+// Webhooks don't subscribe to the bus, so their deliveries are stored even if a full queue drops the event.
+func (s *ShortenerImpl) publishLink(event events.Event) {
+	s.deliverEvent(event)
+	s.events.Publish(event)
+}
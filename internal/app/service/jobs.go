@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/events"
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// errNotDeleted is the failure of a url which was deletable but is not deleted after the job.
+var errNotDeleted = errors.New("URL not deleted")
+
+// newJobID returns a random ID of a delete job.
+func newJobID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Job gets a delete job requested by user.
+func (s *ShortenerImpl) Job(ctx context.Context, userID string, id string) (*models.Job, error) {
+	job, err := s.repo.GetJob(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+	}
+	if job == nil || job.UserID != userID {
+		return nil, models.ErrJobNotFound
+	}
+	return job, nil
+}
+
+// jobLease is the time a delete job is held by the instance running it, other instances can claim it afterwards.
+// Instances look for jobs left by stopped ones as often.
+const jobLease = 10 * time.Minute
+
+// startJob runs a delete job in a goroutine unless the instance runs it already, Close waits for it.
+func (s *ShortenerImpl) startJob(job *models.Job) {
+	s.runningMu.Lock()
+	defer s.runningMu.Unlock()
+	if s.running[job.ID] {
+		return
+	}
+	s.running[job.ID] = true
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		s.runDeleteJob(job)
+		s.runningMu.Lock()
+		delete(s.running, job.ID)
+		s.runningMu.Unlock()
+	}()
+}
+
+// watchJobs resumes delete jobs left pending by stopped instances on start and then every jobLease until Close.
+func (s *ShortenerImpl) watchJobs() {
+	s.resumeJobs()
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		ticker := time.NewTicker(jobLease)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+				s.resumeJobs()
+			}
+		}
+	}()
+}
+
+// resumeJobs claims the pending delete jobs no instance holds and runs them.
+// Claims are atomic, so instances sharing the storage don't run the same job.
+// Urls the interrupted run already deleted are reported as deleted before the job.
+func (s *ShortenerImpl) resumeJobs() {
+	jobs, err := s.repo.ClaimJobs(context.Background(), s.instance, time.Now(), jobLease)
+	if err != nil {
+		log.Printf("error claiming pending delete jobs : %v", err)
+		return
+	}
+	for _, v := range jobs {
+		log.Printf("resuming delete job %s", v.ID)
+		s.startJob(v)
+	}
+}
+
+// runDeleteJob deletes the urls of a pending job and saves its result.
+// Urls which can't be deleted by the user are recorded as failures without being sent for deletion.
+func (s *ShortenerImpl) runDeleteJob(job *models.Job) {
+	ctx := context.Background()
+	live, failures := s.deletableURLs(ctx, job.IDs, job.UserID)
+	var err error
+	if len(live) > 0 {
+		items := make([]*models.DeleteURLItem, len(live))
+		for i, v := range live {
+			items[i] = &models.DeleteURLItem{UserID: job.UserID, ShortURL: v.ShortURL}
+		}
+		deleted, errs := s.loader.LoadAll(items)
+		for _, v := range errs {
+			if v != nil {
+				err = v
+				break
+			}
+		}
+		// Only urls deleted by this job are counted, not the ones deleted concurrently by others.
+		for i, v := range live {
+			if errs[i] != nil || deleted[i] == 0 {
+				failures = append(failures, models.JobFailure{ID: v.ShortURL, Error: errNotDeleted.Error()})
+				continue
+			}
+			job.Deleted++
+			s.publishDeleted(ctx, v.ShortURL)
+		}
+	}
+	now := time.Now()
+	job.Status = models.JobDone
+	if err != nil {
+		job.Status = models.JobFailed
+		job.Error = err.Error()
+	}
+	job.Failures = failures
+	job.FinishedAt = &now
+	if serr := s.repo.SaveJob(ctx, job); serr != nil {
+		log.Printf("error saving delete job %s : %v", job.ID, serr)
+	}
+	s.events.Publish(events.BatchDeleted{JobID: job.ID, UserID: job.UserID, IDs: job.IDs, Deleted: job.Deleted, Err: err, Time: now})
+}
+
+// publishDeleted publishes the deletion of a url with its deleted state.
+func (s *ShortenerImpl) publishDeleted(ctx context.Context, id string) {
+	url, err := s.repo.Get(ctx, id)
+	if err != nil {
+		log.Printf("error getting deleted url %s : %v", id, err)
+		return
+	}
+	at := time.Now()
+	if url.DeletedAt != nil {
+		at = *url.DeletedAt
+	}
+	s.publishLink(events.LinkDeleted{URL: url, Time: at})
+}
+
+// deletableURLs splits ids into urls of user which are not deleted yet and failures of the others.
+func (s *ShortenerImpl) deletableURLs(ctx context.Context, ids []string, userID string) ([]*models.URL, []models.JobFailure) {
+	var live []*models.URL
+	var failures []models.JobFailure
+	seen := make(map[string]bool)
+	for _, v := range ids {
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		url, err := s.repo.Get(ctx, v)
+		switch {
+		case errors.Is(err, models.ErrInvalidID):
+			failures = append(failures, models.JobFailure{ID: v, Error: models.ErrURLNotFound.Error()})
+		case err != nil:
+			failures = append(failures, models.JobFailure{ID: v, Error: err.Error()})
+		case url.UserID != userID:
+			failures = append(failures, models.JobFailure{ID: v, Error: models.ErrNotOwner.Error()})
+		case url.Deleted:
+			failures = append(failures, models.JobFailure{ID: v, Error: models.ErrURLDeleted.Error()})
+		default:
+			live = append(live, url)
+		}
+	}
+	return live, failures
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/config"
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// defaultAllowedSchemes are the schemes of original urls allowed when config is not provided.
+var defaultAllowedSchemes = []string{"http", "https"}
+
+// DestinationPolicy decides which original urls can be shortened.
+type DestinationPolicy interface {
+	// Check returns models.ErrDestinationBlocked if the original url is not allowed.
+	Check(destination *url.URL) error
+}
+
+// Policies is a DestinationPolicy allowing urls allowed by all of its policies.
+type Policies []DestinationPolicy
+
+// Check checks destination against every policy, returning the first error.
+func (p Policies) Check(destination *url.URL) error {
+	for _, v := range p {
+		if err := v.Check(destination); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SchemePolicy allows urls with one of its schemes only.
+type SchemePolicy []string
+
+// Check checks if the scheme of destination is allowed.
+func (p SchemePolicy) Check(destination *url.URL) error {
+	for _, v := range p {
+		if strings.EqualFold(destination.Scheme, v) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: scheme %q", models.ErrDestinationBlocked, destination.Scheme)
+}
+
+// PrivateAddressPolicy rejects urls pointing to loopback, private, link-local or unspecified addresses
+// and to localhost. Only hosts written as addresses are checked, names are not resolved.
+type PrivateAddressPolicy struct{}
+
+// Check checks if the host of destination is a public one.
+func (PrivateAddressPolicy) Check(destination *url.URL) error {
+	host := strings.TrimSuffix(strings.ToLower(destination.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: host %q", models.ErrDestinationBlocked, host)
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return nil
+	}
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsUnspecified() {
+		return fmt.Errorf("%w: address %s", models.ErrDestinationBlocked, addr)
+	}
+	return nil
+}
+
+// DomainBlocklist rejects urls of blocked domains and their subdomains.
+// Domains are read from a file with one domain per line, empty lines and lines starting with "#" are skipped.
+type DomainBlocklist struct {
+	// path is the file the domains are read from.
+	path string
+	// modTime is the modification time of the file when it was read.
+	modTime time.Time
+	// domains is the set of blocked domains.
+	domains map[string]struct{}
+	// RWMutex synchronizes access to domains.
+	sync.RWMutex
+}
+
+// NewDomainBlocklist reads blocked domains from the file at path.
+func NewDomainBlocklist(path string) (*DomainBlocklist, error) {
+	b := &DomainBlocklist{path: path}
+	if _, err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Check checks if the host of destination is blocked.
+func (b *DomainBlocklist) Check(destination *url.URL) error {
+	host := strings.TrimSuffix(strings.ToLower(destination.Hostname()), ".")
+	b.RLock()
+	defer b.RUnlock()
+	// Check the host and every domain it belongs to, e.g. "a.b.com", "b.com" and "com".
+	for domain := host; domain != ""; {
+		if _, ok := b.domains[domain]; ok {
+			return fmt.Errorf("%w: domain %q", models.ErrDestinationBlocked, domain)
+		}
+		_, domain, _ = strings.Cut(domain, ".")
+	}
+	return nil
+}
+
+// Reload reads the file again if it was modified since the last read, reporting if it was.
+// The domains read before are kept if the file can't be read.
+func (b *DomainBlocklist) Reload() (bool, error) {
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return false, fmt.Errorf("error reading blocklist : %w", err)
+	}
+	b.RLock()
+	modified := !info.ModTime().Equal(b.modTime) || b.domains == nil
+	b.RUnlock()
+	if !modified {
+		return false, nil
+	}
+	file, err := os.Open(b.path)
+	if err != nil {
+		return false, fmt.Errorf("error reading blocklist : %w", err)
+	}
+	defer file.Close()
+	domains := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[strings.TrimSuffix(strings.TrimPrefix(line, "*."), ".")] = struct{}{}
+	}
+	if err = scanner.Err(); err != nil {
+		return false, fmt.Errorf("error reading blocklist : %w", err)
+	}
+	b.Lock()
+	b.domains, b.modTime = domains, info.ModTime()
+	b.Unlock()
+	return true, nil
+}
+
+// Watch reloads the file every interval in background.
+func (b *DomainBlocklist) Watch(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			reloaded, err := b.Reload()
+			if err != nil {
+				log.Printf("error reloading blocklist : %v", err)
+				continue
+			}
+			if reloaded {
+				log.Printf("reloaded blocklist %s", b.path)
+			}
+		}
+	}()
+}
+
+// NewDestinationPolicy builds the destination policy configured in cfg: allowed schemes,
+// rejection of private addresses and a domain blocklist reloaded in background.
+func NewDestinationPolicy(cfg *config.Config) (DestinationPolicy, error) {
+	if cfg == nil {
+		return Policies{SchemePolicy(defaultAllowedSchemes), PrivateAddressPolicy{}}, nil
+	}
+	schemes := SchemePolicy(defaultAllowedSchemes)
+	if len(cfg.AllowedSchemes) > 0 {
+		schemes = cfg.AllowedSchemes
+	}
+	policies := Policies{schemes}
+	if cfg.BlockPrivate {
+		policies = append(policies, PrivateAddressPolicy{})
+	}
+	if cfg.BlocklistFile != "" {
+		blocklist, err := NewDomainBlocklist(cfg.BlocklistFile)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.BlocklistReload > 0 {
+			blocklist.Watch(time.Duration(cfg.BlocklistReload) * time.Second)
+		}
+		policies = append(policies, blocklist)
+	}
+	return policies, nil
+}
+
+// checkDestination checks if the original url longURL is allowed by the destination policy.
+func (s *ShortenerImpl) checkDestination(longURL string) error {
+	// Urls without scheme are treated as http ones, like validators.IsURL does.
+	if !strings.Contains(longURL, "://") {
+		longURL = "http://" + longURL
+	}
+	destination, err := url.Parse(longURL)
+	if err != nil {
+		return models.ErrInvalidURL
+	}
+	return s.policy.Check(destination)
+}
+
+// checkDestinations checks the original url of url along with targets of its rules and variants.
+func (s *ShortenerImpl) checkDestinations(url *models.URL) error {
+	if err := s.checkDestination(url.LongURL); err != nil {
+		return err
+	}
+	for _, v := range url.Rules {
+		if err := s.checkDestination(v.Target); err != nil {
+			return err
+		}
+	}
+	for _, v := range url.Variants {
+		if err := s.checkDestination(v.Target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetPolicy replaces the destination policy, it must be called before the service is used.
+func (s *ShortenerImpl) SetPolicy(policy DestinationPolicy) {
+	s.policy = policy
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+func TestDestinationPolicies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# phishing\nevil.com\n\n*.Malware.ORG\n"), 0o600))
+	blocklist, err := NewDomainBlocklist(path)
+	require.NoError(t, err)
+	policy := Policies{SchemePolicy{"http", "https"}, PrivateAddressPolicy{}, blocklist}
+	tests := []struct {
+		name    string
+		url     string
+		blocked bool
+	}{
+		{name: "Public url", url: "https://github.com/"},
+		{name: "Public address", url: "http://8.8.8.8/"},
+		{name: "Uppercase scheme", url: "HTTPS://github.com/"},
+		{name: "Javascript", url: "javascript://example.com/%0Aalert(1)", blocked: true},
+		{name: "Data", url: "data://text/html,hi", blocked: true},
+		{name: "Localhost", url: "http://localhost:8080/", blocked: true},
+		{name: "Localhost subdomain", url: "http://app.localhost/", blocked: true},
+		{name: "Loopback", url: "http://127.0.0.1/", blocked: true},
+		{name: "IPv6 loopback", url: "http://[::1]/", blocked: true},
+		{name: "Mapped IPv4 loopback", url: "http://[::ffff:127.0.0.1]/", blocked: true},
+		{name: "Private", url: "http://10.1.2.3/", blocked: true},
+		{name: "Link-local", url: "http://169.254.169.254/latest/meta-data", blocked: true},
+		{name: "Unspecified", url: "http://0.0.0.0/", blocked: true},
+		{name: "Blocked domain", url: "https://evil.com/login", blocked: true},
+		{name: "Blocked subdomain", url: "https://login.EVIL.com./", blocked: true},
+		{name: "Blocked wildcard", url: "https://a.b.malware.org/", blocked: true},
+		{name: "Similar domain", url: "https://notevil.com/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destination, err := url.Parse(tt.url)
+			require.NoError(t, err)
+			err = policy.Check(destination)
+			if tt.blocked {
+				assert.ErrorIs(t, err, models.ErrDestinationBlocked)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDomainBlocklist_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("evil.com\n"), 0o600))
+	blocklist, err := NewDomainBlocklist(path)
+	require.NoError(t, err)
+	evil, other := &url.URL{Host: "evil.com"}, &url.URL{Host: "other.com"}
+	assert.Error(t, blocklist.Check(evil))
+	assert.NoError(t, blocklist.Check(other))
+
+	reloaded, err := blocklist.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+	require.NoError(t, os.WriteFile(path, []byte("other.com\n"), 0o600))
+	// Modification times of quick writes can be equal, so the change is made visible explicitly.
+	modified := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, modified, modified))
+	reloaded, err = blocklist.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.NoError(t, blocklist.Check(evil))
+	assert.Error(t, blocklist.Check(other))
+
+	// Domains read before are kept if the file is gone.
+	require.NoError(t, os.Remove(path))
+	_, err = blocklist.Reload()
+	assert.Error(t, err)
+	assert.Error(t, blocklist.Check(other))
+
+	_, err = NewDomainBlocklist(path)
+	assert.Error(t, err)
+}
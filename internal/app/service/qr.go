@@ -0,0 +1,176 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/skip2/go-qrcode"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// Defaults and limits of QR code images.
+const (
+	defaultQRSize      = 256
+	minQRSize          = 64
+	maxQRSize          = 2048
+	defaultQRCacheSize = 256
+)
+
+// qrLevels maps error correction levels to their encoder values.
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	models.QRLevelLow:      qrcode.Low,
+	models.QRLevelMedium:   qrcode.Medium,
+	models.QRLevelQuartile: qrcode.High,
+	models.QRLevelHigh:     qrcode.Highest,
+}
+
+// QRCode returns a QR code image of the short url with id, generated images are cached.
+// Codes of deleted and expired urls aren't generated.
+func (s *ShortenerImpl) QRCode(ctx context.Context, id string, opts models.QROptions) (*models.QRCode, error) {
+	opts, err := qrOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	// The url is checked on every request, so cached codes of deleted or blocked urls aren't served.
+	url, err := s.Preview(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if url.Blocked {
+		return nil, models.ErrURLBlocked
+	}
+	key := fmt.Sprintf("%s/%s/%d/%s", id, opts.Format, opts.Size, opts.Level)
+	if code := s.qrCodes.get(key); code != nil {
+		return code, nil
+	}
+	code, err := encodeQR(s.BuildURL(id), opts)
+	if err != nil {
+		return nil, err
+	}
+	s.qrCodes.put(key, code)
+	return code, nil
+}
+
+// qrOptions checks opts and fills in defaults of zero values.
+func qrOptions(opts models.QROptions) (models.QROptions, error) {
+	opts.Format = strings.ToLower(opts.Format)
+	if opts.Format == "" {
+		opts.Format = models.QRFormatPNG
+	}
+	if opts.Format != models.QRFormatPNG && opts.Format != models.QRFormatSVG {
+		return opts, models.ErrInvalidQROptions
+	}
+	if opts.Size == 0 {
+		opts.Size = defaultQRSize
+	}
+	if opts.Size < minQRSize || opts.Size > maxQRSize {
+		return opts, models.ErrInvalidQROptions
+	}
+	opts.Level = strings.ToUpper(opts.Level)
+	if opts.Level == "" {
+		opts.Level = models.QRLevelMedium
+	}
+	if _, ok := qrLevels[opts.Level]; !ok {
+		return opts, models.ErrInvalidQROptions
+	}
+	return opts, nil
+}
+
+// encodeQR generates a QR code image of content.
+func encodeQR(content string, opts models.QROptions) (*models.QRCode, error) {
+	q, err := qrcode.New(content, qrLevels[opts.Level])
+	if err != nil {
+		return nil, fmt.Errorf("error encoding QR code: %w", err)
+	}
+	if opts.Format == models.QRFormatSVG {
+		return &models.QRCode{Image: qrSVG(q.Bitmap(), opts.Size), ContentType: "image/svg+xml"}, nil
+	}
+	image, err := q.PNG(opts.Size)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding QR code: %w", err)
+	}
+	return &models.QRCode{Image: image, ContentType: "image/png"}, nil
+}
+
+// qrSVG renders modules of a QR code, including its quiet zone, as an SVG image of size pixels.
+// Adjacent dark modules of a row are drawn as a single rectangle to keep the image small.
+func qrSVG(bitmap [][]bool, size int) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, len(bitmap), len(bitmap))
+	b.WriteString(`<rect width="100%" height="100%" fill="#fff"/><path fill="#000" d="`)
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&b, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return []byte(b.String())
+}
+
+// qrCache keeps the most recently used QR codes.
+type qrCache struct {
+	// size is the maximal number of cached codes.
+	size int
+	// entries maps keys of codes to their elements of order.
+	entries map[string]*list.Element
+	// order lists cached codes from the most to the least recently used.
+	order *list.List
+	// Mutex synchronizes access to the cache.
+	sync.Mutex
+}
+
+// qrEntry is a cached QR code.
+type qrEntry struct {
+	key  string
+	code *models.QRCode
+}
+
+// newQRCache creates a cache of size codes.
+func newQRCache(size int) *qrCache {
+	return &qrCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// get returns the cached code of key or nil.
+func (c *qrCache) get(key string) *models.QRCode {
+	c.Lock()
+	defer c.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*qrEntry).code
+}
+
+// put caches code of key, evicting the least recently used code if cache is full.
+func (c *qrCache) put(key string, code *models.QRCode) {
+	c.Lock()
+	defer c.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*qrEntry).code = code
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&qrEntry{key: key, code: code})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*qrEntry).key)
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mldlr/url-shortener/internal/app/config"
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/storage"
+)
+
+func TestQROptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts models.QROptions
+		want models.QROptions
+		err  error
+	}{
+		{name: "Defaults", want: models.QROptions{Format: models.QRFormatPNG, Size: defaultQRSize, Level: models.QRLevelMedium}},
+		{name: "Case insensitive", opts: models.QROptions{Format: "SVG", Size: 512, Level: "h"}, want: models.QROptions{Format: models.QRFormatSVG, Size: 512, Level: models.QRLevelHigh}},
+		{name: "Unknown format", opts: models.QROptions{Format: "gif"}, err: models.ErrInvalidQROptions},
+		{name: "Too small", opts: models.QROptions{Size: minQRSize - 1}, err: models.ErrInvalidQROptions},
+		{name: "Too large", opts: models.QROptions{Size: maxQRSize + 1}, err: models.ErrInvalidQROptions},
+		{name: "Unknown level", opts: models.QROptions{Level: "X"}, err: models.ErrInvalidQROptions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := qrOptions(tt.opts)
+			assert.ErrorIs(t, err, tt.err)
+			if tt.err == nil {
+				assert.Equal(t, tt.want, opts)
+			}
+		})
+	}
+}
+
+func TestQRCode(t *testing.T) {
+	repo := storage.NewInMemRepo()
+	shortener := NewShortenerImpl(repo, &config.Config{BaseURL: "http://localhost:8080"})
+	ctx := context.Background()
+	_, err := repo.Add(ctx, &models.URL{ShortURL: "qr1", LongURL: "https://github.com/", UserID: "user1"})
+	require.NoError(t, err)
+
+	code, err := shortener.QRCode(ctx, "qr1", models.QROptions{Size: 300})
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", code.ContentType)
+	img, err := png.Decode(bytes.NewReader(code.Image))
+	require.NoError(t, err)
+	assert.Equal(t, 300, img.Bounds().Dx())
+	// Repeated requests are served from cache.
+	cached, err := shortener.QRCode(ctx, "qr1", models.QROptions{Format: models.QRFormatPNG, Size: 300, Level: models.QRLevelMedium})
+	require.NoError(t, err)
+	assert.Same(t, code, cached)
+
+	code, err = shortener.QRCode(ctx, "qr1", models.QROptions{Format: models.QRFormatSVG})
+	require.NoError(t, err)
+	assert.Equal(t, "image/svg+xml", code.ContentType)
+	assert.Contains(t, string(code.Image), `width="256" height="256"`)
+
+	_, err = shortener.QRCode(ctx, "missing", models.QROptions{})
+	assert.ErrorIs(t, err, models.ErrRepoError)
+	_, err = repo.DeleteURLs([]*models.DeleteURLItem{{ShortURL: "qr1", UserID: "user1"}})
+	require.NoError(t, err)
+	_, err = shortener.QRCode(ctx, "qr1", models.QROptions{Size: 300})
+	assert.ErrorIs(t, err, models.ErrURLDeleted)
+}
+
+func TestQRCache(t *testing.T) {
+	c := newQRCache(2)
+	first, second, third := &models.QRCode{}, &models.QRCode{}, &models.QRCode{}
+	c.put("first", first)
+	c.put("second", second)
+	assert.Same(t, first, c.get("first"))
+	// The least recently used code is evicted.
+	c.put("third", third)
+	assert.Nil(t, c.get("second"))
+	assert.Same(t, first, c.get("first"))
+	assert.Same(t, third, c.get("third"))
+}
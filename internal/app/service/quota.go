@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// quotaLocks serializes quota checks of a user with creation of their urls,
+// so concurrent requests of the user can't exceed the quota together.
+type quotaLocks [64]sync.Mutex
+
+// lock locks the mutex of a user and returns the function unlocking it.
+func (l *quotaLocks) lock(userID string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(userID))
+	m := &l[h.Sum32()%uint32(len(l))]
+	m.Lock()
+	return m.Unlock
+}
+
+// Quota returns how much of their quota a user has used.
+func (s *ShortenerImpl) Quota(ctx context.Context, userID string) (*models.QuotaUsage, error) {
+	return s.quotaUsage(ctx, userID, time.Now())
+}
+
+// SetQuota replaces the configured quota of a user with their own.
+func (s *ShortenerImpl) SetQuota(ctx context.Context, quota *models.Quota) (*models.QuotaUsage, error) {
+	if quota.Daily < 0 || quota.Total < 0 {
+		return nil, models.ErrInvalidQuota
+	}
+	if err := s.repo.SetQuota(ctx, quota); err != nil {
+		return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+	}
+	return s.quotaUsage(ctx, quota.UserID, time.Now())
+}
+
+// quotaUsage counts urls created by user against their quota.
+// Days start at midnight UTC.
+func (s *ShortenerImpl) quotaUsage(ctx context.Context, userID string, now time.Time) (*models.QuotaUsage, error) {
+	quota, err := s.userQuota(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.countUsage(ctx, userID, quota, now)
+}
+
+// userQuota returns the own quota of user or the configured one.
+func (s *ShortenerImpl) userQuota(ctx context.Context, userID string) (*models.Quota, error) {
+	quota, err := s.repo.GetQuota(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+	}
+	if quota == nil {
+		quota = &s.quota
+	}
+	return quota, nil
+}
+
+// countUsage counts urls created by user against quota.
+func (s *ShortenerImpl) countUsage(ctx context.Context, userID string, quota *models.Quota, now time.Time) (*models.QuotaUsage, error) {
+	day := now.UTC().Truncate(24 * time.Hour)
+	total, created, err := s.repo.CountURLs(ctx, userID, day)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+	}
+	return &models.QuotaUsage{
+		Daily:    quotaCounter(quota.Daily, created),
+		Total:    quotaCounter(quota.Total, total),
+		ResetsAt: day.AddDate(0, 0, 1),
+	}, nil
+}
+
+// quotaLeft returns the number of urls user can still create, -1 if it is unlimited.
+// Urls of users without limits are not counted.
+func (s *ShortenerImpl) quotaLeft(ctx context.Context, userID string) (int, error) {
+	quota, err := s.userQuota(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if quota.Daily == 0 && quota.Total == 0 {
+		return -1, nil
+	}
+	usage, err := s.countUsage(ctx, userID, quota, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return usage.Left(), nil
+}
+
+// quotaCounter returns usage of a limit, 0 limits are unlimited.
+func quotaCounter(limit, used int) models.QuotaCounter {
+	c := models.QuotaCounter{Limit: limit, Used: used}
+	if limit > 0 {
+		remaining := limit - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		c.Remaining = &remaining
+	}
+	return c
+}
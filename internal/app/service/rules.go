@@ -0,0 +1,154 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/utils/validators"
+)
+
+// defaultGeoHeader is the header holding the country of a request when config is not provided.
+const defaultGeoHeader = "X-Country"
+
+// maxRules is the maximal number of redirect rules of a url.
+const maxRules = 32
+
+// validateRules checks that every rule has a valid target and at least one well-formed condition.
+func validateRules(rules []*models.RedirectRule) error {
+	if len(rules) > maxRules {
+		return models.ErrInvalidRule
+	}
+	for _, v := range rules {
+		if v == nil || !validators.IsURL(v.Target) {
+			return models.ErrInvalidRule
+		}
+		switch v.Device {
+		case "", models.DeviceIOS, models.DeviceAndroid, models.DeviceMobile, models.DeviceDesktop:
+		default:
+			return models.ErrInvalidRule
+		}
+		// The time of day is matched as a range, so both of its ends are required.
+		if (v.From == "") != (v.To == "") {
+			return models.ErrInvalidRule
+		}
+		if v.From != "" {
+			if _, err := parseClock(v.From); err != nil {
+				return models.ErrInvalidRule
+			}
+			if _, err := parseClock(v.To); err != nil {
+				return models.ErrInvalidRule
+			}
+		}
+		if v.Device == "" && v.Language == "" && v.Country == "" && v.From == "" {
+			return models.ErrInvalidRule
+		}
+	}
+	return nil
+}
+
+// route returns the target of url for visitor, which is the target of the first matching rule,
+// a variant of a split url or the original url. The variant the visitor is redirected to is stored in visitor.
+func (s *ShortenerImpl) route(url *models.URL, visitor *models.Visitor) string {
+	if visitor == nil {
+		visitor = &models.Visitor{}
+	}
+	for _, v := range url.Rules {
+		if matchRule(v, visitor, s.geoHeader) {
+			visitor.Variant = 0
+			return v.Target
+		}
+	}
+	if len(url.Variants) == 0 {
+		visitor.Variant = 0
+		return url.LongURL
+	}
+	// A sticky visitor keeps the variant assigned before as long as the url has it.
+	if !url.Sticky || visitor.Variant < 1 || visitor.Variant > len(url.Variants) {
+		visitor.Variant = s.splitter.pick(url.Variants)
+	}
+	return url.Variants[visitor.Variant-1].Target
+}
+
+// matchRule checks if visitor matches all conditions of rule.
+func matchRule(rule *models.RedirectRule, visitor *models.Visitor, geoHeader string) bool {
+	header := visitor.Header
+	if header == nil {
+		header = http.Header{}
+	}
+	switch {
+	case rule.Device != "" && !matchDevice(rule.Device, header.Get("User-Agent")):
+		return false
+	case rule.Language != "" && !matchLanguage(rule.Language, header.Get("Accept-Language")):
+		return false
+	case rule.Country != "" && !strings.EqualFold(rule.Country, strings.TrimSpace(header.Get(geoHeader))):
+		return false
+	case rule.From != "" && !matchTime(rule.From, rule.To, visitor.Time):
+		return false
+	}
+	return true
+}
+
+// matchDevice checks if the User-Agent header belongs to the device family.
+func matchDevice(device string, userAgent string) bool {
+	ios := strings.Contains(userAgent, "iPhone") || strings.Contains(userAgent, "iPad") || strings.Contains(userAgent, "iPod")
+	android := strings.Contains(userAgent, "Android")
+	mobile := ios || android || strings.Contains(userAgent, "Mobile")
+	switch device {
+	case models.DeviceIOS:
+		return ios
+	case models.DeviceAndroid:
+		return android
+	case models.DeviceMobile:
+		return mobile
+	case models.DeviceDesktop:
+		return userAgent != "" && !mobile
+	}
+	return false
+}
+
+// matchLanguage checks if the Accept-Language header accepts the language.
+// A language matches its regional variants, so "en" matches "en-US".
+func matchLanguage(language string, acceptLanguage string) bool {
+	for _, v := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(v), ";")
+		// Languages with zero quality are explicitly not accepted.
+		if strings.ReplaceAll(params, " ", "") == "q=0" {
+			continue
+		}
+		if strings.EqualFold(tag, language) ||
+			len(tag) > len(language) && tag[len(language)] == '-' && strings.EqualFold(tag[:len(language)], language) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTime checks if the UTC time of day of now is in the range from inclusive to exclusive.
+// A range ending before it starts wraps around midnight.
+func matchTime(from string, to string, now time.Time) bool {
+	start, err := parseClock(from)
+	if err != nil || now.IsZero() {
+		return false
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return false
+	}
+	now = now.UTC()
+	current := now.Hour()*60 + now.Minute()
+	if start <= end {
+		return start <= current && current < end
+	}
+	return current >= start || current < end
+}
+
+// parseClock returns the number of minutes since midnight of a time of day in HH:MM format.
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+func TestValidateRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []*models.RedirectRule
+		err   error
+	}{
+		{name: "No rules"},
+		{name: "Valid rule", rules: []*models.RedirectRule{{Device: "ios", From: "9:30", To: "17:00", Target: "https://example.com/"}}},
+		{name: "No conditions", rules: []*models.RedirectRule{{Target: "https://example.com/"}}, err: models.ErrInvalidRule},
+		{name: "Missing target", rules: []*models.RedirectRule{{Country: "US"}}, err: models.ErrInvalidRule},
+		{name: "Unknown device", rules: []*models.RedirectRule{{Device: "tv", Target: "https://example.com/"}}, err: models.ErrInvalidRule},
+		{name: "Open time range", rules: []*models.RedirectRule{{From: "09:00", Target: "https://example.com/"}}, err: models.ErrInvalidRule},
+		{name: "Invalid time", rules: []*models.RedirectRule{{From: "25:00", To: "09:00", Target: "https://example.com/"}}, err: models.ErrInvalidRule},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, validateRules(tt.rules), tt.err)
+		})
+	}
+}
+
+func TestRoute(t *testing.T) {
+	url := &models.URL{
+		LongURL: "https://example.com/",
+		Rules: []*models.RedirectRule{
+			{From: "22:00", To: "06:00", Target: "https://example.com/night"},
+			{Device: "desktop", From: "09:00", To: "17:30", Target: "https://example.com/office"},
+		},
+	}
+	day := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	desktop := http.Header{"User-Agent": {"Mozilla/5.0 (X11; Linux x86_64)"}}
+	tests := []struct {
+		name    string
+		visitor *models.Visitor
+		want    string
+	}{
+		{name: "No visitor", want: "https://example.com/"},
+		{name: "Before midnight", visitor: &models.Visitor{Time: day.Add(23 * time.Hour)}, want: "https://example.com/night"},
+		{name: "After midnight", visitor: &models.Visitor{Time: day.Add(5 * time.Hour)}, want: "https://example.com/night"},
+		{name: "End of night", visitor: &models.Visitor{Time: day.Add(6 * time.Hour)}, want: "https://example.com/"},
+		{name: "Desktop at work", visitor: &models.Visitor{Header: desktop, Time: day.Add(17 * time.Hour)}, want: "https://example.com/office"},
+		{name: "Desktop after work", visitor: &models.Visitor{Header: desktop, Time: day.Add(17*time.Hour + 30*time.Minute)}, want: "https://example.com/"},
+		{name: "Mobile at work", visitor: &models.Visitor{Header: http.Header{"User-Agent": {"Mobile Safari"}}, Time: day.Add(12 * time.Hour)}, want: "https://example.com/"},
+		{
+			name:    "Local time",
+			visitor: &models.Visitor{Header: desktop, Time: day.Add(20 * time.Hour).In(time.FixedZone("UTC-8", -8*60*60))},
+			want:    "https://example.com/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &ShortenerImpl{geoHeader: defaultGeoHeader}
+			assert.Equal(t, tt.want, s.route(url, tt.visitor))
+		})
+	}
+}
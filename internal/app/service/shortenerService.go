@@ -9,11 +9,29 @@ import (
 // ShortenerService is an interface for handling internal logic of the app
 type ShortenerService interface {
 	Shorten(ctx context.Context, url *models.URL) (*models.URL, error)
-	Expand(ctx context.Context, id string) (*models.URL, error)
-	ExpandUser(ctx context.Context, userID string) ([]*models.URL, error)
-	DeleteBatch(urlIDs []string, userID string)
+	Expand(ctx context.Context, id string, visitor *models.Visitor) (*models.URL, error)
+	ExpandPassword(ctx context.Context, id string, password string, visitor *models.Visitor) (*models.URL, error)
+	Preview(ctx context.Context, id string) (*models.URL, error)
+	QRCode(ctx context.Context, id string, opts models.QROptions) (*models.QRCode, error)
+	ExpandUser(ctx context.Context, userID string, q *models.URLQuery) (*models.URLPage, error)
+	DeleteBatch(ctx context.Context, urlIDs []string, userID string) (*models.Job, error)
+	Job(ctx context.Context, userID string, id string) (*models.Job, error)
+	RestoreBatch(ctx context.Context, urlIDs []string, userID string) (int, error)
 	Ping(ctx context.Context) error
 	ShortenBatch(ctx context.Context, userID string, urls []*models.URL) ([]*models.URL, error)
 	Stats(ctx context.Context) (*models.Stats, error)
+	RecordClick(click *models.Click)
+	ClickStats(ctx context.Context, userID string, id string, bucket string) (*models.ClickStats, error)
+	UpdateURL(ctx context.Context, userID string, id string, longURL string) (*models.URL, error)
+	URLHistory(ctx context.Context, userID string, id string) ([]*models.URLVersion, error)
+	Rules(ctx context.Context, userID string, id string) ([]*models.RedirectRule, error)
+	SetRules(ctx context.Context, userID string, id string, rules []*models.RedirectRule) (*models.URL, error)
+	BlockURL(ctx context.Context, id string, blocked bool, reason string) (*models.URL, error)
+	Quota(ctx context.Context, userID string) (*models.QuotaUsage, error)
+	SetQuota(ctx context.Context, quota *models.Quota) (*models.QuotaUsage, error)
+	AddWebhook(ctx context.Context, userID string, endpoint string, types []string) (*models.Webhook, error)
+	Webhooks(ctx context.Context, userID string) ([]*models.Webhook, error)
+	DeleteWebhook(ctx context.Context, userID string, id string) error
+	WebhookDeliveries(ctx context.Context, userID string, id string) ([]*models.DeliveryAttempt, error)
 	BuildURL(url string) string
 }
@@ -2,35 +2,152 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/Mldlr/url-shortener/internal/app/analytics"
 	"github.com/Mldlr/url-shortener/internal/app/config"
+	"github.com/Mldlr/url-shortener/internal/app/events"
 	"github.com/Mldlr/url-shortener/internal/app/models"
 	"github.com/Mldlr/url-shortener/internal/app/router/loader"
 	"github.com/Mldlr/url-shortener/internal/app/storage"
+	"github.com/Mldlr/url-shortener/internal/app/utils/encoders"
 	"github.com/Mldlr/url-shortener/internal/app/utils/validators"
+	"github.com/Mldlr/url-shortener/internal/app/webhook"
 )
 
 // ShortenerImpl is a ShortenerService implementation
 type ShortenerImpl struct {
-	repo   storage.Repository
-	cfg    *config.Config
-	loader *loader.UserLoader
+	repo     storage.Repository
+	cfg      *config.Config
+	loader   *loader.UserLoader
+	recorder *analytics.Recorder
+	attempts *attemptLimiter
+	// geoHeader is the header holding the country of a request.
+	geoHeader string
+	// splitter picks variants of split urls.
+	splitter *splitter
+	// redirectCode is the status code of redirects of urls without their own.
+	redirectCode int
+	// qrCodes caches generated QR codes.
+	qrCodes *qrCache
+	// normalizer converts shortened urls to their canonical form, nil if urls are stored as sent.
+	normalizer *encoders.URLNormalizer
+	// policy decides which original urls can be shortened.
+	policy DestinationPolicy
+	// quota is the configured quota of users without one of their own.
+	quota models.Quota
+	// quotaLocks serialize creation of urls by the same user.
+	quotaLocks quotaLocks
+	// webhooks delivers events of links to webhooks of their owners.
+	webhooks *webhook.Dispatcher
+	// events is the bus domain events are published to.
+	events *events.Bus
+	// jobs tracks delete jobs in progress.
+	jobs sync.WaitGroup
+	// instance is the ID the instance claims delete jobs with.
+	instance string
+	// running are the IDs of delete jobs run by the instance.
+	running map[string]bool
+	// runningMu guards running.
+	runningMu sync.Mutex
+	// done is closed by Close to stop looking for pending delete jobs.
+	done chan struct{}
 }
 
+// Defaults of click recording when config is not provided.
+const (
+	defaultClickBuffer = 1024
+	defaultClickFlush  = 5
+)
+
+// Defaults of password attempts limiting when config is not provided.
+const (
+	defaultPasswordAttempts = 5
+	defaultPasswordWindow   = 15
+)
+
 // NewShortenerImpl returns a ShortenerImpl implementation
 func NewShortenerImpl(repo storage.Repository, cfg *config.Config) *ShortenerImpl {
-	return &ShortenerImpl{
-		repo:   repo,
-		cfg:    cfg,
-		loader: loader.NewDeleteLoader(repo),
+	clickBuffer, clickFlush := defaultClickBuffer, defaultClickFlush
+	if cfg != nil && cfg.ClickBuffer > 0 && cfg.ClickFlush > 0 {
+		clickBuffer, clickFlush = cfg.ClickBuffer, cfg.ClickFlush
+	}
+	passwordAttempts, passwordWindow := defaultPasswordAttempts, defaultPasswordWindow
+	if cfg != nil && cfg.PasswordAttempts > 0 && cfg.PasswordWindow > 0 {
+		passwordAttempts, passwordWindow = cfg.PasswordAttempts, cfg.PasswordWindow
+	}
+	geoHeader := defaultGeoHeader
+	if cfg != nil && cfg.GeoHeader != "" {
+		geoHeader = cfg.GeoHeader
 	}
+	redirectCode := defaultRedirectCode
+	if cfg != nil && cfg.RedirectCode != 0 {
+		if validRedirectCode(cfg.RedirectCode) {
+			redirectCode = cfg.RedirectCode
+		} else {
+			log.Printf("invalid redirect code %d, using %d", cfg.RedirectCode, defaultRedirectCode)
+		}
+	}
+	qrCacheSize := defaultQRCacheSize
+	if cfg != nil && cfg.QRCacheSize > 0 {
+		qrCacheSize = cfg.QRCacheSize
+	}
+	normalizer := &encoders.URLNormalizer{}
+	if cfg != nil {
+		normalizer = &encoders.URLNormalizer{SortQuery: cfg.NormalizeSortQuery, StripParams: cfg.StripParams}
+		if cfg.DisableNormalize {
+			normalizer = nil
+		}
+	}
+	policy, err := NewDestinationPolicy(cfg)
+	if err != nil {
+		log.Fatal(fmt.Errorf("error initiating destination policy : %v", err))
+	}
+	var quota models.Quota
+	if cfg != nil {
+		quota = models.Quota{Daily: cfg.QuotaDaily, Total: cfg.QuotaTotal}
+	}
+	webhooks, err := webhook.NewStore(cfg)
+	if err != nil {
+		log.Fatal(fmt.Errorf("error initiating webhook storage : %v", err))
+	}
+	s := &ShortenerImpl{
+		repo:         repo,
+		cfg:          cfg,
+		loader:       loader.NewDeleteLoader(repo),
+		recorder:     analytics.NewRecorder(repo, clickBuffer, time.Duration(clickFlush)*time.Second),
+		attempts:     newAttemptLimiter(passwordAttempts, time.Duration(passwordWindow)*time.Minute),
+		geoHeader:    geoHeader,
+		splitter:     newSplitter(),
+		redirectCode: redirectCode,
+		qrCodes:      newQRCache(qrCacheSize),
+		normalizer:   normalizer,
+		policy:       policy,
+		quota:        quota,
+		webhooks:     webhook.NewDispatcher(webhooks, webhookOptions(cfg)),
+		events:       newEventBus(cfg),
+		instance:     newJobID(),
+		running:      make(map[string]bool),
+		done:         make(chan struct{}),
+	}
+	s.events.Subscribe("log", logDeletes, events.NameBatchDeleted)
+	s.watchJobs()
+	return s
 }
 
-// Expand gets original url from short
-func (s *ShortenerImpl) Expand(ctx context.Context, id string) (*models.URL, error) {
+// Expand gets original url from short, routing the visitor by redirect rules of the url
+func (s *ShortenerImpl) Expand(ctx context.Context, id string, visitor *models.Visitor) (*models.URL, error) {
+	return s.ExpandPassword(ctx, id, "", visitor)
+}
+
+// ExpandPassword gets original url from short checking the password if the url is protected
+func (s *ShortenerImpl) ExpandPassword(ctx context.Context, id string, password string, visitor *models.Visitor) (*models.URL, error) {
 	// If the URL has been deleted, return Gone status.
 	url, err := s.repo.Get(ctx, id)
 	if err != nil {
@@ -39,28 +156,103 @@ func (s *ShortenerImpl) Expand(ctx context.Context, id string) (*models.URL, err
 	if url.Deleted {
 		return url, models.ErrURLDeleted
 	}
+	// If the URL has expired, but has not been purged yet.
+	if url.Expired(time.Now()) {
+		return url, models.ErrURLExpired
+	}
+	// Blocked urls are returned for their warning page, but never followed.
+	if url.Blocked {
+		return url, models.ErrURLBlocked
+	}
+	if url.Protected() {
+		if err = s.checkPassword(url, password); err != nil {
+			return nil, err
+		}
+	}
+	// Redirects of urls limited in clicks are counted by the storage, so concurrent ones can't exceed the limit.
+	if url.MaxClicks > 0 {
+		url, err = s.repo.ConsumeClick(ctx, id)
+		if err != nil {
+			if errors.Is(err, models.ErrURLExhausted) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+		}
+	}
+	// The returned url is a copy pointing to the target of the visitor, stored urls are left untouched.
+	routed := *url
+	routed.LongURL = s.route(url, visitor)
+	if routed.RedirectCode == 0 {
+		routed.RedirectCode = s.redirectCode
+	}
+	s.publishLink(events.LinkClicked{URL: &routed, Visitor: visitor, Time: time.Now()})
+	return &routed, nil
+}
+
+// Preview gets a url for its preview page without following it, the password of a protected url isn't checked
+func (s *ShortenerImpl) Preview(ctx context.Context, id string) (*models.URL, error) {
+	url, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+	}
+	if url.Deleted {
+		return url, models.ErrURLDeleted
+	}
+	if url.Expired(time.Now()) {
+		return url, models.ErrURLExpired
+	}
 	return url, nil
 }
 
-// APIDeleteBatch deletes a batch of urls by user
-func (s *ShortenerImpl) DeleteBatch(urlIDs []string, userID string) {
-	// Create a slice of DeleteURLItem objects from the URL IDs.
-	deleteURLs := make([]*models.DeleteURLItem, len(urlIDs))
+// checkPassword checks the password of a protected url, limiting wrong passwords per url.
+func (s *ShortenerImpl) checkPassword(url *models.URL, password string) error {
+	if password == "" {
+		return models.ErrPasswordRequired
+	}
+	now := time.Now()
+	if s.attempts.Blocked(url.ShortURL, now) {
+		return models.ErrTooManyAttempts
+	}
+	if !encoders.CheckPassword(url.PasswordHash, password) {
+		s.attempts.Fail(url.ShortURL, now)
+		return models.ErrWrongPassword
+	}
+	return nil
+}
+
+// DeleteBatch requests deletion of a batch of urls by user, the urls are deleted in background.
+// The returned job is pending, its result is saved to repository when the urls are processed.
+func (s *ShortenerImpl) DeleteBatch(ctx context.Context, urlIDs []string, userID string) (*models.Job, error) {
+	now := time.Now()
+	leaseUntil := now.Add(jobLease)
+	job := &models.Job{
+		ID:         newJobID(),
+		UserID:     userID,
+		Status:     models.JobPending,
+		IDs:        urlIDs,
+		CreatedAt:  now,
+		Owner:      s.instance,
+		LeaseUntil: &leaseUntil,
+	}
+	if err := s.repo.SaveJob(ctx, job); err != nil {
+		return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+	}
+	pending := *job
+	s.startJob(job)
+	return &pending, nil
+}
+
+// RestoreBatch restores a batch of deleted urls by user
+func (s *ShortenerImpl) RestoreBatch(ctx context.Context, urlIDs []string, userID string) (int, error) {
+	restoreURLs := make([]*models.DeleteURLItem, len(urlIDs))
 	for i, v := range urlIDs {
-		deleteURLs[i] = &models.DeleteURLItem{UserID: userID, ShortURL: v}
+		restoreURLs[i] = &models.DeleteURLItem{UserID: userID, ShortURL: v}
 	}
-	// Start a goroutine to delete the URLs asynchronously.
-	go func() {
-		num, err := s.loader.LoadAll(deleteURLs)
-		if err[0] != nil {
-			log.Printf("error deleing urls :%v", err[0])
-		}
-		var result int
-		for _, v := range num {
-			result += v
-		}
-		log.Printf("deleted %v urls", result)
-	}()
+	n, err := s.repo.RestoreURLs(restoreURLs)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+	}
+	return n, nil
 }
 
 // Ping checks availibility
@@ -74,32 +266,109 @@ func (s *ShortenerImpl) Shorten(ctx context.Context, url *models.URL) (*models.U
 	if !validators.IsURL(url.LongURL) {
 		return nil, models.ErrInvalidURL
 	}
+	if err := s.normalize(url); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := setExpiry(url, now); err != nil {
+		return nil, err
+	}
+	if err := setClickLimit(url); err != nil {
+		return nil, err
+	}
+	if url.RedirectCode != 0 && !validRedirectCode(url.RedirectCode) {
+		return nil, models.ErrInvalidRedirectCode
+	}
+	if err := validateRules(url.Rules); err != nil {
+		return nil, err
+	}
+	if err := validateVariants(url.Variants); err != nil {
+		return nil, err
+	}
+	if err := s.checkDestinations(url); err != nil {
+		return nil, err
+	}
+	// Only split urls can keep visitors on a variant.
+	url.Sticky = url.Sticky && len(url.Variants) > 0
+	url.CreatedAt = now
+	resetState(url)
 	var err error
-	// Get short url for long
-	id, err := s.repo.NewID(url.LongURL)
+	// Only the hash of a requested password is stored.
+	url.PasswordHash = ""
+	if url.Password != "" {
+		url.PasswordHash, err = encoders.HashPassword(url.Password)
+		if err != nil {
+			return nil, fmt.Errorf("error hashing password: %w", err)
+		}
+		url.Password = ""
+	}
+	if url.Alias != "" {
+		// Use custom alias as a short url if it was requested.
+		if !validators.IsAlias(url.Alias) {
+			return nil, models.ErrInvalidAlias
+		}
+		url.ShortURL = url.Alias
+	} else {
+		// Get short url for long
+		url.ShortURL, err = s.repo.NewID(url.LongURL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+		}
+	}
+	// Check the quota and add the url holding the lock, so concurrent requests can't exceed it.
+	unlock := s.quotaLocks.lock(url.UserID)
+	defer unlock()
+	left, err := s.quotaLeft(ctx, url.UserID)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+		return nil, err
+	}
+	if left == 0 {
+		// Shortening a stored url again creates nothing, so it is answered even with the quota used up.
+		existing, err := s.repo.GetByLong(ctx, url.LongURL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+		}
+		if existing == nil {
+			return nil, models.ErrQuotaExceeded
+		}
+		url.ShortURL = existing.ShortURL
+		return url, duplicateErr(url)
 	}
-	url.ShortURL = id
 	// Add record to repo
 	duplicates, err := s.repo.Add(ctx, url)
 	if err != nil {
+		if errors.Is(err, models.ErrAliasTaken) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
 	}
 	if duplicates {
-		return url, models.ErrDuplicate
+		return url, duplicateErr(url)
 	}
+	s.publishLink(events.LinkCreated{URL: url, Time: url.CreatedAt})
 	return url, nil
 }
 
-// ShortenBatch shortens multiple urls
+// duplicateErr returns the error of shortening a stored long url again.
+// An alias can't be added to the stored url, so requesting another one fails instead of being dropped.
+func duplicateErr(url *models.URL) error {
+	if url.Alias != "" && url.ShortURL != url.Alias {
+		return models.ErrAliasNotApplied
+	}
+	return models.ErrDuplicate
+}
+
+// ShortenBatch shortens multiple urls.
+// Invalid urls, urls with invalid options or blocked destinations and urls exceeding the quota of user
+// are not shortened, the reason is set as their error.
 func (s *ShortenerImpl) ShortenBatch(ctx context.Context, userID string, urls []*models.URL) ([]*models.URL, error) {
 	var err error
+	now := time.Now()
 	for i, v := range urls {
-		// Check if the original URL is valid.
-		if !validators.IsURL(v.LongURL) {
-			// If the URL is not valid, set the response item to indicate a bad URL request.
-			urls[i].ShortURL = "incorrect url"
+		v.CreatedAt = now
+		resetState(v)
+		// If the URL or its options are not valid, it is skipped.
+		if urls[i].Err = s.checkBatchItem(v, now); urls[i].Err != nil {
 			continue
 		}
 		// Generate a short ID for the URL.
@@ -109,33 +378,292 @@ func (s *ShortenerImpl) ShortenBatch(ctx context.Context, userID string, urls []
 		}
 		// Add short url to info.
 	}
+	unlock := s.quotaLocks.lock(userID)
+	defer unlock()
+	left, err := s.quotaLeft(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// Accept valid urls in order until the quota is used up.
+	// Urls which are already stored or repeat an earlier url of the batch create nothing and don't use the quota.
+	accepted := make([]*models.URL, 0, len(urls))
+	seen := make(map[string]bool)
+	for _, v := range urls {
+		if v.Err != nil {
+			continue
+		}
+		if left >= 0 && !seen[v.LongURL] {
+			existing, err := s.repo.GetByLong(ctx, v.LongURL)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+			}
+			if existing == nil {
+				if left == 0 {
+					v.Err = models.ErrQuotaExceeded
+					continue
+				}
+				left--
+			}
+		}
+		seen[v.LongURL] = true
+		accepted = append(accepted, v)
+	}
+	if len(accepted) == 0 {
+		return urls, nil
+	}
 	// Add the URLs to the repository.
-	duplicates, err := s.repo.AddBatch(ctx, urls)
+	duplicates, err := s.repo.AddBatch(ctx, accepted)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
 	}
+	for _, v := range accepted {
+		if !v.Duplicate {
+			s.publishLink(events.LinkCreated{URL: v, Time: v.CreatedAt})
+		}
+	}
 	if duplicates {
 		return urls, models.ErrDuplicate
 	}
 	return urls, nil
 }
 
+// checkBatchItem validates a url of a batch and its options, returning the reason it can't be shortened.
+func (s *ShortenerImpl) checkBatchItem(url *models.URL, now time.Time) error {
+	if err := setExpiry(url, now); err != nil {
+		return err
+	}
+	if err := setClickLimit(url); err != nil {
+		return err
+	}
+	if url.RedirectCode != 0 && !validRedirectCode(url.RedirectCode) {
+		return models.ErrInvalidRedirectCode
+	}
+	// Check if the original URL is valid.
+	if !validators.IsURL(url.LongURL) || s.normalize(url) != nil {
+		return models.ErrInvalidURL
+	}
+	return s.checkDestination(url.LongURL)
+}
+
+// normalize replaces the original url of url with its canonical form, so it is hashed and deduplicated as such.
+// Urls are kept as sent if normalization is disabled.
+func (s *ShortenerImpl) normalize(url *models.URL) error {
+	if s.normalizer == nil {
+		return nil
+	}
+	longURL, err := s.normalizer.Normalize(url.LongURL)
+	if err != nil {
+		return models.ErrInvalidURL
+	}
+	url.LongURL = longURL
+	return nil
+}
+
+// setExpiry converts the requested lifetime of url to its expiry time.
+func setExpiry(url *models.URL, now time.Time) error {
+	switch {
+	case url.ExpireDays < 0, url.ExpireDays > 0 && url.ExpiresAt != nil:
+		return models.ErrInvalidExpiry
+	case url.ExpireDays > 0:
+		expiresAt := now.AddDate(0, 0, url.ExpireDays)
+		url.ExpiresAt = &expiresAt
+		url.ExpireDays = 0
+	}
+	if url.ExpiresAt != nil && !url.ExpiresAt.After(now) {
+		return models.ErrInvalidExpiry
+	}
+	return nil
+}
+
+// defaultRedirectCode is the status code of redirects when config is not provided.
+const defaultRedirectCode = http.StatusTemporaryRedirect
+
+// validRedirectCode checks if code is one of the supported redirect status codes.
+func validRedirectCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// resetState clears the state of url changed by users and administrators after it is shortened,
+// so new urls can't be created blocked or deleted.
+func resetState(url *models.URL) {
+	url.Deleted = false
+	url.DeletedAt = nil
+	url.Blocked = false
+	url.BlockReason = ""
+}
+
+// setClickLimit checks the requested click limit of url, new urls have no clicks counted.
+func setClickLimit(url *models.URL) error {
+	if url.MaxClicks < 0 {
+		return models.ErrInvalidMaxClicks
+	}
+	url.Clicks = 0
+	return nil
+}
+
 // Stats gets the count of urls and registered users
 func (s *ShortenerImpl) Stats(ctx context.Context) (*models.Stats, error) {
 	return s.repo.Stats(ctx)
 }
 
-// ExpandUser gets user links
-func (s *ShortenerImpl) ExpandUser(ctx context.Context, userID string) ([]*models.URL, error) {
+// RecordClick queues a redirect of a short url to be stored
+func (s *ShortenerImpl) RecordClick(click *models.Click) {
+	s.recorder.Record(click)
+}
+
+// ClickStats gets click statistics of a url created by user
+func (s *ShortenerImpl) ClickStats(ctx context.Context, userID string, id string, bucket string) (*models.ClickStats, error) {
+	url, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", models.ErrURLNotFound, err.Error())
+	}
+	// Only the creator of the url can see its stats.
+	if url.UserID != userID {
+		return nil, models.ErrNotOwner
+	}
+	stats, err := s.repo.GetClickStats(ctx, id, bucket)
+	if err != nil {
+		return nil, err
+	}
+	stats.Variants = variantClicks(url.Variants, stats.Variants)
+	return stats, nil
+}
+
+// UpdateURL changes the target of a url created by user
+func (s *ShortenerImpl) UpdateURL(ctx context.Context, userID string, id string, longURL string) (*models.URL, error) {
+	if !validators.IsURL(longURL) {
+		return nil, models.ErrInvalidURL
+	}
+	update := &models.URL{ShortURL: id, LongURL: longURL, UserID: userID}
+	if err := s.normalize(update); err != nil {
+		return nil, err
+	}
+	if err := s.checkDestination(update.LongURL); err != nil {
+		return nil, err
+	}
+	url, err := s.repo.UpdateURL(ctx, update, time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrURLNotFound), errors.Is(err, models.ErrNotOwner),
+			errors.Is(err, models.ErrURLDeleted), errors.Is(err, models.ErrDuplicate):
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+	}
+	return url, nil
+}
+
+// Rules gets redirect rules of a url created by user
+func (s *ShortenerImpl) Rules(ctx context.Context, userID string, id string) ([]*models.RedirectRule, error) {
+	url, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", models.ErrURLNotFound, err.Error())
+	}
+	// Only the creator of the url can see its rules.
+	if url.UserID != userID {
+		return nil, models.ErrNotOwner
+	}
+	return url.Rules, nil
+}
+
+// SetRules replaces redirect rules of a url created by user, an empty list removes them
+func (s *ShortenerImpl) SetRules(ctx context.Context, userID string, id string, rules []*models.RedirectRule) (*models.URL, error) {
+	if err := validateRules(rules); err != nil {
+		return nil, err
+	}
+	for _, v := range rules {
+		if err := s.checkDestination(v.Target); err != nil {
+			return nil, err
+		}
+	}
+	if len(rules) == 0 {
+		rules = nil
+	}
+	url, err := s.repo.SetRules(ctx, &models.URL{ShortURL: id, UserID: userID, Rules: rules})
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrURLNotFound), errors.Is(err, models.ErrNotOwner), errors.Is(err, models.ErrURLDeleted):
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+	}
+	return url, nil
+}
+
+// BlockURL blocks or unblocks a url of any user, blocked urls show a warning with reason instead of redirecting
+func (s *ShortenerImpl) BlockURL(ctx context.Context, id string, blocked bool, reason string) (*models.URL, error) {
+	if !blocked {
+		reason = ""
+	}
+	url, err := s.repo.SetBlocked(ctx, &models.URL{ShortURL: id, Blocked: blocked, BlockReason: reason})
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidID) {
+			return nil, fmt.Errorf("%w: %s", models.ErrURLNotFound, id)
+		}
+		return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+	}
+	return url, nil
+}
+
+// URLHistory gets previous targets of a url created by user
+func (s *ShortenerImpl) URLHistory(ctx context.Context, userID string, id string) ([]*models.URLVersion, error) {
+	url, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", models.ErrURLNotFound, err.Error())
+	}
+	// Only the creator of the url can see its history.
+	if url.UserID != userID {
+		return nil, models.ErrNotOwner
+	}
+	history, err := s.repo.GetHistory(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+	}
+	return history, nil
+}
+
+// Close finishes delete jobs, handles published events, writes recorded clicks to repository and stops delivery of webhooks
+func (s *ShortenerImpl) Close() error {
+	close(s.done)
+	s.jobs.Wait()
+	// Subscribers handle the published events first, so webhooks get them into the outbox.
+	s.events.Close()
+	err := s.recorder.Close()
+	if werr := s.webhooks.Close(); err == nil {
+		err = werr
+	}
+	return err
+}
+
+// ExpandUser gets a page of user links
+func (s *ShortenerImpl) ExpandUser(ctx context.Context, userID string, q *models.URLQuery) (*models.URLPage, error) {
+	if q.Limit < 0 {
+		return nil, models.ErrInvalidQuery
+	}
+	// Request one extra URL to find out if there is a next page.
+	query := *q
+	if query.Limit > 0 {
+		query.Limit++
+	}
 	// Get the list of URLs created by user.
-	urls, err := s.repo.GetByUser(ctx, userID)
+	urls, err := s.repo.GetByUser(ctx, userID, &query)
 	if err != nil {
 		return nil, err
 	}
 	if len(urls) == 0 {
 		return nil, models.ErrNoContent
 	}
-	return urls, nil
+	page := &models.URLPage{URLs: urls}
+	if q.Limit > 0 && len(urls) > q.Limit {
+		page.URLs = urls[:q.Limit]
+		last := page.URLs[q.Limit-1]
+		page.NextCursor = encoders.EncodeCursor(&models.Cursor{CreatedAt: last.CreatedAt, ShortURL: last.ShortURL})
+	}
+	return page, nil
 }
 
 // BuildURL appends domain to a short link when using rest api
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/utils/validators"
+)
+
+// maxVariants is the maximal number of variants of a split url.
+const maxVariants = 10
+
+// validateVariants checks that a split url has at least two variants with valid targets and positive weights.
+func validateVariants(variants []*models.Variant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+	if len(variants) < 2 || len(variants) > maxVariants {
+		return models.ErrInvalidVariants
+	}
+	for _, v := range variants {
+		if v == nil || v.Weight <= 0 || !validators.IsURL(v.Target) {
+			return models.ErrInvalidVariants
+		}
+	}
+	return nil
+}
+
+// splitter picks variants of split urls in proportion to their weights.
+type splitter struct {
+	// rnd is the source of picks.
+	rnd *rand.Rand
+	// Mutex synchronizes access to rnd.
+	sync.Mutex
+}
+
+// newSplitter creates a splitter seeded with current time.
+func newSplitter() *splitter {
+	return &splitter{rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// pick returns the number of a variant starting with 1, chosen with probability proportional to its weight.
+func (s *splitter) pick(variants []*models.Variant) int {
+	var total int
+	for _, v := range variants {
+		total += v.Weight
+	}
+	s.Lock()
+	n := s.rnd.Intn(total)
+	s.Unlock()
+	for i, v := range variants {
+		if n < v.Weight {
+			return i + 1
+		}
+		n -= v.Weight
+	}
+	return len(variants)
+}
+
+// variantClicks returns click counts of all variants along with their targets.
+func variantClicks(variants []*models.Variant, counted []models.VariantClicks) []models.VariantClicks {
+	if len(variants) == 0 {
+		return nil
+	}
+	clicks := make([]models.VariantClicks, len(variants))
+	for i, v := range variants {
+		clicks[i] = models.VariantClicks{Variant: i + 1, Target: v.Target}
+	}
+	for _, v := range counted {
+		// Clicks of variants removed from the url are not reported.
+		if v.Variant > 0 && v.Variant <= len(clicks) {
+			clicks[v.Variant-1].Count = v.Count
+		}
+	}
+	return clicks
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+func TestValidateVariants(t *testing.T) {
+	tests := []struct {
+		name     string
+		variants []*models.Variant
+		err      error
+	}{
+		{name: "Not split"},
+		{name: "Valid variants", variants: []*models.Variant{{Target: "https://example.com/a", Weight: 1}, {Target: "https://example.com/b", Weight: 3}}},
+		{name: "Single variant", variants: []*models.Variant{{Target: "https://example.com/a", Weight: 1}}, err: models.ErrInvalidVariants},
+		{name: "Zero weight", variants: []*models.Variant{{Target: "https://example.com/a", Weight: 1}, {Target: "https://example.com/b"}}, err: models.ErrInvalidVariants},
+		{name: "Missing target", variants: []*models.Variant{{Target: "https://example.com/a", Weight: 1}, {Weight: 1}}, err: models.ErrInvalidVariants},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, validateVariants(tt.variants), tt.err)
+		})
+	}
+}
+
+func TestSplitter_Pick(t *testing.T) {
+	s := newSplitter()
+	variants := []*models.Variant{{Target: "https://example.com/a", Weight: 1}, {Target: "https://example.com/b", Weight: 0}, {Target: "https://example.com/c", Weight: 3}}
+	picks := make(map[int]int)
+	for i := 0; i < 4000; i++ {
+		picks[s.pick(variants)]++
+	}
+	assert.Zero(t, picks[2])
+	assert.InDelta(t, 1000, picks[1], 150)
+	assert.InDelta(t, 3000, picks[3], 150)
+}
+
+func TestVariantClicks(t *testing.T) {
+	variants := []*models.Variant{{Target: "https://example.com/a", Weight: 1}, {Target: "https://example.com/b", Weight: 1}}
+	// Clicks of removed variants are dropped and variants without clicks are reported.
+	got := variantClicks(variants, []models.VariantClicks{{Variant: 1, Count: 5}, {Variant: 3, Count: 2}})
+	assert.Equal(t, []models.VariantClicks{
+		{Variant: 1, Target: "https://example.com/a", Count: 5},
+		{Variant: 2, Target: "https://example.com/b"},
+	}, got)
+	assert.Nil(t, variantClicks(nil, []models.VariantClicks{{Variant: 1, Count: 5}}))
+}
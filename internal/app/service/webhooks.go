@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/config"
+	"github.com/Mldlr/url-shortener/internal/app/events"
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/utils/validators"
+	"github.com/Mldlr/url-shortener/internal/app/webhook"
+)
+
+// Defaults of webhook deliveries when config is not provided.
+const (
+	defaultWebhookMaxAttempts = 8
+	defaultWebhookBackoff     = 10
+	defaultWebhookTimeout     = 10
+)
+
+// Fixed limits of webhook deliveries.
+const (
+	// webhookMaxBackoff caps delays between retries of a delivery.
+	webhookMaxBackoff = time.Hour
+	// webhookInterval is the time between checks of the outbox for due retries.
+	webhookInterval = 5 * time.Second
+)
+
+// maxWebhooks is the number of webhooks a user can register.
+const maxWebhooks = 10
+
+// webhookOptions returns options of webhook deliveries from config.
+func webhookOptions(cfg *config.Config) webhook.Options {
+	opts := webhook.Options{
+		MaxAttempts:  defaultWebhookMaxAttempts,
+		Backoff:      defaultWebhookBackoff * time.Second,
+		MaxBackoff:   webhookMaxBackoff,
+		Timeout:      defaultWebhookTimeout * time.Second,
+		Interval:     webhookInterval,
+		BlockPrivate: true,
+	}
+	if cfg == nil {
+		return opts
+	}
+	opts.BlockPrivate = cfg.BlockPrivate
+	if cfg.WebhookMaxAttempts > 0 {
+		opts.MaxAttempts = cfg.WebhookMaxAttempts
+	}
+	if cfg.WebhookBackoff > 0 {
+		opts.Backoff = time.Duration(cfg.WebhookBackoff) * time.Second
+	}
+	if cfg.WebhookTimeout > 0 {
+		opts.Timeout = time.Duration(cfg.WebhookTimeout) * time.Second
+	}
+	return opts
+}
+
+// AddWebhook registers an endpoint of user receiving events of the given types, all of them if none are given.
+// The returned webhook holds the secret signing its payloads.
+func (s *ShortenerImpl) AddWebhook(ctx context.Context, userID string, endpoint string, types []string) (*models.Webhook, error) {
+	if err := s.checkWebhookURL(endpoint); err != nil {
+		return nil, err
+	}
+	types, err := validateEvents(types)
+	if err != nil {
+		return nil, err
+	}
+	store := s.webhooks.Store()
+	hooks, err := store.Webhooks(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+	}
+	if len(hooks) >= maxWebhooks {
+		return nil, fmt.Errorf("%w: at most %d webhooks per user", models.ErrInvalidWebhook, maxWebhooks)
+	}
+	hook := &models.Webhook{
+		ID:        webhook.NewID(),
+		UserID:    userID,
+		URL:       endpoint,
+		Events:    types,
+		Secret:    webhook.NewSecret(),
+		CreatedAt: time.Now(),
+	}
+	if err = store.AddWebhook(ctx, hook); err != nil {
+		return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+	}
+	s.webhooks.Forget(userID)
+	return hook, nil
+}
+
+// checkWebhookURL checks if events can be posted to endpoint, it must be an http url allowed by the destination policy.
+func (s *ShortenerImpl) checkWebhookURL(endpoint string) error {
+	if !validators.IsURL(endpoint) {
+		return models.ErrInvalidWebhook
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (!strings.EqualFold(u.Scheme, "http") && !strings.EqualFold(u.Scheme, "https")) {
+		return models.ErrInvalidWebhook
+	}
+	return s.checkDestination(endpoint)
+}
+
+// validateEvents checks types of events of a webhook, dropping repeated ones.
+func validateEvents(types []string) ([]string, error) {
+	var valid []string
+	seen := make(map[string]bool)
+	for _, v := range types {
+		known := false
+		for _, t := range models.EventTypes {
+			known = known || v == t
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: unknown event %q", models.ErrInvalidWebhook, v)
+		}
+		if !seen[v] {
+			seen[v] = true
+			valid = append(valid, v)
+		}
+	}
+	return valid, nil
+}
+
+// Webhooks gets webhooks registered by user, their secrets are not shown.
+func (s *ShortenerImpl) Webhooks(ctx context.Context, userID string) ([]*models.Webhook, error) {
+	hooks, err := s.webhooks.Store().Webhooks(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+	}
+	for _, v := range hooks {
+		v.Secret = ""
+	}
+	return hooks, nil
+}
+
+// DeleteWebhook deletes a webhook registered by user, its pending deliveries are dropped.
+func (s *ShortenerImpl) DeleteWebhook(ctx context.Context, userID string, id string) error {
+	err := s.webhooks.Store().DeleteWebhook(ctx, userID, id)
+	if err != nil {
+		if errors.Is(err, models.ErrWebhookNotFound) {
+			return err
+		}
+		return fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+	}
+	s.webhooks.Forget(userID)
+	return nil
+}
+
+// WebhookDeliveries gets the latest delivery attempts of a webhook registered by user, oldest first.
+func (s *ShortenerImpl) WebhookDeliveries(ctx context.Context, userID string, id string) ([]*models.DeliveryAttempt, error) {
+	store := s.webhooks.Store()
+	hooks, err := store.Webhooks(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+	}
+	found := false
+	for _, v := range hooks {
+		found = found || v.ID == id
+	}
+	if !found {
+		return nil, models.ErrWebhookNotFound
+	}
+	attempts, err := store.DeliveryLog(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", models.ErrRepoError, err.Error())
+	}
+	return attempts, nil
+}
+
+// deliverEvent adds events of links to the outbox of webhooks of their owners before they are published.
+// Failures are logged only, the change of the link is done already.
+func (s *ShortenerImpl) deliverEvent(event events.Event) {
+	var url *models.URL
+	var at time.Time
+	switch e := event.(type) {
+	case events.LinkCreated:
+		url, at = e.URL, e.Time
+	case events.LinkDeleted:
+		url, at = e.URL, e.Time
+	case events.LinkClicked:
+		url, at = e.URL, e.Time
+	default:
+		return
+	}
+	if url.UserID == "" {
+		return
+	}
+	err := s.webhooks.Emit(context.Background(), &models.Event{
+		ID:       webhook.NewID(),
+		Type:     event.Name(),
+		UserID:   url.UserID,
+		ShortURL: url.ShortURL,
+		LongURL:  url.LongURL,
+		Time:     at,
+	})
+	if err != nil {
+		log.Printf("error emitting %s event of %s : %v", event.Name(), url.ShortURL, err)
+	}
+}
@@ -0,0 +1,735 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// Buckets of the bolt storage.
+var (
+	// boltURLs maps short URLs to their corresponding URL models.
+	boltURLs = []byte("urls")
+	// boltLong maps long URLs to their short URLs.
+	boltLong = []byte("long")
+	// boltUsers indexes short URLs by user ID, keys are user ID and short URL joined by userKeySep.
+	boltUsers = []byte("users")
+	// boltClicks holds a nested bucket of recorded clicks for every short URL.
+	boltClicks = []byte("clicks")
+	// boltHistory holds a nested bucket of previous targets for every short URL.
+	boltHistory = []byte("history")
+	// boltQuotas maps user IDs to their own quotas.
+	boltQuotas = []byte("quotas")
+	// boltJobs maps IDs to delete jobs.
+	boltJobs = []byte("jobs")
+)
+
+// userKeySep separates user ID and short URL in keys of the users bucket.
+const userKeySep = 0
+
+// BoltRepo is a url storage in an embedded bolt database.
+type BoltRepo struct {
+	// db is the bolt database, it synchronizes access by itself.
+	db *bolt.DB
+	// leases maps IDs of delete jobs to their owners and leases, they are kept in memory only,
+	// as no other process can open the database.
+	leases map[string]jobLease
+	// leasesMu guards leases.
+	leasesMu sync.Mutex
+	// idSource generates short IDs.
+	idSource
+}
+
+// jobLease is the owner of a delete job and the time they hold it until.
+type jobLease struct {
+	owner string
+	until *time.Time
+}
+
+// NewBoltRepo opens the bolt database file creating it and its buckets if needed.
+func NewBoltRepo(filename string) (*BoltRepo, error) {
+	db, err := bolt.Open(filename, 0666, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening bolt db : %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltURLs, boltLong, boltUsers, boltClicks, boltHistory, boltQuotas, boltJobs} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating bolt buckets : %v", err)
+	}
+	return &BoltRepo{db: db, leases: make(map[string]jobLease), idSource: newIDSource()}, nil
+}
+
+// userKey returns the key of a short url in the users bucket.
+func userKey(userID, shortURL string) []byte {
+	key := make([]byte, 0, len(userID)+len(shortURL)+1)
+	key = append(key, userID...)
+	key = append(key, userKeySep)
+	return append(key, shortURL...)
+}
+
+// itob encodes a sequence number as a big-endian key so keys sort in numeric order.
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// getURL reads a url by short url, it returns nil if there is none.
+func getURL(tx *bolt.Tx, id string) (*models.URL, error) {
+	data := tx.Bucket(boltURLs).Get([]byte(id))
+	if data == nil {
+		return nil, nil
+	}
+	url := &models.URL{}
+	if err := json.Unmarshal(data, url); err != nil {
+		return nil, fmt.Errorf("error decoding url %s : %v", id, err)
+	}
+	return url, nil
+}
+
+// putURL writes a url without changing indexes.
+func putURL(tx *bolt.Tx, url *models.URL) error {
+	data, err := json.Marshal(url)
+	if err != nil {
+		return fmt.Errorf("error encoding url %s : %v", url.ShortURL, err)
+	}
+	return tx.Bucket(boltURLs).Put([]byte(url.ShortURL), data)
+}
+
+// insert writes a new url and indexes it by long url and user.
+func insert(tx *bolt.Tx, url *models.URL) error {
+	if err := putURL(tx, url); err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltLong).Put([]byte(url.LongURL), []byte(url.ShortURL)); err != nil {
+		return err
+	}
+	return tx.Bucket(boltUsers).Put(userKey(url.UserID, url.ShortURL), []byte{})
+}
+
+// purgeURL removes url with its indexes, clicks and history.
+func purgeURL(tx *bolt.Tx, url *models.URL) error {
+	id := []byte(url.ShortURL)
+	if err := tx.Bucket(boltURLs).Delete(id); err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltLong).Delete([]byte(url.LongURL)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltUsers).Delete(userKey(url.UserID, url.ShortURL)); err != nil {
+		return err
+	}
+	for _, name := range [][]byte{boltClicks, boltHistory} {
+		if err := tx.Bucket(name).DeleteBucket(id); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// findURLs returns stored urls matching the filter.
+func findURLs(tx *bolt.Tx, match func(url *models.URL) bool) ([]*models.URL, error) {
+	var urls []*models.URL
+	err := tx.Bucket(boltURLs).ForEach(func(k, v []byte) error {
+		url := &models.URL{}
+		if err := json.Unmarshal(v, url); err != nil {
+			return fmt.Errorf("error decoding url %s : %v", k, err)
+		}
+		if match(url) {
+			urls = append(urls, url)
+		}
+		return nil
+	})
+	return urls, err
+}
+
+// getHistory reads previous targets of a url.
+func getHistory(tx *bolt.Tx, id string) ([]*models.URLVersion, error) {
+	b := tx.Bucket(boltHistory).Bucket([]byte(id))
+	if b == nil {
+		return nil, nil
+	}
+	var history []*models.URLVersion
+	err := b.ForEach(func(k, v []byte) error {
+		version := &models.URLVersion{}
+		if err := json.Unmarshal(v, version); err != nil {
+			return fmt.Errorf("error decoding history of %s : %v", id, err)
+		}
+		history = append(history, version)
+		return nil
+	})
+	return history, err
+}
+
+// Get returns original link by ID or an error if id is not present
+func (r *BoltRepo) Get(ctx context.Context, id string) (*models.URL, error) {
+	var url *models.URL
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var err error
+		url, err = getURL(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if url == nil {
+		return nil, fmt.Errorf("%w: %s", models.ErrInvalidID, id)
+	}
+	return url, nil
+}
+
+// Add adds a link to storage.
+func (r *BoltRepo) Add(ctx context.Context, url *models.URL) (bool, error) {
+	var duplicate bool
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		duplicate, err = r.add(tx, url)
+		return err
+	})
+	return duplicate, err
+}
+
+// AddBatch adds multiple URLs to storage in a single transaction.
+func (r *BoltRepo) AddBatch(ctx context.Context, urls []*models.URL) (bool, error) {
+	var duplicates bool
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		for _, v := range urls {
+			duplicate, err := r.add(tx, v)
+			if err != nil {
+				return err
+			}
+			v.Duplicate = duplicate
+			duplicates = duplicates || duplicate
+		}
+		return nil
+	})
+	return duplicates, err
+}
+
+// add adds url unless its long url is stored already, in which case it reports a duplicate.
+func (r *BoltRepo) add(tx *bolt.Tx, url *models.URL) (bool, error) {
+	// Check for url in index and return if it already exists.
+	if short := tx.Bucket(boltLong).Get([]byte(url.LongURL)); short != nil {
+		url.ShortURL = string(short)
+		return true, nil
+	}
+	// Regenerate short url if it is used by another record.
+	urls := tx.Bucket(boltURLs)
+	taken := func(id string) bool {
+		return urls.Get([]byte(id)) != nil
+	}
+	if err := r.resolve(url, taken); err != nil {
+		return false, err
+	}
+	return false, insert(tx, url)
+}
+
+// GetByLong finds the url stored for a long url, nil if it isn't stored.
+func (r *BoltRepo) GetByLong(ctx context.Context, longURL string) (*models.URL, error) {
+	var url *models.URL
+	err := r.db.View(func(tx *bolt.Tx) error {
+		short := tx.Bucket(boltLong).Get([]byte(longURL))
+		if short == nil {
+			return nil
+		}
+		var err error
+		url, err = getURL(tx, string(short))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return url, nil
+}
+
+// GetByUser finds a page of URLs created by user.
+func (r *BoltRepo) GetByUser(ctx context.Context, userID string, q *models.URLQuery) ([]*models.URL, error) {
+	var urls []*models.URL
+	err := r.db.View(func(tx *bolt.Tx) error {
+		prefix := userKey(userID, "")
+		c := tx.Bucket(boltUsers).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			url, err := getURL(tx, string(k[len(prefix):]))
+			if err != nil {
+				return err
+			}
+			if url != nil {
+				urls = append(urls, url)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pageURLs(urls, q), nil
+}
+
+// DeleteURLs marks urls created by user as deleted.
+func (r *BoltRepo) DeleteURLs(deleteURLs []*models.DeleteURLItem) (int, error) {
+	var deleted []*models.DeleteURLItem
+	now := time.Now()
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		// For each of the urls check if the user created this url and delete it if confirmed.
+		for _, v := range deleteURLs {
+			url, err := getURL(tx, v.ShortURL)
+			if err != nil {
+				return err
+			}
+			if url == nil || url.UserID != v.UserID || url.Deleted {
+				continue
+			}
+			url.Deleted = true
+			url.DeletedAt = &now
+			if err = putURL(tx, url); err != nil {
+				return err
+			}
+			deleted = append(deleted, v)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	// Items are marked once the transaction is committed.
+	for _, v := range deleted {
+		v.Deleted = true
+	}
+	return len(deleted), nil
+}
+
+// RestoreURLs restores deleted urls created by user.
+func (r *BoltRepo) RestoreURLs(restoreURLs []*models.DeleteURLItem) (int, error) {
+	var n int
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		for _, v := range restoreURLs {
+			url, err := getURL(tx, v.ShortURL)
+			if err != nil {
+				return err
+			}
+			if url == nil || !url.Deleted || url.UserID != v.UserID {
+				continue
+			}
+			url.Deleted = false
+			url.DeletedAt = nil
+			if err = putURL(tx, url); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// PurgeDeleted removes urls deleted before the given time.
+func (r *BoltRepo) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	return r.removeMatching(func(url *models.URL) bool {
+		return url.Deleted && url.DeletedAt != nil && !url.DeletedAt.After(before)
+	})
+}
+
+// DeleteExpired removes urls expired by now.
+func (r *BoltRepo) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	return r.removeMatching(func(url *models.URL) bool {
+		return url.Expired(now)
+	})
+}
+
+// removeMatching removes urls matching the filter and returns their count.
+func (r *BoltRepo) removeMatching(match func(url *models.URL) bool) (int, error) {
+	var n int
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		// Buckets can't be changed while they are iterated, so matching urls are collected first.
+		urls, err := findURLs(tx, match)
+		if err != nil {
+			return err
+		}
+		for _, v := range urls {
+			if err = purgeURL(tx, v); err != nil {
+				return err
+			}
+		}
+		n = len(urls)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// UpdateURL changes the target of a url created by user and keeps the previous one in history.
+func (r *BoltRepo) UpdateURL(ctx context.Context, url *models.URL, now time.Time) (*models.URL, error) {
+	var updated *models.URL
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		stored, err := getURL(tx, url.ShortURL)
+		if err != nil {
+			return err
+		}
+		var existing *models.URL
+		if short := tx.Bucket(boltLong).Get([]byte(url.LongURL)); short != nil {
+			existing = &models.URL{ShortURL: string(short)}
+		}
+		if err = checkUpdate(stored, url, existing); err != nil {
+			return err
+		}
+		if stored.LongURL == url.LongURL {
+			updated = stored
+			return nil
+		}
+		history, err := getHistory(tx, url.ShortURL)
+		if err != nil {
+			return err
+		}
+		var version *models.URLVersion
+		updated, version = retarget(stored, url.LongURL, history, now)
+		versions, err := tx.Bucket(boltHistory).CreateBucketIfNotExists([]byte(url.ShortURL))
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(version)
+		if err != nil {
+			return fmt.Errorf("error encoding history of %s : %v", url.ShortURL, err)
+		}
+		if err = versions.Put(itob(uint64(version.Version)), data); err != nil {
+			return err
+		}
+		long := tx.Bucket(boltLong)
+		if err = long.Delete([]byte(stored.LongURL)); err != nil {
+			return err
+		}
+		if err = long.Put([]byte(updated.LongURL), []byte(updated.ShortURL)); err != nil {
+			return err
+		}
+		return putURL(tx, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// GetHistory returns previous targets of a url.
+func (r *BoltRepo) GetHistory(ctx context.Context, id string) ([]*models.URLVersion, error) {
+	var history []*models.URLVersion
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var err error
+		history, err = getHistory(tx, id)
+		return err
+	})
+	return history, err
+}
+
+// AddClicks stores recorded clicks.
+func (r *BoltRepo) AddClicks(ctx context.Context, clicks []*models.Click) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		for _, v := range clicks {
+			b, err := tx.Bucket(boltClicks).CreateBucketIfNotExists([]byte(v.ShortURL))
+			if err != nil {
+				return err
+			}
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("error encoding click : %v", err)
+			}
+			if err = b.Put(itob(seq), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetRules replaces redirect rules of a url created by user.
+func (r *BoltRepo) SetRules(ctx context.Context, url *models.URL) (*models.URL, error) {
+	var updated *models.URL
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		updated, err = getURL(tx, url.ShortURL)
+		if err != nil {
+			return err
+		}
+		if err = checkUpdate(updated, url, nil); err != nil {
+			return err
+		}
+		updated.Rules = url.Rules
+		return putURL(tx, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// SetBlocked blocks or unblocks a url regardless of its owner.
+func (r *BoltRepo) SetBlocked(ctx context.Context, url *models.URL) (*models.URL, error) {
+	var updated *models.URL
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		updated, err = getURL(tx, url.ShortURL)
+		switch {
+		case err != nil:
+			return err
+		case updated == nil:
+			return fmt.Errorf("%w: %s", models.ErrInvalidID, url.ShortURL)
+		}
+		updated.Blocked, updated.BlockReason = url.Blocked, url.BlockReason
+		return putURL(tx, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// CountURLs counts urls kept by user and urls they created since the given time.
+func (r *BoltRepo) CountURLs(ctx context.Context, userID string, since time.Time) (int, int, error) {
+	var urls []*models.URL
+	err := r.db.View(func(tx *bolt.Tx) error {
+		prefix := userKey(userID, "")
+		c := tx.Bucket(boltUsers).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			url, err := getURL(tx, string(k[len(prefix):]))
+			if err != nil {
+				return err
+			}
+			if url != nil {
+				urls = append(urls, url)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	total, created := countURLs(urls, since)
+	return total, created, nil
+}
+
+// GetQuota returns the quota of user, nil if they have none of their own.
+func (r *BoltRepo) GetQuota(ctx context.Context, userID string) (*models.Quota, error) {
+	var quota *models.Quota
+	err := r.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltQuotas).Get([]byte(userID))
+		if data == nil {
+			return nil
+		}
+		quota = &models.Quota{}
+		if err := json.Unmarshal(data, quota); err != nil {
+			return fmt.Errorf("error decoding quota : %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return quota, nil
+}
+
+// SetQuota stores the quota of a user replacing their previous one.
+func (r *BoltRepo) SetQuota(ctx context.Context, quota *models.Quota) error {
+	data, err := json.Marshal(quota)
+	if err != nil {
+		return fmt.Errorf("error encoding quota : %v", err)
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltQuotas).Put([]byte(quota.UserID), data)
+	})
+}
+
+// GetJob returns a delete job, nil if there is none with the ID.
+func (r *BoltRepo) GetJob(ctx context.Context, id string) (*models.Job, error) {
+	var job *models.Job
+	err := r.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltJobs).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		job = &models.Job{}
+		if err := json.Unmarshal(data, job); err != nil {
+			return fmt.Errorf("error decoding job : %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// ClaimJobs returns the pending delete jobs whose lease ended by now, oldest first, and leases them to owner.
+func (r *BoltRepo) ClaimJobs(ctx context.Context, owner string, now time.Time, lease time.Duration) ([]*models.Job, error) {
+	r.leasesMu.Lock()
+	defer r.leasesMu.Unlock()
+	jobs := make(map[string]*models.Job)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltJobs).ForEach(func(k, v []byte) error {
+			job := &models.Job{}
+			if err := json.Unmarshal(v, job); err != nil {
+				return fmt.Errorf("error decoding job : %v", err)
+			}
+			l := r.leases[job.ID]
+			job.Owner, job.LeaseUntil = l.owner, l.until
+			jobs[job.ID] = job
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	claimed := claimJobs(jobs, owner, now, lease)
+	for _, v := range claimed {
+		r.leases[v.ID] = jobLease{owner: v.Owner, until: v.LeaseUntil}
+	}
+	return claimed, nil
+}
+
+// SaveJob stores a delete job replacing its previous state unless another owner holds it.
+func (r *BoltRepo) SaveJob(ctx context.Context, job *models.Job) error {
+	r.leasesMu.Lock()
+	defer r.leasesMu.Unlock()
+	if err := checkJobOwner(r.leases[job.ID].owner, job); err != nil {
+		return err
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("error encoding job : %v", err)
+	}
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltJobs).Put([]byte(job.ID), data)
+	})
+	if err != nil {
+		return err
+	}
+	r.leases[job.ID] = jobLease{owner: job.Owner, until: job.LeaseUntil}
+	return nil
+}
+
+// ReserveIDs advances the id sequence by n and returns its previous value.
+// The id sequence is kept as the sequence of the urls bucket.
+func (r *BoltRepo) ReserveIDs(ctx context.Context, n uint64) (uint64, error) {
+	var last uint64
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltURLs)
+		last = b.Sequence()
+		return b.SetSequence(last + n)
+	})
+	return last, err
+}
+
+// ConsumeClick counts a redirect of a url limited in clicks, failing once all of them are used.
+func (r *BoltRepo) ConsumeClick(ctx context.Context, id string) (*models.URL, error) {
+	var url *models.URL
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		url, err = getURL(tx, id)
+		switch {
+		case err != nil:
+			return err
+		case url == nil:
+			return fmt.Errorf("%w: %s", models.ErrInvalidID, id)
+		case url.Exhausted():
+			return models.ErrURLExhausted
+		}
+		url.Clicks++
+		return putURL(tx, url)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return url, nil
+}
+
+// GetClickStats counts clicks of a short url grouped by bucket.
+func (r *BoltRepo) GetClickStats(ctx context.Context, id string, bucket string) (*models.ClickStats, error) {
+	var clicks []*models.Click
+	err := r.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltClicks).Bucket([]byte(id))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			c := &models.Click{}
+			if err := json.Unmarshal(v, c); err != nil {
+				return fmt.Errorf("error decoding click : %v", err)
+			}
+			clicks = append(clicks, c)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bucketClicks(id, clicks, bucket)
+}
+
+// Ping checks if the database can be read.
+func (r *BoltRepo) Ping(ctx context.Context) error {
+	return r.db.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+}
+
+// Stats gets count of urls and registered users
+func (r *BoltRepo) Stats(ctx context.Context) (*models.Stats, error) {
+	var stats models.Stats
+	err := r.db.View(func(tx *bolt.Tx) error {
+		stats.URLCount = tx.Bucket(boltLong).Stats().KeyN
+		// Keys of a user are adjacent, so users are counted by changes of the key prefix.
+		var last []byte
+		return tx.Bucket(boltUsers).ForEach(func(k, v []byte) error {
+			user := k[:bytes.IndexByte(k, userKeySep)]
+			if last == nil || !bytes.Equal(user, last) {
+				stats.UserCount++
+				last = user
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// DeleteRepo closes and deletes the database file.
+func (r *BoltRepo) DeleteRepo(ctx context.Context) error {
+	path := r.db.Path()
+	if err := r.db.Close(); err != nil {
+		return fmt.Errorf("error closing bolt db : %v", err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("error deleting bolt db : %v", err)
+	}
+	return nil
+}
+
+// Close closes the database.
+func (r *BoltRepo) Close() error {
+	return r.db.Close()
+}
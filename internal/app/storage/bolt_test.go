@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// newTestBoltRepo opens a bolt storage in a temporary directory.
+func newTestBoltRepo(t *testing.T) *BoltRepo {
+	repo, err := NewBoltRepo(filepath.Join(t.TempDir(), "shortener.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		repo.Close()
+	})
+	return repo
+}
+
+func TestBoltRepo_Add(t *testing.T) {
+	repo := newTestBoltRepo(t)
+	url := &models.URL{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1"}
+	duplicate, err := repo.Add(context.Background(), url)
+	require.NoError(t, err)
+	assert.False(t, duplicate)
+	// The same long url returns the stored short url.
+	url = &models.URL{ShortURL: "2", LongURL: "https://github.com/", UserID: "user2"}
+	duplicate, err = repo.Add(context.Background(), url)
+	require.NoError(t, err)
+	assert.True(t, duplicate)
+	assert.Equal(t, "1", url.ShortURL)
+	// Taken short urls are regenerated.
+	url = &models.URL{ShortURL: "1", LongURL: "https://yandex.ru/", UserID: "user1"}
+	_, err = repo.Add(context.Background(), url)
+	require.NoError(t, err)
+	assert.NotEqual(t, "1", url.ShortURL)
+	got, err := repo.Get(context.Background(), url.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, url, got)
+	_, err = repo.Get(context.Background(), "3")
+	assert.Error(t, err)
+	stats, err := repo.Stats(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &models.Stats{URLCount: 2, UserCount: 1}, stats)
+}
+
+func TestBoltRepo_AddBatch(t *testing.T) {
+	repo := newTestBoltRepo(t)
+	urls := []*models.URL{
+		{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1"},
+		{ShortURL: "2", LongURL: "https://yandex.ru/", UserID: "user1"},
+		{ShortURL: "3", LongURL: "https://github.com/", UserID: "user1"},
+	}
+	duplicates, err := repo.AddBatch(context.Background(), urls)
+	require.NoError(t, err)
+	assert.True(t, duplicates)
+	assert.Equal(t, "1", urls[2].ShortURL)
+	got, err := repo.GetByUser(context.Background(), "user1", &models.URLQuery{})
+	require.NoError(t, err)
+	assert.Equal(t, urls[:2], got)
+}
+
+func TestBoltRepo_GetByUserPage(t *testing.T) {
+	now := time.Now().UTC()
+	repo := newTestBoltRepo(t)
+	urls := []*models.URL{
+		{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1", CreatedAt: now},
+		{ShortURL: "2", LongURL: "https://yandex.ru/", UserID: "user1", CreatedAt: now.Add(time.Second), Deleted: true},
+		{ShortURL: "3", LongURL: "https://gitlab.com/", UserID: "user1", CreatedAt: now.Add(2 * time.Second)},
+		{ShortURL: "4", LongURL: "https://GitHub.com/Mldlr", UserID: "user2", CreatedAt: now.Add(2 * time.Second)},
+	}
+	_, err := repo.AddBatch(context.Background(), urls)
+	require.NoError(t, err)
+	deleted := false
+	tests := []struct {
+		name  string
+		query *models.URLQuery
+		want  []*models.URL
+	}{
+		{
+			name:  "First page",
+			query: &models.URLQuery{Limit: 2},
+			want:  urls[:2],
+		},
+		{
+			name:  "Newest first after cursor",
+			query: &models.URLQuery{Desc: true, After: &models.Cursor{CreatedAt: urls[2].CreatedAt, ShortURL: "3"}},
+			want:  []*models.URL{urls[1], urls[0]},
+		},
+		{
+			name:  "Not deleted",
+			query: &models.URLQuery{Deleted: &deleted},
+			want:  []*models.URL{urls[0], urls[2]},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.GetByUser(context.Background(), "user1", tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBoltRepo_UpdateURL(t *testing.T) {
+	now := time.Now().UTC()
+	repo := newTestBoltRepo(t)
+	urls := []*models.URL{
+		{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1"},
+		{ShortURL: "2", LongURL: "https://yandex.ru/", UserID: "user1"},
+	}
+	_, err := repo.AddBatch(context.Background(), urls)
+	require.NoError(t, err)
+	got, err := repo.UpdateURL(context.Background(), &models.URL{ShortURL: "1", LongURL: "https://gitlab.com/", UserID: "user1"}, now)
+	require.NoError(t, err)
+	assert.Equal(t, "https://gitlab.com/", got.LongURL)
+	_, err = repo.UpdateURL(context.Background(), &models.URL{ShortURL: "1", LongURL: "https://yandex.ru/", UserID: "user1"}, now)
+	assert.ErrorIs(t, err, models.ErrDuplicate)
+	_, err = repo.UpdateURL(context.Background(), &models.URL{ShortURL: "1", LongURL: "https://bitbucket.org/", UserID: "user2"}, now)
+	assert.ErrorIs(t, err, models.ErrNotOwner)
+	_, err = repo.UpdateURL(context.Background(), &models.URL{ShortURL: "3", LongURL: "https://bitbucket.org/", UserID: "user1"}, now)
+	assert.ErrorIs(t, err, models.ErrURLNotFound)
+	// The previous target can be shortened again.
+	url := &models.URL{ShortURL: "5", LongURL: "https://github.com/", UserID: "user1"}
+	duplicate, err := repo.Add(context.Background(), url)
+	require.NoError(t, err)
+	assert.False(t, duplicate)
+	history, err := repo.GetHistory(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, []*models.URLVersion{
+		{ShortURL: "1", Version: 1, LongURL: "https://github.com/", ChangedAt: now},
+	}, history)
+}
+
+func TestBoltRepo_DeleteRestorePurge(t *testing.T) {
+	repo := newTestBoltRepo(t)
+	urls := []*models.URL{
+		{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1"},
+		{ShortURL: "2", LongURL: "https://yandex.ru/", UserID: "user1"},
+	}
+	_, err := repo.AddBatch(context.Background(), urls)
+	require.NoError(t, err)
+	require.NoError(t, repo.AddClicks(context.Background(), []*models.Click{{ShortURL: "1", Time: time.Now()}}))
+	// Only urls of the user are deleted.
+	n, err := repo.DeleteURLs([]*models.DeleteURLItem{{ShortURL: "1", UserID: "user1"}, {ShortURL: "2", UserID: "user2"}, {ShortURL: "3", UserID: "user1"}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	got, err := repo.Get(context.Background(), "1")
+	require.NoError(t, err)
+	assert.True(t, got.Deleted)
+	require.NotNil(t, got.DeletedAt)
+	n, err = repo.RestoreURLs([]*models.DeleteURLItem{{ShortURL: "1", UserID: "user1"}, {ShortURL: "2", UserID: "user1"}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = repo.DeleteURLs([]*models.DeleteURLItem{{ShortURL: "1", UserID: "user1"}})
+	require.NoError(t, err)
+	n, err = repo.PurgeDeleted(context.Background(), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = repo.Get(context.Background(), "1")
+	assert.Error(t, err)
+	clicks, err := repo.GetClickStats(context.Background(), "1", models.BucketDay)
+	require.NoError(t, err)
+	assert.Equal(t, 0, clicks.Total)
+	stats, err := repo.Stats(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &models.Stats{URLCount: 1, UserCount: 1}, stats)
+}
+
+func TestBoltRepo_DeleteExpired(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	repo := newTestBoltRepo(t)
+	urls := []*models.URL{
+		{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1", ExpiresAt: &past},
+		{ShortURL: "2", LongURL: "https://yandex.ru/", UserID: "user1"},
+		{ShortURL: "3", LongURL: "https://gitlab.com/", UserID: "user2", ExpiresAt: &past},
+	}
+	_, err := repo.AddBatch(context.Background(), urls)
+	require.NoError(t, err)
+	n, err := repo.DeleteExpired(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	stats, err := repo.Stats(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &models.Stats{URLCount: 1, UserCount: 1}, stats)
+}
+
+func TestBoltRepo_Reopen(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "shortener.db")
+	repo, err := NewBoltRepo(filename)
+	require.NoError(t, err)
+	url := &models.URL{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1"}
+	_, err = repo.Add(context.Background(), url)
+	require.NoError(t, err)
+	clicks := []*models.Click{{ShortURL: "1", Time: time.Now().UTC()}, {ShortURL: "1", Time: time.Now().UTC()}}
+	require.NoError(t, repo.AddClicks(context.Background(), clicks))
+	require.NoError(t, repo.Close())
+
+	repo, err = NewBoltRepo(filename)
+	require.NoError(t, err)
+	defer repo.Close()
+	got, err := repo.Get(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, url, got)
+	stats, err := repo.GetClickStats(context.Background(), "1", models.BucketHour)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Total)
+}
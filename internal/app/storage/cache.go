@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// CachedRepo is a Repository decorator caching results of Get in a bounded LRU.
+// Unknown ids are cached too, so repeated requests of missing links don't reach the storage.
+// Cached urls are invalidated by changes made through the decorator and expire after ttl,
+// which bounds staleness of changes made by other instances sharing the storage.
+type CachedRepo struct {
+	// Repository is the decorated storage.
+	Repository
+	// size is the maximal number of cached ids.
+	size int
+	// ttl is the time a cached url stays valid.
+	ttl time.Duration
+	// entries maps short urls to their elements of order.
+	entries map[string]*list.Element
+	// order lists cache entries from the most to the least recently used.
+	order *list.List
+	// generation is increased by every invalidation, so urls read before it aren't cached after it.
+	generation uint64
+	// now returns current time.
+	now func() time.Time
+	// hits counts Get calls served from cache.
+	hits atomic.Int64
+	// misses counts Get calls passed to the storage.
+	misses atomic.Int64
+	// Mutex synchronizes access to the cache.
+	sync.Mutex
+}
+
+// cacheEntry is a cached result of Get.
+type cacheEntry struct {
+	// id is the short url.
+	id string
+	// url is the stored url, nil if id is unknown.
+	url *models.URL
+	// expires is the time the entry becomes invalid.
+	expires time.Time
+}
+
+// NewCachedRepo wraps repo with a cache of size ids valid for ttl.
+func NewCachedRepo(repo Repository, size int, ttl time.Duration) *CachedRepo {
+	return &CachedRepo{
+		Repository: repo,
+		size:       size,
+		ttl:        ttl,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// Get returns url by id from cache or reads it from the storage on a miss.
+func (r *CachedRepo) Get(ctx context.Context, id string) (*models.URL, error) {
+	entry, generation := r.lookup(id)
+	if entry != nil {
+		r.hits.Add(1)
+		if entry.url == nil {
+			return nil, fmt.Errorf("%w: %s", models.ErrInvalidID, id)
+		}
+		return entry.url, nil
+	}
+	r.misses.Add(1)
+	url, err := r.Repository.Get(ctx, id)
+	// Only unknown ids are cached as missing, other errors may be transient.
+	if err != nil && !errors.Is(err, models.ErrInvalidID) {
+		return nil, err
+	}
+	r.store(id, url, generation)
+	return url, err
+}
+
+// lookup returns a valid cache entry of id or nil and the current generation on a miss.
+func (r *CachedRepo) lookup(id string) (*cacheEntry, uint64) {
+	r.Lock()
+	defer r.Unlock()
+	el, ok := r.entries[id]
+	if !ok {
+		return nil, r.generation
+	}
+	entry := el.Value.(*cacheEntry)
+	if !r.now().Before(entry.expires) {
+		r.order.Remove(el)
+		delete(r.entries, id)
+		return nil, r.generation
+	}
+	r.order.MoveToFront(el)
+	return entry, r.generation
+}
+
+// store caches url of id read in generation, evicting the least recently used entry if cache is full.
+func (r *CachedRepo) store(id string, url *models.URL, generation uint64) {
+	r.Lock()
+	defer r.Unlock()
+	// The url might have been changed since it was read.
+	if generation != r.generation {
+		return
+	}
+	entry := &cacheEntry{id: id, url: url, expires: r.now().Add(r.ttl)}
+	if el, ok := r.entries[id]; ok {
+		el.Value = entry
+		r.order.MoveToFront(el)
+		return
+	}
+	r.entries[id] = r.order.PushFront(entry)
+	if r.order.Len() > r.size {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.entries, oldest.Value.(*cacheEntry).id)
+	}
+}
+
+// invalidate removes ids from cache.
+func (r *CachedRepo) invalidate(ids ...string) {
+	r.Lock()
+	defer r.Unlock()
+	r.generation++
+	for _, id := range ids {
+		if el, ok := r.entries[id]; ok {
+			r.order.Remove(el)
+			delete(r.entries, id)
+		}
+	}
+}
+
+// flush removes all ids from cache.
+func (r *CachedRepo) flush() {
+	r.Lock()
+	defer r.Unlock()
+	r.generation++
+	r.entries = make(map[string]*list.Element)
+	r.order.Init()
+}
+
+// Add adds a link to storage and drops the cached unknown id it is stored under.
+func (r *CachedRepo) Add(ctx context.Context, url *models.URL) (bool, error) {
+	duplicate, err := r.Repository.Add(ctx, url)
+	r.invalidate(url.ShortURL)
+	return duplicate, err
+}
+
+// AddBatch adds multiple URLs to storage and drops the cached unknown ids they are stored under.
+func (r *CachedRepo) AddBatch(ctx context.Context, urls []*models.URL) (bool, error) {
+	duplicates, err := r.Repository.AddBatch(ctx, urls)
+	ids := make([]string, len(urls))
+	for i, v := range urls {
+		ids[i] = v.ShortURL
+	}
+	r.invalidate(ids...)
+	return duplicates, err
+}
+
+// DeleteURLs deletes urls in storage and drops them from cache.
+func (r *CachedRepo) DeleteURLs(deleteURLs []*models.DeleteURLItem) (int, error) {
+	n, err := r.Repository.DeleteURLs(deleteURLs)
+	r.invalidate(itemIDs(deleteURLs)...)
+	return n, err
+}
+
+// RestoreURLs restores urls in storage and drops them from cache.
+func (r *CachedRepo) RestoreURLs(restoreURLs []*models.DeleteURLItem) (int, error) {
+	n, err := r.Repository.RestoreURLs(restoreURLs)
+	r.invalidate(itemIDs(restoreURLs)...)
+	return n, err
+}
+
+// itemIDs returns short urls of items.
+func itemIDs(items []*models.DeleteURLItem) []string {
+	ids := make([]string, len(items))
+	for i, v := range items {
+		ids[i] = v.ShortURL
+	}
+	return ids
+}
+
+// UpdateURL changes the target of a url in storage and drops it from cache.
+func (r *CachedRepo) UpdateURL(ctx context.Context, url *models.URL, now time.Time) (*models.URL, error) {
+	updated, err := r.Repository.UpdateURL(ctx, url, now)
+	r.invalidate(url.ShortURL)
+	return updated, err
+}
+
+// ConsumeClick counts a redirect of a url limited in clicks in storage and drops it from cache.
+func (r *CachedRepo) ConsumeClick(ctx context.Context, id string) (*models.URL, error) {
+	url, err := r.Repository.ConsumeClick(ctx, id)
+	r.invalidate(id)
+	return url, err
+}
+
+// SetBlocked blocks or unblocks a url in storage and drops it from cache.
+func (r *CachedRepo) SetBlocked(ctx context.Context, url *models.URL) (*models.URL, error) {
+	updated, err := r.Repository.SetBlocked(ctx, url)
+	r.invalidate(url.ShortURL)
+	return updated, err
+}
+
+// SetRules replaces redirect rules of a url in storage and drops it from cache.
+func (r *CachedRepo) SetRules(ctx context.Context, url *models.URL) (*models.URL, error) {
+	updated, err := r.Repository.SetRules(ctx, url)
+	r.invalidate(url.ShortURL)
+	return updated, err
+}
+
+// PurgeDeleted removes urls deleted before the given time from storage and flushes cache.
+func (r *CachedRepo) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	n, err := r.Repository.PurgeDeleted(ctx, before)
+	r.flush()
+	return n, err
+}
+
+// DeleteExpired removes expired urls from storage and flushes cache.
+func (r *CachedRepo) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	n, err := r.Repository.DeleteExpired(ctx, now)
+	r.flush()
+	return n, err
+}
+
+// DeleteRepo deletes repository data and flushes cache.
+func (r *CachedRepo) DeleteRepo(ctx context.Context) error {
+	err := r.Repository.DeleteRepo(ctx)
+	r.flush()
+	return err
+}
+
+// Stats gets count of urls and registered users along with cache hits and misses.
+func (r *CachedRepo) Stats(ctx context.Context) (*models.Stats, error) {
+	stats, err := r.Repository.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats.CacheHits = r.hits.Load()
+	stats.CacheMisses = r.misses.Load()
+	return stats, nil
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// assertCacheStats checks hit and miss counters of cached repository.
+func assertCacheStats(t *testing.T, repo *CachedRepo, hits, misses int64) {
+	t.Helper()
+	stats, err := repo.Stats(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, hits, stats.CacheHits, "hits")
+	assert.Equal(t, misses, stats.CacheMisses, "misses")
+}
+
+func TestCachedRepo_Get(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	repo := NewCachedRepo(NewInMemRepo(), 2, time.Minute)
+	repo.now = func() time.Time { return now }
+	_, err := repo.AddBatch(ctx, []*models.URL{
+		{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1"},
+		{ShortURL: "2", LongURL: "https://yandex.ru/", UserID: "user1"},
+		{ShortURL: "3", LongURL: "https://gitlab.com/", UserID: "user1"},
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		url, err := repo.Get(ctx, "1")
+		require.NoError(t, err)
+		assert.Equal(t, "https://github.com/", url.LongURL)
+	}
+	assertCacheStats(t, repo, 1, 1)
+
+	// Unknown ids are cached as well.
+	for i := 0; i < 2; i++ {
+		_, err = repo.Get(ctx, "4")
+		assert.ErrorIs(t, err, models.ErrInvalidID)
+	}
+	assertCacheStats(t, repo, 2, 2)
+
+	// The least recently used id is evicted.
+	_, err = repo.Get(ctx, "2")
+	require.NoError(t, err)
+	_, err = repo.Get(ctx, "1")
+	require.NoError(t, err)
+	assertCacheStats(t, repo, 2, 4)
+
+	// Entries expire after ttl.
+	now = now.Add(time.Minute)
+	_, err = repo.Get(ctx, "2")
+	require.NoError(t, err)
+	assertCacheStats(t, repo, 2, 5)
+}
+
+func TestCachedRepo_Invalidate(t *testing.T) {
+	ctx := context.Background()
+	repo := NewCachedRepo(NewInMemRepo(), 10, time.Minute)
+	_, err := repo.Get(ctx, "1")
+	require.ErrorIs(t, err, models.ErrInvalidID)
+	// Adding a url drops its cached unknown id.
+	_, err = repo.Add(ctx, &models.URL{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1"})
+	require.NoError(t, err)
+	url, err := repo.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.False(t, url.Deleted)
+
+	_, err = repo.DeleteURLs([]*models.DeleteURLItem{{ShortURL: "1", UserID: "user1"}})
+	require.NoError(t, err)
+	url, err = repo.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.True(t, url.Deleted)
+
+	_, err = repo.RestoreURLs([]*models.DeleteURLItem{{ShortURL: "1", UserID: "user1"}})
+	require.NoError(t, err)
+	_, err = repo.UpdateURL(ctx, &models.URL{ShortURL: "1", LongURL: "https://gitlab.com/", UserID: "user1"}, time.Now())
+	require.NoError(t, err)
+	url, err = repo.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.False(t, url.Deleted)
+	assert.Equal(t, "https://gitlab.com/", url.LongURL)
+
+	_, err = repo.DeleteURLs([]*models.DeleteURLItem{{ShortURL: "1", UserID: "user1"}})
+	require.NoError(t, err)
+	_, err = repo.PurgeDeleted(ctx, time.Now())
+	require.NoError(t, err)
+	_, err = repo.Get(ctx, "1")
+	assert.ErrorIs(t, err, models.ErrInvalidID)
+	assertCacheStats(t, repo, 0, 5)
+}
+
+func TestCachedRepo_Conformance(t *testing.T) {
+	testRepository(t, func(t *testing.T) Repository {
+		return NewCachedRepo(NewInMemRepo(), 10, time.Minute)
+	})
+}
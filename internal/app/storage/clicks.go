@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// bucketClicks groups clicks of a short url by bucket start time.
+func bucketClicks(id string, clicks []*models.Click, bucket string) (*models.ClickStats, error) {
+	var size time.Duration
+	switch bucket {
+	case models.BucketHour:
+		size = time.Hour
+	case models.BucketDay:
+		size = 24 * time.Hour
+	default:
+		return nil, models.ErrInvalidBucket
+	}
+	// Count clicks for every bucket start and variant.
+	counts := make(map[time.Time]int)
+	variants := make(map[int]int)
+	for _, v := range clicks {
+		counts[v.Time.UTC().Truncate(size)]++
+		if v.Variant > 0 {
+			variants[v.Variant]++
+		}
+	}
+	stats := &models.ClickStats{ShortURL: id, Total: len(clicks), Buckets: make([]models.ClickBucket, 0, len(counts))}
+	for start, count := range counts {
+		stats.Buckets = append(stats.Buckets, models.ClickBucket{Start: start, Count: count})
+	}
+	sort.Slice(stats.Buckets, func(i, j int) bool {
+		return stats.Buckets[i].Start.Before(stats.Buckets[j].Start)
+	})
+	for variant, count := range variants {
+		stats.Variants = append(stats.Variants, models.VariantClicks{Variant: variant, Count: count})
+	}
+	sort.Slice(stats.Variants, func(i, j int) bool {
+		return stats.Variants[i].Variant < stats.Variants[j].Variant
+	})
+	return stats, nil
+}
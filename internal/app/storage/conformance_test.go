@@ -0,0 +1,461 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// testRepository runs behaviour every Repository implementation has to conform to.
+// newRepo is called for every case and returns an empty repository.
+func testRepository(t *testing.T, newRepo func(t *testing.T) Repository) {
+	ctx := context.Background()
+
+	t.Run("Duplicate", func(t *testing.T) {
+		repo := newRepo(t)
+		url := &models.URL{ShortURL: "dup1", LongURL: "https://github.com/", UserID: "user1"}
+		duplicate, err := repo.Add(ctx, url)
+		require.NoError(t, err)
+		assert.False(t, duplicate)
+		// Shortening the same url again returns the stored short url.
+		url = &models.URL{ShortURL: "dup2", LongURL: "https://github.com/", UserID: "user2"}
+		duplicate, err = repo.Add(ctx, url)
+		require.NoError(t, err)
+		assert.True(t, duplicate)
+		assert.Equal(t, "dup1", url.ShortURL)
+		_, err = repo.Get(ctx, "dup2")
+		assert.Error(t, err)
+		// The stored url is found by its long url.
+		got, err := repo.GetByLong(ctx, "https://github.com/")
+		require.NoError(t, err)
+		require.NotNil(t, got)
+		assert.Equal(t, "dup1", got.ShortURL)
+		got, err = repo.GetByLong(ctx, "https://yandex.ru/")
+		require.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("Batch duplicates", func(t *testing.T) {
+		repo := newRepo(t)
+		_, err := repo.Add(ctx, &models.URL{ShortURL: "dup1", LongURL: "https://github.com/", UserID: "user1"})
+		require.NoError(t, err)
+		urls := []*models.URL{
+			{ShortURL: "dup2", LongURL: "https://github.com/", UserID: "user1"},
+			{ShortURL: "dup3", LongURL: "https://yandex.ru/", UserID: "user1"},
+			{ShortURL: "dup4", LongURL: "https://yandex.ru/", UserID: "user1"},
+		}
+		duplicates, err := repo.AddBatch(ctx, urls)
+		require.NoError(t, err)
+		assert.True(t, duplicates)
+		assert.Equal(t, "dup1", urls[0].ShortURL)
+		assert.Equal(t, "dup3", urls[1].ShortURL)
+		assert.Equal(t, "dup3", urls[2].ShortURL)
+		assert.Equal(t, []bool{true, false, true}, []bool{urls[0].Duplicate, urls[1].Duplicate, urls[2].Duplicate})
+		// Urls added in a batch are known to later additions.
+		url := &models.URL{ShortURL: "dup5", LongURL: "https://yandex.ru/", UserID: "user2"}
+		duplicate, err := repo.Add(ctx, url)
+		require.NoError(t, err)
+		assert.True(t, duplicate)
+		assert.Equal(t, "dup3", url.ShortURL)
+		stats, err := repo.Stats(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, stats.URLCount)
+	})
+
+	t.Run("Short id collision", func(t *testing.T) {
+		repo := newRepo(t)
+		_, err := repo.Add(ctx, &models.URL{ShortURL: "id1", LongURL: "https://github.com/", UserID: "user1"})
+		require.NoError(t, err)
+		url := &models.URL{ShortURL: "id1", LongURL: "https://yandex.ru/", UserID: "user1"}
+		duplicate, err := repo.Add(ctx, url)
+		require.NoError(t, err)
+		assert.False(t, duplicate)
+		assert.NotEqual(t, "id1", url.ShortURL)
+		got, err := repo.Get(ctx, url.ShortURL)
+		require.NoError(t, err)
+		assert.Equal(t, "https://yandex.ru/", got.LongURL)
+	})
+
+	t.Run("Ownership on delete", func(t *testing.T) {
+		repo := newRepo(t)
+		_, err := repo.AddBatch(ctx, []*models.URL{
+			{ShortURL: "del1", LongURL: "https://github.com/", UserID: "user1"},
+			{ShortURL: "del2", LongURL: "https://yandex.ru/", UserID: "user1"},
+		})
+		require.NoError(t, err)
+		n, err := repo.DeleteURLs(nil)
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+		// Urls of another user are not deleted.
+		n, err = repo.DeleteURLs([]*models.DeleteURLItem{{ShortURL: "del1", UserID: "user2"}, {ShortURL: "del2", UserID: "user2"}})
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+		// Unknown urls are skipped.
+		items := []*models.DeleteURLItem{{ShortURL: "del1", UserID: "user1"}, {ShortURL: "del3", UserID: "user1"}}
+		n, err = repo.DeleteURLs(items)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []bool{true, false}, []bool{items[0].Deleted, items[1].Deleted})
+		// Urls deleted before are not deleted again.
+		items = []*models.DeleteURLItem{{ShortURL: "del1", UserID: "user1"}}
+		n, err = repo.DeleteURLs(items)
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+		assert.False(t, items[0].Deleted)
+		got, err := repo.Get(ctx, "del1")
+		require.NoError(t, err)
+		assert.True(t, got.Deleted)
+		got, err = repo.Get(ctx, "del2")
+		require.NoError(t, err)
+		assert.False(t, got.Deleted)
+		// A url repeated in the batch is counted once.
+		items = []*models.DeleteURLItem{{ShortURL: "del2", UserID: "user1"}, {ShortURL: "del2", UserID: "user1"}}
+		n, err = repo.DeleteURLs(items)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []bool{true, false}, []bool{items[0].Deleted, items[1].Deleted})
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		repo := newRepo(t)
+		stats, err := repo.Stats(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, stats.URLCount)
+		assert.Equal(t, 0, stats.UserCount)
+		_, err = repo.AddBatch(ctx, []*models.URL{
+			{ShortURL: "st1", LongURL: "https://github.com/", UserID: "user1"},
+			{ShortURL: "st2", LongURL: "https://yandex.ru/", UserID: "user1"},
+			{ShortURL: "st3", LongURL: "https://gitlab.com/", UserID: "user2"},
+		})
+		require.NoError(t, err)
+		stats, err = repo.Stats(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 3, stats.URLCount)
+		assert.Equal(t, 2, stats.UserCount)
+	})
+
+	t.Run("Click limit", func(t *testing.T) {
+		repo := newRepo(t)
+		_, err := repo.Add(ctx, &models.URL{ShortURL: "mc1", LongURL: "https://github.com/", UserID: "user1", MaxClicks: 5})
+		require.NoError(t, err)
+		const workers = 20
+		var wg sync.WaitGroup
+		errs := make(chan error, workers)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := repo.ConsumeClick(ctx, "mc1")
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		var consumed int
+		for err := range errs {
+			if err == nil {
+				consumed++
+				continue
+			}
+			assert.ErrorIs(t, err, models.ErrURLExhausted)
+		}
+		assert.Equal(t, 5, consumed)
+		got, err := repo.Get(ctx, "mc1")
+		require.NoError(t, err)
+		assert.Equal(t, 5, got.Clicks)
+		assert.True(t, got.Exhausted())
+		_, err = repo.ConsumeClick(ctx, "mc2")
+		assert.ErrorIs(t, err, models.ErrInvalidID)
+	})
+
+	t.Run("Rules", func(t *testing.T) {
+		repo := newRepo(t)
+		_, err := repo.Add(ctx, &models.URL{ShortURL: "ru1", LongURL: "https://github.com/", UserID: "user1"})
+		require.NoError(t, err)
+		rules := []*models.RedirectRule{
+			{Device: models.DeviceIOS, Target: "https://apps.apple.com/"},
+			{Country: "DE", From: "08:00", To: "20:00", Target: "https://github.de/"},
+		}
+		_, err = repo.SetRules(ctx, &models.URL{ShortURL: "ru1", UserID: "user2", Rules: rules})
+		assert.ErrorIs(t, err, models.ErrNotOwner)
+		_, err = repo.SetRules(ctx, &models.URL{ShortURL: "ru2", UserID: "user1", Rules: rules})
+		assert.ErrorIs(t, err, models.ErrURLNotFound)
+		updated, err := repo.SetRules(ctx, &models.URL{ShortURL: "ru1", UserID: "user1", Rules: rules})
+		require.NoError(t, err)
+		assert.Equal(t, rules, updated.Rules)
+		got, err := repo.Get(ctx, "ru1")
+		require.NoError(t, err)
+		assert.Equal(t, rules, got.Rules)
+		assert.Equal(t, "https://github.com/", got.LongURL)
+		// Rules are removed by an empty list.
+		_, err = repo.SetRules(ctx, &models.URL{ShortURL: "ru1", UserID: "user1"})
+		require.NoError(t, err)
+		got, err = repo.Get(ctx, "ru1")
+		require.NoError(t, err)
+		assert.Empty(t, got.Rules)
+		_, err = repo.DeleteURLs([]*models.DeleteURLItem{{ShortURL: "ru1", UserID: "user1"}})
+		require.NoError(t, err)
+		_, err = repo.SetRules(ctx, &models.URL{ShortURL: "ru1", UserID: "user1", Rules: rules})
+		assert.ErrorIs(t, err, models.ErrURLDeleted)
+	})
+
+	t.Run("Blocking", func(t *testing.T) {
+		repo := newRepo(t)
+		_, err := repo.Add(ctx, &models.URL{ShortURL: "bl1", LongURL: "https://github.com/", UserID: "user1"})
+		require.NoError(t, err)
+		_, err = repo.SetBlocked(ctx, &models.URL{ShortURL: "bl2", Blocked: true})
+		assert.ErrorIs(t, err, models.ErrInvalidID)
+		updated, err := repo.SetBlocked(ctx, &models.URL{ShortURL: "bl1", Blocked: true, BlockReason: "phishing"})
+		require.NoError(t, err)
+		assert.True(t, updated.Blocked)
+		got, err := repo.Get(ctx, "bl1")
+		require.NoError(t, err)
+		assert.True(t, got.Blocked)
+		assert.Equal(t, "phishing", got.BlockReason)
+		assert.Equal(t, "user1", got.UserID)
+		_, err = repo.SetBlocked(ctx, &models.URL{ShortURL: "bl1"})
+		require.NoError(t, err)
+		got, err = repo.Get(ctx, "bl1")
+		require.NoError(t, err)
+		assert.False(t, got.Blocked)
+		assert.Empty(t, got.BlockReason)
+	})
+
+	t.Run("Variants", func(t *testing.T) {
+		repo := newRepo(t)
+		variants := []*models.Variant{{Target: "https://github.com/a", Weight: 70}, {Target: "https://github.com/b", Weight: 30}}
+		_, err := repo.Add(ctx, &models.URL{ShortURL: "ab1", LongURL: "https://github.com/", UserID: "user1", Variants: variants, Sticky: true})
+		require.NoError(t, err)
+		got, err := repo.Get(ctx, "ab1")
+		require.NoError(t, err)
+		assert.Equal(t, variants, got.Variants)
+		assert.True(t, got.Sticky)
+		now := time.Now()
+		require.NoError(t, repo.AddClicks(ctx, []*models.Click{
+			{ShortURL: "ab1", Time: now, Variant: 1},
+			{ShortURL: "ab1", Time: now, Variant: 2},
+			{ShortURL: "ab1", Time: now, Variant: 1},
+			{ShortURL: "ab1", Time: now},
+		}))
+		stats, err := repo.GetClickStats(ctx, "ab1", models.BucketDay)
+		require.NoError(t, err)
+		assert.Equal(t, 4, stats.Total)
+		assert.Equal(t, []models.VariantClicks{{Variant: 1, Count: 2}, {Variant: 2, Count: 1}}, stats.Variants)
+	})
+
+	t.Run("Redirect code", func(t *testing.T) {
+		repo := newRepo(t)
+		_, err := repo.AddBatch(ctx, []*models.URL{
+			{ShortURL: "rc1", LongURL: "https://github.com/", UserID: "user1", RedirectCode: 301},
+			{ShortURL: "rc2", LongURL: "https://gitlab.com/", UserID: "user1"},
+		})
+		require.NoError(t, err)
+		got, err := repo.Get(ctx, "rc1")
+		require.NoError(t, err)
+		assert.Equal(t, 301, got.RedirectCode)
+		got, err = repo.Get(ctx, "rc2")
+		require.NoError(t, err)
+		assert.Zero(t, got.RedirectCode)
+	})
+
+	t.Run("Quota", func(t *testing.T) {
+		repo := newRepo(t)
+		quota, err := repo.GetQuota(ctx, "user1")
+		require.NoError(t, err)
+		assert.Nil(t, quota)
+		require.NoError(t, repo.SetQuota(ctx, &models.Quota{UserID: "user1", Daily: 5, Total: 10}))
+		require.NoError(t, repo.SetQuota(ctx, &models.Quota{UserID: "user1", Daily: 2}))
+		quota, err = repo.GetQuota(ctx, "user1")
+		require.NoError(t, err)
+		assert.Equal(t, &models.Quota{UserID: "user1", Daily: 2}, quota)
+
+		now := time.Now()
+		_, err = repo.AddBatch(ctx, []*models.URL{
+			{ShortURL: "qt1", LongURL: "https://github.com/", UserID: "user1", CreatedAt: now.Add(-48 * time.Hour)},
+			{ShortURL: "qt2", LongURL: "https://gitlab.com/", UserID: "user1", CreatedAt: now},
+			{ShortURL: "qt3", LongURL: "https://bitbucket.org/", UserID: "user1", CreatedAt: now},
+			{ShortURL: "qt4", LongURL: "https://example.com/", UserID: "user2", CreatedAt: now},
+		})
+		require.NoError(t, err)
+		_, err = repo.DeleteURLs([]*models.DeleteURLItem{{ShortURL: "qt3", UserID: "user1"}})
+		require.NoError(t, err)
+		// Deleted urls are still counted as created.
+		total, created, err := repo.CountURLs(ctx, "user1", now.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 2, total)
+		assert.Equal(t, 2, created)
+		total, created, err = repo.CountURLs(ctx, "user3", now.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Zero(t, total)
+		assert.Zero(t, created)
+	})
+
+	t.Run("Jobs", func(t *testing.T) {
+		repo := newRepo(t)
+		job, err := repo.GetJob(ctx, "job1")
+		require.NoError(t, err)
+		assert.Nil(t, job)
+		created := time.Now().UTC().Truncate(time.Millisecond)
+		require.NoError(t, repo.SaveJob(ctx, &models.Job{ID: "job1", UserID: "user1", Status: models.JobPending,
+			IDs: []string{"a", "b"}, CreatedAt: created}))
+		job, err = repo.GetJob(ctx, "job1")
+		require.NoError(t, err)
+		require.NotNil(t, job)
+		assert.Equal(t, models.JobPending, job.Status)
+		assert.Nil(t, job.FinishedAt)
+
+		// Saving a job again replaces its state.
+		finished := created.Add(time.Second)
+		want := &models.Job{ID: "job1", UserID: "user1", Status: models.JobDone, IDs: []string{"a", "b"}, Deleted: 1,
+			Failures: []models.JobFailure{{ID: "b", Error: "URL not found"}}, CreatedAt: created, FinishedAt: &finished}
+		require.NoError(t, repo.SaveJob(ctx, want))
+		job, err = repo.GetJob(ctx, "job1")
+		require.NoError(t, err)
+		require.NotNil(t, job)
+		assert.True(t, job.CreatedAt.Equal(created))
+		assert.True(t, job.FinishedAt.Equal(finished))
+		job.CreatedAt, job.FinishedAt = want.CreatedAt, want.FinishedAt
+		assert.Equal(t, want, job)
+
+		// Only unfinished jobs are claimed, oldest first.
+		require.NoError(t, repo.SaveJob(ctx, &models.Job{ID: "job2", UserID: "user1", Status: models.JobPending,
+			IDs: []string{"c"}, CreatedAt: created.Add(2 * time.Second)}))
+		require.NoError(t, repo.SaveJob(ctx, &models.Job{ID: "job3", UserID: "user2", Status: models.JobPending,
+			IDs: []string{"d"}, CreatedAt: created.Add(time.Second)}))
+		claimIDs := func(owner string, now time.Time) []string {
+			claimed, err := repo.ClaimJobs(ctx, owner, now, time.Minute)
+			require.NoError(t, err)
+			ids := make([]string, len(claimed))
+			for i, v := range claimed {
+				assert.Equal(t, owner, v.Owner)
+				ids[i] = v.ID
+			}
+			return ids
+		}
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		assert.Equal(t, []string{"job3", "job2"}, claimIDs("instance1", now))
+		// Claimed jobs are skipped by others until the lease ends.
+		assert.Empty(t, claimIDs("instance2", now.Add(time.Second)))
+		assert.Equal(t, []string{"job3", "job2"}, claimIDs("instance2", now.Add(time.Minute)))
+		// The previous owner can't save a job claimed by another one.
+		job = &models.Job{ID: "job2", UserID: "user1", Status: models.JobDone, IDs: []string{"c"}, Deleted: 1,
+			CreatedAt: created.Add(2 * time.Second), FinishedAt: &finished, Owner: "instance1"}
+		assert.ErrorIs(t, repo.SaveJob(ctx, job), models.ErrJobClaimed)
+		job.Owner = "instance2"
+		require.NoError(t, repo.SaveJob(ctx, job))
+		assert.Equal(t, []string{"job3"}, claimIDs("instance1", now.Add(time.Hour)))
+	})
+
+	t.Run("ID sequence", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, step := range []struct{ n, last uint64 }{{0, 0}, {10, 0}, {5, 10}, {0, 15}} {
+			last, err := repo.ReserveIDs(ctx, step.n)
+			require.NoError(t, err)
+			assert.Equal(t, step.last, last)
+		}
+	})
+
+	t.Run("Concurrent access", func(t *testing.T) {
+		repo := newRepo(t)
+		const workers, targets, rounds = 50, 10, 10
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				userID := fmt.Sprintf("user%d", i%targets)
+				url := &models.URL{
+					ShortURL: fmt.Sprintf("cc%d", i),
+					LongURL:  fmt.Sprintf("https://example.com/%d", i%targets),
+					UserID:   userID,
+				}
+				if _, err := repo.Add(ctx, url); !assert.NoError(t, err) {
+					return
+				}
+				// Read urls while other workers change them.
+				for round := 0; round < rounds; round++ {
+					got, err := repo.Get(ctx, url.ShortURL)
+					if assert.NoError(t, err) {
+						assert.Equal(t, url.LongURL, got.LongURL)
+						assert.Equal(t, got.Deleted, got.DeletedAt != nil)
+					}
+					urls, err := repo.GetByUser(ctx, userID, &models.URLQuery{})
+					if assert.NoError(t, err) {
+						for _, v := range urls {
+							assert.Equal(t, userID, v.UserID)
+							assert.Equal(t, v.Deleted, v.DeletedAt != nil)
+						}
+					}
+					item := []*models.DeleteURLItem{{ShortURL: url.ShortURL, UserID: userID}}
+					_, err = repo.DeleteURLs(item)
+					assert.NoError(t, err)
+					_, err = repo.RestoreURLs(item)
+					assert.NoError(t, err)
+					_, err = repo.Stats(ctx)
+					assert.NoError(t, err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		stats, err := repo.Stats(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, targets, stats.URLCount)
+		assert.Equal(t, targets, stats.UserCount)
+	})
+}
+
+func TestInMemRepo_Conformance(t *testing.T) {
+	testRepository(t, func(t *testing.T) Repository {
+		return NewInMemRepo()
+	})
+}
+
+func TestFileRepo_Conformance(t *testing.T) {
+	testRepository(t, func(t *testing.T) Repository {
+		repo, err := NewFileRepo(filepath.Join(t.TempDir(), "urls.json"))
+		require.NoError(t, err)
+		require.NoError(t, repo.Load())
+		t.Cleanup(func() {
+			repo.Close()
+		})
+		return repo
+	})
+}
+
+func TestBoltRepo_Conformance(t *testing.T) {
+	testRepository(t, func(t *testing.T) Repository {
+		return newTestBoltRepo(t)
+	})
+}
+
+// TestPostgresRepo_Conformance runs against the database from DATABASE_DSN and is skipped without one.
+// Tables are dropped after every case, so the database must not hold other data.
+func TestPostgresRepo_Conformance(t *testing.T) {
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("DATABASE_DSN is not set")
+	}
+	testRepository(t, func(t *testing.T) Repository {
+		repo, err := NewPostgresRepo(dsn)
+		require.NoError(t, err)
+		if err = repo.Ping(context.Background()); err != nil {
+			repo.Close()
+			t.Skipf("postgres is unavailable : %v", err)
+		}
+		require.NoError(t, repo.Migrate())
+		t.Cleanup(func() {
+			repo.DeleteRepo(context.Background())
+			repo.Close()
+		})
+		return repo
+	})
+}
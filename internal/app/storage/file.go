@@ -1,65 +1,336 @@
 package storage
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/Mldlr/url-shortener/internal/app/models"
-	"github.com/Mldlr/url-shortener/internal/app/utils/encoders"
 )
 
-// FileRepo is an in-file url storage
+// FileRepo is an in-file url storage.
+// URLs are kept in a snapshot file and changes made since the snapshot in an append-only log,
+// which is replayed on Load and periodically compacted into a new snapshot.
 type FileRepo struct {
-	// file stores URL data.
-	file *os.File
+	// filename is the path of the snapshot file.
+	filename string
+	// wal is the append-only log of changes made since the snapshot.
+	wal *os.File
+	// walWriter buffers log records until they are synced.
+	walWriter *bufio.Writer
+	// groupCommit leaves syncing of the log to periodic sync calls instead of syncing every write.
+	groupCommit bool
 	// cacheByShort maps short URLs to their corresponding URL models.
 	cacheByShort map[string]*models.URL
 	// cacheByUser maps user IDs to lists of URL models.
 	cacheByUser map[string][]*models.URL
 	// existingURLs maps long URLs to their corresponding URL models.
 	existingURLs map[string]*models.URL
-	// encoder encodes URL data for storage in the file.
-	encoder json.Encoder
+	// clicksFile stores recorded clicks next to the URL data.
+	clicksFile *os.File
+	// clicks maps short URLs to their recorded clicks.
+	clicks map[string][]*models.Click
+	// historyFile stores previous targets of URLs.
+	historyFile *os.File
+	// history maps short URLs to their previous targets.
+	history map[string][]*models.URLVersion
+	// quotasFile stores quotas of users, the last record of a user replaces the previous ones.
+	quotasFile *os.File
+	// quotas maps user IDs to their own quotas.
+	quotas map[string]*models.Quota
+	// jobsFile stores delete jobs, the last record of a job replaces the previous ones.
+	jobsFile *os.File
+	// jobs maps IDs to delete jobs.
+	jobs map[string]*models.Job
+	// stale holds the side files with records which are replaced or belong to purged urls.
+	// Compaction rewrites them from the cached records.
+	stale map[*os.File]bool
+	// sequence is the last reserved value of the id sequence, kept in the ids file.
+	sequence uint64
+	// idSource generates short IDs.
+	idSource
 	// RWMutex synchronizes access to the FileRepo.
 	sync.RWMutex
 }
 
+// Operations of log records.
+const (
+	opCreate  = "create"
+	opUpdate  = "update"
+	opDelete  = "delete"
+	opRestore = "restore"
+	opRemove  = "remove"
+	opClick   = "click"
+	opRules   = "rules"
+	opBlock   = "block"
+)
+
+// logRecord is a change of a url in the log.
+type logRecord struct {
+	// Op is the operation that changed the url.
+	Op string `json:"op"`
+	// URL is the state of the url after the change.
+	URL *models.URL `json:"url"`
+}
+
 // NewFileRepo initializes a new in-file storage.
 func NewFileRepo(filename string) (*FileRepo, error) {
-	// Create or open file
-	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0666)
+	// Changes are only appended to the log until it is compacted.
+	wal, err := os.OpenFile(filename+".wal", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("error openin log file : %v", err)
+	}
+	// Clicks are only appended, so they are kept in a separate file.
+	clicksFile, err := os.OpenFile(filename+".clicks", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("error openin clicks file : %v", err)
+	}
+	historyFile, err := os.OpenFile(filename+".history", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("error openin history file : %v", err)
+	}
+	quotasFile, err := os.OpenFile(filename+".quotas", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
-		return nil, fmt.Errorf("error openin file : %v", err)
+		return nil, fmt.Errorf("error openin quotas file : %v", err)
+	}
+	jobsFile, err := os.OpenFile(filename+".jobs", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("error openin jobs file : %v", err)
 	}
 	return &FileRepo{
-		file:         file,
+		filename:     filename,
+		wal:          wal,
+		walWriter:    bufio.NewWriter(wal),
 		cacheByShort: make(map[string]*models.URL),
 		cacheByUser:  make(map[string][]*models.URL),
 		existingURLs: make(map[string]*models.URL),
-		encoder:      *json.NewEncoder(file),
+		clicksFile:   clicksFile,
+		clicks:       make(map[string][]*models.Click),
+		historyFile:  historyFile,
+		history:      make(map[string][]*models.URLVersion),
+		quotasFile:   quotasFile,
+		quotas:       make(map[string]*models.Quota),
+		jobsFile:     jobsFile,
+		jobs:         make(map[string]*models.Job),
+		stale:        make(map[*os.File]bool),
+		idSource:     newIDSource(),
 	}, nil
 }
 
-// Load loads stored url records from file.
+// Load loads stored url records from the snapshot and replays the log on top of it.
 func (r *FileRepo) Load() error {
-	// Decode file
-	decoder := json.NewDecoder(r.file)
-	u := &models.URL{}
+	if err := r.loadSnapshot(); err != nil {
+		return err
+	}
+	if err := r.replay(); err != nil {
+		return err
+	}
+	if err := r.loadClicks(); err != nil {
+		return err
+	}
+	if err := r.loadHistory(); err != nil {
+		return err
+	}
+	if err := r.loadQuotas(); err != nil {
+		return err
+	}
+	if err := r.loadJobs(); err != nil {
+		return err
+	}
+	return r.loadSequence()
+}
+
+// loadSnapshot loads url records from the snapshot file.
+func (r *FileRepo) loadSnapshot() error {
+	file, err := os.Open(r.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error openin file : %v", err)
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(bufio.NewReader(file))
 	for {
+		// Decode every record to a new value so optional fields don't leak between records.
+		u := &models.URL{}
 		if err := decoder.Decode(u); err == io.EOF {
 			break
 		} else if err != nil {
 			return fmt.Errorf("error decoding file : %v", err)
 		}
-		// Add decoded URL to maps
-		url := &models.URL{ShortURL: u.ShortURL, LongURL: u.LongURL}
-		r.cacheByShort[u.ShortURL] = url
-		r.cacheByUser[u.UserID] = append(r.cacheByUser[u.UserID], url)
+		r.put(u)
+	}
+	return nil
+}
+
+// replay applies log records to the loaded snapshot.
+// A record torn by a crash while it was written is cut off the log.
+func (r *FileRepo) replay() error {
+	if _, err := r.wal.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error reading log file : %v", err)
+	}
+	decoder := json.NewDecoder(bufio.NewReader(r.wal))
+	for {
+		offset := decoder.InputOffset()
+		rec := &logRecord{}
+		if err := decoder.Decode(rec); err == io.EOF {
+			break
+		} else if err != nil || rec.URL == nil {
+			log.Printf("truncating log file at %d after invalid record : %v", offset, err)
+			if err = r.wal.Truncate(offset); err != nil {
+				return fmt.Errorf("error truncating log file : %v", err)
+			}
+			break
+		}
+		if rec.Op == opRemove {
+			if stored, ok := r.cacheByShort[rec.URL.ShortURL]; ok {
+				r.remove(stored)
+			}
+			continue
+		}
+		r.put(rec.URL)
+	}
+	return nil
+}
+
+// put stores url in cache replacing the stored url with the same short url.
+func (r *FileRepo) put(url *models.URL) {
+	if stored, ok := r.cacheByShort[url.ShortURL]; ok {
+		delete(r.existingURLs, stored.LongURL)
+		if stored.UserID == url.UserID {
+			replaceURL(r.cacheByUser[url.UserID], stored, url)
+		} else {
+			r.cacheByUser[stored.UserID] = removeURL(r.cacheByUser[stored.UserID], stored)
+			r.cacheByUser[url.UserID] = append(r.cacheByUser[url.UserID], url)
+		}
+	} else {
+		r.cacheByUser[url.UserID] = append(r.cacheByUser[url.UserID], url)
+	}
+	r.cacheByShort[url.ShortURL] = url
+	r.existingURLs[url.LongURL] = url
+}
+
+// write appends records of changed urls to the log, syncing it unless group commit is used.
+func (r *FileRepo) write(op string, urls ...*models.URL) error {
+	encoder := json.NewEncoder(r.walWriter)
+	for _, v := range urls {
+		if err := encoder.Encode(&logRecord{Op: op, URL: v}); err != nil {
+			return fmt.Errorf("error writing log file : %v", err)
+		}
+	}
+	if r.groupCommit {
+		return nil
+	}
+	return r.syncLog()
+}
+
+// syncLog flushes buffered log records and syncs the log to disk.
+func (r *FileRepo) syncLog() error {
+	if err := r.walWriter.Flush(); err != nil {
+		return fmt.Errorf("error writing log file : %v", err)
+	}
+	if err := r.wal.Sync(); err != nil {
+		return fmt.Errorf("error syncing log file : %v", err)
+	}
+	return nil
+}
+
+// loadClicks loads recorded clicks of stored urls from clicks file.
+func (r *FileRepo) loadClicks() error {
+	decoder := json.NewDecoder(r.clicksFile)
+	for {
+		c := &models.Click{}
+		if err := decoder.Decode(c); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("error decoding clicks file : %v", err)
+		}
+		// Skip clicks of purged urls.
+		if _, ok := r.cacheByShort[c.ShortURL]; ok {
+			r.clicks[c.ShortURL] = append(r.clicks[c.ShortURL], c)
+		} else {
+			r.stale[r.clicksFile] = true
+		}
+	}
+	return nil
+}
+
+// loadHistory loads previous targets of stored urls from history file.
+func (r *FileRepo) loadHistory() error {
+	decoder := json.NewDecoder(r.historyFile)
+	for {
+		v := &models.URLVersion{}
+		if err := decoder.Decode(v); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("error decoding history file : %v", err)
+		}
+		// Skip history of purged urls.
+		if _, ok := r.cacheByShort[v.ShortURL]; ok {
+			r.history[v.ShortURL] = append(r.history[v.ShortURL], v)
+		} else {
+			r.stale[r.historyFile] = true
+		}
+	}
+	return nil
+}
+
+// loadQuotas loads quotas of users from quotas file.
+func (r *FileRepo) loadQuotas() error {
+	decoder := json.NewDecoder(r.quotasFile)
+	for {
+		q := &models.Quota{}
+		if err := decoder.Decode(q); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("error decoding quotas file : %v", err)
+		}
+		if _, ok := r.quotas[q.UserID]; ok {
+			r.stale[r.quotasFile] = true
+		}
+		r.quotas[q.UserID] = q
+	}
+	return nil
+}
+
+// loadJobs loads delete jobs from jobs file.
+func (r *FileRepo) loadJobs() error {
+	decoder := json.NewDecoder(r.jobsFile)
+	for {
+		job := &models.Job{}
+		if err := decoder.Decode(job); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("error decoding jobs file : %v", err)
+		}
+		if _, ok := r.jobs[job.ID]; ok {
+			r.stale[r.jobsFile] = true
+		}
+		r.jobs[job.ID] = job
+	}
+	return nil
+}
+
+// loadSequence loads the last reserved value of the id sequence from ids file.
+func (r *FileRepo) loadSequence() error {
+	data, err := os.ReadFile(r.filename + ".ids")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading ids file : %v", err)
+	}
+	r.sequence, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("error decoding ids file : %v", err)
 	}
 	return nil
 }
@@ -71,11 +342,18 @@ func (r *FileRepo) Get(ctx context.Context, id string) (*models.URL, error) {
 	// check for URL in map
 	url, ok := r.cacheByShort[id]
 	if !ok {
-		return nil, fmt.Errorf("invalid id: %s", id)
+		return nil, fmt.Errorf("%w: %s", models.ErrInvalidID, id)
 	}
 	return url, nil
 }
 
+// GetByLong finds the url stored for a long url, nil if it isn't stored.
+func (r *FileRepo) GetByLong(ctx context.Context, longURL string) (*models.URL, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.existingURLs[longURL], nil
+}
+
 // Add adds a link to db and returns assigned id
 func (r *FileRepo) Add(ctx context.Context, url *models.URL) (bool, error) {
 	r.Lock()
@@ -85,10 +363,15 @@ func (r *FileRepo) Add(ctx context.Context, url *models.URL) (bool, error) {
 		url.ShortURL = v.ShortURL
 		return true, nil
 	}
+	// regenerate short url if it is used by another record
+	if err := r.resolve(url, r.taken); err != nil {
+		return false, err
+	}
+	if err := r.write(opCreate, url); err != nil {
+		return false, err
+	}
 	// otherwise add url to maps
-	r.cacheByShort[url.ShortURL] = url
-	r.cacheByUser[url.UserID] = append(r.cacheByUser[url.UserID], url)
-	r.existingURLs[url.LongURL] = url
+	r.put(url)
 	return false, nil
 }
 
@@ -97,98 +380,570 @@ func (r *FileRepo) AddBatch(ctx context.Context, urls []*models.URL) (bool, erro
 	r.Lock()
 	defer r.Unlock()
 	var duplicates bool
+	added := make([]*models.URL, 0, len(urls))
 	// for each url check if url is in map and add it otherwise
 	for _, v := range urls {
 		if i, k := r.existingURLs[v.LongURL]; k {
 			duplicates = true
-			v.ShortURL = i.ShortURL
+			v.ShortURL, v.Duplicate = i.ShortURL, true
 			continue
 		}
-		r.cacheByShort[v.ShortURL] = v
-		r.cacheByUser[v.UserID] = append(r.cacheByUser[v.UserID], v)
+		if err := r.resolve(v, r.taken); err != nil {
+			r.rollback(added)
+			return duplicates, err
+		}
+		r.put(v)
+		added = append(added, v)
+	}
+	// Log the whole batch at once.
+	if err := r.write(opCreate, added...); err != nil {
+		r.rollback(added)
+		return duplicates, err
 	}
 	return duplicates, nil
 }
 
-// NewID calculates a string to use as an ID.
-func (r *FileRepo) NewID(url string) (string, error) {
-	return encoders.ToRBase62(url), nil
+// rollback removes urls of a batch that wasn't logged.
+func (r *FileRepo) rollback(urls []*models.URL) {
+	for _, v := range urls {
+		r.remove(v)
+	}
 }
 
-// GetByUser finds URLs created by a specific user.
-func (r *FileRepo) GetByUser(ctx context.Context, userID string) ([]*models.URL, error) {
+// taken checks if short url is used by a stored record.
+func (r *FileRepo) taken(id string) bool {
+	_, ok := r.cacheByShort[id]
+	return ok
+}
+
+// GetByUser finds a page of URLs created by a specific user.
+func (r *FileRepo) GetByUser(ctx context.Context, userID string, q *models.URLQuery) ([]*models.URL, error) {
 	r.RLock()
 	defer r.RUnlock()
-	s := make([]*models.URL, 0)
-	// Get all urls for user
-	s = append(s, r.cacheByUser[userID]...)
-	if len(s) == 0 {
-		return nil, nil
-	}
-	return s, nil
+	return pageURLs(r.cacheByUser[userID], q), nil
 }
 
 // DeleteURLs delete urls from cache.
 func (r *FileRepo) DeleteURLs(deleteURLs []*models.DeleteURLItem) (int, error) {
 	r.Lock()
 	defer r.Unlock()
-	var n int
-	// For each of the urls check if the user created this url and delete it if confirmed
+	now := time.Now()
+	var deleted []*models.URL
+	var items []*models.DeleteURLItem
+	seen := make(map[string]bool)
+	// For each of the urls check if the user created this url and delete it if confirmed.
+	// A url repeated in the batch is deleted by its first item only.
 	for _, v := range deleteURLs {
-		if r.cacheByShort[v.ShortURL].UserID == v.UserID {
-			r.cacheByShort[v.ShortURL].Deleted = true
-			n++
+		if url, ok := r.cacheByShort[v.ShortURL]; ok && url.UserID == v.UserID && !url.Deleted && !seen[v.ShortURL] {
+			seen[v.ShortURL] = true
+			d := *url
+			d.Deleted = true
+			d.DeletedAt = &now
+			deleted = append(deleted, &d)
+			items = append(items, v)
+		}
+	}
+	if err := r.write(opDelete, deleted...); err != nil {
+		return 0, err
+	}
+	// Cached urls are replaced by the copies so readers holding them don't race with the delete.
+	for i, v := range deleted {
+		r.put(v)
+		items[i].Deleted = true
+	}
+	return len(deleted), nil
+}
+
+// RestoreURLs restores deleted urls created by user.
+func (r *FileRepo) RestoreURLs(restoreURLs []*models.DeleteURLItem) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+	var restored []*models.URL
+	for _, v := range restoreURLs {
+		if url, ok := r.cacheByShort[v.ShortURL]; ok && url.Deleted && url.UserID == v.UserID {
+			d := *url
+			d.Deleted = false
+			d.DeletedAt = nil
+			restored = append(restored, &d)
+		}
+	}
+	if err := r.write(opRestore, restored...); err != nil {
+		return 0, err
+	}
+	for _, v := range restored {
+		r.put(v)
+	}
+	return len(restored), nil
+}
+
+// PurgeDeleted removes urls deleted before the given time from cache.
+func (r *FileRepo) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+	var purged []*models.URL
+	for _, url := range r.cacheByShort {
+		if url.Deleted && url.DeletedAt != nil && !url.DeletedAt.After(before) {
+			purged = append(purged, url)
+		}
+	}
+	return r.removeLogged(purged)
+}
+
+// removeLogged logs removal of urls and removes them from cache.
+func (r *FileRepo) removeLogged(urls []*models.URL) (int, error) {
+	if err := r.write(opRemove, urls...); err != nil {
+		return 0, err
+	}
+	for _, v := range urls {
+		r.remove(v)
+	}
+	return len(urls), nil
+}
+
+// remove removes url and its clicks and history from cache.
+func (r *FileRepo) remove(url *models.URL) {
+	delete(r.cacheByShort, url.ShortURL)
+	delete(r.existingURLs, url.LongURL)
+	if _, ok := r.clicks[url.ShortURL]; ok {
+		r.stale[r.clicksFile] = true
+		delete(r.clicks, url.ShortURL)
+	}
+	if _, ok := r.history[url.ShortURL]; ok {
+		r.stale[r.historyFile] = true
+		delete(r.history, url.ShortURL)
+	}
+	r.cacheByUser[url.UserID] = removeURL(r.cacheByUser[url.UserID], url)
+	if len(r.cacheByUser[url.UserID]) == 0 {
+		delete(r.cacheByUser, url.UserID)
+	}
+}
+
+// DeleteExpired removes urls expired by now from cache.
+func (r *FileRepo) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+	var expired []*models.URL
+	for _, url := range r.cacheByShort {
+		if url.Expired(now) {
+			expired = append(expired, url)
+		}
+	}
+	return r.removeLogged(expired)
+}
+
+// UpdateURL changes the target of a url created by user and appends the previous one to the history file.
+func (r *FileRepo) UpdateURL(ctx context.Context, url *models.URL, now time.Time) (*models.URL, error) {
+	r.Lock()
+	defer r.Unlock()
+	stored := r.cacheByShort[url.ShortURL]
+	if err := checkUpdate(stored, url, r.existingURLs[url.LongURL]); err != nil {
+		return nil, err
+	}
+	if stored.LongURL == url.LongURL {
+		return stored, nil
+	}
+	updated, version := retarget(stored, url.LongURL, r.history[url.ShortURL], now)
+	// The previous target is synced before the update is logged, so an update kept by the log keeps its history.
+	if err := json.NewEncoder(r.historyFile).Encode(version); err != nil {
+		return nil, fmt.Errorf("error writing history file : %v", err)
+	}
+	if !r.groupCommit {
+		if err := r.historyFile.Sync(); err != nil {
+			return nil, fmt.Errorf("error syncing history file : %v", err)
 		}
 	}
-	return n, nil
+	if err := r.write(opUpdate, updated); err != nil {
+		return nil, err
+	}
+	r.history[url.ShortURL] = append(r.history[url.ShortURL], version)
+	r.put(updated)
+	return updated, nil
 }
 
-func (r *FileRepo) update() {
+// SetRules replaces redirect rules of a url created by user.
+func (r *FileRepo) SetRules(ctx context.Context, url *models.URL) (*models.URL, error) {
 	r.Lock()
 	defer r.Unlock()
-	r.updateFile()
+	stored := r.cacheByShort[url.ShortURL]
+	if err := checkUpdate(stored, url, nil); err != nil {
+		return nil, err
+	}
+	updated := *stored
+	updated.Rules = url.Rules
+	if err := r.write(opRules, &updated); err != nil {
+		return nil, err
+	}
+	r.put(&updated)
+	return &updated, nil
 }
 
-// updateFile updates file contents from cache.
-func (r *FileRepo) updateFile() {
-	log.Println("starting file update")
-	// Truncate file
-	err := r.file.Truncate(0)
+// SetBlocked blocks or unblocks a url regardless of its owner.
+func (r *FileRepo) SetBlocked(ctx context.Context, url *models.URL) (*models.URL, error) {
+	r.Lock()
+	defer r.Unlock()
+	stored, ok := r.cacheByShort[url.ShortURL]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", models.ErrInvalidID, url.ShortURL)
+	}
+	updated := *stored
+	updated.Blocked, updated.BlockReason = url.Blocked, url.BlockReason
+	if err := r.write(opBlock, &updated); err != nil {
+		return nil, err
+	}
+	r.put(&updated)
+	return &updated, nil
+}
+
+// CountURLs counts urls kept by user and urls they created since the given time.
+func (r *FileRepo) CountURLs(ctx context.Context, userID string, since time.Time) (int, int, error) {
+	r.RLock()
+	defer r.RUnlock()
+	total, created := countURLs(r.cacheByUser[userID], since)
+	return total, created, nil
+}
+
+// GetQuota returns the quota of user, nil if they have none of their own.
+func (r *FileRepo) GetQuota(ctx context.Context, userID string) (*models.Quota, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.quotas[userID], nil
+}
+
+// SetQuota appends the quota of a user to the quotas file replacing their previous one.
+func (r *FileRepo) SetQuota(ctx context.Context, quota *models.Quota) error {
+	r.Lock()
+	defer r.Unlock()
+	stored := *quota
+	if err := json.NewEncoder(r.quotasFile).Encode(&stored); err != nil {
+		return fmt.Errorf("error writing quotas file : %v", err)
+	}
+	if _, ok := r.quotas[quota.UserID]; ok {
+		r.stale[r.quotasFile] = true
+	}
+	r.quotas[quota.UserID] = &stored
+	return nil
+}
+
+// GetJob returns a delete job, nil if there is none with the ID.
+func (r *FileRepo) GetJob(ctx context.Context, id string) (*models.Job, error) {
+	r.RLock()
+	defer r.RUnlock()
+	stored, ok := r.jobs[id]
+	if !ok {
+		return nil, nil
+	}
+	job := *stored
+	return &job, nil
+}
+
+// ClaimJobs returns the pending delete jobs whose lease ended by now, oldest first, and leases them to owner.
+func (r *FileRepo) ClaimJobs(ctx context.Context, owner string, now time.Time, lease time.Duration) ([]*models.Job, error) {
+	r.Lock()
+	defer r.Unlock()
+	return claimJobs(r.jobs, owner, now, lease), nil
+}
+
+// SaveJob appends a delete job to the jobs file replacing its previous state unless another owner holds it.
+// Owners and leases are kept in memory only, as no other process uses the storage.
+func (r *FileRepo) SaveJob(ctx context.Context, job *models.Job) error {
+	r.Lock()
+	defer r.Unlock()
+	if stored, ok := r.jobs[job.ID]; ok {
+		if err := checkJobOwner(stored.Owner, job); err != nil {
+			return err
+		}
+	}
+	stored := *job
+	if err := json.NewEncoder(r.jobsFile).Encode(&stored); err != nil {
+		return fmt.Errorf("error writing jobs file : %v", err)
+	}
+	if _, ok := r.jobs[job.ID]; ok {
+		r.stale[r.jobsFile] = true
+	}
+	r.jobs[job.ID] = &stored
+	return nil
+}
+
+// ReserveIDs advances the id sequence by n and returns its previous value.
+// The ids file is replaced rather than appended to, so it holds a single value.
+func (r *FileRepo) ReserveIDs(ctx context.Context, n uint64) (uint64, error) {
+	r.Lock()
+	defer r.Unlock()
+	last := r.sequence
+	if n == 0 {
+		return last, nil
+	}
+	err := replaceFile(r.filename+".ids", func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, last+n)
+		return err
+	})
 	if err != nil {
-		log.Println("error updating file 1:", err)
+		return 0, err
+	}
+	r.sequence = last + n
+	return last, nil
+}
+
+// GetHistory returns previous targets of a url.
+func (r *FileRepo) GetHistory(ctx context.Context, id string) ([]*models.URLVersion, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.history[id], nil
+}
+
+// AddClicks appends recorded clicks to the clicks file.
+func (r *FileRepo) AddClicks(ctx context.Context, clicks []*models.Click) error {
+	r.Lock()
+	defer r.Unlock()
+	encoder := json.NewEncoder(r.clicksFile)
+	for _, v := range clicks {
+		if err := encoder.Encode(v); err != nil {
+			return fmt.Errorf("error writing clicks file : %v", err)
+		}
+		r.clicks[v.ShortURL] = append(r.clicks[v.ShortURL], v)
+	}
+	return nil
+}
+
+// ConsumeClick counts a redirect of a url limited in clicks, failing once all of them are used.
+func (r *FileRepo) ConsumeClick(ctx context.Context, id string) (*models.URL, error) {
+	r.Lock()
+	defer r.Unlock()
+	url, ok := r.cacheByShort[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", models.ErrInvalidID, id)
+	}
+	if url.Exhausted() {
+		return nil, models.ErrURLExhausted
+	}
+	clicked := *url
+	clicked.Clicks++
+	// The counter is logged before the redirect, so a restart can't give extra clicks.
+	if err := r.write(opClick, &clicked); err != nil {
+		return nil, err
+	}
+	r.put(&clicked)
+	return &clicked, nil
+}
+
+// GetClickStats counts clicks of a short url grouped by bucket.
+func (r *FileRepo) GetClickStats(ctx context.Context, id string, bucket string) (*models.ClickStats, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return bucketClicks(id, r.clicks[id], bucket)
+}
+
+// sync syncs log and history records written since the last sync when group commit is used.
+func (r *FileRepo) sync() {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.historyFile.Sync(); err != nil {
+		log.Printf("error syncing history file : %v", err)
+	}
+	if err := r.syncLog(); err != nil {
+		log.Println(err)
 	}
-	// Put cursor at the beginning of the file
-	_, err = r.file.Seek(0, 0)
+}
+
+// checkpoint compacts the log into a new snapshot.
+func (r *FileRepo) checkpoint() {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.compact(); err != nil {
+		log.Println(err)
+	}
+}
+
+// compact writes cached urls to a new snapshot and truncates the log, then rewrites stale side files.
+// The snapshot replaces the old one only when it is completely written,
+// so a crash leaves either the old snapshot with the full log or the new one.
+func (r *FileRepo) compact() error {
+	err := replaceFile(r.filename, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		for _, v := range r.cacheByShort {
+			if err := encoder.Encode(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		log.Println("error updating file 2:", err)
+		return fmt.Errorf("error writing snapshot : %v", err)
 	}
-	// Write cached data to file
-	for _, v := range r.cacheByShort {
-		err = r.encoder.Encode(&v)
+	// Records not flushed yet are in the snapshot already.
+	r.walWriter.Reset(r.wal)
+	if err = r.wal.Truncate(0); err != nil {
+		return fmt.Errorf("error truncating log file : %v", err)
+	}
+	if err = r.wal.Sync(); err != nil {
+		return fmt.Errorf("error syncing log file : %v", err)
+	}
+	return r.compactSideFiles()
+}
+
+// compactSideFiles rewrites side files holding stale records with the cached records only.
+func (r *FileRepo) compactSideFiles() error {
+	if r.stale[r.clicksFile] {
+		err := r.rewrite(&r.clicksFile, func(encoder *json.Encoder) error {
+			for _, clicks := range r.clicks {
+				for _, v := range clicks {
+					if err := encoder.Encode(v); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
 		if err != nil {
-			log.Println("error updating file 3:", err)
+			return err
 		}
 	}
-	log.Println("finished file update")
+	if r.stale[r.historyFile] {
+		err := r.rewrite(&r.historyFile, func(encoder *json.Encoder) error {
+			for _, versions := range r.history {
+				for _, v := range versions {
+					if err := encoder.Encode(v); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if r.stale[r.quotasFile] {
+		err := r.rewrite(&r.quotasFile, func(encoder *json.Encoder) error {
+			for _, v := range r.quotas {
+				if err := encoder.Encode(v); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if r.stale[r.jobsFile] {
+		err := r.rewrite(&r.jobsFile, func(encoder *json.Encoder) error {
+			for _, v := range r.jobs {
+				if err := encoder.Encode(v); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewrite replaces a side file with the records written by write and reopens it for appending.
+func (r *FileRepo) rewrite(file **os.File, write func(encoder *json.Encoder) error) error {
+	name := (*file).Name()
+	err := replaceFile(name, func(w io.Writer) error {
+		return write(json.NewEncoder(w))
+	})
+	if err != nil {
+		return err
+	}
+	reopened, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("error opening %s : %v", name, err)
+	}
+	delete(r.stale, *file)
+	(*file).Close()
+	*file = reopened
+	return nil
+}
+
+// replaceFile writes a temporary file and renames it to name once it is written and synced,
+// so a crash leaves either the old content of name or the new one.
+func replaceFile(name string, write func(w io.Writer) error) error {
+	tmp := name + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("error creating %s : %v", tmp, err)
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	if err = write(w); err != nil {
+		return fmt.Errorf("error writing %s : %v", tmp, err)
+	}
+	if err = w.Flush(); err != nil {
+		return fmt.Errorf("error writing %s : %v", tmp, err)
+	}
+	if err = file.Sync(); err != nil {
+		return fmt.Errorf("error syncing %s : %v", tmp, err)
+	}
+	if err = os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("error replacing %s : %v", name, err)
+	}
+	return nil
 }
 
 // Ping checks if file is available.
 func (r *FileRepo) Ping(ctx context.Context) error {
-	_, err := os.Stat(r.file.Name())
+	_, err := os.Stat(r.wal.Name())
 	return err
 }
 
-// DeleteRepo deletes repository file.
+// DeleteRepo deletes repository files.
 func (r *FileRepo) DeleteRepo(ctx context.Context) error {
-	err := r.file.Close()
+	err := r.wal.Close()
 	if err != nil {
-		return fmt.Errorf("error closing file : %v", err)
+		return fmt.Errorf("error closing log file : %v", err)
 	}
-	// Delete the file
-	err = os.Remove(r.file.Name())
+	err = os.Remove(r.wal.Name())
 	if err != nil {
+		return fmt.Errorf("error deleting log file : %v", err)
+	}
+	// The snapshot doesn't exist until the log is compacted.
+	err = os.Remove(r.filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return fmt.Errorf("error deleting file : %v", err)
 	}
+	err = r.clicksFile.Close()
+	if err != nil {
+		return fmt.Errorf("error closing clicks file : %v", err)
+	}
+	err = os.Remove(r.clicksFile.Name())
+	if err != nil {
+		return fmt.Errorf("error deleting clicks file : %v", err)
+	}
+	err = r.historyFile.Close()
+	if err != nil {
+		return fmt.Errorf("error closing history file : %v", err)
+	}
+	err = os.Remove(r.historyFile.Name())
+	if err != nil {
+		return fmt.Errorf("error deleting history file : %v", err)
+	}
+	err = r.quotasFile.Close()
+	if err != nil {
+		return fmt.Errorf("error closing quotas file : %v", err)
+	}
+	err = os.Remove(r.quotasFile.Name())
+	if err != nil {
+		return fmt.Errorf("error deleting quotas file : %v", err)
+	}
+	err = r.jobsFile.Close()
+	if err != nil {
+		return fmt.Errorf("error closing jobs file : %v", err)
+	}
+	err = os.Remove(r.jobsFile.Name())
+	if err != nil {
+		return fmt.Errorf("error deleting jobs file : %v", err)
+	}
+	// The ids file doesn't exist until ids are reserved.
+	err = os.Remove(r.filename + ".ids")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error deleting ids file : %v", err)
+	}
 	return nil
 }
 
@@ -202,14 +957,33 @@ func (r *FileRepo) Stats(ctx context.Context) (*models.Stats, error) {
 	return &stats, nil
 }
 
-// Close closes file
+// Close compacts the log and closes files
 func (r *FileRepo) Close() error {
 	r.Lock()
 	defer r.Unlock()
-	r.updateFile()
-	err := r.file.Close()
+	err := r.compact()
+	if err != nil {
+		return err
+	}
+	err = r.wal.Close()
+	if err != nil {
+		return fmt.Errorf("error closing log file : %v", err)
+	}
+	err = r.clicksFile.Close()
+	if err != nil {
+		return fmt.Errorf("error closing clicks file : %v", err)
+	}
+	err = r.historyFile.Close()
+	if err != nil {
+		return fmt.Errorf("error closing history file : %v", err)
+	}
+	err = r.quotasFile.Close()
+	if err != nil {
+		return fmt.Errorf("error closing quotas file : %v", err)
+	}
+	err = r.jobsFile.Close()
 	if err != nil {
-		return fmt.Errorf("error closing file : %v", err)
+		return fmt.Errorf("error closing jobs file : %v", err)
 	}
 	return nil
 }
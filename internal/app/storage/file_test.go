@@ -1,7 +1,12 @@
 package storage
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Mldlr/url-shortener/internal/app/models"
 	"github.com/stretchr/testify/assert"
@@ -57,3 +62,162 @@ func TestFileRepo(t *testing.T) {
 		})
 	}
 }
+
+// reopen loads a new FileRepo from the files of repo.
+func reopen(t *testing.T, filename string) *FileRepo {
+	r, err := NewFileRepo(filename)
+	require.NoError(t, err)
+	require.NoError(t, r.Load())
+	return r
+}
+
+func TestFileRepo_Replay(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "urls")
+	repo := reopen(t, filename)
+	_, err := repo.Add(ctx, &models.URL{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1"})
+	require.NoError(t, err)
+	_, err = repo.AddBatch(ctx, []*models.URL{
+		{ShortURL: "2", LongURL: "https://yandex.ru/", UserID: "user1"},
+		{ShortURL: "3", LongURL: "https://gitlab.com/", UserID: "user2"},
+	})
+	require.NoError(t, err)
+	_, err = repo.DeleteURLs([]*models.DeleteURLItem{{ShortURL: "1", UserID: "user1"}, {ShortURL: "2", UserID: "user1"}})
+	require.NoError(t, err)
+	_, err = repo.RestoreURLs([]*models.DeleteURLItem{{ShortURL: "2", UserID: "user1"}})
+	require.NoError(t, err)
+	_, err = repo.UpdateURL(ctx, &models.URL{ShortURL: "3", LongURL: "https://bitbucket.org/", UserID: "user2"}, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, repo.SetQuota(ctx, &models.Quota{UserID: "user1", Daily: 5}))
+	require.NoError(t, repo.SetQuota(ctx, &models.Quota{UserID: "user1", Daily: 10, Total: 20}))
+	require.NoError(t, repo.SaveJob(ctx, &models.Job{ID: "j1", UserID: "user1", Status: models.JobPending, IDs: []string{"1"}}))
+	require.NoError(t, repo.SaveJob(ctx, &models.Job{ID: "j1", UserID: "user1", Status: models.JobDone, IDs: []string{"1"}, Deleted: 1}))
+
+	// Load the log without closing repo as if it crashed.
+	loaded := reopen(t, filename)
+	for _, id := range []string{"1", "2", "3"} {
+		want, err := repo.Get(ctx, id)
+		require.NoError(t, err)
+		got, err := loaded.Get(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, want.LongURL, got.LongURL)
+		assert.Equal(t, want.UserID, got.UserID)
+		assert.Equal(t, want.Deleted, got.Deleted)
+	}
+	stats, err := loaded.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &models.Stats{URLCount: 3, UserCount: 2}, stats)
+	quota, err := loaded.GetQuota(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, &models.Quota{UserID: "user1", Daily: 10, Total: 20}, quota)
+	job, err := loaded.GetJob(ctx, "j1")
+	require.NoError(t, err)
+	assert.Equal(t, models.JobDone, job.Status)
+	assert.Equal(t, 1, job.Deleted)
+	require.NoError(t, repo.Close())
+	require.NoError(t, loaded.Close())
+}
+
+func TestFileRepo_Compact(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "urls")
+	repo := reopen(t, filename)
+	_, err := repo.AddBatch(ctx, []*models.URL{
+		{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1"},
+		{ShortURL: "2", LongURL: "https://yandex.ru/", UserID: "user1"},
+	})
+	require.NoError(t, err)
+	_, err = repo.DeleteURLs([]*models.DeleteURLItem{{ShortURL: "1", UserID: "user1"}})
+	require.NoError(t, err)
+	repo.checkpoint()
+	info, err := os.Stat(filename + ".wal")
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+	// Changes after compaction are logged on top of the snapshot.
+	n, err := repo.PurgeDeleted(ctx, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	loaded := reopen(t, filename)
+	_, err = loaded.Get(ctx, "1")
+	assert.Error(t, err)
+	got, err := loaded.GetByUser(ctx, "user1", &models.URLQuery{})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, "https://yandex.ru/", got[0].LongURL)
+	require.NoError(t, repo.Close())
+	require.NoError(t, loaded.Close())
+}
+
+func TestFileRepo_CompactSideFiles(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "urls")
+	repo := reopen(t, filename)
+	_, err := repo.AddBatch(ctx, []*models.URL{
+		{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1"},
+		{ShortURL: "2", LongURL: "https://yandex.ru/", UserID: "user1"},
+	})
+	require.NoError(t, err)
+	now := time.Now()
+	require.NoError(t, repo.AddClicks(ctx, []*models.Click{{ShortURL: "1", Time: now}, {ShortURL: "2", Time: now}}))
+	_, err = repo.UpdateURL(ctx, &models.URL{ShortURL: "2", LongURL: "https://gitlab.com/", UserID: "user1"}, now)
+	require.NoError(t, err)
+	// Replaced quotas and jobs and records of purged urls are stale.
+	for _, daily := range []int{1, 2, 3} {
+		require.NoError(t, repo.SetQuota(ctx, &models.Quota{UserID: "user1", Daily: daily}))
+	}
+	for _, status := range []string{models.JobPending, models.JobDone} {
+		require.NoError(t, repo.SaveJob(ctx, &models.Job{ID: "job1", UserID: "user1", Status: status, CreatedAt: now}))
+	}
+	_, err = repo.DeleteURLs([]*models.DeleteURLItem{{ShortURL: "2", UserID: "user1"}})
+	require.NoError(t, err)
+	_, err = repo.PurgeDeleted(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	repo.checkpoint()
+	lines := func(suffix string) int {
+		data, err := os.ReadFile(filename + suffix)
+		require.NoError(t, err)
+		return strings.Count(string(data), "\n")
+	}
+	assert.Equal(t, 1, lines(".clicks"))
+	assert.Zero(t, lines(".history"))
+	assert.Equal(t, 1, lines(".quotas"))
+	assert.Equal(t, 1, lines(".jobs"))
+	// Records are appended to the rewritten files.
+	require.NoError(t, repo.AddClicks(ctx, []*models.Click{{ShortURL: "1", Time: now}}))
+
+	loaded := reopen(t, filename)
+	assert.Len(t, loaded.clicks["1"], 2)
+	assert.Empty(t, loaded.history)
+	quota, err := loaded.GetQuota(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, quota.Daily)
+	job, err := loaded.GetJob(ctx, "job1")
+	require.NoError(t, err)
+	assert.Equal(t, models.JobDone, job.Status)
+	require.NoError(t, repo.Close())
+	require.NoError(t, loaded.Close())
+}
+
+func TestFileRepo_TornLog(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "urls")
+	repo := reopen(t, filename)
+	_, err := repo.Add(ctx, &models.URL{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1"})
+	require.NoError(t, err)
+	// Write half of a record as if the process crashed while writing it.
+	_, err = repo.wal.WriteString(`{"op":"create","url":{"short_u`)
+	require.NoError(t, err)
+
+	loaded := reopen(t, filename)
+	_, err = loaded.Get(ctx, "1")
+	assert.NoError(t, err)
+	_, err = loaded.Add(ctx, &models.URL{ShortURL: "2", LongURL: "https://yandex.ru/", UserID: "user1"})
+	require.NoError(t, err)
+	again := reopen(t, filename)
+	_, err = again.Get(ctx, "2")
+	assert.NoError(t, err)
+	require.NoError(t, repo.Close())
+	require.NoError(t, loaded.Close())
+	require.NoError(t, again.Close())
+}
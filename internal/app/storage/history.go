@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// checkUpdate checks if stored url can be retargeted by the update.
+// existing is the stored url with the requested target, if any.
+func checkUpdate(stored, update, existing *models.URL) error {
+	switch {
+	case stored == nil:
+		return models.ErrURLNotFound
+	case stored.UserID != update.UserID:
+		return models.ErrNotOwner
+	case stored.Deleted:
+		return models.ErrURLDeleted
+	case existing != nil && existing.ShortURL != stored.ShortURL:
+		return models.ErrDuplicate
+	}
+	return nil
+}
+
+// retarget returns a copy of stored url pointing to the new target and the version of the replaced target.
+// Stored url is copied so readers holding it don't race with the update.
+func retarget(stored *models.URL, longURL string, history []*models.URLVersion, now time.Time) (*models.URL, *models.URLVersion) {
+	updated := *stored
+	updated.LongURL = longURL
+	version := &models.URLVersion{
+		ShortURL:  stored.ShortURL,
+		Version:   len(history) + 1,
+		LongURL:   stored.LongURL,
+		ChangedAt: now,
+	}
+	return &updated, version
+}
+
+// replaceURL replaces url in a list of urls.
+func replaceURL(urls []*models.URL, old, url *models.URL) {
+	for i, v := range urls {
+		if v == old {
+			urls[i] = url
+			return
+		}
+	}
+}
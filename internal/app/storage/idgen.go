@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/Mldlr/url-shortener/internal/app/config"
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/utils/encoders"
+	"github.com/Mldlr/url-shortener/internal/app/utils/validators"
+)
+
+// Short id generation strategies.
+const (
+	// IDStrategyHash derives id from the hash of the long url.
+	IDStrategyHash = "hash"
+	// IDStrategyRandom generates random ids.
+	IDStrategyRandom = "random"
+	// IDStrategySequence encodes an incrementing counter.
+	IDStrategySequence = "sequence"
+)
+
+// defaultIDRetries is the number of regenerations on collision if none is configured.
+const defaultIDRetries = 5
+
+// IDGenerator generates short ids for long urls.
+type IDGenerator interface {
+	// Generate returns an id for url, attempt is the number of collisions already met.
+	Generate(url string, attempt int) (string, error)
+}
+
+// NewIDGenerator initializes the id generator selected in config.
+func NewIDGenerator(c *config.Config) (IDGenerator, error) {
+	switch c.IDStrategy {
+	case IDStrategyHash, "":
+		return &HashGenerator{Salt: c.IDSalt}, nil
+	case IDStrategyRandom:
+		if c.IDLength <= 0 {
+			return nil, fmt.Errorf("invalid id length: %d", c.IDLength)
+		}
+		return &RandomGenerator{Length: c.IDLength}, nil
+	case IDStrategySequence:
+		return &SequenceGenerator{}, nil
+	default:
+		return nil, fmt.Errorf("unknown id strategy: %s", c.IDStrategy)
+	}
+}
+
+// HashGenerator derives ids from url hash, salting it on collision.
+type HashGenerator struct {
+	// Salt is appended to the url with the attempt number on collision.
+	Salt string
+}
+
+// Generate returns the hash of url, or of the salted url on retries.
+func (g *HashGenerator) Generate(url string, attempt int) (string, error) {
+	if attempt == 0 {
+		return encoders.ToRBase62(url), nil
+	}
+	return encoders.ToRBase62(url + g.Salt + strconv.Itoa(attempt)), nil
+}
+
+// RandomGenerator generates random base62 ids.
+type RandomGenerator struct {
+	// Length is the length of generated ids.
+	Length int
+}
+
+// Generate returns a new random id.
+func (g *RandomGenerator) Generate(string, int) (string, error) {
+	return encoders.RandomBase62(g.Length)
+}
+
+// sequenceBlock is the number of sequence values reserved in the repository at once.
+const sequenceBlock = 100
+
+// SequenceGenerator encodes an incrementing counter to base62.
+// With a repository the values are reserved there in blocks, so a restart continues past all of them.
+type SequenceGenerator struct {
+	// counter is the last issued value.
+	counter uint64
+	// limit is the last value of the reserved block.
+	limit uint64
+	// reserve advances the stored sequence by n and returns its previous value, nil if values are not stored.
+	reserve func(n uint64) (uint64, error)
+	// Mutex guards the counter and the block.
+	sync.Mutex
+}
+
+// Generate returns the next id of the sequence.
+// Blocks are reserved only on first attempts, which are made by NewID outside of repository locks,
+// while retries under the locks take the rest of the block, which is topped up before it runs out.
+// Retries may run past the block, so the check doesn't subtract the counter from the limit.
+func (g *SequenceGenerator) Generate(_ string, attempt int) (string, error) {
+	g.Lock()
+	defer g.Unlock()
+	if g.reserve != nil && attempt == 0 && g.counter+sequenceBlock/2 >= g.limit {
+		start, err := g.reserve(sequenceBlock)
+		if err != nil {
+			return "", fmt.Errorf("error reserving id sequence : %v", err)
+		}
+		// Another instance sharing the repository took the values following the block.
+		if start != g.limit {
+			g.counter = start
+		}
+		g.limit = start + sequenceBlock
+	}
+	g.counter++
+	return encoders.EncodeRBase62(g.counter), nil
+}
+
+// Seed moves the sequence past n already issued ids.
+func (g *SequenceGenerator) Seed(n uint64) {
+	g.Lock()
+	defer g.Unlock()
+	g.counter, g.limit = n, n
+}
+
+// seedIDs moves a sequence generator past the ids reserved in repository and makes it reserve the next ones there.
+func seedIDs(r Repository, gen IDGenerator) {
+	seq, ok := gen.(*SequenceGenerator)
+	if !ok {
+		return
+	}
+	ctx := context.Background()
+	last, err := r.ReserveIDs(ctx, 0)
+	if err != nil {
+		log.Fatal(fmt.Errorf("error seeding id sequence : %v", err))
+	}
+	// Repositories written before the sequence was stored start past the number of their urls.
+	if last == 0 {
+		stats, err := r.Stats(ctx)
+		if err != nil {
+			log.Fatal(fmt.Errorf("error seeding id sequence : %v", err))
+		}
+		if last, err = r.ReserveIDs(ctx, uint64(stats.URLCount)); err != nil {
+			log.Fatal(fmt.Errorf("error seeding id sequence : %v", err))
+		}
+		last += uint64(stats.URLCount)
+	}
+	seq.Seed(last)
+	seq.reserve = func(n uint64) (uint64, error) {
+		return r.ReserveIDs(context.Background(), n)
+	}
+}
+
+// idSource provides short id generation to repositories.
+type idSource struct {
+	gen     IDGenerator
+	retries int
+}
+
+// newIDSource returns an idSource using the hash strategy.
+func newIDSource() idSource {
+	return idSource{gen: &HashGenerator{}, retries: defaultIDRetries}
+}
+
+// NewID calculates a string to use as an ID.
+func (s idSource) NewID(url string) (string, error) {
+	return s.gen.Generate(url, 0)
+}
+
+// resolve regenerates the short id of url until taken reports it as free.
+func (s idSource) resolve(url *models.URL, taken func(id string) bool) error {
+	var err error
+	for attempt := 1; taken(url.ShortURL) || validators.IsReserved(url.ShortURL); attempt++ {
+		// Custom aliases are never regenerated.
+		if url.Alias != "" {
+			return models.ErrAliasTaken
+		}
+		if attempt > s.retries {
+			return models.ErrIDCollision
+		}
+		url.ShortURL, err = s.gen.Generate(url.LongURL, attempt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
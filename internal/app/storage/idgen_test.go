@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mldlr/url-shortener/internal/app/config"
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/utils/encoders"
+)
+
+// constGenerator always returns the same id on the first attempt.
+type constGenerator struct {
+	id string
+}
+
+func (g *constGenerator) Generate(url string, attempt int) (string, error) {
+	if attempt == 0 {
+		return g.id, nil
+	}
+	return (&HashGenerator{}).Generate(url, attempt)
+}
+
+func TestNewIDGenerator(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		want     IDGenerator
+		wantErr  bool
+	}{
+		{name: "Hash", strategy: IDStrategyHash, want: &HashGenerator{}},
+		{name: "Random", strategy: IDStrategyRandom, want: &RandomGenerator{Length: 8}},
+		{name: "Sequence", strategy: IDStrategySequence, want: &SequenceGenerator{}},
+		{name: "Unknown", strategy: "uuid", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := NewIDGenerator(&config.Config{IDStrategy: tt.strategy, IDLength: 8})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, gen)
+		})
+	}
+}
+
+func TestSequenceGenerator(t *testing.T) {
+	gen := &SequenceGenerator{}
+	gen.Seed(61)
+	id, err := gen.Generate("", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "01", id)
+}
+
+func TestSequenceGenerator_Retries(t *testing.T) {
+	// Both generators reserve blocks of a sequence stored like in a shared repository.
+	var stored uint64
+	reserve := func(n uint64) (uint64, error) {
+		start := stored
+		stored += n
+		return start, nil
+	}
+	first := &SequenceGenerator{reserve: reserve}
+	second := &SequenceGenerator{reserve: reserve}
+	_, err := first.Generate("", 0)
+	require.NoError(t, err)
+	// Retries take more values than the block holds.
+	for i := 0; i < sequenceBlock*3/2; i++ {
+		_, err = first.Generate("", 1)
+		require.NoError(t, err)
+	}
+	id, err := second.Generate("", 0)
+	require.NoError(t, err)
+	assert.Equal(t, encoders.EncodeRBase62(sequenceBlock+1), id)
+	// The next first attempt reserves a new block instead of issuing values of the second generator.
+	id, err = first.Generate("", 0)
+	require.NoError(t, err)
+	assert.Equal(t, encoders.EncodeRBase62(2*sequenceBlock+1), id)
+}
+
+func TestSequenceGenerator_Restart(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "urls")
+	// open reloads the repository with a sequence generator and no retries, so a reissued id fails to be added.
+	open := func() *FileRepo {
+		repo := reopen(t, filename)
+		gen := &SequenceGenerator{}
+		repo.idSource = idSource{gen: gen}
+		seedIDs(repo, gen)
+		return repo
+	}
+	add := func(repo *FileRepo, longURL string) (string, error) {
+		url := &models.URL{LongURL: longURL, UserID: "user1"}
+		var err error
+		url.ShortURL, err = repo.NewID(url.LongURL)
+		require.NoError(t, err)
+		_, err = repo.Add(ctx, url)
+		return url.ShortURL, err
+	}
+	repo := open()
+	var ids []string
+	for _, v := range []string{"https://github.com/", "https://yandex.ru/", "https://gitlab.com/"} {
+		id, err := add(repo, v)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	assert.Equal(t, []string{"1", "2", "3"}, ids)
+	// Purging the first url leaves fewer urls than issued ids.
+	_, err := repo.DeleteURLs([]*models.DeleteURLItem{{ShortURL: "1", UserID: "user1"}})
+	require.NoError(t, err)
+	n, err := repo.PurgeDeleted(ctx, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.NoError(t, repo.Close())
+
+	loaded := open()
+	id, err := add(loaded, "https://bitbucket.org/")
+	require.NoError(t, err)
+	assert.NotContains(t, ids, id)
+	require.NoError(t, loaded.Close())
+}
+
+func TestInMemRepo_Collision(t *testing.T) {
+	repo := NewInMemRepo()
+	repo.idSource = idSource{gen: &constGenerator{id: "same"}, retries: 1}
+	ctx := context.Background()
+	first := &models.URL{LongURL: "https://github.com/", UserID: "user1"}
+	first.ShortURL, _ = repo.NewID(first.LongURL)
+	_, err := repo.Add(ctx, first)
+	require.NoError(t, err)
+	assert.Equal(t, "same", first.ShortURL)
+	// Second url gets the same id from generator and has to be regenerated.
+	second := &models.URL{LongURL: "https://yandex.ru/", UserID: "user1"}
+	second.ShortURL, _ = repo.NewID(second.LongURL)
+	_, err = repo.AddBatch(ctx, []*models.URL{second})
+	require.NoError(t, err)
+	assert.NotEqual(t, "same", second.ShortURL)
+	got, err := repo.Get(ctx, "same")
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.com/", got.LongURL)
+	// Alias is never regenerated.
+	alias := &models.URL{LongURL: "https://gitlab.com/", ShortURL: "same", Alias: "same"}
+	_, err = repo.Add(ctx, alias)
+	assert.ErrorIs(t, err, models.ErrAliasTaken)
+}
@@ -4,8 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
-
-	"github.com/Mldlr/url-shortener/internal/app/utils/encoders"
+	"time"
 
 	"github.com/Mldlr/url-shortener/internal/app/models"
 )
@@ -18,6 +17,18 @@ type InMemRepo struct {
 	urlsByShort map[string]*models.URL
 	// urlsByUser maps user IDs to their corresponding URL models.
 	urlsByUser map[string][]*models.URL
+	// clicks maps short URLs to their recorded clicks.
+	clicks map[string][]*models.Click
+	// history maps short URLs to their previous targets.
+	history map[string][]*models.URLVersion
+	// quotas maps user IDs to their own quotas.
+	quotas map[string]*models.Quota
+	// jobs maps IDs to delete jobs.
+	jobs map[string]*models.Job
+	// sequence is the last reserved value of the id sequence.
+	sequence uint64
+	// idSource generates short IDs.
+	idSource
 	// RWMutex synchronizes access to the FileRepo.
 	sync.RWMutex
 }
@@ -28,6 +39,11 @@ func NewInMemRepo() *InMemRepo {
 		urlsByShort:  make(map[string]*models.URL),
 		urlsByUser:   make(map[string][]*models.URL),
 		existingURLs: make(map[string]*models.URL),
+		clicks:       make(map[string][]*models.Click),
+		history:      make(map[string][]*models.URLVersion),
+		quotas:       make(map[string]*models.Quota),
+		jobs:         make(map[string]*models.Job),
+		idSource:     newIDSource(),
 	}
 }
 
@@ -37,7 +53,7 @@ func (r *InMemRepo) Get(ctx context.Context, id string) (*models.URL, error) {
 	defer r.RUnlock()
 	url, ok := r.urlsByShort[id]
 	if !ok {
-		return nil, fmt.Errorf("invalid id: %s", id)
+		return nil, fmt.Errorf("%w: %s", models.ErrInvalidID, id)
 	}
 	return url, nil
 }
@@ -51,6 +67,10 @@ func (r *InMemRepo) Add(ctx context.Context, url *models.URL) (bool, error) {
 		url.ShortURL = v.ShortURL
 		return true, nil
 	}
+	// Regenerate short url if it is used by another record.
+	if err := r.resolve(url, r.taken); err != nil {
+		return false, err
+	}
 	// Otherwise add url to maps.
 	r.urlsByShort[url.ShortURL] = url
 	r.urlsByUser[url.UserID] = append(r.urlsByUser[url.UserID], url)
@@ -67,9 +87,12 @@ func (r *InMemRepo) AddBatch(ctx context.Context, urls []*models.URL) (bool, err
 	for _, v := range urls {
 		if i, k := r.existingURLs[v.LongURL]; k {
 			duplicates = true
-			v.ShortURL = i.ShortURL
+			v.ShortURL, v.Duplicate = i.ShortURL, true
 			continue
 		}
+		if err := r.resolve(v, r.taken); err != nil {
+			return duplicates, err
+		}
 		r.existingURLs[v.LongURL] = v
 		r.urlsByShort[v.ShortURL] = v
 		r.urlsByUser[v.UserID] = append(r.urlsByUser[v.UserID], v)
@@ -77,22 +100,24 @@ func (r *InMemRepo) AddBatch(ctx context.Context, urls []*models.URL) (bool, err
 	return duplicates, nil
 }
 
-// NewID returns a number to encode as an id
-func (r *InMemRepo) NewID(url string) (string, error) {
-	return encoders.ToRBase62(url), nil
+// taken checks if short url is used by a stored record.
+func (r *InMemRepo) taken(id string) bool {
+	_, ok := r.urlsByShort[id]
+	return ok
 }
 
-// GetByUser finds URLs created by user.
-func (r *InMemRepo) GetByUser(ctx context.Context, userID string) ([]*models.URL, error) {
+// GetByLong finds the url stored for a long url, nil if it isn't stored.
+func (r *InMemRepo) GetByLong(ctx context.Context, longURL string) (*models.URL, error) {
 	r.RLock()
 	defer r.RUnlock()
-	urls := make([]*models.URL, 0)
-	// Get all urls for user.
-	urls = append(urls, r.urlsByUser[userID]...)
-	if len(urls) == 0 {
-		return nil, nil
-	}
-	return urls, nil
+	return r.existingURLs[longURL], nil
+}
+
+// GetByUser finds a page of URLs created by user.
+func (r *InMemRepo) GetByUser(ctx context.Context, userID string, q *models.URLQuery) ([]*models.URL, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return pageURLs(r.urlsByUser[userID], q), nil
 }
 
 // DeleteURLs delete urls from maps.
@@ -100,16 +125,251 @@ func (r *InMemRepo) DeleteURLs(deleteURLs []*models.DeleteURLItem) (int, error)
 	r.Lock()
 	defer r.Unlock()
 	var n int
+	now := time.Now()
 	// For each of the urls check if the user created this url and delete it if confirmed.
+	// Deleted urls are copied so readers holding them don't race with the delete.
 	for _, v := range deleteURLs {
-		if _, ok := r.urlsByShort[v.ShortURL]; ok && r.urlsByShort[v.ShortURL].UserID == v.UserID {
-			r.urlsByShort[v.ShortURL].Deleted = true
+		if url, ok := r.urlsByShort[v.ShortURL]; ok && url.UserID == v.UserID && !url.Deleted {
+			deleted := *url
+			deleted.Deleted = true
+			deleted.DeletedAt = &now
+			r.replace(url, &deleted)
+			v.Deleted = true
 			n++
 		}
 	}
 	return n, nil
 }
 
+// UpdateURL changes the target of a url created by user and keeps the previous one in history.
+func (r *InMemRepo) UpdateURL(ctx context.Context, url *models.URL, now time.Time) (*models.URL, error) {
+	r.Lock()
+	defer r.Unlock()
+	stored := r.urlsByShort[url.ShortURL]
+	if err := checkUpdate(stored, url, r.existingURLs[url.LongURL]); err != nil {
+		return nil, err
+	}
+	if stored.LongURL == url.LongURL {
+		return stored, nil
+	}
+	updated, version := retarget(stored, url.LongURL, r.history[url.ShortURL], now)
+	r.history[url.ShortURL] = append(r.history[url.ShortURL], version)
+	delete(r.existingURLs, stored.LongURL)
+	r.replace(stored, updated)
+	return updated, nil
+}
+
+// SetRules replaces redirect rules of a url created by user.
+func (r *InMemRepo) SetRules(ctx context.Context, url *models.URL) (*models.URL, error) {
+	r.Lock()
+	defer r.Unlock()
+	stored := r.urlsByShort[url.ShortURL]
+	if err := checkUpdate(stored, url, nil); err != nil {
+		return nil, err
+	}
+	updated := *stored
+	updated.Rules = url.Rules
+	r.replace(stored, &updated)
+	return &updated, nil
+}
+
+// SetBlocked blocks or unblocks a url regardless of its owner.
+func (r *InMemRepo) SetBlocked(ctx context.Context, url *models.URL) (*models.URL, error) {
+	r.Lock()
+	defer r.Unlock()
+	stored, ok := r.urlsByShort[url.ShortURL]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", models.ErrInvalidID, url.ShortURL)
+	}
+	updated := *stored
+	updated.Blocked, updated.BlockReason = url.Blocked, url.BlockReason
+	r.replace(stored, &updated)
+	return &updated, nil
+}
+
+// CountURLs counts urls kept by user and urls they created since the given time.
+func (r *InMemRepo) CountURLs(ctx context.Context, userID string, since time.Time) (int, int, error) {
+	r.RLock()
+	defer r.RUnlock()
+	total, created := countURLs(r.urlsByUser[userID], since)
+	return total, created, nil
+}
+
+// GetQuota returns the quota of user, nil if they have none of their own.
+func (r *InMemRepo) GetQuota(ctx context.Context, userID string) (*models.Quota, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.quotas[userID], nil
+}
+
+// SetQuota stores the quota of a user replacing their previous one.
+func (r *InMemRepo) SetQuota(ctx context.Context, quota *models.Quota) error {
+	r.Lock()
+	defer r.Unlock()
+	stored := *quota
+	r.quotas[quota.UserID] = &stored
+	return nil
+}
+
+// GetJob returns a delete job, nil if there is none with the ID.
+func (r *InMemRepo) GetJob(ctx context.Context, id string) (*models.Job, error) {
+	r.RLock()
+	defer r.RUnlock()
+	stored, ok := r.jobs[id]
+	if !ok {
+		return nil, nil
+	}
+	job := *stored
+	return &job, nil
+}
+
+// ClaimJobs returns the pending delete jobs whose lease ended by now, oldest first, and leases them to owner.
+func (r *InMemRepo) ClaimJobs(ctx context.Context, owner string, now time.Time, lease time.Duration) ([]*models.Job, error) {
+	r.Lock()
+	defer r.Unlock()
+	return claimJobs(r.jobs, owner, now, lease), nil
+}
+
+// SaveJob stores a delete job replacing its previous state unless another owner holds it.
+func (r *InMemRepo) SaveJob(ctx context.Context, job *models.Job) error {
+	r.Lock()
+	defer r.Unlock()
+	if stored, ok := r.jobs[job.ID]; ok {
+		if err := checkJobOwner(stored.Owner, job); err != nil {
+			return err
+		}
+	}
+	stored := *job
+	r.jobs[job.ID] = &stored
+	return nil
+}
+
+// ReserveIDs advances the id sequence by n and returns its previous value.
+func (r *InMemRepo) ReserveIDs(ctx context.Context, n uint64) (uint64, error) {
+	r.Lock()
+	defer r.Unlock()
+	last := r.sequence
+	r.sequence += n
+	return last, nil
+}
+
+// replace replaces stored url with its changed copy in maps.
+func (r *InMemRepo) replace(stored, url *models.URL) {
+	r.urlsByShort[url.ShortURL] = url
+	r.existingURLs[url.LongURL] = url
+	replaceURL(r.urlsByUser[url.UserID], stored, url)
+}
+
+// GetHistory returns previous targets of a url.
+func (r *InMemRepo) GetHistory(ctx context.Context, id string) ([]*models.URLVersion, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.history[id], nil
+}
+
+// RestoreURLs restores deleted urls created by user.
+func (r *InMemRepo) RestoreURLs(restoreURLs []*models.DeleteURLItem) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+	var n int
+	for _, v := range restoreURLs {
+		if url, ok := r.urlsByShort[v.ShortURL]; ok && url.Deleted && url.UserID == v.UserID {
+			restored := *url
+			restored.Deleted = false
+			restored.DeletedAt = nil
+			r.replace(url, &restored)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// PurgeDeleted removes urls deleted before the given time from maps.
+func (r *InMemRepo) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+	var n int
+	for _, url := range r.urlsByShort {
+		if !url.Deleted || url.DeletedAt == nil || url.DeletedAt.After(before) {
+			continue
+		}
+		r.remove(url)
+		n++
+	}
+	return n, nil
+}
+
+// remove removes url and its clicks and history from maps.
+func (r *InMemRepo) remove(url *models.URL) {
+	delete(r.urlsByShort, url.ShortURL)
+	delete(r.existingURLs, url.LongURL)
+	delete(r.clicks, url.ShortURL)
+	delete(r.history, url.ShortURL)
+	r.urlsByUser[url.UserID] = removeURL(r.urlsByUser[url.UserID], url)
+	if len(r.urlsByUser[url.UserID]) == 0 {
+		delete(r.urlsByUser, url.UserID)
+	}
+}
+
+// DeleteExpired removes urls expired by now from maps.
+func (r *InMemRepo) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+	var n int
+	for _, url := range r.urlsByShort {
+		if !url.Expired(now) {
+			continue
+		}
+		r.remove(url)
+		n++
+	}
+	return n, nil
+}
+
+// removeURL returns urls without url.
+func removeURL(urls []*models.URL, url *models.URL) []*models.URL {
+	for i, v := range urls {
+		if v == url {
+			return append(urls[:i], urls[i+1:]...)
+		}
+	}
+	return urls
+}
+
+// AddClicks stores recorded clicks.
+func (r *InMemRepo) AddClicks(ctx context.Context, clicks []*models.Click) error {
+	r.Lock()
+	defer r.Unlock()
+	for _, v := range clicks {
+		r.clicks[v.ShortURL] = append(r.clicks[v.ShortURL], v)
+	}
+	return nil
+}
+
+// ConsumeClick counts a redirect of a url limited in clicks, failing once all of them are used.
+func (r *InMemRepo) ConsumeClick(ctx context.Context, id string) (*models.URL, error) {
+	r.Lock()
+	defer r.Unlock()
+	url, ok := r.urlsByShort[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", models.ErrInvalidID, id)
+	}
+	if url.Exhausted() {
+		return nil, models.ErrURLExhausted
+	}
+	clicked := *url
+	clicked.Clicks++
+	r.replace(url, &clicked)
+	return &clicked, nil
+}
+
+// GetClickStats counts clicks of a short url grouped by bucket.
+func (r *InMemRepo) GetClickStats(ctx context.Context, id string, bucket string) (*models.ClickStats, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return bucketClicks(id, r.clicks[id], bucket)
+}
+
 // Ping is redundant for in-memory storage.
 func (r *InMemRepo) Ping(context.Context) error {
 	return nil
@@ -132,6 +392,11 @@ func (r *InMemRepo) DeleteRepo(context.Context) error {
 	// Reallocate maps.
 	r.urlsByShort = make(map[string]*models.URL)
 	r.urlsByUser = make(map[string][]*models.URL)
+	r.clicks = make(map[string][]*models.Click)
+	r.history = make(map[string][]*models.URLVersion)
+	r.quotas = make(map[string]*models.Quota)
+	r.jobs = make(map[string]*models.Job)
+	r.sequence = 0
 	return nil
 }
 
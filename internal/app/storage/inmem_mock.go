@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/Mldlr/url-shortener/internal/app/models"
 	"github.com/Mldlr/url-shortener/internal/app/utils/encoders"
@@ -13,6 +14,11 @@ type mockRepo struct {
 	urlsByShort  map[string]*models.URL
 	urlsByUser   map[string][]*models.URL
 	existingURLs map[string]*models.URL
+	clicks       map[string][]*models.Click
+	history      map[string][]*models.URLVersion
+	quotas       map[string]*models.Quota
+	jobs         map[string]*models.Job
+	sequence     uint64
 	sync.RWMutex
 }
 
@@ -22,6 +28,10 @@ func NewMockRepo() *mockRepo {
 		urlsByShort:  make(map[string]*models.URL),
 		urlsByUser:   make(map[string][]*models.URL),
 		existingURLs: make(map[string]*models.URL),
+		clicks:       make(map[string][]*models.Click),
+		history:      make(map[string][]*models.URLVersion),
+		quotas:       make(map[string]*models.Quota),
+		jobs:         make(map[string]*models.Job),
 	}
 	url1 := &models.URL{ShortURL: "3S93m80EGmF", LongURL: "https://github.com/Mldlr/url-shortener/internal/app/utils/encoders", UserID: "KS097f1lS&F"}
 	url2 := &models.URL{ShortURL: "aQqomlSbUsE", LongURL: "https://yandex.ru/", UserID: "KS097f1lS&F"}
@@ -39,7 +49,7 @@ func (r *mockRepo) Get(ctx context.Context, id string) (*models.URL, error) {
 	defer r.RUnlock()
 	url, ok := r.urlsByShort[id]
 	if !ok {
-		return nil, fmt.Errorf("invalid id: %s", id)
+		return nil, fmt.Errorf("%w: %s", models.ErrInvalidID, id)
 	}
 	return url, nil
 }
@@ -52,6 +62,9 @@ func (r *mockRepo) Add(ctx context.Context, url *models.URL) (bool, error) {
 		url.ShortURL = v.ShortURL
 		return true, nil
 	}
+	if _, k := r.urlsByShort[url.ShortURL]; k && url.Alias != "" {
+		return false, models.ErrAliasTaken
+	}
 	r.urlsByShort[url.ShortURL] = url
 	r.urlsByUser[url.UserID] = append(r.urlsByUser[url.UserID], url)
 	r.existingURLs[url.LongURL] = url
@@ -66,7 +79,7 @@ func (r *mockRepo) AddBatch(ctx context.Context, urls []*models.URL) (bool, erro
 	for _, v := range urls {
 		if i, k := r.existingURLs[v.LongURL]; k {
 			duplicates = true
-			v.ShortURL = i.ShortURL
+			v.ShortURL, v.Duplicate = i.ShortURL, true
 			continue
 		}
 		r.existingURLs[v.LongURL] = v
@@ -81,16 +94,18 @@ func (r *mockRepo) NewID(url string) (string, error) {
 	return encoders.ToRBase62(url), nil
 }
 
-// GetByUser finds URLs created by user.
-func (r *mockRepo) GetByUser(ctx context.Context, userID string) ([]*models.URL, error) {
+// GetByLong finds the url stored for a long url, nil if it isn't stored.
+func (r *mockRepo) GetByLong(ctx context.Context, longURL string) (*models.URL, error) {
 	r.RLock()
 	defer r.RUnlock()
-	s := make([]*models.URL, 0)
-	s = append(s, r.urlsByUser[userID]...)
-	if len(s) == 0 {
-		return nil, nil
-	}
-	return s, nil
+	return r.existingURLs[longURL], nil
+}
+
+// GetByUser finds a page of URLs created by user.
+func (r *mockRepo) GetByUser(ctx context.Context, userID string, q *models.URLQuery) ([]*models.URL, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return pageURLs(r.urlsByUser[userID], q), nil
 }
 
 // DeleteURLs delete urls from maps.
@@ -98,15 +113,236 @@ func (r *mockRepo) DeleteURLs(deleteURLs []*models.DeleteURLItem) (int, error) {
 	r.Lock()
 	defer r.Unlock()
 	var n int
+	now := time.Now()
 	for _, v := range deleteURLs {
-		if _, ok := r.urlsByShort[v.ShortURL]; ok && r.urlsByShort[v.ShortURL].UserID == v.UserID {
-			r.urlsByShort[v.ShortURL].Deleted = true
+		if url, ok := r.urlsByShort[v.ShortURL]; ok && url.UserID == v.UserID && !url.Deleted {
+			url.Deleted = true
+			url.DeletedAt = &now
+			v.Deleted = true
+			n++
+		}
+	}
+	return n, nil
+}
+
+// RestoreURLs restores deleted urls created by user.
+func (r *mockRepo) RestoreURLs(restoreURLs []*models.DeleteURLItem) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+	var n int
+	for _, v := range restoreURLs {
+		if url, ok := r.urlsByShort[v.ShortURL]; ok && url.Deleted && url.UserID == v.UserID {
+			url.Deleted = false
+			url.DeletedAt = nil
 			n++
 		}
 	}
 	return n, nil
 }
 
+// PurgeDeleted removes urls deleted before the given time from maps.
+func (r *mockRepo) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+	var n int
+	for _, url := range r.urlsByShort {
+		if !url.Deleted || url.DeletedAt == nil || url.DeletedAt.After(before) {
+			continue
+		}
+		r.remove(url)
+		n++
+	}
+	return n, nil
+}
+
+// remove removes url and its clicks and history from maps.
+func (r *mockRepo) remove(url *models.URL) {
+	delete(r.urlsByShort, url.ShortURL)
+	delete(r.existingURLs, url.LongURL)
+	delete(r.clicks, url.ShortURL)
+	delete(r.history, url.ShortURL)
+	r.urlsByUser[url.UserID] = removeURL(r.urlsByUser[url.UserID], url)
+	if len(r.urlsByUser[url.UserID]) == 0 {
+		delete(r.urlsByUser, url.UserID)
+	}
+}
+
+// DeleteExpired removes urls expired by now from maps.
+func (r *mockRepo) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+	var n int
+	for _, url := range r.urlsByShort {
+		if !url.Expired(now) {
+			continue
+		}
+		r.remove(url)
+		n++
+	}
+	return n, nil
+}
+
+// UpdateURL changes the target of a url created by user.
+func (r *mockRepo) UpdateURL(ctx context.Context, url *models.URL, now time.Time) (*models.URL, error) {
+	r.Lock()
+	defer r.Unlock()
+	stored := r.urlsByShort[url.ShortURL]
+	if err := checkUpdate(stored, url, r.existingURLs[url.LongURL]); err != nil {
+		return nil, err
+	}
+	if stored.LongURL == url.LongURL {
+		return stored, nil
+	}
+	updated, version := retarget(stored, url.LongURL, r.history[url.ShortURL], now)
+	r.history[url.ShortURL] = append(r.history[url.ShortURL], version)
+	r.urlsByShort[url.ShortURL] = updated
+	delete(r.existingURLs, stored.LongURL)
+	r.existingURLs[updated.LongURL] = updated
+	replaceURL(r.urlsByUser[updated.UserID], stored, updated)
+	return updated, nil
+}
+
+// SetRules replaces redirect rules of a url created by user.
+func (r *mockRepo) SetRules(ctx context.Context, url *models.URL) (*models.URL, error) {
+	r.Lock()
+	defer r.Unlock()
+	stored := r.urlsByShort[url.ShortURL]
+	if err := checkUpdate(stored, url, nil); err != nil {
+		return nil, err
+	}
+	updated := *stored
+	updated.Rules = url.Rules
+	r.urlsByShort[url.ShortURL] = &updated
+	r.existingURLs[updated.LongURL] = &updated
+	replaceURL(r.urlsByUser[updated.UserID], stored, &updated)
+	return &updated, nil
+}
+
+// SetBlocked blocks or unblocks a url regardless of its owner.
+func (r *mockRepo) SetBlocked(ctx context.Context, url *models.URL) (*models.URL, error) {
+	r.Lock()
+	defer r.Unlock()
+	stored, ok := r.urlsByShort[url.ShortURL]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", models.ErrInvalidID, url.ShortURL)
+	}
+	updated := *stored
+	updated.Blocked, updated.BlockReason = url.Blocked, url.BlockReason
+	r.urlsByShort[url.ShortURL] = &updated
+	r.existingURLs[updated.LongURL] = &updated
+	replaceURL(r.urlsByUser[updated.UserID], stored, &updated)
+	return &updated, nil
+}
+
+// CountURLs counts urls kept by user and urls they created since the given time.
+func (r *mockRepo) CountURLs(ctx context.Context, userID string, since time.Time) (int, int, error) {
+	r.RLock()
+	defer r.RUnlock()
+	total, created := countURLs(r.urlsByUser[userID], since)
+	return total, created, nil
+}
+
+// GetQuota returns the quota of user, nil if they have none of their own.
+func (r *mockRepo) GetQuota(ctx context.Context, userID string) (*models.Quota, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.quotas[userID], nil
+}
+
+// SetQuota stores the quota of a user replacing their previous one.
+func (r *mockRepo) SetQuota(ctx context.Context, quota *models.Quota) error {
+	r.Lock()
+	defer r.Unlock()
+	stored := *quota
+	r.quotas[quota.UserID] = &stored
+	return nil
+}
+
+// GetJob returns a delete job, nil if there is none with the ID.
+func (r *mockRepo) GetJob(ctx context.Context, id string) (*models.Job, error) {
+	r.RLock()
+	defer r.RUnlock()
+	stored, ok := r.jobs[id]
+	if !ok {
+		return nil, nil
+	}
+	job := *stored
+	return &job, nil
+}
+
+// ClaimJobs returns the pending delete jobs whose lease ended by now, oldest first, and leases them to owner.
+func (r *mockRepo) ClaimJobs(ctx context.Context, owner string, now time.Time, lease time.Duration) ([]*models.Job, error) {
+	r.Lock()
+	defer r.Unlock()
+	return claimJobs(r.jobs, owner, now, lease), nil
+}
+
+// SaveJob stores a delete job replacing its previous state unless another owner holds it.
+func (r *mockRepo) SaveJob(ctx context.Context, job *models.Job) error {
+	r.Lock()
+	defer r.Unlock()
+	if stored, ok := r.jobs[job.ID]; ok {
+		if err := checkJobOwner(stored.Owner, job); err != nil {
+			return err
+		}
+	}
+	stored := *job
+	r.jobs[job.ID] = &stored
+	return nil
+}
+
+// ReserveIDs advances the id sequence by n and returns its previous value.
+func (r *mockRepo) ReserveIDs(ctx context.Context, n uint64) (uint64, error) {
+	r.Lock()
+	defer r.Unlock()
+	last := r.sequence
+	r.sequence += n
+	return last, nil
+}
+
+// GetHistory returns previous targets of a url.
+func (r *mockRepo) GetHistory(ctx context.Context, id string) ([]*models.URLVersion, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.history[id], nil
+}
+
+// ConsumeClick counts a redirect of a url limited in clicks, failing once all of them are used.
+func (r *mockRepo) ConsumeClick(ctx context.Context, id string) (*models.URL, error) {
+	r.Lock()
+	defer r.Unlock()
+	url, ok := r.urlsByShort[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", models.ErrInvalidID, id)
+	}
+	if url.Exhausted() {
+		return nil, models.ErrURLExhausted
+	}
+	clicked := *url
+	clicked.Clicks++
+	r.urlsByShort[id] = &clicked
+	r.existingURLs[clicked.LongURL] = &clicked
+	replaceURL(r.urlsByUser[clicked.UserID], url, &clicked)
+	return &clicked, nil
+}
+
+// AddClicks stores recorded clicks.
+func (r *mockRepo) AddClicks(ctx context.Context, clicks []*models.Click) error {
+	r.Lock()
+	defer r.Unlock()
+	for _, v := range clicks {
+		r.clicks[v.ShortURL] = append(r.clicks[v.ShortURL], v)
+	}
+	return nil
+}
+
+// GetClickStats counts clicks of a short url grouped by bucket.
+func (r *mockRepo) GetClickStats(ctx context.Context, id string, bucket string) (*models.ClickStats, error) {
+	r.RLock()
+	defer r.RUnlock()
+	return bucketClicks(id, r.clicks[id], bucket)
+}
+
 // Ping is redundant for in-memory storage.
 func (r *mockRepo) Ping(context.Context) error {
 	return nil
@@ -128,6 +364,11 @@ func (r *mockRepo) DeleteRepo(context.Context) error {
 	defer r.Unlock()
 	r.urlsByShort = make(map[string]*models.URL)
 	r.urlsByUser = make(map[string][]*models.URL)
+	r.clicks = make(map[string][]*models.Click)
+	r.history = make(map[string][]*models.URLVersion)
+	r.quotas = make(map[string]*models.Quota)
+	r.jobs = make(map[string]*models.Job)
+	r.sequence = 0
 	return nil
 }
 
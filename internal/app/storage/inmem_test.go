@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -138,7 +139,7 @@ func TestInMemRepo_GetByUser(t *testing.T) {
 				urlsByShort: mock.urlsByShort,
 				urlsByUser:  mock.urlsByUser,
 			}
-			got, err := r.GetByUser(context.Background(), tt.userID)
+			got, err := r.GetByUser(context.Background(), tt.userID, &models.URLQuery{})
 			if !tt.wantErr {
 				require.NoError(t, err)
 				assert.Equal(t, tt.want, got)
@@ -148,3 +149,207 @@ func TestInMemRepo_GetByUser(t *testing.T) {
 		})
 	}
 }
+
+func TestInMemRepo_GetByUserPage(t *testing.T) {
+	now := time.Now()
+	repo := NewInMemRepo()
+	urls := []*models.URL{
+		{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1", CreatedAt: now},
+		{ShortURL: "2", LongURL: "https://yandex.ru/", UserID: "user1", CreatedAt: now.Add(time.Second), Deleted: true},
+		{ShortURL: "3", LongURL: "https://gitlab.com/", UserID: "user1", CreatedAt: now.Add(2 * time.Second)},
+		{ShortURL: "4", LongURL: "https://GitHub.com/Mldlr", UserID: "user1", CreatedAt: now.Add(2 * time.Second)},
+	}
+	_, err := repo.AddBatch(context.Background(), urls)
+	require.NoError(t, err)
+	deleted := false
+	tests := []struct {
+		name  string
+		query *models.URLQuery
+		want  []*models.URL
+	}{
+		{
+			name:  "First page",
+			query: &models.URLQuery{Limit: 2},
+			want:  urls[:2],
+		},
+		{
+			name:  "Next page",
+			query: &models.URLQuery{Limit: 2, After: &models.Cursor{CreatedAt: urls[1].CreatedAt, ShortURL: "2"}},
+			want:  urls[2:],
+		},
+		{
+			name:  "Newest first",
+			query: &models.URLQuery{Limit: 3, Desc: true},
+			want:  []*models.URL{urls[3], urls[2], urls[1]},
+		},
+		{
+			name:  "Newest first after cursor",
+			query: &models.URLQuery{Desc: true, After: &models.Cursor{CreatedAt: urls[2].CreatedAt, ShortURL: "3"}},
+			want:  []*models.URL{urls[1], urls[0]},
+		},
+		{
+			name:  "Not deleted",
+			query: &models.URLQuery{Deleted: &deleted},
+			want:  []*models.URL{urls[0], urls[2], urls[3]},
+		},
+		{
+			name:  "Search",
+			query: &models.URLQuery{Search: "github"},
+			want:  []*models.URL{urls[0], urls[3]},
+		},
+		{
+			name:  "Empty page",
+			query: &models.URLQuery{After: &models.Cursor{CreatedAt: urls[3].CreatedAt, ShortURL: "4"}},
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.GetByUser(context.Background(), "user1", tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestInMemRepo_UpdateURL(t *testing.T) {
+	now := time.Now()
+	repo := NewInMemRepo()
+	urls := []*models.URL{
+		{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1"},
+		{ShortURL: "2", LongURL: "https://yandex.ru/", UserID: "user1"},
+	}
+	_, err := repo.AddBatch(context.Background(), urls)
+	require.NoError(t, err)
+	tests := []struct {
+		name    string
+		update  *models.URL
+		wantErr error
+	}{
+		{
+			name:   "Retarget",
+			update: &models.URL{ShortURL: "1", LongURL: "https://gitlab.com/", UserID: "user1"},
+		},
+		{
+			name:   "Retarget back",
+			update: &models.URL{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1"},
+		},
+		{
+			name:    "Not found",
+			update:  &models.URL{ShortURL: "3", LongURL: "https://gitlab.com/", UserID: "user1"},
+			wantErr: models.ErrURLNotFound,
+		},
+		{
+			name:    "Not owner",
+			update:  &models.URL{ShortURL: "1", LongURL: "https://gitlab.com/", UserID: "user2"},
+			wantErr: models.ErrNotOwner,
+		},
+		{
+			name:    "Target of another url",
+			update:  &models.URL{ShortURL: "1", LongURL: "https://yandex.ru/", UserID: "user1"},
+			wantErr: models.ErrDuplicate,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.UpdateURL(context.Background(), tt.update, now)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.update.LongURL, got.LongURL)
+			stored, err := repo.Get(context.Background(), tt.update.ShortURL)
+			require.NoError(t, err)
+			assert.Equal(t, got, stored)
+		})
+	}
+	history, err := repo.GetHistory(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, []*models.URLVersion{
+		{ShortURL: "1", Version: 1, LongURL: "https://github.com/", ChangedAt: now},
+		{ShortURL: "1", Version: 2, LongURL: "https://gitlab.com/", ChangedAt: now},
+	}, history)
+	// The original url wasn't changed in place.
+	assert.Equal(t, "https://github.com/", urls[0].LongURL)
+}
+
+func TestInMemRepo_RestoreURLs(t *testing.T) {
+	repo := NewInMemRepo()
+	urls := []*models.URL{
+		{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1"},
+		{ShortURL: "2", LongURL: "https://yandex.ru/", UserID: "user1"},
+		{ShortURL: "3", LongURL: "https://gitlab.com/", UserID: "user1"},
+	}
+	_, err := repo.AddBatch(context.Background(), urls)
+	require.NoError(t, err)
+	n, err := repo.DeleteURLs([]*models.DeleteURLItem{{ShortURL: "1", UserID: "user1"}, {ShortURL: "2", UserID: "user1"}})
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	deleted, err := repo.Get(context.Background(), "1")
+	require.NoError(t, err)
+	require.NotNil(t, deleted.DeletedAt)
+	// Only deleted urls of the user are restored.
+	n, err = repo.RestoreURLs([]*models.DeleteURLItem{
+		{ShortURL: "1", UserID: "user2"},
+		{ShortURL: "2", UserID: "user1"},
+		{ShortURL: "3", UserID: "user1"},
+		{ShortURL: "4", UserID: "user1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	got, err := repo.Get(context.Background(), "1")
+	require.NoError(t, err)
+	assert.True(t, got.Deleted)
+	got, err = repo.Get(context.Background(), "2")
+	require.NoError(t, err)
+	assert.False(t, got.Deleted)
+	assert.Nil(t, got.DeletedAt)
+}
+
+func TestInMemRepo_PurgeDeleted(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+	recent := now.Add(-time.Minute)
+	repo := NewInMemRepo()
+	urls := []*models.URL{
+		{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1", Deleted: true, DeletedAt: &old},
+		{ShortURL: "2", LongURL: "https://yandex.ru/", UserID: "user1", Deleted: true, DeletedAt: &recent},
+		{ShortURL: "3", LongURL: "https://gitlab.com/", UserID: "user2"},
+	}
+	_, err := repo.AddBatch(context.Background(), urls)
+	require.NoError(t, err)
+	n, err := repo.PurgeDeleted(context.Background(), now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = repo.Get(context.Background(), "1")
+	assert.Error(t, err)
+	got, err := repo.GetByUser(context.Background(), "user1", &models.URLQuery{})
+	require.NoError(t, err)
+	assert.Equal(t, []*models.URL{urls[1]}, got)
+}
+
+func TestInMemRepo_DeleteExpired(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	repo := NewInMemRepo()
+	urls := []*models.URL{
+		{ShortURL: "1", LongURL: "https://github.com/", UserID: "user1", ExpiresAt: &past},
+		{ShortURL: "2", LongURL: "https://yandex.ru/", UserID: "user1", ExpiresAt: &future},
+		{ShortURL: "3", LongURL: "https://gitlab.com/", UserID: "user2", ExpiresAt: &past},
+	}
+	_, err := repo.AddBatch(context.Background(), urls)
+	require.NoError(t, err)
+	n, err := repo.DeleteExpired(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	_, err = repo.Get(context.Background(), "1")
+	assert.Error(t, err)
+	got, err := repo.GetByUser(context.Background(), "user1", &models.URLQuery{})
+	require.NoError(t, err)
+	assert.Equal(t, []*models.URL{urls[1]}, got)
+	stats, err := repo.Stats(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &models.Stats{URLCount: 1, UserCount: 1}, stats)
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// claimJobs leases the pending jobs whose lease ended by now to owner and returns their copies, oldest first.
+func claimJobs(jobs map[string]*models.Job, owner string, now time.Time, lease time.Duration) []*models.Job {
+	var claimed []*models.Job
+	for _, v := range jobs {
+		if v.Status != models.JobPending || v.LeaseUntil != nil && v.LeaseUntil.After(now) {
+			continue
+		}
+		until := now.Add(lease)
+		v.Owner, v.LeaseUntil = owner, &until
+		job := *v
+		claimed = append(claimed, &job)
+	}
+	sortJobs(claimed)
+	return claimed
+}
+
+// sortJobs sorts jobs oldest first.
+func sortJobs(jobs []*models.Job) {
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+}
+
+// checkJobOwner checks if job can replace a stored job held by owner, only jobs without an owner can be saved by anyone.
+func checkJobOwner(owner string, job *models.Job) error {
+	if owner != "" && owner != job.Owner {
+		return models.ErrJobClaimed
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migrationFiles contains ordered schema migrations of Postgres db,
+// named <version>_<name>.up.sql and <version>_<name>.down.sql.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey is the advisory lock key held while migrating,
+// so replicas starting at the same time don't migrate concurrently.
+const migrationLockKey = 7_301_846_127
+
+const (
+	// createMigrations creates the table of applied migrations if it doesn't exist.
+	createMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+				version integer PRIMARY KEY,
+				name text NOT NULL,
+				applied_at timestamptz NOT NULL DEFAULT now()
+				)`
+	// getMigrations retrieves applied migrations.
+	getMigrations = `SELECT version, applied_at FROM schema_migrations`
+	// addMigration records an applied migration.
+	addMigration = `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+	// deleteMigration removes a rolled back migration.
+	deleteMigration = `DELETE FROM schema_migrations WHERE version = $1`
+	// lockMigrations waits for the migration advisory lock.
+	lockMigrations = `SELECT pg_advisory_lock($1)`
+	// unlockMigrations releases the migration advisory lock.
+	unlockMigrations = `SELECT pg_advisory_unlock($1)`
+)
+
+// Migration is a versioned change of db schema.
+type Migration struct {
+	// Version orders migrations.
+	Version int
+	// Name describes the migration.
+	Name string
+	// Up applies the migration.
+	Up string
+	// Down rolls the migration back.
+	Down string
+}
+
+// MigrationStatus is a migration with the time it was applied.
+type MigrationStatus struct {
+	*Migration
+	// AppliedAt is nil if the migration is pending.
+	AppliedAt *time.Time
+}
+
+// Migrator applies schema migrations to Postgres db.
+type Migrator struct {
+	conn       *pgxpool.Pool
+	migrations []*Migration
+}
+
+// NewMigrator initializes a Migrator with embedded migrations.
+func NewMigrator(conn *pgxpool.Pool) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{conn: conn, migrations: migrations}, nil
+}
+
+// loadMigrations reads migrations from files and sorts them by version.
+func loadMigrations(files fs.FS) ([]*Migration, error) {
+	names, err := fs.Glob(files, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, path := range names {
+		file := strings.TrimPrefix(path, "migrations/")
+		up := strings.HasSuffix(file, ".up.sql")
+		if !up && !strings.HasSuffix(file, ".down.sql") {
+			return nil, fmt.Errorf("invalid migration file name: %s", file)
+		}
+		base := strings.TrimSuffix(strings.TrimSuffix(file, ".up.sql"), ".down.sql")
+		v, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(v)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name: %s", file)
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d has different names: %s and %s", version, m.Name, name)
+		}
+		sql, err := fs.ReadFile(files, path)
+		if err != nil {
+			return nil, err
+		}
+		if up {
+			m.Up = string(sql)
+		} else {
+			m.Down = string(sql)
+		}
+	}
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d must have up and down files", m.Version)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Up applies all pending migrations and returns them.
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	var applied []*Migration
+	err := m.locked(ctx, func(conn *pgxpool.Conn, done map[int]time.Time) error {
+		for _, v := range m.migrations {
+			if _, ok := done[v.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, v.Up, addMigration, v.Version, v.Name); err != nil {
+				return fmt.Errorf("error applying migration %d_%s : %v", v.Version, v.Name, err)
+			}
+			applied = append(applied, v)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the given number of last applied migrations and returns them.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	var rolledBack []*Migration
+	err := m.locked(ctx, func(conn *pgxpool.Conn, done map[int]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+			v := m.migrations[i]
+			if _, ok := done[v.Version]; !ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, v.Down, deleteMigration, v.Version); err != nil {
+				return fmt.Errorf("error rolling back migration %d_%s : %v", v.Version, v.Name, err)
+			}
+			rolledBack = append(rolledBack, v)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Status returns all migrations with the time they were applied.
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	var statuses []*MigrationStatus
+	err := m.locked(ctx, func(conn *pgxpool.Conn, done map[int]time.Time) error {
+		for _, v := range m.migrations {
+			s := &MigrationStatus{Migration: v}
+			if t, ok := done[v.Version]; ok {
+				s.AppliedAt = &t
+			}
+			statuses = append(statuses, s)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// locked runs f holding the migration lock with the applied migrations.
+func (m *Migrator) locked(ctx context.Context, f func(conn *pgxpool.Conn, done map[int]time.Time) error) error {
+	// Advisory locks belong to a session, so everything runs on one connection.
+	conn, err := m.conn.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	if _, err = conn.Exec(ctx, lockMigrations, migrationLockKey); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), unlockMigrations, migrationLockKey)
+	if _, err = conn.Exec(ctx, createMigrations); err != nil {
+		return err
+	}
+	done, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return f(conn, done)
+}
+
+// appliedMigrations reads versions of applied migrations with the time they were applied.
+func appliedMigrations(ctx context.Context, conn *pgxpool.Conn) (map[int]time.Time, error) {
+	rows, err := conn.Query(ctx, getMigrations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	done := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		done[version] = appliedAt
+	}
+	return done, rows.Err()
+}
+
+// apply runs migration sql and records the change in one transaction.
+func (m *Migrator) apply(ctx context.Context, conn *pgxpool.Conn, sql string, record string, args ...any) (err error) {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+			return
+		}
+		err = tx.Commit(ctx)
+	}()
+	if _, err = tx.Exec(ctx, sql); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, record, args...)
+	return err
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version)
+		assert.NotEmpty(t, m.Name)
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+	}
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{
+			name: "Missing down",
+			files: fstest.MapFS{
+				"migrations/0001_init.up.sql": {Data: []byte("CREATE TABLE t (id int)")},
+			},
+		},
+		{
+			name: "Invalid version",
+			files: fstest.MapFS{
+				"migrations/init.up.sql":   {Data: []byte("CREATE TABLE t (id int)")},
+				"migrations/init.down.sql": {Data: []byte("DROP TABLE t")},
+			},
+		},
+		{
+			name: "Different names",
+			files: fstest.MapFS{
+				"migrations/0001_init.up.sql":    {Data: []byte("CREATE TABLE t (id int)")},
+				"migrations/0001_other.down.sql": {Data: []byte("DROP TABLE t")},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.files)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS urls (
+    short varchar(255) PRIMARY KEY,
+    original varchar(255),
+    userid varchar(64),
+    deleted boolean DEFAULT false,
+    UNIQUE(original)
+);
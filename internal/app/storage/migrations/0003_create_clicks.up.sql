@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS clicks (
+    short varchar(255) NOT NULL,
+    clicked_at timestamptz NOT NULL,
+    referrer text,
+    user_agent text,
+    ip varchar(64)
+);
+CREATE INDEX IF NOT EXISTS clicks_short_idx ON clicks (short, clicked_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS urls_userid_created_idx;
+ALTER TABLE urls DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS url_history (
+    short varchar(255) NOT NULL,
+    version integer NOT NULL,
+    original varchar(255),
+    changed_at timestamptz NOT NULL,
+    PRIMARY KEY (short, version)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+-- Start the retention window of urls deleted before the column existed.
+UPDATE urls SET deleted_at = now() WHERE deleted AND deleted_at IS NULL;
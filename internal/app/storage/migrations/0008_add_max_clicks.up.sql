@@ -0,0 +1,3 @@
+-- Redirects of urls limited in clicks are counted, other redirects are only recorded in clicks table.
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS max_clicks integer;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS clicks integer NOT NULL DEFAULT 0;
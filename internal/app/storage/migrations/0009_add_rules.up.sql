@@ -0,0 +1,2 @@
+-- Rules route matching redirects to other targets, stored as a JSON array.
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS rules jsonb;
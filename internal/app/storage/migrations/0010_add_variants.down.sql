@@ -0,0 +1,3 @@
+ALTER TABLE clicks DROP COLUMN IF EXISTS variant;
+ALTER TABLE urls DROP COLUMN IF EXISTS sticky;
+ALTER TABLE urls DROP COLUMN IF EXISTS variants;
@@ -0,0 +1,4 @@
+-- Variants split redirects between weighted targets, clicks record the variant they were redirected to.
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS variants jsonb;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS sticky boolean NOT NULL DEFAULT false;
+ALTER TABLE clicks ADD COLUMN IF NOT EXISTS variant integer NOT NULL DEFAULT 0;
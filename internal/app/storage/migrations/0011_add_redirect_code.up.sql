@@ -0,0 +1,2 @@
+-- Status code of redirects of a url, NULL uses the configured one.
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS redirect_code smallint;
@@ -0,0 +1,3 @@
+-- Links blocked by an administrator show a warning instead of redirecting.
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS blocked boolean NOT NULL DEFAULT false;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS block_reason text;
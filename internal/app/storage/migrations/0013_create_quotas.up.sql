@@ -0,0 +1,6 @@
+-- Quotas of users replacing the configured ones.
+CREATE TABLE IF NOT EXISTS quotas (
+    userid varchar(64) PRIMARY KEY,
+    daily integer NOT NULL DEFAULT 0,
+    total integer NOT NULL DEFAULT 0
+);
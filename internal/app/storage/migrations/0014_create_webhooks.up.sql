@@ -0,0 +1,35 @@
+-- Endpoints of users receiving events of their links.
+CREATE TABLE IF NOT EXISTS webhooks (
+    id varchar(64) PRIMARY KEY,
+    userid varchar(64) NOT NULL,
+    url text NOT NULL,
+    events text[],
+    secret varchar(128) NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS webhooks_userid ON webhooks (userid);
+-- Outbox of pending deliveries, finished ones are deleted.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id varchar(64) PRIMARY KEY,
+    webhook_id varchar(64) NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    url text NOT NULL,
+    secret varchar(128) NOT NULL,
+    event jsonb NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_next_attempt ON webhook_deliveries (next_attempt);
+-- Delivery log of webhooks.
+CREATE TABLE IF NOT EXISTS webhook_attempts (
+    id bigserial PRIMARY KEY,
+    webhook_id varchar(64) NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    delivery_id varchar(64) NOT NULL,
+    event_id varchar(64) NOT NULL,
+    event_type varchar(32) NOT NULL,
+    attempt integer NOT NULL,
+    status_code integer,
+    error text,
+    status varchar(16) NOT NULL,
+    attempted_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS webhook_attempts_webhook_id ON webhook_attempts (webhook_id, id);
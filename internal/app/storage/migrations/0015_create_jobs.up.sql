@@ -0,0 +1,12 @@
+-- Delete jobs requested by users, kept for checking their results.
+CREATE TABLE IF NOT EXISTS jobs (
+    id varchar(64) PRIMARY KEY,
+    userid varchar(64) NOT NULL,
+    status varchar(16) NOT NULL,
+    ids text[] NOT NULL,
+    deleted integer NOT NULL DEFAULT 0,
+    failures jsonb,
+    error text NOT NULL DEFAULT '',
+    created_at timestamptz NOT NULL,
+    finished_at timestamptz
+);
@@ -0,0 +1,5 @@
+-- Last reserved values of sequences, so generated short ids continue past them after a restart.
+CREATE TABLE IF NOT EXISTS sequences (
+    name varchar(64) PRIMARY KEY,
+    value bigint NOT NULL DEFAULT 0
+);
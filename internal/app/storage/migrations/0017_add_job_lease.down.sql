@@ -0,0 +1,2 @@
+ALTER TABLE jobs DROP COLUMN IF EXISTS lease_until;
+ALTER TABLE jobs DROP COLUMN IF EXISTS owner;
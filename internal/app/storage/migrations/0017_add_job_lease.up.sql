@@ -0,0 +1,3 @@
+-- Delete jobs are held by the instance running them until their lease ends, so other instances don't run them too.
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS owner varchar(64) NOT NULL DEFAULT '';
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS lease_until timestamptz;
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// pageURLs filters urls of a user and returns a sorted page of them according to the query.
+func pageURLs(urls []*models.URL, q *models.URLQuery) []*models.URL {
+	search := strings.ToLower(q.Search)
+	page := make([]*models.URL, 0, len(urls))
+	for _, v := range urls {
+		if q.Deleted != nil && v.Deleted != *q.Deleted {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(v.LongURL), search) {
+			continue
+		}
+		if q.After != nil && !after(v, q.After, q.Desc) {
+			continue
+		}
+		page = append(page, v)
+	}
+	sort.Slice(page, func(i, j int) bool {
+		if q.Desc {
+			return before(page[j], page[i])
+		}
+		return before(page[i], page[j])
+	})
+	if q.Limit > 0 && len(page) > q.Limit {
+		page = page[:q.Limit]
+	}
+	if len(page) == 0 {
+		return nil
+	}
+	return page
+}
+
+// before reports whether url a goes before url b in a listing sorted by creation time.
+func before(a, b *models.URL) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ShortURL < b.ShortURL
+}
+
+// after reports whether url goes after the cursor in the listing order.
+func after(url *models.URL, c *models.Cursor, desc bool) bool {
+	pos := &models.URL{CreatedAt: c.CreatedAt, ShortURL: c.ShortURL}
+	if desc {
+		return before(url, pos)
+	}
+	return before(pos, url)
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"sync"
+	"time"
 
 	"github.com/Mldlr/url-shortener/internal/app/models"
-	"github.com/Mldlr/url-shortener/internal/app/utils/encoders"
 	"github.com/Mldlr/url-shortener/internal/app/utils/helpers"
+	"github.com/Mldlr/url-shortener/internal/app/utils/validators"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -16,6 +18,8 @@ import (
 // PostgresRepo is a Postgres db storage.
 type PostgresRepo struct {
 	conn *pgxpool.Pool
+	// idSource generates short IDs.
+	idSource
 	sync.Mutex
 }
 
@@ -31,132 +35,524 @@ func NewPostgresRepo(connString string) (*PostgresRepo, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &PostgresRepo{conn: conn}, nil
+	return &PostgresRepo{conn: conn, idSource: newIDSource()}, nil
 }
 
-// NewTableURLs creates the 'urls' table in the database if it does not already exist.
-func (r *PostgresRepo) NewTableURLs() error {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	_, err := r.conn.Exec(ctx, createUrls)
+// Migrator returns a Migrator of the database schema.
+func (r *PostgresRepo) Migrator() (*Migrator, error) {
+	return NewMigrator(r.conn)
+}
+
+// Migrate applies pending schema migrations to the database.
+func (r *PostgresRepo) Migrate() error {
+	m, err := r.Migrator()
 	if err != nil {
 		return err
 	}
-	return nil
+	applied, err := m.Up(context.Background())
+	for _, v := range applied {
+		log.Printf("applied migration %d_%s", v.Version, v.Name)
+	}
+	return err
 }
 
 // Get returns original link by id or an error if id is not present
 func (r *PostgresRepo) Get(ctx context.Context, id string) (*models.URL, error) {
-	var url models.URL
-	err := r.conn.QueryRow(ctx, getQuery, id).Scan(&url.LongURL, &url.Deleted)
-	if err != nil {
-		return nil, fmt.Errorf("invalid id: %v", id)
+	url := models.URL{ShortURL: id}
+	err := r.conn.QueryRow(ctx, getQuery, id).Scan(urlFields(&url)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", models.ErrInvalidID, id)
+	} else if err != nil {
+		return nil, err
 	}
 	return &url, nil
 }
 
-// GetByUser finds URLs created by a specific user.
-func (r *PostgresRepo) GetByUser(ctx context.Context, userID string) ([]*models.URL, error) {
-	var url models.URL
-	var count int
-	err := r.conn.QueryRow(ctx, countUserURLs, userID).Scan(&count)
-	if err != nil {
+// GetByLong finds the url stored for a long url, nil if it isn't stored.
+func (r *PostgresRepo) GetByLong(ctx context.Context, longURL string) (*models.URL, error) {
+	var short string
+	err := r.conn.QueryRow(ctx, getShort, longURL).Scan(&short)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
 		return nil, err
 	}
-	// Preallocate a slice of URL
-	urls := make([]*models.URL, 0, count)
-	rows, err := r.conn.Query(ctx, getByUserQuery, userID)
-	if err != nil {
+	return r.Get(ctx, short)
+}
+
+// urlFields returns destinations of urlColumns.
+func urlFields(url *models.URL) []any {
+	return []any{&url.LongURL, &url.UserID, &url.Deleted, &url.ExpiresAt, &url.CreatedAt, &url.DeletedAt,
+		&url.PasswordHash, &url.MaxClicks, &url.Clicks, &url.Rules, &url.Variants, &url.Sticky,
+		&url.RedirectCode, &url.Blocked, &url.BlockReason}
+}
+
+// ConsumeClick counts a redirect of a url limited in clicks, failing once all of them are used.
+// The counter is checked and increased by a single update, so concurrent redirects can't exceed the limit.
+func (r *PostgresRepo) ConsumeClick(ctx context.Context, id string) (*models.URL, error) {
+	url := models.URL{ShortURL: id}
+	err := r.conn.QueryRow(ctx, consumeClickQuery, id).Scan(urlFields(&url)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The url is either unknown or exhausted.
+		if _, err = r.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, models.ErrURLExhausted
+	} else if err != nil {
 		return nil, err
 	}
-	if rows.Err() != nil {
-		return nil, rows.Err()
+	return &url, nil
+}
+
+// GetByUser finds a page of URLs created by a specific user.
+func (r *PostgresRepo) GetByUser(ctx context.Context, userID string, q *models.URLQuery) ([]*models.URL, error) {
+	query := getByUserQuery
+	if q.Desc {
+		query = getByUserDescQuery
+	}
+	var urls []*models.URL
+	rows, err := r.conn.Query(ctx, query, pageArgs(userID, q)...)
+	if err != nil {
+		return nil, err
 	}
 	defer rows.Close()
 	// For each row return read values to structure and append to URL slice
 	for rows.Next() {
-		err = rows.Scan(&url.ShortURL, &url.LongURL, &url.UserID, &url.Deleted)
+		var url models.URL
+		err = rows.Scan(&url.ShortURL, &url.LongURL, &url.UserID, &url.Deleted, &url.ExpiresAt, &url.CreatedAt, &url.DeletedAt)
 		if err != nil {
 			return nil, err
 		}
 		urls = append(urls, &url)
 	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
 	return urls, nil
 }
 
+// pageArgs builds arguments of a user URL listing query.
+func pageArgs(userID string, q *models.URLQuery) []any {
+	var createdAt *time.Time
+	var short *string
+	if q.After != nil {
+		createdAt, short = &q.After.CreatedAt, &q.After.ShortURL
+	}
+	// A NULL limit returns all rows.
+	var limit *int
+	if q.Limit > 0 {
+		limit = &q.Limit
+	}
+	return []any{userID, q.Deleted, q.Search, createdAt, short, limit}
+}
+
 // Add adds a link to db and returns assigned id
-func (r *PostgresRepo) Add(ctx context.Context, url *models.URL) (bool, error) {
-	var duplicates bool
+func (r *PostgresRepo) Add(ctx context.Context, url *models.URL) (duplicate bool, err error) {
 	tx, err := r.conn.Begin(ctx)
 	if err != nil {
 		return false, err
 	}
-	defer helpers.CommitTx(ctx, tx, err)
-	// Execute insert query and read inserted ID.
-	err = tx.QueryRow(ctx, addQuery, url.ShortURL, url.LongURL, url.UserID).Scan(&url.ShortURL)
-	if err != nil {
-		// If no rows inserted, but query was successful.
-		if errors.Is(err, pgx.ErrNoRows) {
-			duplicates = true
-			// Select existing id.
-			err = tx.QueryRow(ctx, getShort, url.LongURL).Scan(&url.ShortURL)
-		} else {
-			return false, err
-		}
-	}
-	return duplicates, err
+	// The transaction is rolled back on any returned error, collisions included.
+	defer func() { helpers.CommitTx(ctx, tx, err) }()
+	return r.insert(ctx, tx, url)
 }
 
 // AddBatch adds multiple URLs to repository.
-func (r *PostgresRepo) AddBatch(ctx context.Context, urls []*models.URL) (bool, error) {
-	var duplicates bool
+func (r *PostgresRepo) AddBatch(ctx context.Context, urls []*models.URL) (duplicates bool, err error) {
 	tx, err := r.conn.Begin(ctx)
 	if err != nil {
 		return false, err
 	}
-	defer helpers.CommitTx(ctx, tx, err)
+	// None of the urls are stored if one of them fails.
+	defer func() { helpers.CommitTx(ctx, tx, err) }()
 	// For every URL.
 	for _, v := range urls {
-		// Execute insert query and read inserted ID.
-		err = tx.QueryRow(ctx, addQuery, v.ShortURL, v.LongURL, v.UserID).Scan(&v.ShortURL)
+		var duplicate bool
+		duplicate, err = r.insert(ctx, tx, v)
 		if err != nil {
-			// If no rows inserted, but query was successful.
-			if errors.Is(err, pgx.ErrNoRows) {
-				duplicates = true
-				// Select existing id.
-				err = tx.QueryRow(ctx, getShort, v.LongURL).Scan(&v.ShortURL)
+			return duplicates, err
+		}
+		v.Duplicate = duplicate
+		duplicates = duplicates || duplicate
+	}
+	return duplicates, nil
+}
+
+// insert inserts url in transaction, regenerating its short id on collision with another url.
+func (r *PostgresRepo) insert(ctx context.Context, tx pgx.Tx, url *models.URL) (bool, error) {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if !validators.IsReserved(url.ShortURL) {
+			// Execute insert query and read inserted ID.
+			err = tx.QueryRow(ctx, addQuery, url.ShortURL, url.LongURL, url.UserID, url.ExpiresAt, url.CreatedAt, url.PasswordHash, url.MaxClicks, url.Rules,
+				url.Variants, url.Sticky, url.RedirectCode).Scan(&url.ShortURL)
+			// If row was inserted or query failed.
+			if !errors.Is(err, pgx.ErrNoRows) {
+				return false, err
 			}
+			// If no rows inserted, but query was successful select existing id.
+			err = tx.QueryRow(ctx, getShort, url.LongURL).Scan(&url.ShortURL)
+			if !errors.Is(err, pgx.ErrNoRows) {
+				return err == nil, err
+			}
+		}
+		// If the original url is not stored, the conflict is on the short id.
+		if url.Alias != "" {
+			return false, models.ErrAliasTaken
+		}
+		if attempt > r.retries {
+			return false, models.ErrIDCollision
+		}
+		url.ShortURL, err = r.gen.Generate(url.LongURL, attempt)
+		if err != nil {
+			return false, err
 		}
 	}
-	return duplicates, err
 }
 
 // DeleteURLs delete urls from cache.
-func (r *PostgresRepo) DeleteURLs(deleteURLs []*models.DeleteURLItem) (int, error) {
+func (r *PostgresRepo) DeleteURLs(deleteURLs []*models.DeleteURLItem) (n int, err error) {
+	if len(deleteURLs) == 0 {
+		return 0, nil
+	}
 	ctx := context.Background()
 	tx, err := r.conn.Begin(ctx)
-	var n int
 	if err != nil {
 		return n, err
 	}
-	defer helpers.CommitTx(ctx, tx, err)
-	// Preallocate slice to store short URLs.
-	shortURLs := make([]string, len(deleteURLs))
-	for i, v := range deleteURLs {
+	defer func() { helpers.CommitTx(ctx, tx, err) }()
+	deleted, err := deleteByUser(ctx, tx, updateDeleteQuery, deleteURLs)
+	if err != nil {
+		return n, err
+	}
+	return markDeleted(deleteURLs, deleted), nil
+}
+
+// deleteByUser runs the delete query for the items of each user, returning the short urls it deleted by user.
+func deleteByUser(ctx context.Context, tx pgx.Tx, query string, deleteURLs []*models.DeleteURLItem) (map[string]map[string]bool, error) {
+	byUser := make(map[string][]string)
+	for _, v := range deleteURLs {
+		byUser[v.UserID] = append(byUser[v.UserID], v.ShortURL)
+	}
+	deleted := make(map[string]map[string]bool)
+	for userID, shortURLs := range byUser {
+		rows, err := tx.Query(ctx, query, shortURLs, userID)
+		if err != nil {
+			return nil, err
+		}
+		deleted[userID] = make(map[string]bool)
+		for rows.Next() {
+			var short string
+			if err = rows.Scan(&short); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			deleted[userID][short] = true
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return deleted, nil
+}
+
+// markDeleted marks the items which deleted their urls and returns their number.
+func markDeleted(deleteURLs []*models.DeleteURLItem, deleted map[string]map[string]bool) int {
+	var n int
+	for _, v := range deleteURLs {
+		if deleted[v.UserID][v.ShortURL] {
+			v.Deleted = true
+			n++
+			// A url repeated in the batch is deleted by its first item only.
+			delete(deleted[v.UserID], v.ShortURL)
+		}
+	}
+	return n
+}
+
+// RestoreURLs restores deleted urls created by user.
+func (r *PostgresRepo) RestoreURLs(restoreURLs []*models.DeleteURLItem) (int, error) {
+	if len(restoreURLs) == 0 {
+		return 0, nil
+	}
+	shortURLs := make([]string, len(restoreURLs))
+	for i, v := range restoreURLs {
 		shortURLs[i] = v.ShortURL
 	}
-	// Update URLs.
-	res, err := tx.Exec(ctx, updateDeleteQuery, shortURLs, deleteURLs[0].UserID)
+	res, err := r.conn.Exec(context.Background(), updateRestoreQuery, shortURLs, restoreURLs[0].UserID)
 	if err != nil {
-		return n, err
+		return 0, err
+	}
+	return int(res.RowsAffected()), nil
+}
+
+// PurgeDeleted deletes urls deleted before the given time from db.
+func (r *PostgresRepo) PurgeDeleted(ctx context.Context, before time.Time) (n int, err error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { helpers.CommitTx(ctx, tx, err) }()
+	// Delete clicks and history before the urls they belong to.
+	if _, err = tx.Exec(ctx, purgeDeletedClicks, before); err != nil {
+		return 0, err
+	}
+	if _, err = tx.Exec(ctx, purgeDeletedHistory, before); err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(ctx, purgeDeletedQuery, before)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.RowsAffected()), nil
+}
+
+// DeleteExpired deletes urls expired by now from db.
+func (r *PostgresRepo) DeleteExpired(ctx context.Context, now time.Time) (n int, err error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { helpers.CommitTx(ctx, tx, err) }()
+	// Delete clicks and history before the urls they belong to.
+	_, err = tx.Exec(ctx, deleteExpiredClicks, now)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(ctx, deleteExpiredHistory, now)
+	if err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(ctx, deleteExpiredQuery, now)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.RowsAffected()), nil
+}
+
+// UpdateURL changes the target of a url created by user and stores the previous one in history.
+func (r *PostgresRepo) UpdateURL(ctx context.Context, url *models.URL, now time.Time) (updated *models.URL, err error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { helpers.CommitTx(ctx, tx, err) }()
+	// Lock the url so concurrent updates get consecutive versions.
+	stored := &models.URL{ShortURL: url.ShortURL}
+	err = tx.QueryRow(ctx, lockURLQuery, url.ShortURL).Scan(&stored.LongURL, &stored.UserID, &stored.Deleted, &stored.ExpiresAt, &stored.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		stored = nil
+	} else if err != nil {
+		return nil, err
+	}
+	// Find the url already pointing to the new target.
+	var existing *models.URL
+	var short string
+	err = tx.QueryRow(ctx, getShort, url.LongURL).Scan(&short)
+	if err == nil {
+		existing = &models.URL{ShortURL: short}
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	if err = checkUpdate(stored, url, existing); err != nil {
+		return nil, err
+	}
+	if stored.LongURL == url.LongURL {
+		return stored, nil
+	}
+	if _, err = tx.Exec(ctx, addHistoryQuery, url.ShortURL, stored.LongURL, now); err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec(ctx, updateURLQuery, url.ShortURL, url.LongURL); err != nil {
+		return nil, err
+	}
+	stored.LongURL = url.LongURL
+	return stored, nil
+}
+
+// SetRules replaces redirect rules of a url created by user.
+func (r *PostgresRepo) SetRules(ctx context.Context, url *models.URL) (*models.URL, error) {
+	updated := models.URL{ShortURL: url.ShortURL}
+	err := r.conn.QueryRow(ctx, setRulesQuery, url.ShortURL, url.UserID, url.Rules).Scan(urlFields(&updated)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Find out why the url wasn't updated.
+		stored, err := r.Get(ctx, url.ShortURL)
+		if errors.Is(err, models.ErrInvalidID) {
+			stored = nil
+		} else if err != nil {
+			return nil, err
+		}
+		return nil, checkUpdate(stored, url, nil)
+	} else if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// SetBlocked blocks or unblocks a url regardless of its owner.
+func (r *PostgresRepo) SetBlocked(ctx context.Context, url *models.URL) (*models.URL, error) {
+	updated := models.URL{ShortURL: url.ShortURL}
+	err := r.conn.QueryRow(ctx, setBlockedQuery, url.ShortURL, url.Blocked, url.BlockReason).Scan(urlFields(&updated)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", models.ErrInvalidID, url.ShortURL)
+	} else if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// CountURLs counts urls kept by user and urls they created since the given time.
+func (r *PostgresRepo) CountURLs(ctx context.Context, userID string, since time.Time) (int, int, error) {
+	var total, created int
+	err := r.conn.QueryRow(ctx, countURLsQuery, userID, since).Scan(&total, &created)
+	if err != nil {
+		return 0, 0, err
+	}
+	return total, created, nil
+}
+
+// GetQuota returns the quota of user, nil if they have none of their own.
+func (r *PostgresRepo) GetQuota(ctx context.Context, userID string) (*models.Quota, error) {
+	quota := models.Quota{UserID: userID}
+	err := r.conn.QueryRow(ctx, getQuotaQuery, userID).Scan(&quota.Daily, &quota.Total)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// SetQuota stores the quota of a user replacing their previous one.
+func (r *PostgresRepo) SetQuota(ctx context.Context, quota *models.Quota) error {
+	_, err := r.conn.Exec(ctx, setQuotaQuery, quota.UserID, quota.Daily, quota.Total)
+	return err
+}
+
+// GetJob returns a delete job, nil if there is none with the ID.
+func (r *PostgresRepo) GetJob(ctx context.Context, id string) (*models.Job, error) {
+	job := models.Job{ID: id}
+	err := r.conn.QueryRow(ctx, getJobQuery, id).Scan(&job.UserID, &job.Status, &job.IDs, &job.Deleted, &job.Failures,
+		&job.Error, &job.CreatedAt, &job.FinishedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ClaimJobs returns the pending delete jobs whose lease ended by now, oldest first, and leases them to owner.
+// Jobs claimed by another instance at the same time are skipped.
+func (r *PostgresRepo) ClaimJobs(ctx context.Context, owner string, now time.Time, lease time.Duration) ([]*models.Job, error) {
+	rows, err := r.conn.Query(ctx, claimJobsQuery, models.JobPending, owner, now.Add(lease), now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var jobs []*models.Job
+	for rows.Next() {
+		job := &models.Job{}
+		err = rows.Scan(&job.ID, &job.UserID, &job.Status, &job.IDs, &job.Deleted, &job.Failures, &job.Error,
+			&job.CreatedAt, &job.FinishedAt, &job.Owner, &job.LeaseUntil)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	sortJobs(jobs)
+	return jobs, nil
+}
+
+// SaveJob stores a delete job replacing its previous state unless another owner holds it.
+func (r *PostgresRepo) SaveJob(ctx context.Context, job *models.Job) error {
+	tag, err := r.conn.Exec(ctx, saveJobQuery, job.ID, job.UserID, job.Status, job.IDs, job.Deleted, job.Failures,
+		job.Error, job.CreatedAt, job.FinishedAt, job.Owner, job.LeaseUntil)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrJobClaimed
+	}
+	return nil
+}
+
+// ReserveIDs advances the id sequence by n and returns its previous value.
+func (r *PostgresRepo) ReserveIDs(ctx context.Context, n uint64) (uint64, error) {
+	var last int64
+	err := r.conn.QueryRow(ctx, reserveIDsQuery, int64(n)).Scan(&last)
+	return uint64(last), err
+}
+
+// GetHistory returns previous targets of a url.
+func (r *PostgresRepo) GetHistory(ctx context.Context, id string) ([]*models.URLVersion, error) {
+	rows, err := r.conn.Query(ctx, getHistoryQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var history []*models.URLVersion
+	for rows.Next() {
+		v := &models.URLVersion{ShortURL: id}
+		if err = rows.Scan(&v.Version, &v.LongURL, &v.ChangedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, v)
 	}
-	n = int(res.RowsAffected())
-	return n, err
+	return history, rows.Err()
+}
+
+// AddClicks copies recorded clicks to db.
+func (r *PostgresRepo) AddClicks(ctx context.Context, clicks []*models.Click) error {
+	_, err := r.conn.CopyFrom(ctx,
+		pgx.Identifier{"clicks"},
+		[]string{"short", "clicked_at", "referrer", "user_agent", "ip", "variant"},
+		pgx.CopyFromSlice(len(clicks), func(i int) ([]any, error) {
+			return []any{clicks[i].ShortURL, clicks[i].Time, clicks[i].Referrer, clicks[i].UserAgent, clicks[i].IP, clicks[i].Variant}, nil
+		}),
+	)
+	return err
 }
 
-// NewID calculates a string to use as an ID.
-func (r *PostgresRepo) NewID(url string) (string, error) {
-	return encoders.ToRBase62(url), nil
+// GetClickStats counts clicks of a short url grouped by bucket.
+func (r *PostgresRepo) GetClickStats(ctx context.Context, id string, bucket string) (*models.ClickStats, error) {
+	if bucket != models.BucketHour && bucket != models.BucketDay {
+		return nil, models.ErrInvalidBucket
+	}
+	rows, err := r.conn.Query(ctx, clickStatsQuery, id, bucket)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stats := &models.ClickStats{ShortURL: id, Buckets: make([]models.ClickBucket, 0)}
+	for rows.Next() {
+		var b models.ClickBucket
+		if err = rows.Scan(&b.Start, &b.Count); err != nil {
+			return nil, err
+		}
+		stats.Total += b.Count
+		stats.Buckets = append(stats.Buckets, b)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows, err = r.conn.Query(ctx, variantClicksQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v models.VariantClicks
+		if err = rows.Scan(&v.Variant, &v.Count); err != nil {
+			return nil, err
+		}
+		stats.Variants = append(stats.Variants, v)
+	}
+	return stats, rows.Err()
 }
 
 // Ping checks if db is available.
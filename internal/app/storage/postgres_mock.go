@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/Mldlr/url-shortener/internal/app/models"
 	"github.com/Mldlr/url-shortener/internal/app/utils/encoders"
@@ -18,20 +19,114 @@ const (
                 original varchar(255),
     			userid varchar(64),
     			deleted boolean DEFAULT false,
+    			expires_at timestamptz,
+    			created_at timestamptz NOT NULL DEFAULT now(),
+    			deleted_at timestamptz,
+    			password_hash varchar(255),
+    			max_clicks integer,
+    			clicks integer NOT NULL DEFAULT 0,
+    			rules jsonb,
+    			variants jsonb,
+    			sticky boolean NOT NULL DEFAULT false,
+    			redirect_code smallint,
+    			blocked boolean NOT NULL DEFAULT false,
+    			block_reason text,
     			UNIQUE(original)
-                )`
+                );
+	CREATE TABLE IF NOT EXISTS clicks_test (
+				short varchar(255) NOT NULL,
+				clicked_at timestamptz NOT NULL,
+				referrer text,
+				user_agent text,
+				ip varchar(64),
+				variant integer NOT NULL DEFAULT 0
+				);
+	CREATE TABLE IF NOT EXISTS url_history_test (
+				short varchar(255) NOT NULL,
+				version integer NOT NULL,
+				original varchar(255),
+				changed_at timestamptz NOT NULL,
+				PRIMARY KEY (short, version)
+				);
+	CREATE TABLE IF NOT EXISTS quotas_test (
+				userid varchar(64) PRIMARY KEY,
+				daily integer NOT NULL DEFAULT 0,
+				total integer NOT NULL DEFAULT 0
+				);
+	CREATE TABLE IF NOT EXISTS jobs_test (
+				id varchar(64) PRIMARY KEY,
+				userid varchar(64) NOT NULL,
+				status varchar(16) NOT NULL,
+				ids text[] NOT NULL,
+				deleted integer NOT NULL DEFAULT 0,
+				failures jsonb,
+				error text NOT NULL DEFAULT '',
+				created_at timestamptz NOT NULL,
+				finished_at timestamptz,
+				owner varchar(64) NOT NULL DEFAULT '',
+				lease_until timestamptz
+				);
+	CREATE TABLE IF NOT EXISTS sequences_test (
+				name varchar(64) PRIMARY KEY,
+				value bigint NOT NULL DEFAULT 0
+				)`
 	mockAddQuery = `
-	INSERT INTO urls_test (short, original, userid)
-	VALUES ($1, $2, $3)
+	INSERT INTO urls_test (short, original, userid, expires_at, created_at, password_hash, max_clicks, rules, variants, sticky, redirect_code)
+	VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, 0), $8, $9, $10, NULLIF($11, 0))
 	ON CONFLICT DO NOTHING
 	RETURNING short`
-	mockUpdateDeleteQuery = `UPDATE urls_test SET deleted=TRUE WHERE short IN (SELECT unnest($1::text[])) AND userid = $2`
-	mockGetQuery          = `SELECT original, deleted FROM urls_test WHERE short = $1`
-	mockGetByUserQuery    = `SELECT * FROM urls_test WHERE userid = $1`
-	mockGetShort          = `SELECT short FROM urls_test WHERE original = $1`
-	mockCountUserURLs     = "SELECT count(*) FROM urls_test WHERE userid = $1"
-	getMockStats          = "SELECT COUNT(*), COUNT(DISTINCT(userid)) FROM urls_test;"
-	mockDrop              = `DROP TABLE urls_test`
+	mockUpdateDeleteQuery = `UPDATE urls_test SET deleted=TRUE, deleted_at = now() WHERE short IN (SELECT unnest($1::text[])) AND userid = $2
+	AND NOT deleted RETURNING short`
+	mockRestoreQuery = `UPDATE urls_test SET deleted = FALSE, deleted_at = NULL WHERE short IN (SELECT unnest($1::text[])) AND userid = $2 AND deleted`
+	mockGetQuery     = `SELECT ` + urlColumns + ` FROM urls_test WHERE short = $1`
+	mockConsumeClick = `UPDATE urls_test SET clicks = clicks + 1
+	WHERE short = $1 AND (max_clicks IS NULL OR clicks < max_clicks)
+	RETURNING ` + urlColumns
+	mockSetRules       = `UPDATE urls_test SET rules = $3 WHERE short = $1 AND userid = $2 AND NOT deleted RETURNING ` + urlColumns
+	mockSetBlocked     = `UPDATE urls_test SET blocked = $2, block_reason = NULLIF($3, '') WHERE short = $1 RETURNING ` + urlColumns
+	mockGetByUserQuery = `SELECT short, original, userid, deleted, expires_at, created_at, deleted_at FROM urls_test
+	WHERE userid = $1
+	AND ($2::boolean IS NULL OR deleted = $2)
+	AND ($3 = '' OR strpos(lower(original), lower($3)) > 0)
+	AND ($4::timestamptz IS NULL OR (created_at, short) > ($4, $5::text))
+	ORDER BY created_at, short
+	LIMIT $6`
+	mockGetByUserDescQuery = `SELECT short, original, userid, deleted, expires_at, created_at, deleted_at FROM urls_test
+	WHERE userid = $1
+	AND ($2::boolean IS NULL OR deleted = $2)
+	AND ($3 = '' OR strpos(lower(original), lower($3)) > 0)
+	AND ($4::timestamptz IS NULL OR (created_at, short) < ($4, $5::text))
+	ORDER BY created_at DESC, short DESC
+	LIMIT $6`
+	mockGetShort     = `SELECT short FROM urls_test WHERE original = $1`
+	mockLockURLQuery = `SELECT original, userid, deleted, expires_at, created_at FROM urls_test WHERE short = $1 FOR UPDATE`
+	mockUpdateURL    = `UPDATE urls_test SET original = $2 WHERE short = $1`
+	mockAddHistory   = `INSERT INTO url_history_test (short, version, original, changed_at)
+	SELECT $1, COALESCE(max(version), 0) + 1, $2, $3 FROM url_history_test WHERE short = $1`
+	mockGetHistory    = `SELECT version, original, changed_at FROM url_history_test WHERE short = $1 ORDER BY version`
+	mockDeleteExpired = `DELETE FROM urls_test WHERE expires_at <= $1`
+	mockPurgeDeleted  = `DELETE FROM urls_test WHERE deleted AND deleted_at <= $1`
+	mockClickStats    = `SELECT date_trunc($2, clicked_at AT TIME ZONE 'UTC') AS start, count(*) FROM clicks_test
+	WHERE short = $1 GROUP BY start ORDER BY start`
+	mockVariantClicks = `SELECT variant, count(*) FROM clicks_test WHERE short = $1 AND variant > 0 GROUP BY variant ORDER BY variant`
+	mockCountURLs     = `SELECT COUNT(*) FILTER (WHERE NOT deleted), COUNT(*) FILTER (WHERE created_at >= $2) FROM urls_test WHERE userid = $1`
+	mockGetQuota      = `SELECT daily, total FROM quotas_test WHERE userid = $1`
+	mockSetQuota      = `INSERT INTO quotas_test (userid, daily, total) VALUES ($1, $2, $3)
+	ON CONFLICT (userid) DO UPDATE SET daily = EXCLUDED.daily, total = EXCLUDED.total`
+	mockGetJob    = `SELECT userid, status, ids, deleted, failures, error, created_at, finished_at FROM jobs_test WHERE id = $1`
+	mockClaimJobs = `UPDATE jobs_test j SET owner = $2, lease_until = $3
+	FROM (SELECT id FROM jobs_test WHERE status = $1 AND (lease_until IS NULL OR lease_until <= $4) FOR UPDATE SKIP LOCKED) due
+	WHERE j.id = due.id
+	RETURNING j.id, j.userid, j.status, j.ids, j.deleted, j.failures, j.error, j.created_at, j.finished_at, j.owner, j.lease_until`
+	mockSaveJob = `INSERT INTO jobs_test (id, userid, status, ids, deleted, failures, error, created_at, finished_at, owner, lease_until)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	ON CONFLICT (id) DO UPDATE SET status = EXCLUDED.status, deleted = EXCLUDED.deleted, failures = EXCLUDED.failures,
+	error = EXCLUDED.error, finished_at = EXCLUDED.finished_at, owner = EXCLUDED.owner, lease_until = EXCLUDED.lease_until
+	WHERE jobs_test.owner = '' OR jobs_test.owner = EXCLUDED.owner`
+	mockReserveIDs = `INSERT INTO sequences_test (name, value) VALUES ('ids', $1::bigint)
+	ON CONFLICT (name) DO UPDATE SET value = sequences_test.value + EXCLUDED.value RETURNING value - $1::bigint`
+	getMockStats = "SELECT COUNT(*), COUNT(DISTINCT(userid)) FROM urls_test;"
+	mockDrop     = `DROP TABLE urls_test, clicks_test, url_history_test, quotas_test, jobs_test, sequences_test`
 )
 
 type postgresMockRepo struct {
@@ -64,72 +159,88 @@ func NewPostgresMockRepo(connString string) (*postgresMockRepo, error) {
 
 // Get returns original link by id or an error if id is not present.
 func (r *postgresMockRepo) Get(ctx context.Context, id string) (*models.URL, error) {
-	var url models.URL
-	err := r.conn.QueryRow(ctx, mockGetQuery, id).Scan(&url.LongURL, &url.Deleted)
-	if err != nil {
-		return nil, fmt.Errorf("invalid id: %v", id)
+	url := models.URL{ShortURL: id}
+	err := r.conn.QueryRow(ctx, mockGetQuery, id).Scan(urlFields(&url)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", models.ErrInvalidID, id)
+	} else if err != nil {
+		return nil, err
 	}
 	return &url, nil
 }
 
-// GetByUser finds URLs created by a specific user.
-func (r *postgresMockRepo) GetByUser(ctx context.Context, userID string) ([]*models.URL, error) {
-	var url models.URL
-	var count int
-	err := r.conn.QueryRow(ctx, mockCountUserURLs, userID).Scan(count)
-	if err != nil {
+// GetByLong finds the url stored for a long url, nil if it isn't stored.
+func (r *postgresMockRepo) GetByLong(ctx context.Context, longURL string) (*models.URL, error) {
+	var short string
+	err := r.conn.QueryRow(ctx, mockGetShort, longURL).Scan(&short)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
 		return nil, err
 	}
-	urls := make([]*models.URL, 0, count)
-	rows, err := r.conn.Query(ctx, mockGetByUserQuery, userID)
+	return r.Get(ctx, short)
+}
+
+// GetByUser finds a page of URLs created by a specific user.
+func (r *postgresMockRepo) GetByUser(ctx context.Context, userID string, q *models.URLQuery) ([]*models.URL, error) {
+	query := mockGetByUserQuery
+	if q.Desc {
+		query = mockGetByUserDescQuery
+	}
+	var urls []*models.URL
+	rows, err := r.conn.Query(ctx, query, pageArgs(userID, q)...)
 	if err != nil {
 		return nil, err
 	}
-	if rows.Err() != nil {
-		return nil, rows.Err()
-	}
 	defer rows.Close()
 	for rows.Next() {
-		err = rows.Scan(&url.ShortURL, &url.LongURL, &url.UserID, &url.Deleted)
+		var url models.URL
+		err = rows.Scan(&url.ShortURL, &url.LongURL, &url.UserID, &url.Deleted, &url.ExpiresAt, &url.CreatedAt, &url.DeletedAt)
 		if err != nil {
 			return nil, err
 		}
 		urls = append(urls, &url)
 	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
 	return urls, nil
 }
 
 // Add adds a link to db and returns assigned id
-func (r *postgresMockRepo) Add(ctx context.Context, url *models.URL) (bool, error) {
-	var duplicates bool
+func (r *postgresMockRepo) Add(ctx context.Context, url *models.URL) (duplicates bool, err error) {
 	tx, err := r.conn.Begin(ctx)
 	if err != nil {
 		return false, err
 	}
-	defer helpers.CommitTx(ctx, tx, err)
-	err = tx.QueryRow(ctx, mockAddQuery, url.ShortURL, url.LongURL, url.UserID).Scan(&url.ShortURL)
+	defer func() { helpers.CommitTx(ctx, tx, err) }()
+	err = tx.QueryRow(ctx, mockAddQuery, url.ShortURL, url.LongURL, url.UserID, url.ExpiresAt, url.CreatedAt, url.PasswordHash, url.MaxClicks, url.Rules,
+		url.Variants, url.Sticky, url.RedirectCode).Scan(&url.ShortURL)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			duplicates = true
 			err = tx.QueryRow(ctx, mockGetShort, url.LongURL).Scan(&url.ShortURL)
+			if errors.Is(err, pgx.ErrNoRows) && url.Alias != "" {
+				return false, models.ErrAliasTaken
+			}
+			duplicates = err == nil
 		}
 	}
 	return duplicates, err
 }
 
 // AddBatch adds multiple URLs to repository.
-func (r *postgresMockRepo) AddBatch(ctx context.Context, urls []*models.URL) (bool, error) {
-	var duplicates bool
+func (r *postgresMockRepo) AddBatch(ctx context.Context, urls []*models.URL) (duplicates bool, err error) {
 	tx, err := r.conn.Begin(ctx)
 	if err != nil {
 		return false, err
 	}
-	defer helpers.CommitTx(ctx, tx, err)
+	defer func() { helpers.CommitTx(ctx, tx, err) }()
 	for _, v := range urls {
-		err = tx.QueryRow(ctx, mockAddQuery, v.ShortURL, v.LongURL, v.UserID).Scan(&v.ShortURL)
+		err = tx.QueryRow(ctx, mockAddQuery, v.ShortURL, v.LongURL, v.UserID, v.ExpiresAt, v.CreatedAt, v.PasswordHash, v.MaxClicks, v.Rules,
+			v.Variants, v.Sticky, v.RedirectCode).Scan(&v.ShortURL)
 		if err != nil {
 			if errors.Is(err, pgx.ErrNoRows) {
-				duplicates = true
+				duplicates, v.Duplicate = true, true
 				err = tx.QueryRow(ctx, mockGetShort, v.LongURL).Scan(&v.ShortURL)
 			}
 		}
@@ -143,24 +254,291 @@ func (r *postgresMockRepo) NewID(url string) (string, error) {
 }
 
 // NewID calculates a string to use as an ID.
-func (r *postgresMockRepo) DeleteURLs(deleteURLs []*models.DeleteURLItem) (int, error) {
+func (r *postgresMockRepo) DeleteURLs(deleteURLs []*models.DeleteURLItem) (n int, err error) {
+	if len(deleteURLs) == 0 {
+		return 0, nil
+	}
 	ctx := context.Background()
 	tx, err := r.conn.Begin(ctx)
-	var n int
 	if err != nil {
 		return n, err
 	}
-	defer helpers.CommitTx(ctx, tx, err)
-	shortURLs := make([]string, len(deleteURLs))
-	for i, v := range deleteURLs {
+	defer func() { helpers.CommitTx(ctx, tx, err) }()
+	deleted, err := deleteByUser(ctx, tx, mockUpdateDeleteQuery, deleteURLs)
+	if err != nil {
+		return n, err
+	}
+	return markDeleted(deleteURLs, deleted), nil
+}
+
+// RestoreURLs restores deleted urls created by user.
+func (r *postgresMockRepo) RestoreURLs(restoreURLs []*models.DeleteURLItem) (int, error) {
+	if len(restoreURLs) == 0 {
+		return 0, nil
+	}
+	shortURLs := make([]string, len(restoreURLs))
+	for i, v := range restoreURLs {
 		shortURLs[i] = v.ShortURL
 	}
-	res, err := tx.Exec(ctx, mockUpdateDeleteQuery, shortURLs, deleteURLs[0].UserID)
+	res, err := r.conn.Exec(context.Background(), mockRestoreQuery, shortURLs, restoreURLs[0].UserID)
 	if err != nil {
-		return n, err
+		return 0, err
+	}
+	return int(res.RowsAffected()), nil
+}
+
+// PurgeDeleted deletes urls deleted before the given time from db.
+func (r *postgresMockRepo) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	res, err := r.conn.Exec(ctx, mockPurgeDeleted, before)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.RowsAffected()), nil
+}
+
+// DeleteExpired deletes urls expired by now from db.
+func (r *postgresMockRepo) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	res, err := r.conn.Exec(ctx, mockDeleteExpired, now)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.RowsAffected()), nil
+}
+
+// UpdateURL changes the target of a url created by user and stores the previous one in history.
+func (r *postgresMockRepo) UpdateURL(ctx context.Context, url *models.URL, now time.Time) (updated *models.URL, err error) {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { helpers.CommitTx(ctx, tx, err) }()
+	stored := &models.URL{ShortURL: url.ShortURL}
+	err = tx.QueryRow(ctx, mockLockURLQuery, url.ShortURL).Scan(&stored.LongURL, &stored.UserID, &stored.Deleted, &stored.ExpiresAt, &stored.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		stored = nil
+	} else if err != nil {
+		return nil, err
+	}
+	var existing *models.URL
+	var short string
+	err = tx.QueryRow(ctx, mockGetShort, url.LongURL).Scan(&short)
+	if err == nil {
+		existing = &models.URL{ShortURL: short}
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	if err = checkUpdate(stored, url, existing); err != nil {
+		return nil, err
+	}
+	if stored.LongURL == url.LongURL {
+		return stored, nil
+	}
+	if _, err = tx.Exec(ctx, mockAddHistory, url.ShortURL, stored.LongURL, now); err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec(ctx, mockUpdateURL, url.ShortURL, url.LongURL); err != nil {
+		return nil, err
+	}
+	stored.LongURL = url.LongURL
+	return stored, nil
+}
+
+// SetRules replaces redirect rules of a url created by user.
+func (r *postgresMockRepo) SetRules(ctx context.Context, url *models.URL) (*models.URL, error) {
+	updated := models.URL{ShortURL: url.ShortURL}
+	err := r.conn.QueryRow(ctx, mockSetRules, url.ShortURL, url.UserID, url.Rules).Scan(urlFields(&updated)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		stored, err := r.Get(ctx, url.ShortURL)
+		if errors.Is(err, models.ErrInvalidID) {
+			stored = nil
+		} else if err != nil {
+			return nil, err
+		}
+		return nil, checkUpdate(stored, url, nil)
+	} else if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// SetBlocked blocks or unblocks a url regardless of its owner.
+func (r *postgresMockRepo) SetBlocked(ctx context.Context, url *models.URL) (*models.URL, error) {
+	updated := models.URL{ShortURL: url.ShortURL}
+	err := r.conn.QueryRow(ctx, mockSetBlocked, url.ShortURL, url.Blocked, url.BlockReason).Scan(urlFields(&updated)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", models.ErrInvalidID, url.ShortURL)
+	} else if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// CountURLs counts urls kept by user and urls they created since the given time.
+func (r *postgresMockRepo) CountURLs(ctx context.Context, userID string, since time.Time) (int, int, error) {
+	var total, created int
+	err := r.conn.QueryRow(ctx, mockCountURLs, userID, since).Scan(&total, &created)
+	if err != nil {
+		return 0, 0, err
+	}
+	return total, created, nil
+}
+
+// GetQuota returns the quota of user, nil if they have none of their own.
+func (r *postgresMockRepo) GetQuota(ctx context.Context, userID string) (*models.Quota, error) {
+	quota := models.Quota{UserID: userID}
+	err := r.conn.QueryRow(ctx, mockGetQuota, userID).Scan(&quota.Daily, &quota.Total)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// SetQuota stores the quota of a user replacing their previous one.
+func (r *postgresMockRepo) SetQuota(ctx context.Context, quota *models.Quota) error {
+	_, err := r.conn.Exec(ctx, mockSetQuota, quota.UserID, quota.Daily, quota.Total)
+	return err
+}
+
+// GetJob returns a delete job, nil if there is none with the ID.
+func (r *postgresMockRepo) GetJob(ctx context.Context, id string) (*models.Job, error) {
+	job := models.Job{ID: id}
+	err := r.conn.QueryRow(ctx, mockGetJob, id).Scan(&job.UserID, &job.Status, &job.IDs, &job.Deleted, &job.Failures,
+		&job.Error, &job.CreatedAt, &job.FinishedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ClaimJobs returns the pending delete jobs whose lease ended by now, oldest first, and leases them to owner.
+// Jobs claimed by another instance at the same time are skipped.
+func (r *postgresMockRepo) ClaimJobs(ctx context.Context, owner string, now time.Time, lease time.Duration) ([]*models.Job, error) {
+	rows, err := r.conn.Query(ctx, mockClaimJobs, models.JobPending, owner, now.Add(lease), now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var jobs []*models.Job
+	for rows.Next() {
+		job := &models.Job{}
+		err = rows.Scan(&job.ID, &job.UserID, &job.Status, &job.IDs, &job.Deleted, &job.Failures, &job.Error,
+			&job.CreatedAt, &job.FinishedAt, &job.Owner, &job.LeaseUntil)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	sortJobs(jobs)
+	return jobs, nil
+}
+
+// SaveJob stores a delete job replacing its previous state unless another owner holds it.
+func (r *postgresMockRepo) SaveJob(ctx context.Context, job *models.Job) error {
+	tag, err := r.conn.Exec(ctx, mockSaveJob, job.ID, job.UserID, job.Status, job.IDs, job.Deleted, job.Failures,
+		job.Error, job.CreatedAt, job.FinishedAt, job.Owner, job.LeaseUntil)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return models.ErrJobClaimed
+	}
+	return nil
+}
+
+// ReserveIDs advances the id sequence by n and returns its previous value.
+func (r *postgresMockRepo) ReserveIDs(ctx context.Context, n uint64) (uint64, error) {
+	var last int64
+	err := r.conn.QueryRow(ctx, mockReserveIDs, int64(n)).Scan(&last)
+	return uint64(last), err
+}
+
+// GetHistory returns previous targets of a url.
+func (r *postgresMockRepo) GetHistory(ctx context.Context, id string) ([]*models.URLVersion, error) {
+	rows, err := r.conn.Query(ctx, mockGetHistory, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var history []*models.URLVersion
+	for rows.Next() {
+		v := &models.URLVersion{ShortURL: id}
+		if err = rows.Scan(&v.Version, &v.LongURL, &v.ChangedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, v)
+	}
+	return history, rows.Err()
+}
+
+// ConsumeClick counts a redirect of a url limited in clicks, failing once all of them are used.
+func (r *postgresMockRepo) ConsumeClick(ctx context.Context, id string) (*models.URL, error) {
+	url := models.URL{ShortURL: id}
+	err := r.conn.QueryRow(ctx, mockConsumeClick, id).Scan(urlFields(&url)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err = r.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, models.ErrURLExhausted
+	} else if err != nil {
+		return nil, err
+	}
+	return &url, nil
+}
+
+// AddClicks copies recorded clicks to db.
+func (r *postgresMockRepo) AddClicks(ctx context.Context, clicks []*models.Click) error {
+	_, err := r.conn.CopyFrom(ctx,
+		pgx.Identifier{"clicks_test"},
+		[]string{"short", "clicked_at", "referrer", "user_agent", "ip", "variant"},
+		pgx.CopyFromSlice(len(clicks), func(i int) ([]any, error) {
+			return []any{clicks[i].ShortURL, clicks[i].Time, clicks[i].Referrer, clicks[i].UserAgent, clicks[i].IP, clicks[i].Variant}, nil
+		}),
+	)
+	return err
+}
+
+// GetClickStats counts clicks of a short url grouped by bucket.
+func (r *postgresMockRepo) GetClickStats(ctx context.Context, id string, bucket string) (*models.ClickStats, error) {
+	if bucket != models.BucketHour && bucket != models.BucketDay {
+		return nil, models.ErrInvalidBucket
+	}
+	rows, err := r.conn.Query(ctx, mockClickStats, id, bucket)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stats := &models.ClickStats{ShortURL: id, Buckets: make([]models.ClickBucket, 0)}
+	for rows.Next() {
+		var b models.ClickBucket
+		if err = rows.Scan(&b.Start, &b.Count); err != nil {
+			return nil, err
+		}
+		stats.Total += b.Count
+		stats.Buckets = append(stats.Buckets, b)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows, err = r.conn.Query(ctx, mockVariantClicks, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v models.VariantClicks
+		if err = rows.Scan(&v.Variant, &v.Count); err != nil {
+			return nil, err
+		}
+		stats.Variants = append(stats.Variants, v)
 	}
-	n = int(res.RowsAffected())
-	return n, err
+	return stats, rows.Err()
 }
 
 // Ping checks if file is available.
@@ -1,32 +1,99 @@
 package storage
 
 const (
-	// createUrls creates tables if they don't exist.
-	createUrls = `CREATE TABLE IF NOT EXISTS urls (
-            	short varchar(255) PRIMARY KEY,
-                original varchar(255),
-    			userid varchar(64),
-    			deleted boolean DEFAULT false,
-    			UNIQUE(original)
-                )`
 	// addQuery inserts a new URL into the 'urls' table, returning existing short ID if it already exists.
 	addQuery = `
-	INSERT INTO urls (short, original, userid)
-	VALUES ($1, $2, $3)
+	INSERT INTO urls (short, original, userid, expires_at, created_at, password_hash, max_clicks, rules, variants, sticky, redirect_code)
+	VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, 0), $8, $9, $10, NULLIF($11, 0))
 	ON CONFLICT DO NOTHING
 	RETURNING short`
 	// updateDeleteQuery marks the urls from the list and created by a specific user as deleted.
-	updateDeleteQuery = `UPDATE urls SET DELETED=TRUE WHERE short IN (SELECT unnest($1::text[])) AND userid = $2`
+	updateDeleteQuery = `UPDATE urls SET DELETED=TRUE, deleted_at = now() WHERE short IN (SELECT unnest($1::text[])) AND userid = $2
+	AND NOT deleted RETURNING short`
+	// updateRestoreQuery marks the deleted urls from the list and created by a specific user as not deleted.
+	updateRestoreQuery = `UPDATE urls SET deleted = FALSE, deleted_at = NULL WHERE short IN (SELECT unnest($1::text[])) AND userid = $2 AND deleted`
+	// urlColumns are the columns of a single URL scanned by urlFields.
+	urlColumns = `original, userid, deleted, expires_at, created_at, deleted_at, COALESCE(password_hash, ''), COALESCE(max_clicks, 0), clicks, rules,
+	variants, sticky, COALESCE(redirect_code, 0), blocked, COALESCE(block_reason, '')`
 	// getQuery retrieves a single URL from the 'urls' table.
-	getQuery = `SELECT original, deleted FROM urls WHERE short = $1`
-	// getByUserQuery retrieves all URLs belonging to a specific user from the 'urls' table.
-	getByUserQuery = `SELECT * FROM urls WHERE userid = $1`
+	getQuery = `SELECT ` + urlColumns + ` FROM urls WHERE short = $1`
+	// consumeClickQuery counts a redirect of a URL unless it has used all of its clicks, returning the URL.
+	consumeClickQuery = `UPDATE urls SET clicks = clicks + 1
+	WHERE short = $1 AND (max_clicks IS NULL OR clicks < max_clicks)
+	RETURNING ` + urlColumns
+	// setRulesQuery replaces redirect rules of a URL created by a specific user unless it is deleted, returning the URL.
+	setRulesQuery = `UPDATE urls SET rules = $3 WHERE short = $1 AND userid = $2 AND NOT deleted RETURNING ` + urlColumns
+	// setBlockedQuery blocks or unblocks a URL regardless of its owner, returning the URL.
+	setBlockedQuery = `UPDATE urls SET blocked = $2, block_reason = NULLIF($3, '') WHERE short = $1 RETURNING ` + urlColumns
+	// getByUserQuery retrieves a page of URLs belonging to a specific user from the 'urls' table, oldest first.
+	getByUserQuery = `SELECT short, original, userid, deleted, expires_at, created_at, deleted_at FROM urls
+	WHERE userid = $1
+	AND ($2::boolean IS NULL OR deleted = $2)
+	AND ($3 = '' OR strpos(lower(original), lower($3)) > 0)
+	AND ($4::timestamptz IS NULL OR (created_at, short) > ($4, $5::text))
+	ORDER BY created_at, short
+	LIMIT $6`
+	// getByUserDescQuery retrieves a page of URLs belonging to a specific user from the 'urls' table, newest first.
+	getByUserDescQuery = `SELECT short, original, userid, deleted, expires_at, created_at, deleted_at FROM urls
+	WHERE userid = $1
+	AND ($2::boolean IS NULL OR deleted = $2)
+	AND ($3 = '' OR strpos(lower(original), lower($3)) > 0)
+	AND ($4::timestamptz IS NULL OR (created_at, short) < ($4, $5::text))
+	ORDER BY created_at DESC, short DESC
+	LIMIT $6`
+	// lockURLQuery retrieves a single URL from the 'urls' table and locks it for update.
+	lockURLQuery = `SELECT original, userid, deleted, expires_at, created_at FROM urls WHERE short = $1 FOR UPDATE`
+	// updateURLQuery changes the original URL of a short URL.
+	updateURLQuery = `UPDATE urls SET original = $2 WHERE short = $1`
+	// addHistoryQuery stores the previous original URL of a short URL as its next version.
+	addHistoryQuery = `INSERT INTO url_history (short, version, original, changed_at)
+	SELECT $1, COALESCE(max(version), 0) + 1, $2, $3 FROM url_history WHERE short = $1`
+	// getHistoryQuery retrieves previous original URLs of a short URL.
+	getHistoryQuery = `SELECT version, original, changed_at FROM url_history WHERE short = $1 ORDER BY version`
 	// getShort retrieves the short URL for a given original URL from the 'urls' table.
 	getShort = `SELECT short FROM urls WHERE original = $1`
-	// countUserURLs counts the number of URLs belonging to a specific user in the 'urls' table.
-	countUserURLs = "SELECT count(*) FROM urls WHERE userid = $1"
+	// deleteExpiredQuery deletes urls expired by the given time.
+	deleteExpiredQuery = `DELETE FROM urls WHERE expires_at <= $1`
+	// deleteExpiredClicks deletes clicks of urls expired by the given time.
+	deleteExpiredClicks = `DELETE FROM clicks WHERE short IN (SELECT short FROM urls WHERE expires_at <= $1)`
+	// deleteExpiredHistory deletes history of urls expired by the given time.
+	deleteExpiredHistory = `DELETE FROM url_history WHERE short IN (SELECT short FROM urls WHERE expires_at <= $1)`
+	// purgeDeletedQuery deletes urls deleted before the given time.
+	purgeDeletedQuery = `DELETE FROM urls WHERE deleted AND deleted_at <= $1`
+	// purgeDeletedClicks deletes clicks of urls deleted before the given time.
+	purgeDeletedClicks = `DELETE FROM clicks WHERE short IN (SELECT short FROM urls WHERE deleted AND deleted_at <= $1)`
+	// purgeDeletedHistory deletes history of urls deleted before the given time.
+	purgeDeletedHistory = `DELETE FROM url_history WHERE short IN (SELECT short FROM urls WHERE deleted AND deleted_at <= $1)`
+	// clickStatsQuery counts clicks of a short url grouped by time bucket.
+	clickStatsQuery = `SELECT date_trunc($2, clicked_at AT TIME ZONE 'UTC') AS start, count(*) FROM clicks
+	WHERE short = $1 GROUP BY start ORDER BY start`
+	// variantClicksQuery counts clicks of a short url by variant.
+	variantClicksQuery = `SELECT variant, count(*) FROM clicks WHERE short = $1 AND variant > 0 GROUP BY variant ORDER BY variant`
+	// countURLsQuery counts URLs kept by a specific user and URLs they created since the given time.
+	countURLsQuery = `SELECT COUNT(*) FILTER (WHERE NOT deleted), COUNT(*) FILTER (WHERE created_at >= $2) FROM urls WHERE userid = $1`
+	// getQuotaQuery retrieves the quota of a specific user.
+	getQuotaQuery = `SELECT daily, total FROM quotas WHERE userid = $1`
+	// setQuotaQuery stores the quota of a user replacing their previous one.
+	setQuotaQuery = `INSERT INTO quotas (userid, daily, total) VALUES ($1, $2, $3)
+	ON CONFLICT (userid) DO UPDATE SET daily = EXCLUDED.daily, total = EXCLUDED.total`
+	// getJobQuery retrieves a delete job.
+	getJobQuery = `SELECT userid, status, ids, deleted, failures, error, created_at, finished_at FROM jobs WHERE id = $1`
+	// claimJobsQuery leases delete jobs in the given state whose lease ended, so other instances skip them, returning them.
+	claimJobsQuery = `UPDATE jobs j SET owner = $2, lease_until = $3
+	FROM (SELECT id FROM jobs WHERE status = $1 AND (lease_until IS NULL OR lease_until <= $4) FOR UPDATE SKIP LOCKED) due
+	WHERE j.id = due.id
+	RETURNING j.id, j.userid, j.status, j.ids, j.deleted, j.failures, j.error, j.created_at, j.finished_at, j.owner, j.lease_until`
+	// saveJobQuery stores a delete job replacing its previous state unless another owner holds it.
+	saveJobQuery = `INSERT INTO jobs (id, userid, status, ids, deleted, failures, error, created_at, finished_at, owner, lease_until)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	ON CONFLICT (id) DO UPDATE SET status = EXCLUDED.status, deleted = EXCLUDED.deleted, failures = EXCLUDED.failures,
+	error = EXCLUDED.error, finished_at = EXCLUDED.finished_at, owner = EXCLUDED.owner, lease_until = EXCLUDED.lease_until
+	WHERE jobs.owner = '' OR jobs.owner = EXCLUDED.owner`
+	// reserveIDsQuery advances the id sequence by $1 and returns its previous value.
+	reserveIDsQuery = `INSERT INTO sequences (name, value) VALUES ('ids', $1::bigint)
+	ON CONFLICT (name) DO UPDATE SET value = sequences.value + EXCLUDED.value RETURNING value - $1::bigint`
 	// get count of registered users and urls
 	getStats = "SELECT COUNT(*), COUNT(DISTINCT(userid)) FROM urls;"
-	// drop drops the 'urls' table.
-	drop = `DROP TABLE urls`
+	// drop drops the 'urls', 'clicks', 'url_history', 'quotas', webhook, 'jobs', 'sequences' and 'schema_migrations' tables.
+	drop = `DROP TABLE urls, clicks, url_history, quotas, webhook_attempts, webhook_deliveries, webhooks, jobs, sequences, schema_migrations`
 )
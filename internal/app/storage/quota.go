@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// countURLs counts urls a user keeps and urls they created since the given time.
+// Deleted urls are only counted as created, so deleting urls frees the total quota but not the daily one.
+func countURLs(urls []*models.URL, since time.Time) (total, created int) {
+	for _, v := range urls {
+		if !v.Deleted {
+			total++
+		}
+		if !v.CreatedAt.Before(since) {
+			created++
+		}
+	}
+	return total, created
+}
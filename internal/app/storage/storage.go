@@ -16,35 +16,68 @@ import (
 // Repository is an interface for storage instances
 type Repository interface {
 	Get(ctx context.Context, id string) (*models.URL, error)
-	GetByUser(ctx context.Context, userID string) ([]*models.URL, error)
+	GetByLong(ctx context.Context, longURL string) (*models.URL, error)
+	GetByUser(ctx context.Context, userID string, q *models.URLQuery) ([]*models.URL, error)
 	Add(ctx context.Context, url *models.URL) (bool, error)
 	AddBatch(ctx context.Context, urls []*models.URL) (bool, error)
 	NewID(url string) (string, error)
 	Ping(ctx context.Context) error
 	DeleteRepo(ctx context.Context) error
 	DeleteURLs(deleteURLs []*models.DeleteURLItem) (int, error)
+	RestoreURLs(restoreURLs []*models.DeleteURLItem) (int, error)
+	PurgeDeleted(ctx context.Context, before time.Time) (int, error)
+	UpdateURL(ctx context.Context, url *models.URL, now time.Time) (*models.URL, error)
+	GetHistory(ctx context.Context, id string) ([]*models.URLVersion, error)
+	SetRules(ctx context.Context, url *models.URL) (*models.URL, error)
+	SetBlocked(ctx context.Context, url *models.URL) (*models.URL, error)
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+	CountURLs(ctx context.Context, userID string, since time.Time) (int, int, error)
+	GetQuota(ctx context.Context, userID string) (*models.Quota, error)
+	SetQuota(ctx context.Context, quota *models.Quota) error
+	GetJob(ctx context.Context, id string) (*models.Job, error)
+	ClaimJobs(ctx context.Context, owner string, now time.Time, lease time.Duration) ([]*models.Job, error)
+	SaveJob(ctx context.Context, job *models.Job) error
+	ReserveIDs(ctx context.Context, n uint64) (uint64, error)
 	Stats(ctx context.Context) (*models.Stats, error)
+	AddClicks(ctx context.Context, clicks []*models.Click) error
+	ConsumeClick(ctx context.Context, id string) (*models.URL, error)
+	GetClickStats(ctx context.Context, id string, bucket string) (*models.ClickStats, error)
 	Close() error
 }
 
 // New initializes a new Repository instance to use as a storage.
 func New(c *config.Config) Repository {
-	if c.PostgresURL != "" {
+	gen, err := NewIDGenerator(c)
+	if err != nil {
+		log.Fatal(fmt.Errorf("error initiating id generator : %v", err))
+	}
+	ids := idSource{gen: gen, retries: c.IDRetries}
+	s := gocron.NewScheduler(time.UTC)
+	var repo Repository
+	switch {
+	case c.PostgresURL != "":
 		r, err := NewPostgresRepo(c.PostgresURL)
 		if err != nil {
 			log.Fatal(fmt.Errorf("error initiating postgres connection : %v", err))
 		}
-		err = r.NewTableURLs()
+		err = r.Migrate()
 		if err != nil {
-			log.Fatal(fmt.Errorf("error creating urls table  : %v", err))
+			log.Fatal(fmt.Errorf("error migrating db : %v", err))
 		}
 		err = r.Ping(context.Background())
 		if err != nil {
 			log.Fatal(fmt.Errorf("error pinging db : %v", err))
 		}
-		return r
-	}
-	if c.FileStorage != "" {
+		r.idSource = ids
+		repo = r
+	case c.BoltStorage != "":
+		r, err := NewBoltRepo(c.BoltStorage)
+		if err != nil {
+			log.Fatal(fmt.Errorf("error initiating bolt storage : %v", err))
+		}
+		r.idSource = ids
+		repo = r
+	case c.FileStorage != "":
 		r, err := NewFileRepo(c.FileStorage)
 		if err != nil {
 			log.Fatal(fmt.Errorf("error initiating file storage : %v", err))
@@ -53,12 +86,62 @@ func New(c *config.Config) Repository {
 		if err != nil {
 			log.Fatal(fmt.Errorf("error loading json data from file : %v", err))
 		}
-		s := gocron.NewScheduler(time.UTC)
-		s.Every(1).Minutes().Do(func() {
-			r.update()
+		// Sync the log in groups of writes if requested instead of syncing every write.
+		if c.FileSyncInterval > 0 {
+			r.groupCommit = true
+			s.Every(c.FileSyncInterval).Milliseconds().Do(func() {
+				r.sync()
+			})
+		}
+		if c.FileCompactInterval > 0 {
+			s.Every(c.FileCompactInterval).Minutes().Do(func() {
+				r.checkpoint()
+			})
+		}
+		r.idSource = ids
+		repo = r
+	default:
+		r := NewInMemRepo()
+		r.idSource = ids
+		repo = r
+	}
+	seedIDs(repo, gen)
+	if c.CacheSize > 0 {
+		repo = NewCachedRepo(repo, c.CacheSize, time.Duration(c.CacheTTL)*time.Second)
+	}
+	// Purge expired urls in background.
+	if c.ReapInterval > 0 {
+		s.Every(c.ReapInterval).Minutes().Do(func() {
+			reap(repo)
 		})
-		s.StartAsync()
-		return r
 	}
-	return NewInMemRepo()
+	// Purge deleted urls once they can't be restored.
+	if c.ReapInterval > 0 && c.DeletedRetention > 0 {
+		retention := time.Duration(c.DeletedRetention) * time.Hour
+		s.Every(c.ReapInterval).Minutes().Do(func() {
+			purge(repo, retention)
+		})
+	}
+	s.StartAsync()
+	return repo
+}
+
+// reap deletes expired urls from repository.
+func reap(r Repository) {
+	n, err := r.DeleteExpired(context.Background(), time.Now())
+	if err != nil {
+		log.Printf("error deleting expired urls : %v", err)
+		return
+	}
+	log.Printf("deleted %v expired urls", n)
+}
+
+// purge deletes urls deleted longer than retention ago from repository.
+func purge(r Repository, retention time.Duration) {
+	n, err := r.PurgeDeleted(context.Background(), time.Now().Add(-retention))
+	if err != nil {
+		log.Printf("error purging deleted urls : %v", err)
+		return
+	}
+	log.Printf("purged %v deleted urls", n)
 }
@@ -0,0 +1,36 @@
+package encoders
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// errInvalidCursor is returned if cursor can't be decoded.
+var errInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor encodes position in a listing to an opaque string.
+func EncodeCursor(c *models.Cursor) string {
+	t, _ := c.CreatedAt.MarshalText()
+	return base64.RawURLEncoding.EncodeToString([]byte(string(t) + " " + c.ShortURL))
+}
+
+// DecodeCursor decodes position in a listing encoded by EncodeCursor.
+func DecodeCursor(s string) (*models.Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	t, id, ok := strings.Cut(string(b), " ")
+	if !ok {
+		return nil, errInvalidCursor
+	}
+	var createdAt time.Time
+	if err = createdAt.UnmarshalText([]byte(t)); err != nil {
+		return nil, errInvalidCursor
+	}
+	return &models.Cursor{CreatedAt: createdAt, ShortURL: id}, nil
+}
@@ -0,0 +1,35 @@
+package encoders
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+func TestCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor *models.Cursor
+	}{
+		{name: "Test #1",
+			cursor: &models.Cursor{CreatedAt: time.Date(2023, 1, 2, 3, 4, 5, 6, time.UTC), ShortURL: "vRveliyDLz8"},
+		},
+		{name: "Zero time",
+			cursor: &models.Cursor{ShortURL: "aQqomlSbUsE"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeCursor(EncodeCursor(tt.cursor))
+			require.NoError(t, err)
+			assert.True(t, tt.cursor.CreatedAt.Equal(got.CreatedAt))
+			assert.Equal(t, tt.cursor.ShortURL, got.ShortURL)
+		})
+	}
+	_, err := DecodeCursor("not a cursor")
+	assert.Error(t, err)
+}
@@ -0,0 +1,101 @@
+package encoders
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// defaultPorts maps schemes to their default ports, which are dropped from normalized urls.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ws":    "80",
+	"wss":   "443",
+	"ftp":   "21",
+}
+
+// URLNormalizer converts urls to a canonical form, so equal urls written differently are stored once.
+type URLNormalizer struct {
+	// SortQuery orders query parameters by name.
+	SortQuery bool
+	// StripParams lists query parameters removed from urls, names ending with "*" match by prefix, e.g. "utm_*".
+	StripParams []string
+}
+
+// Normalize returns the canonical form of longURL: the scheme defaults to http, scheme and host are lowercased,
+// default ports are dropped, dot-segments of the path are resolved and an empty path becomes "/".
+// Query parameters are stripped and sorted as configured, escaping of the url is kept as is.
+func (n URLNormalizer) Normalize(longURL string) (string, error) {
+	// Urls without scheme are treated as http ones, like validators.IsURL does.
+	if !strings.Contains(longURL, "://") {
+		longURL = "http://" + longURL
+	}
+	u, err := url.Parse(longURL)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if host, port, err := net.SplitHostPort(u.Host); err == nil && port == defaultPorts[u.Scheme] {
+		u.Host = host
+		// Brackets of IPv6 hosts are removed by SplitHostPort.
+		if strings.Contains(host, ":") {
+			u.Host = "[" + host + "]"
+		}
+	}
+	// Resolving an empty reference removes dot-segments of the path.
+	if u.Opaque == "" {
+		u = u.ResolveReference(&url.URL{})
+		if u.Path == "" {
+			u.Path = "/"
+		}
+	}
+	u.RawQuery = n.query(u.RawQuery)
+	// A "?" without parameters is dropped as well.
+	u.ForceQuery = false
+	return u.String(), nil
+}
+
+// query strips and sorts parameters of rawQuery as configured.
+func (n URLNormalizer) query(rawQuery string) string {
+	if rawQuery == "" || !n.SortQuery && len(n.StripParams) == 0 {
+		return rawQuery
+	}
+	params := strings.Split(rawQuery, "&")
+	names := make(map[string]string, len(params))
+	kept := params[:0]
+	for _, v := range params {
+		if v == "" {
+			continue
+		}
+		rawName, _, _ := strings.Cut(v, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil {
+			name = rawName
+		}
+		if n.stripped(name) {
+			continue
+		}
+		names[v] = name
+		kept = append(kept, v)
+	}
+	if n.SortQuery {
+		// The order of values of the same parameter is meaningful, so it is kept.
+		sort.SliceStable(kept, func(i, j int) bool {
+			return names[kept[i]] < names[kept[j]]
+		})
+	}
+	return strings.Join(kept, "&")
+}
+
+// stripped checks if the query parameter name is removed from urls.
+func (n URLNormalizer) stripped(name string) bool {
+	for _, v := range n.StripParams {
+		if strings.HasSuffix(v, "*") && strings.HasPrefix(name, strings.TrimSuffix(v, "*")) || name == v {
+			return true
+		}
+	}
+	return false
+}
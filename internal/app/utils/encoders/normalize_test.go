@@ -0,0 +1,59 @@
+package encoders
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLNormalizer_Normalize(t *testing.T) {
+	tests := []struct {
+		name       string
+		normalizer URLNormalizer
+		url        string
+		want       string
+	}{
+		{name: "Missing scheme", url: "Example.com", want: "http://example.com/"},
+		{name: "Empty path", url: "http://example.com", want: "http://example.com/"},
+		{name: "Uppercase scheme and host", url: "HTTPS://WWW.Example.COM/Path", want: "https://www.example.com/Path"},
+		{name: "Default port", url: "https://example.com:443/a", want: "https://example.com/a"},
+		{name: "Other port", url: "https://example.com:8443/a", want: "https://example.com:8443/a"},
+		{name: "IPv6 default port", url: "http://[::1]:80/a", want: "http://[::1]/a"},
+		{name: "Dot segments", url: "http://example.com/a/./b/../c/", want: "http://example.com/a/c/"},
+		{name: "Escaping kept", url: "http://example.com/a%2Fb?q=a%20b", want: "http://example.com/a%2Fb?q=a%20b"},
+		{name: "Empty query", url: "http://example.com/a?", want: "http://example.com/a"},
+		{name: "Fragment kept", url: "http://example.com/a#top", want: "http://example.com/a#top"},
+		{name: "Query order kept", url: "http://example.com/?b=1&a=2", want: "http://example.com/?b=1&a=2"},
+		{
+			name:       "Sorted query",
+			normalizer: URLNormalizer{SortQuery: true},
+			url:        "http://example.com/?b=1&a=2&b=0",
+			want:       "http://example.com/?a=2&b=1&b=0",
+		},
+		{
+			name:       "Stripped params",
+			normalizer: URLNormalizer{StripParams: []string{"utm_*", "fbclid"}},
+			url:        "http://example.com/?utm_source=x&id=1&fbclid=abc&utm_medium=y&fbclid2=z",
+			want:       "http://example.com/?id=1&fbclid2=z",
+		},
+		{
+			name:       "All params stripped",
+			normalizer: URLNormalizer{StripParams: []string{"utm_*"}},
+			url:        "http://example.com/a?utm_source=x",
+			want:       "http://example.com/a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.normalizer.Normalize(tt.url)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestURLNormalizer_Invalid(t *testing.T) {
+	_, err := URLNormalizer{}.Normalize("http://exa mple.com/%zz")
+	assert.Error(t, err)
+}
@@ -1,6 +1,8 @@
+// Package encoders provides functions to encode data.
 package encoders
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
 	"math/big"
 	"strings"
@@ -17,6 +19,11 @@ func ToRBase62(url string) string {
 	// Calculate hash.
 	sha.Write([]byte(url))
 	num := new(big.Int).SetBytes(sha.Sum(nil)).Uint64()
+	return EncodeRBase62(num)
+}
+
+// EncodeRBase62 encodes a number to Base62 string in reversed order
+func EncodeRBase62(num uint64) string {
 	// Build string ID.
 	var b strings.Builder
 	b.Grow(64)
@@ -27,3 +34,17 @@ func ToRBase62(url string) string {
 	}
 	return b.String()
 }
+
+// RandomBase62 generates a random Base62 string of the given length.
+func RandomBase62(length int) (string, error) {
+	buf := make([]byte, length)
+	max := big.NewInt(base)
+	for i := range buf {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		buf[i] = charSet[n.Int64()]
+	}
+	return string(buf), nil
+}
@@ -27,3 +27,31 @@ func TestToBase62(t *testing.T) {
 		})
 	}
 }
+
+func TestEncodeRBase62(t *testing.T) {
+	tests := []struct {
+		name string
+		num  uint64
+		want string
+	}{
+		{name: "Test #1",
+			num:  61,
+			want: "z",
+		},
+		{name: "Test #2",
+			num:  62,
+			want: "01",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, EncodeRBase62(tt.num))
+		})
+	}
+}
+
+func TestRandomBase62(t *testing.T) {
+	id, err := RandomBase62(8)
+	assert.NoError(t, err)
+	assert.Len(t, id, 8)
+}
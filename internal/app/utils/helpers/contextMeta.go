@@ -2,8 +2,11 @@ package helpers
 
 import (
 	"context"
+	"net/http"
+	"net/netip"
 
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 )
 
 // CheckMDValue checks if theres is a value in metadata in context
@@ -17,3 +20,26 @@ func CheckMDValue(ctx context.Context, value string) (string, bool) {
 	}
 	return "", false
 }
+
+// MDHeader returns metadata in context as a http header, so it can be read like headers of http requests.
+func MDHeader(ctx context.Context) http.Header {
+	header := http.Header{}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, v := range md {
+		for _, value := range v {
+			header.Add(k, value)
+		}
+	}
+	return header
+}
+
+// PeerIP returns the ip of the client from the X-Real-IP metadata set by a proxy or the address of the peer.
+// The metadata is only taken from trusted proxies, as clients could set it themselves.
+func PeerIP(ctx context.Context, proxies []netip.Prefix) string {
+	ip, _ := CheckMDValue(ctx, "X-Real-IP")
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	return realIP(p.Addr.String(), ip, proxies)
+}
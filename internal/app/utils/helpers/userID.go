@@ -1,7 +1,9 @@
 package helpers
 
 import (
+	"net"
 	"net/http"
+	"net/netip"
 )
 
 // GetUserID check for user_id cookie in request and returns its value if it is present.
@@ -12,3 +14,30 @@ func GetUserID(r *http.Request) (string, bool) {
 	}
 	return userID.Value, true
 }
+
+// ClientIP returns the ip of the client from the X-Real-IP header set by a proxy or the remote address of the request.
+// The header is only taken from trusted proxies, as clients could set it themselves.
+func ClientIP(r *http.Request, proxies []netip.Prefix) string {
+	return realIP(r.RemoteAddr, r.Header.Get("X-Real-IP"), proxies)
+}
+
+// realIP returns the ip set by a proxy if the remote address is one of the trusted proxies, the remote ip otherwise.
+func realIP(remoteAddr string, proxied string, proxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	if proxied == "" {
+		return host
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	for _, v := range proxies {
+		if v.Contains(addr.Unmap()) {
+			return proxied
+		}
+	}
+	return host
+}
@@ -0,0 +1,41 @@
+package validators
+
+const (
+	// aliasMinLen is the minimal length of a custom alias.
+	aliasMinLen = 3
+	// aliasMaxLen is the maximal length of a custom alias.
+	aliasMaxLen = 64
+)
+
+// reservedAliases are the path segments used by the service routes.
+var reservedAliases = map[string]struct{}{
+	"api":   {},
+	"ping":  {},
+	"debug": {},
+}
+
+// IsAlias checks if alias can be used as a short url id.
+func IsAlias(alias string) bool {
+	if len(alias) < aliasMinLen || len(alias) > aliasMaxLen {
+		return false
+	}
+	// Check that alias is not one of the service routes.
+	if IsReserved(alias) {
+		return false
+	}
+	// Allow only url safe characters.
+	for _, c := range alias {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// IsReserved checks if id collides with one of the service routes.
+func IsReserved(id string) bool {
+	_, ok := reservedAliases[id]
+	return ok
+}
@@ -0,0 +1,46 @@
+package validators
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsAlias(t *testing.T) {
+	tests := []struct {
+		name  string
+		alias string
+		want  bool
+	}{
+		{
+			name:  "Correct alias #1",
+			alias: "q3-report",
+			want:  true,
+		},
+		{
+			name:  "Correct alias #2",
+			alias: "Docs_2023",
+			want:  true,
+		},
+		{
+			name:  "Too short alias",
+			alias: "ab",
+			want:  false,
+		},
+		{
+			name:  "Reserved alias",
+			alias: "api",
+			want:  false,
+		},
+		{
+			name:  "Invalid characters",
+			alias: "q3/report",
+			want:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsAlias(tt.alias))
+		})
+	}
+}
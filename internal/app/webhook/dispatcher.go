@@ -0,0 +1,325 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// Headers of posted events.
+const (
+	HeaderID        = "X-Webhook-ID"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// claimSize is the number of deliveries attempted at once.
+const claimSize = 20
+
+// hooksTTL is the time webhooks of a user are cached for, so frequent events don't hit the store.
+const hooksTTL = 30 * time.Second
+
+// maxCachedUsers is the number of users whose webhooks are cached, the cache is reset when it is exceeded.
+const maxCachedUsers = 10000
+
+// Options configure delivery of events.
+type Options struct {
+	// MaxAttempts is the number of attempts after which a delivery fails.
+	MaxAttempts int
+	// Backoff is the delay of the first retry, every next one is doubled.
+	Backoff time.Duration
+	// MaxBackoff caps delays of retries.
+	MaxBackoff time.Duration
+	// Timeout is the time a webhook has to respond.
+	Timeout time.Duration
+	// Interval is the time between checks of the outbox for due retries.
+	Interval time.Duration
+	// BlockPrivate refuses connections to loopback, private, link-local and unspecified addresses.
+	// The address is checked when connecting, after the host of a webhook is resolved.
+	BlockPrivate bool
+}
+
+// cachedHooks are webhooks of a user cached until expiry.
+type cachedHooks struct {
+	hooks   []*models.Webhook
+	expires time.Time
+}
+
+// Dispatcher adds events to the outbox and delivers them to webhooks in background.
+type Dispatcher struct {
+	// store keeps webhooks and the outbox.
+	store Store
+	// opts configure delivery.
+	opts Options
+	// client posts events, it doesn't follow redirects.
+	client *http.Client
+	// mu guards hooks.
+	mu sync.Mutex
+	// hooks caches webhooks by user ID.
+	hooks map[string]cachedHooks
+	// wake triggers delivery of new events.
+	wake chan struct{}
+	// ctx is canceled to stop the dispatcher.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// done is closed when the dispatcher is stopped.
+	done chan struct{}
+}
+
+// NewDispatcher creates a Dispatcher of events in store and starts it.
+func NewDispatcher(store Store, opts Options) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		store: store,
+		opts:  opts,
+		client: &http.Client{
+			Transport: newTransport(opts.BlockPrivate),
+			Timeout:   opts.Timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		hooks:  make(map[string]cachedHooks),
+		wake:   make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// newTransport creates the transport posting events. When blockPrivate is set, every connection
+// is checked against the resolved address, so hosts resolving or rebound to private addresses are refused.
+// Proxies are not used then, since they would resolve the host instead.
+func newTransport(blockPrivate bool) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !blockPrivate {
+		return transport
+	}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   checkPublic,
+	}
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// checkPublic rejects connections to loopback, private, link-local and unspecified addresses.
+func checkPublic(network, address string, c syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: address %s", models.ErrDestinationBlocked, address)
+	}
+	addr := addrPort.Addr().Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsUnspecified() {
+		return fmt.Errorf("%w: address %s", models.ErrDestinationBlocked, addr)
+	}
+	return nil
+}
+
+// Store returns the store of the dispatcher.
+func (d *Dispatcher) Store() Store {
+	return d.store
+}
+
+// Emit adds deliveries of event to the outbox for every webhook of its user subscribed to it.
+func (d *Dispatcher) Emit(ctx context.Context, event *models.Event) error {
+	hooks, err := d.webhooks(ctx, event.UserID, event.Time)
+	if err != nil {
+		return err
+	}
+	var deliveries []*models.Delivery
+	for _, v := range hooks {
+		if !v.Subscribed(event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, &models.Delivery{
+			ID:          NewID(),
+			WebhookID:   v.ID,
+			URL:         v.URL,
+			Secret:      v.Secret,
+			Event:       event,
+			NextAttempt: event.Time,
+			Status:      models.DeliveryPending,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if err = d.store.Enqueue(ctx, deliveries); err != nil {
+		return err
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Forget drops cached webhooks of user, so their changes apply to the next events.
+func (d *Dispatcher) Forget(userID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.hooks, userID)
+}
+
+// webhooks returns webhooks of user from cache or the store.
+func (d *Dispatcher) webhooks(ctx context.Context, userID string, now time.Time) ([]*models.Webhook, error) {
+	d.mu.Lock()
+	cached, ok := d.hooks[userID]
+	d.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.hooks, nil
+	}
+	hooks, err := d.store.Webhooks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.hooks) >= maxCachedUsers {
+		d.hooks = make(map[string]cachedHooks)
+	}
+	d.hooks[userID] = cachedHooks{hooks: hooks, expires: now.Add(hooksTTL)}
+	return hooks, nil
+}
+
+// Close stops the dispatcher and closes its store, deliveries left in the outbox are attempted after restart.
+func (d *Dispatcher) Close() error {
+	d.cancel()
+	<-d.done
+	return d.store.Close()
+}
+
+// run delivers due events when new ones are added and on interval.
+func (d *Dispatcher) run() {
+	defer close(d.done)
+	ticker := time.NewTicker(d.opts.Interval)
+	defer ticker.Stop()
+	for {
+		d.dispatch()
+		select {
+		case <-d.wake:
+		case <-ticker.C:
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// dispatch attempts due deliveries until none is left.
+func (d *Dispatcher) dispatch() {
+	for d.ctx.Err() == nil {
+		// Claimed deliveries are skipped by other instances until all of them are attempted.
+		due, err := d.store.Claim(d.ctx, time.Now(), 2*d.opts.Timeout, claimSize)
+		if err != nil {
+			log.Printf("error claiming webhook deliveries : %v", err)
+			return
+		}
+		var wg sync.WaitGroup
+		for _, v := range due {
+			wg.Add(1)
+			go func(delivery *models.Delivery) {
+				defer wg.Done()
+				d.deliver(delivery)
+			}(v)
+		}
+		wg.Wait()
+		if len(due) < claimSize {
+			return
+		}
+	}
+}
+
+// deliver attempts a delivery and records the result, scheduling a retry if it failed.
+func (d *Dispatcher) deliver(delivery *models.Delivery) {
+	now := time.Now()
+	code, err := d.post(delivery, now)
+	// Attempts interrupted by stop are repeated after restart.
+	if d.ctx.Err() != nil {
+		return
+	}
+	delivery.Attempts++
+	attempt := &models.DeliveryAttempt{
+		DeliveryID: delivery.ID,
+		WebhookID:  delivery.WebhookID,
+		EventID:    delivery.Event.ID,
+		EventType:  delivery.Event.Type,
+		Attempt:    delivery.Attempts,
+		StatusCode: code,
+		Time:       now,
+	}
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliveryDelivered
+	case delivery.Attempts >= d.opts.MaxAttempts:
+		attempt.Error = err.Error()
+		delivery.Status = models.DeliveryFailed
+	default:
+		attempt.Error = err.Error()
+		delivery.NextAttempt = now.Add(d.backoff(delivery.Attempts))
+	}
+	attempt.Status = delivery.Status
+	if err = d.store.Record(context.Background(), delivery, attempt); err != nil {
+		log.Printf("error recording webhook delivery %s : %v", delivery.ID, err)
+	}
+}
+
+// backoff returns the delay of the retry after the given number of failed attempts.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.opts.Backoff
+	for i := 1; i < attempts && wait < d.opts.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.opts.MaxBackoff {
+		wait = d.opts.MaxBackoff
+	}
+	return wait
+}
+
+// post posts the event of a delivery signed with the secret of its webhook,
+// returning the response status and an error unless the webhook accepted it with a 2xx status.
+func (d *Dispatcher) post(delivery *models.Delivery, now time.Time) (int, error) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, delivery.ID)
+	req.Header.Set(HeaderEvent, delivery.Event.Type)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(delivery.Secret, timestamp, body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Read some of the body, so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
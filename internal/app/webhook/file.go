@@ -0,0 +1,214 @@
+package webhook
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// FileStore is a webhook storage keeping its changes in an append-only file.
+// The file is replayed and compacted to the current state when the store is opened.
+type FileStore struct {
+	// MemStore holds the current state.
+	*MemStore
+	// filename is the path of the file.
+	filename string
+	// file is the file open for appending.
+	file *os.File
+}
+
+// Operations of file records.
+const (
+	opWebhook  = "webhook"
+	opUnhook   = "unhook"
+	opDelivery = "delivery"
+	opAttempt  = "attempt"
+)
+
+// fileRecord is a change of the store in the file.
+type fileRecord struct {
+	// Op is the operation of the change.
+	Op string `json:"op"`
+	// Webhook is the added or deleted webhook.
+	Webhook *models.Webhook `json:"webhook,omitempty"`
+	// Delivery is the state of a delivery after the change.
+	Delivery *models.Delivery `json:"delivery,omitempty"`
+	// Attempt is an attempt appended to the delivery log.
+	Attempt *models.DeliveryAttempt `json:"attempt,omitempty"`
+}
+
+// NewFileStore opens a webhook storage in file creating it if needed.
+func NewFileStore(filename string) (*FileStore, error) {
+	s := &FileStore{MemStore: NewMemStore(), filename: filename}
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("error opening webhooks file : %v", err)
+	}
+	s.file = file
+	return s, nil
+}
+
+// replay applies records of the file to the store, ignoring a record torn by a crash.
+func (s *FileStore) replay() error {
+	file, err := os.Open(s.filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error opening webhooks file : %v", err)
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for {
+		rec := &fileRecord{}
+		if err := decoder.Decode(rec); err == io.EOF {
+			return nil
+		} else if err != nil {
+			// The record is dropped by compaction.
+			log.Printf("ignoring webhooks file after invalid record : %v", err)
+			return nil
+		}
+		s.apply(rec)
+	}
+}
+
+// apply applies a record to the state.
+func (s *FileStore) apply(rec *fileRecord) {
+	switch {
+	case rec.Op == opWebhook && rec.Webhook != nil:
+		s.addWebhook(rec.Webhook)
+	case rec.Op == opUnhook && rec.Webhook != nil:
+		s.deleteWebhook(rec.Webhook.ID)
+	case rec.Op == opDelivery && rec.Delivery != nil:
+		s.putDelivery(rec.Delivery)
+	case rec.Op == opAttempt && rec.Attempt != nil:
+		if rec.Delivery != nil {
+			s.putDelivery(rec.Delivery)
+		}
+		s.appendLog(rec.Attempt)
+	}
+}
+
+// compact replaces the file with records of the current state.
+// The new file replaces the old one only when it is completely written.
+func (s *FileStore) compact() error {
+	tmp := s.filename + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("error creating webhooks file : %v", err)
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	encoder := json.NewEncoder(w)
+	var records []*fileRecord
+	for _, v := range s.webhooks {
+		records = append(records, &fileRecord{Op: opWebhook, Webhook: v})
+		for _, a := range s.log[v.ID] {
+			records = append(records, &fileRecord{Op: opAttempt, Attempt: a})
+		}
+	}
+	// Deliveries are written after their webhooks, they are dropped otherwise.
+	for _, v := range s.deliveries {
+		records = append(records, &fileRecord{Op: opDelivery, Delivery: v})
+	}
+	for _, v := range records {
+		if err = encoder.Encode(v); err != nil {
+			return fmt.Errorf("error writing webhooks file : %v", err)
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return fmt.Errorf("error writing webhooks file : %v", err)
+	}
+	if err = file.Sync(); err != nil {
+		return fmt.Errorf("error syncing webhooks file : %v", err)
+	}
+	if err = os.Rename(tmp, s.filename); err != nil {
+		return fmt.Errorf("error replacing webhooks file : %v", err)
+	}
+	return nil
+}
+
+// write appends records to the file and syncs it.
+func (s *FileStore) write(records ...*fileRecord) error {
+	encoder := json.NewEncoder(s.file)
+	for _, v := range records {
+		if err := encoder.Encode(v); err != nil {
+			return fmt.Errorf("error writing webhooks file : %v", err)
+		}
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("error syncing webhooks file : %v", err)
+	}
+	return nil
+}
+
+// AddWebhook registers a webhook.
+func (s *FileStore) AddWebhook(ctx context.Context, hook *models.Webhook) error {
+	s.Lock()
+	defer s.Unlock()
+	if err := s.write(&fileRecord{Op: opWebhook, Webhook: hook}); err != nil {
+		return err
+	}
+	s.addWebhook(hook)
+	return nil
+}
+
+// DeleteWebhook deletes a webhook registered by user with its pending deliveries and log.
+func (s *FileStore) DeleteWebhook(ctx context.Context, userID string, id string) error {
+	s.Lock()
+	defer s.Unlock()
+	if hook, ok := s.webhooks[id]; !ok || hook.UserID != userID {
+		return models.ErrWebhookNotFound
+	}
+	if err := s.write(&fileRecord{Op: opUnhook, Webhook: &models.Webhook{ID: id}}); err != nil {
+		return err
+	}
+	s.deleteWebhook(id)
+	return nil
+}
+
+// Enqueue adds deliveries to the outbox.
+func (s *FileStore) Enqueue(ctx context.Context, deliveries []*models.Delivery) error {
+	s.Lock()
+	defer s.Unlock()
+	records := make([]*fileRecord, len(deliveries))
+	for i, v := range deliveries {
+		records[i] = &fileRecord{Op: opDelivery, Delivery: v}
+	}
+	if err := s.write(records...); err != nil {
+		return err
+	}
+	for _, v := range deliveries {
+		s.putDelivery(v)
+	}
+	return nil
+}
+
+// Record stores the state of a delivery after an attempt and appends the attempt to the delivery log.
+func (s *FileStore) Record(ctx context.Context, delivery *models.Delivery, attempt *models.DeliveryAttempt) error {
+	s.Lock()
+	defer s.Unlock()
+	if err := s.write(&fileRecord{Op: opAttempt, Delivery: delivery, Attempt: attempt}); err != nil {
+		return err
+	}
+	s.record(delivery, attempt)
+	return nil
+}
+
+// Close closes the file.
+func (s *FileStore) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,176 @@
+package webhook
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+// MemStore is an in-memory webhook storage.
+type MemStore struct {
+	// webhooks maps IDs to webhooks.
+	webhooks map[string]*models.Webhook
+	// deliveries maps IDs to pending deliveries.
+	deliveries map[string]*models.Delivery
+	// log maps webhook IDs to their latest delivery attempts.
+	log map[string][]*models.DeliveryAttempt
+	// Mutex synchronizes access to the MemStore.
+	sync.Mutex
+}
+
+// NewMemStore initializes a new in-memory webhook storage.
+func NewMemStore() *MemStore {
+	return &MemStore{
+		webhooks:   make(map[string]*models.Webhook),
+		deliveries: make(map[string]*models.Delivery),
+		log:        make(map[string][]*models.DeliveryAttempt),
+	}
+}
+
+// AddWebhook registers a webhook.
+func (s *MemStore) AddWebhook(ctx context.Context, hook *models.Webhook) error {
+	s.Lock()
+	defer s.Unlock()
+	s.addWebhook(hook)
+	return nil
+}
+
+// addWebhook stores a copy of webhook.
+func (s *MemStore) addWebhook(hook *models.Webhook) {
+	stored := *hook
+	s.webhooks[hook.ID] = &stored
+}
+
+// Webhooks returns webhooks registered by user, oldest first.
+func (s *MemStore) Webhooks(ctx context.Context, userID string) ([]*models.Webhook, error) {
+	s.Lock()
+	defer s.Unlock()
+	var hooks []*models.Webhook
+	for _, v := range s.webhooks {
+		if v.UserID == userID {
+			hook := *v
+			hooks = append(hooks, &hook)
+		}
+	}
+	sort.Slice(hooks, func(i, j int) bool {
+		if hooks[i].CreatedAt.Equal(hooks[j].CreatedAt) {
+			return hooks[i].ID < hooks[j].ID
+		}
+		return hooks[i].CreatedAt.Before(hooks[j].CreatedAt)
+	})
+	return hooks, nil
+}
+
+// DeleteWebhook deletes a webhook registered by user with its pending deliveries and log.
+func (s *MemStore) DeleteWebhook(ctx context.Context, userID string, id string) error {
+	s.Lock()
+	defer s.Unlock()
+	if hook, ok := s.webhooks[id]; !ok || hook.UserID != userID {
+		return models.ErrWebhookNotFound
+	}
+	s.deleteWebhook(id)
+	return nil
+}
+
+// deleteWebhook deletes a webhook with its pending deliveries and log.
+func (s *MemStore) deleteWebhook(id string) {
+	delete(s.webhooks, id)
+	delete(s.log, id)
+	for k, v := range s.deliveries {
+		if v.WebhookID == id {
+			delete(s.deliveries, k)
+		}
+	}
+}
+
+// Enqueue adds deliveries to the outbox.
+func (s *MemStore) Enqueue(ctx context.Context, deliveries []*models.Delivery) error {
+	s.Lock()
+	defer s.Unlock()
+	for _, v := range deliveries {
+		s.putDelivery(v)
+	}
+	return nil
+}
+
+// putDelivery stores a copy of a pending delivery and forgets a finished one.
+// Deliveries to deleted webhooks are dropped.
+func (s *MemStore) putDelivery(delivery *models.Delivery) {
+	if _, ok := s.webhooks[delivery.WebhookID]; !ok || delivery.Status != models.DeliveryPending {
+		delete(s.deliveries, delivery.ID)
+		return
+	}
+	stored := *delivery
+	s.deliveries[delivery.ID] = &stored
+}
+
+// Claim returns up to limit pending deliveries due by now, oldest first, and postpones them by lease.
+func (s *MemStore) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.Delivery, error) {
+	s.Lock()
+	defer s.Unlock()
+	var due []*models.Delivery
+	for _, v := range s.deliveries {
+		if !v.NextAttempt.After(now) {
+			due = append(due, v)
+		}
+	}
+	sortDeliveries(due)
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	claimed := make([]*models.Delivery, len(due))
+	for i, v := range due {
+		delivery := *v
+		claimed[i] = &delivery
+		v.NextAttempt = now.Add(lease)
+	}
+	return claimed, nil
+}
+
+// sortDeliveries sorts deliveries by the time of their next attempt.
+func sortDeliveries(deliveries []*models.Delivery) {
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttempt.Before(deliveries[j].NextAttempt)
+	})
+}
+
+// Record stores the state of a delivery after an attempt and appends the attempt to the delivery log.
+func (s *MemStore) Record(ctx context.Context, delivery *models.Delivery, attempt *models.DeliveryAttempt) error {
+	s.Lock()
+	defer s.Unlock()
+	s.record(delivery, attempt)
+	return nil
+}
+
+// record stores a delivery and its attempt unless the webhook was deleted.
+func (s *MemStore) record(delivery *models.Delivery, attempt *models.DeliveryAttempt) {
+	s.putDelivery(delivery)
+	s.appendLog(attempt)
+}
+
+// appendLog appends an attempt to the delivery log of its webhook, dropping the oldest ones over maxLog.
+func (s *MemStore) appendLog(attempt *models.DeliveryAttempt) {
+	if _, ok := s.webhooks[attempt.WebhookID]; !ok {
+		return
+	}
+	log := append(s.log[attempt.WebhookID], attempt)
+	if len(log) > maxLog {
+		log = log[len(log)-maxLog:]
+	}
+	s.log[attempt.WebhookID] = log
+}
+
+// DeliveryLog returns the latest attempts of deliveries to a webhook, oldest first.
+func (s *MemStore) DeliveryLog(ctx context.Context, webhookID string) ([]*models.DeliveryAttempt, error) {
+	s.Lock()
+	defer s.Unlock()
+	return append([]*models.DeliveryAttempt(nil), s.log[webhookID]...), nil
+}
+
+// Close is not implemented for in-memory storage.
+func (s *MemStore) Close() error {
+	return nil
+}
@@ -0,0 +1,180 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+const (
+	// addWebhookQuery registers a webhook.
+	addWebhookQuery = `INSERT INTO webhooks (id, userid, url, events, secret, created_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	// getWebhooksQuery retrieves webhooks registered by a specific user, oldest first.
+	getWebhooksQuery = `SELECT id, url, COALESCE(events, '{}'), secret, created_at FROM webhooks WHERE userid = $1 ORDER BY created_at, id`
+	// deleteWebhookQuery deletes a webhook registered by a specific user, its deliveries and log are deleted in cascade.
+	deleteWebhookQuery = `DELETE FROM webhooks WHERE id = $1 AND userid = $2`
+	// enqueueQuery adds a delivery to the outbox unless its webhook was deleted.
+	enqueueQuery = `INSERT INTO webhook_deliveries (id, webhook_id, url, secret, event, attempts, next_attempt)
+	SELECT $1, $2, $3, $4, $5, $6, $7 WHERE EXISTS (SELECT 1 FROM webhooks WHERE id = $2)`
+	// claimQuery postpones pending deliveries due by the given time, so other workers skip them, returning them oldest first.
+	claimQuery = `UPDATE webhook_deliveries d SET next_attempt = $2
+	FROM (SELECT id, next_attempt FROM webhook_deliveries WHERE next_attempt <= $1 ORDER BY next_attempt LIMIT $3 FOR UPDATE SKIP LOCKED) due
+	WHERE d.id = due.id
+	RETURNING d.id, d.webhook_id, d.url, d.secret, d.event, d.attempts, due.next_attempt`
+	// retryQuery schedules the next attempt of a delivery.
+	retryQuery = `UPDATE webhook_deliveries SET attempts = $2, next_attempt = $3 WHERE id = $1`
+	// finishQuery deletes a delivered or failed delivery from the outbox.
+	finishQuery = `DELETE FROM webhook_deliveries WHERE id = $1`
+	// addAttemptQuery appends an attempt to the delivery log unless the webhook was deleted.
+	addAttemptQuery = `INSERT INTO webhook_attempts (webhook_id, delivery_id, event_id, event_type, attempt, status_code, error, status, attempted_at)
+	SELECT $1, $2, $3, $4, $5, NULLIF($6, 0), NULLIF($7, ''), $8, $9 WHERE EXISTS (SELECT 1 FROM webhooks WHERE id = $1)`
+	// trimLogQuery deletes attempts of a webhook older than the latest ones.
+	trimLogQuery = `DELETE FROM webhook_attempts WHERE webhook_id = $1
+	AND id <= (SELECT id FROM webhook_attempts WHERE webhook_id = $1 ORDER BY id DESC OFFSET $2 LIMIT 1)`
+	// getLogQuery retrieves the delivery log of a webhook, oldest first.
+	getLogQuery = `SELECT delivery_id, event_id, event_type, attempt, COALESCE(status_code, 0), COALESCE(error, ''), status, attempted_at
+	FROM webhook_attempts WHERE webhook_id = $1 ORDER BY id`
+)
+
+// PostgresStore is a webhook storage in the Postgres db of urls, its tables are created by url storage migrations.
+type PostgresStore struct {
+	conn *pgxpool.Pool
+}
+
+// NewPostgresStore initializes a Postgres webhook storage from connection string.
+func NewPostgresStore(connString string) (*PostgresStore, error) {
+	poolConfig, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresStore{conn: conn}, nil
+}
+
+// AddWebhook registers a webhook.
+func (s *PostgresStore) AddWebhook(ctx context.Context, hook *models.Webhook) error {
+	_, err := s.conn.Exec(ctx, addWebhookQuery, hook.ID, hook.UserID, hook.URL, hook.Events, hook.Secret, hook.CreatedAt)
+	return err
+}
+
+// Webhooks returns webhooks registered by user, oldest first.
+func (s *PostgresStore) Webhooks(ctx context.Context, userID string) ([]*models.Webhook, error) {
+	rows, err := s.conn.Query(ctx, getWebhooksQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var hooks []*models.Webhook
+	for rows.Next() {
+		hook := &models.Webhook{UserID: userID}
+		if err = rows.Scan(&hook.ID, &hook.URL, &hook.Events, &hook.Secret, &hook.CreatedAt); err != nil {
+			return nil, err
+		}
+		if len(hook.Events) == 0 {
+			hook.Events = nil
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+// DeleteWebhook deletes a webhook registered by user with its pending deliveries and log.
+func (s *PostgresStore) DeleteWebhook(ctx context.Context, userID string, id string) error {
+	res, err := s.conn.Exec(ctx, deleteWebhookQuery, id, userID)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return models.ErrWebhookNotFound
+	}
+	return nil
+}
+
+// Enqueue adds deliveries to the outbox.
+func (s *PostgresStore) Enqueue(ctx context.Context, deliveries []*models.Delivery) error {
+	batch := &pgx.Batch{}
+	for _, v := range deliveries {
+		batch.Queue(enqueueQuery, v.ID, v.WebhookID, v.URL, v.Secret, v.Event, v.Attempts, v.NextAttempt)
+	}
+	return s.conn.SendBatch(ctx, batch).Close()
+}
+
+// Claim returns up to limit pending deliveries due by now, oldest first, and postpones them by lease.
+func (s *PostgresStore) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.Delivery, error) {
+	rows, err := s.conn.Query(ctx, claimQuery, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var due []*models.Delivery
+	for rows.Next() {
+		v := &models.Delivery{Status: models.DeliveryPending}
+		if err = rows.Scan(&v.ID, &v.WebhookID, &v.URL, &v.Secret, &v.Event, &v.Attempts, &v.NextAttempt); err != nil {
+			return nil, err
+		}
+		due = append(due, v)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	// Updated rows are returned in no particular order.
+	sortDeliveries(due)
+	return due, nil
+}
+
+// Record stores the state of a delivery after an attempt and appends the attempt to the delivery log.
+func (s *PostgresStore) Record(ctx context.Context, delivery *models.Delivery, attempt *models.DeliveryAttempt) error {
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if delivery.Status == models.DeliveryPending {
+		_, err = tx.Exec(ctx, retryQuery, delivery.ID, delivery.Attempts, delivery.NextAttempt)
+	} else {
+		_, err = tx.Exec(ctx, finishQuery, delivery.ID)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, addAttemptQuery, attempt.WebhookID, attempt.DeliveryID, attempt.EventID, attempt.EventType, attempt.Attempt,
+		attempt.StatusCode, attempt.Error, attempt.Status, attempt.Time)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, trimLogQuery, attempt.WebhookID, maxLog); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// DeliveryLog returns the latest attempts of deliveries to a webhook, oldest first.
+func (s *PostgresStore) DeliveryLog(ctx context.Context, webhookID string) ([]*models.DeliveryAttempt, error) {
+	rows, err := s.conn.Query(ctx, getLogQuery, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var attempts []*models.DeliveryAttempt
+	for rows.Next() {
+		v := &models.DeliveryAttempt{WebhookID: webhookID}
+		if err = rows.Scan(&v.DeliveryID, &v.EventID, &v.EventType, &v.Attempt, &v.StatusCode, &v.Error, &v.Status, &v.Time); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, v)
+	}
+	return attempts, rows.Err()
+}
+
+// Close closes the connection pool.
+func (s *PostgresStore) Close() error {
+	s.conn.Close()
+	return nil
+}
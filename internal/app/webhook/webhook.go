@@ -0,0 +1,78 @@
+// Package webhook provides delivery of link events to webhooks of users through a durable outbox.
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/Mldlr/url-shortener/internal/app/config"
+	"github.com/Mldlr/url-shortener/internal/app/models"
+	"github.com/Mldlr/url-shortener/internal/app/utils/encoders"
+)
+
+// Store keeps webhooks, the outbox of their deliveries and the delivery log.
+type Store interface {
+	// AddWebhook registers a webhook.
+	AddWebhook(ctx context.Context, hook *models.Webhook) error
+	// Webhooks returns webhooks registered by user.
+	Webhooks(ctx context.Context, userID string) ([]*models.Webhook, error)
+	// DeleteWebhook deletes a webhook registered by user with its pending deliveries and log.
+	DeleteWebhook(ctx context.Context, userID string, id string) error
+	// Enqueue adds deliveries to the outbox.
+	Enqueue(ctx context.Context, deliveries []*models.Delivery) error
+	// Claim returns up to limit pending deliveries due by now, oldest first,
+	// and postpones them by lease, so they aren't claimed again while they are attempted.
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.Delivery, error)
+	// Record stores the state of a delivery after an attempt and appends the attempt to the delivery log.
+	Record(ctx context.Context, delivery *models.Delivery, attempt *models.DeliveryAttempt) error
+	// DeliveryLog returns attempts of deliveries to a webhook, oldest first.
+	DeliveryLog(ctx context.Context, webhookID string) ([]*models.DeliveryAttempt, error)
+	// Close closes the store.
+	Close() error
+}
+
+// maxLog is the number of the latest attempts kept in the delivery log of a webhook.
+const maxLog = 100
+
+// NewStore initializes the store matching the storage of urls.
+// Postgres keeps webhooks in its own tables, file and bolt storages in a file next to theirs.
+func NewStore(c *config.Config) (Store, error) {
+	switch {
+	case c == nil:
+		return NewMemStore(), nil
+	case c.PostgresURL != "":
+		return NewPostgresStore(c.PostgresURL)
+	case c.BoltStorage != "":
+		return NewFileStore(c.BoltStorage + ".webhooks")
+	case c.FileStorage != "":
+		return NewFileStore(c.FileStorage + ".webhooks")
+	default:
+		return NewMemStore(), nil
+	}
+}
+
+// NewID returns a random ID of a webhook, an event or a delivery.
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewSecret returns a random key of signatures of a webhook.
+func NewSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Sign returns the signature of a payload sent at the given unix timestamp.
+// Receivers check it by signing the timestamp header and the body the same way.
+func Sign(secret string, timestamp string, body []byte) string {
+	return encoders.HMACString(timestamp+"."+string(body), []byte(secret))
+}
@@ -0,0 +1,271 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mldlr/url-shortener/internal/app/models"
+)
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"Memory": func(t *testing.T) Store { return NewMemStore() },
+		"File": func(t *testing.T) Store {
+			s, err := NewFileStore(filepath.Join(t.TempDir(), "webhooks"))
+			require.NoError(t, err)
+			return s
+		},
+	}
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := open(t)
+			defer s.Close()
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Second)
+			hook := &models.Webhook{ID: "h1", UserID: "u1", URL: "http://example.com", Secret: "s", CreatedAt: now}
+			require.NoError(t, s.AddWebhook(ctx, hook))
+			require.NoError(t, s.AddWebhook(ctx, &models.Webhook{ID: "h2", UserID: "u2", URL: "http://example.org", CreatedAt: now}))
+			hooks, err := s.Webhooks(ctx, "u1")
+			require.NoError(t, err)
+			assert.Equal(t, []*models.Webhook{hook}, hooks)
+
+			event := &models.Event{ID: "e1", Type: models.EventLinkCreated, UserID: "u1", ShortURL: "abc", Time: now}
+			deliveries := []*models.Delivery{
+				{ID: "d1", WebhookID: "h1", URL: hook.URL, Event: event, NextAttempt: now, Status: models.DeliveryPending},
+				{ID: "d2", WebhookID: "h1", URL: hook.URL, Event: event, NextAttempt: now.Add(time.Minute), Status: models.DeliveryPending},
+			}
+			require.NoError(t, s.Enqueue(ctx, deliveries))
+
+			// Only due deliveries are claimed, and not again until the lease ends.
+			due, err := s.Claim(ctx, now, time.Minute, 10)
+			require.NoError(t, err)
+			require.Len(t, due, 1)
+			assert.Equal(t, "d1", due[0].ID)
+			due, err = s.Claim(ctx, now.Add(time.Second), time.Minute, 10)
+			require.NoError(t, err)
+			assert.Empty(t, due)
+
+			d := deliveries[0]
+			d.Attempts, d.NextAttempt = 1, now.Add(time.Second)
+			require.NoError(t, s.Record(ctx, d, &models.DeliveryAttempt{DeliveryID: "d1", WebhookID: "h1", Attempt: 1,
+				StatusCode: 500, Error: "unexpected status 500", Status: models.DeliveryPending, Time: now}))
+			due, err = s.Claim(ctx, now.Add(time.Minute), time.Minute, 10)
+			require.NoError(t, err)
+			require.Len(t, due, 2)
+			assert.Equal(t, 1, due[0].Attempts)
+
+			d.Status = models.DeliveryDelivered
+			require.NoError(t, s.Record(ctx, d, &models.DeliveryAttempt{DeliveryID: "d1", WebhookID: "h1", Attempt: 2,
+				StatusCode: 200, Status: models.DeliveryDelivered, Time: now}))
+			due, err = s.Claim(ctx, now.Add(time.Hour), time.Minute, 10)
+			require.NoError(t, err)
+			require.Len(t, due, 1)
+			assert.Equal(t, "d2", due[0].ID)
+			log, err := s.DeliveryLog(ctx, "h1")
+			require.NoError(t, err)
+			require.Len(t, log, 2)
+			assert.Equal(t, []string{models.DeliveryPending, models.DeliveryDelivered}, []string{log[0].Status, log[1].Status})
+
+			// Webhooks are deleted by their owners only, with their deliveries.
+			assert.ErrorIs(t, s.DeleteWebhook(ctx, "u2", "h1"), models.ErrWebhookNotFound)
+			require.NoError(t, s.DeleteWebhook(ctx, "u1", "h1"))
+			hooks, err = s.Webhooks(ctx, "u1")
+			require.NoError(t, err)
+			assert.Empty(t, hooks)
+			due, err = s.Claim(ctx, now.Add(time.Hour), time.Minute, 10)
+			require.NoError(t, err)
+			assert.Empty(t, due)
+		})
+	}
+}
+
+func TestFileStore_Reopen(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "webhooks")
+	s, err := NewFileStore(filename)
+	require.NoError(t, err)
+	now := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, s.AddWebhook(ctx, &models.Webhook{ID: "h1", UserID: "u1", URL: "http://example.com", CreatedAt: now}))
+	require.NoError(t, s.AddWebhook(ctx, &models.Webhook{ID: "h2", UserID: "u1", URL: "http://example.org", CreatedAt: now}))
+	event := &models.Event{ID: "e1", Type: models.EventLinkDeleted, UserID: "u1", ShortURL: "abc", Time: now}
+	require.NoError(t, s.Enqueue(ctx, []*models.Delivery{
+		{ID: "d1", WebhookID: "h1", Event: event, NextAttempt: now, Status: models.DeliveryPending},
+		{ID: "d2", WebhookID: "h2", Event: event, NextAttempt: now, Status: models.DeliveryPending},
+	}))
+	require.NoError(t, s.Record(ctx, &models.Delivery{ID: "d1", WebhookID: "h1", Event: event, Attempts: 1, Status: models.DeliveryFailed},
+		&models.DeliveryAttempt{DeliveryID: "d1", WebhookID: "h1", Attempt: 1, Status: models.DeliveryFailed, Time: now}))
+	require.NoError(t, s.DeleteWebhook(ctx, "u1", "h2"))
+	require.NoError(t, s.Close())
+
+	// The outbox and the delivery log survive restarts.
+	s, err = NewFileStore(filename)
+	require.NoError(t, err)
+	defer s.Close()
+	hooks, err := s.Webhooks(ctx, "u1")
+	require.NoError(t, err)
+	require.Len(t, hooks, 1)
+	assert.Equal(t, "h1", hooks[0].ID)
+	due, err := s.Claim(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+	log, err := s.DeliveryLog(ctx, "h1")
+	require.NoError(t, err)
+	require.Len(t, log, 1)
+	assert.Equal(t, models.DeliveryFailed, log[0].Status)
+}
+
+// receiver is a webhook endpoint failing the first requests.
+type receiver struct {
+	sync.Mutex
+	// fail is the number of requests to fail.
+	fail int
+	// requests are the received requests with their bodies.
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.Lock()
+	defer rc.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	if len(rc.requests) <= rc.fail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rc *receiver) count() int {
+	rc.Lock()
+	defer rc.Unlock()
+	return len(rc.requests)
+}
+
+// dispatch registers a webhook served by rc and emits an event to it.
+func dispatch(t *testing.T, rc http.Handler, opts Options) (*Dispatcher, *models.Event) {
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+	store := NewMemStore()
+	ctx := context.Background()
+	require.NoError(t, store.AddWebhook(ctx, &models.Webhook{ID: "h1", UserID: "u1", URL: srv.URL,
+		Events: []string{models.EventLinkCreated}, Secret: "secret", CreatedAt: time.Now()}))
+	d := NewDispatcher(store, opts)
+	t.Cleanup(func() { d.Close() })
+	// Events the webhook isn't subscribed to are not delivered.
+	require.NoError(t, d.Emit(ctx, &models.Event{ID: "e0", Type: models.EventLinkClicked, UserID: "u1", Time: time.Now()}))
+	event := &models.Event{ID: "e1", Type: models.EventLinkCreated, UserID: "u1", ShortURL: "abc",
+		LongURL: "http://example.com", Time: time.Now().UTC().Truncate(time.Second)}
+	require.NoError(t, d.Emit(ctx, event))
+	return d, event
+}
+
+func TestDispatcher_Deliver(t *testing.T) {
+	rc := &receiver{}
+	d, event := dispatch(t, rc, Options{MaxAttempts: 3, Backoff: time.Hour, MaxBackoff: time.Hour, Timeout: time.Second, Interval: time.Hour})
+	require.Eventually(t, func() bool { return rc.count() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	r, body := rc.requests[0], rc.bodies[0]
+	assert.Equal(t, models.EventLinkCreated, r.Header.Get(HeaderEvent))
+	assert.NotEmpty(t, r.Header.Get(HeaderID))
+	// Receivers verify the payload with the secret of the webhook.
+	assert.Equal(t, "sha256="+Sign("secret", r.Header.Get(HeaderTimestamp), body), r.Header.Get(HeaderSignature))
+	var got models.Event
+	require.NoError(t, json.Unmarshal(body, &got))
+	assert.Equal(t, *event, got)
+
+	require.Eventually(t, func() bool {
+		log, _ := d.Store().DeliveryLog(context.Background(), "h1")
+		return len(log) == 1 && log[0].Status == models.DeliveryDelivered && log[0].StatusCode == http.StatusNoContent
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	rc := &receiver{fail: 2}
+	d, _ := dispatch(t, rc, Options{MaxAttempts: 5, Backoff: 20 * time.Millisecond, MaxBackoff: time.Second,
+		Timeout: time.Second, Interval: 10 * time.Millisecond})
+	require.Eventually(t, func() bool {
+		log, _ := d.Store().DeliveryLog(context.Background(), "h1")
+		return len(log) == 3 && log[2].Status == models.DeliveryDelivered
+	}, 5*time.Second, 10*time.Millisecond)
+	log, err := d.Store().DeliveryLog(context.Background(), "h1")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, []int{log[0].Attempt, log[1].Attempt, log[2].Attempt})
+	assert.Equal(t, http.StatusServiceUnavailable, log[0].StatusCode)
+	assert.Equal(t, models.DeliveryPending, log[0].Status)
+	// Retries wait for the doubled backoff.
+	assert.GreaterOrEqual(t, log[2].Time.Sub(log[1].Time), 40*time.Millisecond)
+	// Every attempt carries the same delivery ID, so receivers can drop repeated ones.
+	assert.Equal(t, rc.requests[0].Header.Get(HeaderID), rc.requests[2].Header.Get(HeaderID))
+}
+
+func TestDispatcher_Fail(t *testing.T) {
+	rc := &receiver{fail: 10}
+	d, _ := dispatch(t, rc, Options{MaxAttempts: 2, Backoff: time.Millisecond, MaxBackoff: time.Millisecond,
+		Timeout: time.Second, Interval: 10 * time.Millisecond})
+	require.Eventually(t, func() bool {
+		log, _ := d.Store().DeliveryLog(context.Background(), "h1")
+		return len(log) == 2 && log[1].Status == models.DeliveryFailed
+	}, 5*time.Second, 10*time.Millisecond)
+	// Failed deliveries are not attempted anymore.
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 2, rc.count())
+}
+
+func TestDispatcher_Backoff(t *testing.T) {
+	d := &Dispatcher{opts: Options{Backoff: time.Second, MaxBackoff: 5 * time.Second}}
+	var got []time.Duration
+	for i := 1; i <= 5; i++ {
+		got = append(got, d.backoff(i))
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, got)
+}
+
+func TestDispatcher_BlockPrivate(t *testing.T) {
+	rc := &receiver{}
+	d, _ := dispatch(t, rc, Options{MaxAttempts: 1, Backoff: time.Hour, MaxBackoff: time.Hour,
+		Timeout: time.Second, Interval: time.Hour, BlockPrivate: true})
+	// The webhook is registered by address here, hosts resolving to private addresses are refused the same way.
+	require.Eventually(t, func() bool {
+		log, _ := d.Store().DeliveryLog(context.Background(), "h1")
+		return len(log) == 1 && log[0].Status == models.DeliveryFailed
+	}, 5*time.Second, 10*time.Millisecond)
+	log, _ := d.Store().DeliveryLog(context.Background(), "h1")
+	assert.Contains(t, log[0].Error, models.ErrDestinationBlocked.Error())
+	assert.Equal(t, 0, rc.count())
+}
+
+func TestDispatcher_Redirect(t *testing.T) {
+	rc := &receiver{}
+	target := httptest.NewServer(rc)
+	t.Cleanup(target.Close)
+	redirect := &redirector{target: target.URL}
+	d, _ := dispatch(t, redirect, Options{MaxAttempts: 1, Backoff: time.Hour, MaxBackoff: time.Hour,
+		Timeout: time.Second, Interval: time.Hour})
+	// Redirects are not followed, so a webhook can't send events to another host.
+	require.Eventually(t, func() bool {
+		log, _ := d.Store().DeliveryLog(context.Background(), "h1")
+		return len(log) == 1 && log[0].Status == models.DeliveryFailed && log[0].StatusCode == http.StatusTemporaryRedirect
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, rc.count())
+}
+
+// redirector redirects every request to target.
+type redirector struct {
+	target string
+}
+
+func (rd *redirector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, rd.target, http.StatusTemporaryRedirect)
+}